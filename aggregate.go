@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// aggregateByPath is the --aggregate-by value collapsing the methods of a path
+const aggregateByPath = "path"
+
+// collapseMethods merges the operations sharing a path into one operation
+// matching all their methods, in the order of their first occurrence.
+// Streaming operations keep their own panels.
+func collapseMethods(ops []OperationInfo) []OperationInfo {
+	index := make(map[string]int)
+	var collapsed []OperationInfo
+	for _, op := range ops {
+		if streamProtocol(op.Operation) != "" {
+			collapsed = append(collapsed, op)
+			continue
+		}
+		i, ok := index[op.Path]
+		if !ok {
+			index[op.Path] = len(collapsed)
+			collapsed = append(collapsed, op)
+			continue
+		}
+		collapsed[i] = mergeMethods(collapsed[i], op)
+	}
+	return collapsed
+}
+
+// mergeMethods adds the method of op to the collapsed operation of its path
+func mergeMethods(collapsed, op OperationInfo) OperationInfo {
+	if len(collapsed.Methods) == 0 {
+		collapsed.Methods = []string{strings.ToUpper(collapsed.Method)}
+		// The operation stands for the whole path now
+		operation := *collapsed.Operation
+		operation.OperationID = ""
+		operation.Summary = ""
+		collapsed.Operation = &operation
+	}
+	collapsed.Methods = append(collapsed.Methods, strings.ToUpper(op.Method))
+	sort.Strings(collapsed.Methods)
+	collapsed.Method = strings.Join(collapsed.Methods, "|")
+
+	seen := make(map[string]bool)
+	for _, scheme := range collapsed.SecuritySchemes {
+		seen[scheme] = true
+	}
+	for _, scheme := range op.SecuritySchemes {
+		if !seen[scheme] {
+			collapsed.SecuritySchemes = append(collapsed.SecuritySchemes, scheme)
+		}
+	}
+	sort.Strings(collapsed.SecuritySchemes)
+	collapsed.Services = mergeServiceNames(collapsed.Services, op.Services)
+	return collapsed
+}
+
+// mergeServiceNames returns the union of two service lists
+func mergeServiceNames(a, b []string) []string {
+	seen := make(map[string]bool, len(a))
+	for _, name := range a {
+		seen[name] = true
+	}
+	for _, name := range b {
+		if !seen[name] {
+			seen[name] = true
+			a = append(a, name)
+		}
+	}
+	return a
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+const collapsedSpec = `openapi: 3.0.3
+info:
+  title: Orders
+  version: 1.0.0
+paths:
+  /orders:
+    get:
+      operationId: listOrders
+      security: [{apiKey: []}]
+      responses:
+        "200":
+          description: OK
+    post:
+      operationId: createOrder
+      security: [{oauth: []}]
+      responses:
+        "201":
+          description: Created
+    put:
+      responses:
+        "200":
+          description: OK
+  /orders/events:
+    get:
+      x-sse: true
+      responses:
+        "200":
+          description: OK
+    post:
+      responses:
+        "202":
+          description: Accepted
+components:
+  securitySchemes:
+    apiKey: {type: apiKey, in: header, name: X-API-Key}
+    oauth: {type: oauth2, flows: {clientCredentials: {tokenUrl: https://example.com/token, scopes: {}}}}
+`
+
+func TestCollapseMethods(t *testing.T) {
+	ops := collectOperations(loadTestSpec(t, "orders.yaml", collapsedSpec).Doc, "path")
+	collapsed := collapseMethods(ops)
+
+	if got, want := operationKeys(collapsed), []string{"GET|POST|PUT /orders", "GET /orders/events", "POST /orders/events"}; !slices.Equal(got, want) {
+		t.Fatalf("collapsed operations = %v, want %v", got, want)
+	}
+	path := collapsed[0]
+	if got, want := path.Methods, []string{"GET", "POST", "PUT"}; !slices.Equal(got, want) {
+		t.Errorf("methods = %v, want %v", got, want)
+	}
+	if got, want := path.SecuritySchemes, []string{"apiKey", "oauth"}; !slices.Equal(got, want) {
+		t.Errorf("security schemes = %v, want %v", got, want)
+	}
+	if path.Operation.OperationID != "" {
+		t.Errorf("collapsed operation ID = %q, want none", path.Operation.OperationID)
+	}
+	if ops[0].Operation.OperationID != "listOrders" {
+		t.Errorf("collapsing cleared the operation ID of the spec: %q", ops[0].Operation.OperationID)
+	}
+
+	// The collapsed operation selects every method, broken down by method
+	match := operationMatch{Path: path.Path, Methods: path.Methods}
+	if got, want := match.selector("http_requests_total").String(), `http_requests_total{path="/orders", method=~"GET|POST|PUT"}`; got != want {
+		t.Errorf("selector = %s, want %s", got, want)
+	}
+	if !match.byMethod() {
+		t.Error("collapsed operation is not broken down by method")
+	}
+}
+
+func TestMergeServiceNames(t *testing.T) {
+	if got, want := mergeServiceNames([]string{"orders", "users"}, []string{"users", "billing"}), []string{"orders", "users", "billing"}; !slices.Equal(got, want) {
+		t.Errorf("merged services = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Annotation sources of the config file
+const (
+	annotationSourceGrafana    = "grafana"
+	annotationSourcePrometheus = "prometheus"
+	annotationSourceLoki       = "loki"
+)
+
+// deployAnnotationColor marks deployments on every panel
+const deployAnnotationColor = "rgba(255, 152, 48, 1)"
+
+// AnnotationConfig defines an annotation query of the config file, e.g. the
+// deployment events shown on every panel
+type AnnotationConfig struct {
+	Name string `yaml:"name"`
+	// Source is grafana (annotations with all of Tags), prometheus or loki (Expr)
+	Source string   `yaml:"source"`
+	Tags   []string `yaml:"tags"`
+	Expr   string   `yaml:"expr"`
+	// Datasource defaults to the dashboard's Prometheus datasource; loki requires it
+	Datasource string `yaml:"datasource"`
+	// Title and Text format the event, e.g. {{version}}
+	Title string `yaml:"title"`
+	Text  string `yaml:"text"`
+	// TagKeys are the labels shown as event tags
+	TagKeys []string `yaml:"tag_keys"`
+	Color   string   `yaml:"color"`
+}
+
+// validateAnnotations checks the annotations of the config file
+func validateAnnotations(annotations []AnnotationConfig) error {
+	for i, annotation := range annotations {
+		if annotation.Name == "" {
+			return fmt.Errorf("annotations[%d]: name is required", i)
+		}
+		switch annotation.Source {
+		case annotationSourceGrafana:
+			if len(annotation.Tags) == 0 {
+				return fmt.Errorf("annotations[%d]: grafana annotations require tags", i)
+			}
+		case annotationSourcePrometheus, annotationSourceLoki:
+			if annotation.Expr == "" {
+				return fmt.Errorf("annotations[%d]: %s annotations require expr", i, annotation.Source)
+			}
+			if annotation.Source == annotationSourceLoki && annotation.Datasource == "" {
+				return fmt.Errorf("annotations[%d]: loki annotations require datasource", i)
+			}
+		default:
+			return fmt.Errorf("annotations[%d]: invalid source %q, must be grafana, prometheus or loki", i, annotation.Source)
+		}
+	}
+	return nil
+}
+
+// annotationConfigs returns the annotations of the config file, or the
+// default deploy markers: Grafana annotations tagged deploy:$<variable> for
+// the first query variable. An empty annotations list disables them.
+func (c *Config) annotationConfigs() []AnnotationConfig {
+	if annotations := c.fileConfig().Annotations; annotations != nil {
+		return annotations
+	}
+	tag := "deploy"
+	if variables := c.queryVariables(); len(variables) > 0 {
+		tag += ":$" + variables[0].Name
+	}
+	return []AnnotationConfig{{Name: "Deployments", Source: annotationSourceGrafana, Tags: []string{tag}}}
+}
+
+// createAnnotation builds the dashboard annotation query of a config entry
+func createAnnotation(annotation AnnotationConfig) Annotation {
+	color := annotation.Color
+	if color == "" {
+		color = deployAnnotationColor
+	}
+	result := Annotation{
+		Enable:    true,
+		IconColor: color,
+		Name:      annotation.Name,
+	}
+	switch annotation.Source {
+	case annotationSourceGrafana:
+		result.Datasource = "-- Grafana --"
+		result.Type = "tags"
+		result.Tags = annotation.Tags
+		result.Limit = 100
+		return result
+	case annotationSourceLoki:
+		result.Datasource = map[string]string{"type": "loki", "uid": annotation.Datasource}
+	default:
+		result.Datasource = map[string]string{"type": "prometheus", "uid": "${datasource}"}
+		if annotation.Datasource != "" {
+			result.Datasource = map[string]string{"type": "prometheus", "uid": annotation.Datasource}
+		}
+		result.Step = "60s"
+	}
+	result.Expr = annotation.Expr
+	result.TitleFormat = annotation.Title
+	result.TextFormat = annotation.Text
+	result.TagKeys = strings.Join(annotation.TagKeys, ",")
+	return result
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v3"
+)
+
+// AsyncAPIDoc is the subset of an AsyncAPI 2.x/3.x document needed to
+// generate event-driven panels
+type AsyncAPIDoc struct {
+	Version  string
+	Protocol string
+	Channels []AsyncChannel
+}
+
+// AsyncChannel is a channel (topic, queue, routing key) and the operations on it
+type AsyncChannel struct {
+	Name       string
+	Address    string
+	Operations []AsyncOperation
+}
+
+// AsyncOperation is a send/receive operation; AsyncAPI 2 publish and
+// subscribe are normalised to receive and send (from the application's view)
+type AsyncOperation struct {
+	ID      string
+	Action  string
+	Summary string
+}
+
+// BrokerPreset holds the PromQL queries of message broker panels. Every
+// query is built for the channel address; application metrics are filtered
+// by the query scope, broker metrics carry no service labels.
+type BrokerPreset struct {
+	PublishRate       func(address string, scope []string) string
+	ConsumerLag       func(address string, scope []string) string
+	ProcessingLatency func(address string, scope []string) string
+}
+
+// messagingProcessingLatency is the p99 processing time of the OpenTelemetry
+// messaging metrics, shared by every preset
+func messagingProcessingLatency(address string, scope []string) string {
+	return promHistogramQuantile("0.99", selectorOf("messaging_process_duration_seconds").eq("destination", address).with(scope...))
+}
+
+// brokerPresets maps preset names to metric conventions
+var brokerPresets = map[string]BrokerPreset{
+	// kafka_exporter and application-side OpenTelemetry messaging metrics
+	"kafka": {
+		PublishRate: func(address string, _ []string) string {
+			return promSum(promRate(selectorOf("kafka_topic_partition_current_offset").eq("topic", address)))
+		},
+		ConsumerLag: func(address string, _ []string) string {
+			return promSum(selectorOf("kafka_consumergroup_lag").eq("topic", address).String(), "consumergroup")
+		},
+		ProcessingLatency: messagingProcessingLatency,
+	},
+	// RabbitMQ built-in Prometheus plugin
+	"rabbitmq": {
+		PublishRate: func(address string, _ []string) string {
+			return promSum(promRate(selectorOf("rabbitmq_queue_messages_published_total").eq("queue", address)))
+		},
+		ConsumerLag: func(address string, _ []string) string {
+			return promSum(selectorOf("rabbitmq_queue_messages_ready").eq("queue", address).String())
+		},
+		ProcessingLatency: messagingProcessingLatency,
+	},
+	// Broker-agnostic application metrics
+	"generic": {
+		PublishRate: func(address string, scope []string) string {
+			return promSum(promRate(selectorOf("messaging_publish_messages_total").eq("destination", address).with(scope...)))
+		},
+		ConsumerLag: func(address string, scope []string) string {
+			return promSum(selectorOf("messaging_consumer_lag_messages").eq("destination", address).with(scope...).String())
+		},
+		ProcessingLatency: messagingProcessingLatency,
+	},
+}
+
+// protocolPresets selects a broker preset from the AsyncAPI server protocol
+var protocolPresets = map[string]string{
+	"kafka":        "kafka",
+	"kafka-secure": "kafka",
+	"amqp":         "rabbitmq",
+	"amqps":        "rabbitmq",
+}
+
+// isAsyncAPI reports whether data is an AsyncAPI document rather than OpenAPI
+func isAsyncAPI(data []byte) bool {
+	var probe struct {
+		AsyncAPI string `yaml:"asyncapi"`
+	}
+	return yaml.Unmarshal(data, &probe) == nil && probe.AsyncAPI != ""
+}
+
+// swaggerVersion returns the version of a Swagger 2.0 document, which is not supported
+func swaggerVersion(data []byte) string {
+	var probe struct {
+		Swagger string `yaml:"swagger"`
+	}
+	if yaml.Unmarshal(data, &probe) != nil {
+		return ""
+	}
+	return probe.Swagger
+}
+
+// asyncAPIRaw mirrors the AsyncAPI fields read from both major versions
+type asyncAPIRaw struct {
+	AsyncAPI string `yaml:"asyncapi"`
+	Info     struct {
+		Title       string `yaml:"title"`
+		Version     string `yaml:"version"`
+		Description string `yaml:"description"`
+	} `yaml:"info"`
+	Servers map[string]struct {
+		Protocol string `yaml:"protocol"`
+	} `yaml:"servers"`
+	Channels map[string]struct {
+		Address   string             `yaml:"address"`
+		Publish   *asyncOperationRaw `yaml:"publish"`
+		Subscribe *asyncOperationRaw `yaml:"subscribe"`
+	} `yaml:"channels"`
+	Operations map[string]struct {
+		Action  string `yaml:"action"`
+		Summary string `yaml:"summary"`
+		Channel struct {
+			Ref string `yaml:"$ref"`
+		} `yaml:"channel"`
+	} `yaml:"operations"`
+}
+
+type asyncOperationRaw struct {
+	OperationID string `yaml:"operationId"`
+	Summary     string `yaml:"summary"`
+}
+
+// parseAsyncAPI parses an AsyncAPI document into a LoadedSpec. The OpenAPI
+// document is synthesised from the info block so titles and service names
+// work as for OpenAPI input.
+func parseAsyncAPI(source string, data []byte) (LoadedSpec, error) {
+	var raw asyncAPIRaw
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return LoadedSpec{}, &SpecLoadError{Source: source, Op: "loading AsyncAPI spec", Err: err}
+	}
+
+	async := &AsyncAPIDoc{Version: raw.AsyncAPI}
+	for _, name := range sortedMapKeys(raw.Servers) {
+		if async.Protocol = raw.Servers[name].Protocol; async.Protocol != "" {
+			break
+		}
+	}
+
+	channels := make(map[string]*AsyncChannel)
+	channel := func(name string) *AsyncChannel {
+		if ch, ok := channels[name]; ok {
+			return ch
+		}
+		ch := &AsyncChannel{Name: name, Address: name}
+		if def, ok := raw.Channels[name]; ok && def.Address != "" {
+			ch.Address = def.Address
+		}
+		channels[name] = ch
+		return ch
+	}
+
+	if strings.HasPrefix(raw.AsyncAPI, "2.") {
+		for name, def := range raw.Channels {
+			ch := channel(name)
+			if def.Publish != nil {
+				ch.Operations = append(ch.Operations, AsyncOperation{ID: def.Publish.OperationID, Action: "receive", Summary: def.Publish.Summary})
+			}
+			if def.Subscribe != nil {
+				ch.Operations = append(ch.Operations, AsyncOperation{ID: def.Subscribe.OperationID, Action: "send", Summary: def.Subscribe.Summary})
+			}
+		}
+	} else {
+		for name := range raw.Channels {
+			channel(name)
+		}
+		for _, id := range sortedMapKeys(raw.Operations) {
+			op := raw.Operations[id]
+			name := strings.TrimPrefix(op.Channel.Ref, "#/channels/")
+			if name == "" {
+				continue
+			}
+			ch := channel(name)
+			ch.Operations = append(ch.Operations, AsyncOperation{ID: id, Action: op.Action, Summary: op.Summary})
+		}
+	}
+
+	for _, name := range sortedMapKeys(channels) {
+		async.Channels = append(async.Channels, *channels[name])
+	}
+
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info:    &openapi3.Info{Title: raw.Info.Title, Version: raw.Info.Version, Description: raw.Info.Description},
+		Paths:   openapi3.NewPaths(),
+	}
+	return LoadedSpec{
+		File:    source,
+		Service: specServiceName(source, doc),
+		Doc:     doc,
+		Data:    data,
+		Async:   async,
+	}, nil
+}
+
+// resolveBrokerPreset picks the configured preset, falling back to the one
+// implied by the AsyncAPI server protocol, then to "generic". Plugin presets
+// are fetched for the query scope.
+func resolveBrokerPreset(ctx context.Context, name string, async *AsyncAPIDoc, scope []string) (BrokerPreset, error) {
+	if name == "" {
+		name = protocolPresets[async.Protocol]
+	}
+	if name == "" {
+		name = "generic"
+	}
+	if plugin := pluginBrokerPresets[name]; plugin != nil {
+		return pluginBrokerPreset(ctx, plugin, name, async, scope)
+	}
+	preset, ok := brokerPresets[name]
+	if !ok {
+		return BrokerPreset{}, &UnsupportedFeatureError{Feature: "broker preset", Value: name}
+	}
+	return preset, nil
+}
+
+// addAsyncAPIPanels appends publish rate, consumer lag and processing
+// latency panels for every channel of an AsyncAPI spec
+func addAsyncAPIPanels(dashboard *GrafanaDashboard, async *AsyncAPIDoc, preset BrokerPreset, scope []string, cursor *panelCursor) {
+	for _, ch := range async.Channels {
+		title := "Channel " + ch.Address
+		var ids []string
+		for _, op := range ch.Operations {
+			if op.ID != "" {
+				ids = append(ids, fmt.Sprintf("%s (%s)", op.ID, op.Action))
+			}
+		}
+		description := "Channel " + ch.Address
+		if len(ids) > 0 {
+			description += ". Operations: " + strings.Join(ids, ", ")
+		}
+
+		panels := []Panel{
+			createStreamingPanel(cursor.ID, title+" - Publish Rate", description, "ops", cursor.Height, cursor.Y, []Target{
+				{Expr: preset.PublishRate(ch.Address, scope), LegendFormat: "Published", RefID: "A"},
+			}),
+			createStreamingPanel(cursor.ID+1, title+" - Consumer Lag", description, "short", cursor.Height, cursor.Y+cursor.Height, []Target{
+				{Expr: preset.ConsumerLag(ch.Address, scope), LegendFormat: "{{consumergroup}}", RefID: "A"},
+			}),
+			createStreamingPanel(cursor.ID+2, title+" - Processing Latency", description, "s", cursor.Height, cursor.Y+2*cursor.Height, []Target{
+				{Expr: preset.ProcessingLatency(ch.Address, scope), LegendFormat: "p99", RefID: "A"},
+			}),
+		}
+
+		group := OperationPanels{Key: ch.Name, Method: "CHANNEL", Path: ch.Address}
+		for _, panel := range panels {
+			panel.Description = describeOperation(panel.Description, group.operation())
+			dashboard.Panels = append(dashboard.Panels, panel)
+			group.PanelIDs = append(group.PanelIDs, panel.ID)
+		}
+		if dashboard.operations == nil {
+			dashboard.operations = make(map[string]OperationPanels)
+		}
+		dashboard.operations[group.Key] = group
+		for _, op := range ch.Operations {
+			if op.ID != "" {
+				dashboard.operations[op.ID] = group
+			}
+		}
+
+		cursor.ID += len(panels)
+		cursor.Y += len(panels) * cursor.Height
+	}
+}
+
+func sortedMapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
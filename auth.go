@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// authFailureStatus matches the status codes of rejected credentials and permissions
+const authFailureStatus = `status_code=~"401|403"`
+
+// securitySchemes returns the names of the security schemes an operation
+// requires: its own security requirements, or the document-wide ones when it
+// declares none. An empty list means the operation is unauthenticated.
+func securitySchemes(doc *openapi3.T, operation *openapi3.Operation) []string {
+	requirements := doc.Security
+	if operation.Security != nil {
+		requirements = *operation.Security
+	}
+
+	seen := make(map[string]bool)
+	var schemes []string
+	for _, requirement := range requirements {
+		for name := range requirement {
+			if !seen[name] {
+				seen[name] = true
+				schemes = append(schemes, name)
+			}
+		}
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// createAuthFailurePanel shows the 401 and 403 rates of a secured operation
+func createAuthFailurePanel(title string, match operationMatch, schemes []string, panelID, height, yPos int) Panel {
+	return createStreamingPanel(panelID, title+" - Auth Failures",
+		"Rejected credentials (401) and permissions (403), secured by "+strings.Join(schemes, ", "),
+		metricUnit("http_requests_total"), height, yPos, []Target{
+			{
+				Expr:         promSum(promRate(match.selector("http_requests_total").with(authFailureStatus)), match.by("status_code")...),
+				LegendFormat: match.legend("{{status_code}}"),
+				RefID:        "A",
+			},
+		})
+}
+
+// addAuthPanels appends an "Authentication" row summarising auth failures by
+// endpoint and token validation latency when any operation is secured
+func addAuthPanels(dashboard *GrafanaDashboard, ops []OperationInfo, scope []string, cursor *panelCursor) {
+	schemes := make(map[string]bool)
+	for _, op := range ops {
+		for _, scheme := range op.SecuritySchemes {
+			schemes[scheme] = true
+		}
+	}
+	if len(schemes) == 0 {
+		return
+	}
+	names := make([]string, 0, len(schemes))
+	for scheme := range schemes {
+		names = append(names, scheme)
+	}
+	sort.Strings(names)
+
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Authentication", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	table := createCoverageTablePanel(cursor.ID, "Auth Failures by Endpoint",
+		"401 and 403 responses per endpoint in the selected time range, secured by "+strings.Join(names, ", "),
+		promRangeTotals([]string{"method", "path", "status_code"}, selectorOf("http_requests_total", scope...).with(authFailureStatus)),
+		cursor.Height, cursor.Y)
+	validation := selectorOf("auth_token_validation_duration_seconds", scope...)
+	latency := createStreamingPanel(cursor.ID+1, "Token Validation Latency",
+		"Time spent validating credentials before requests are handled",
+		metricUnit("auth_token_validation_duration_seconds"), cursor.Height, cursor.Y+cursor.Height, []Target{
+			{
+				Expr:         promHistogramQuantile("0.99", validation),
+				LegendFormat: "p99",
+				RefID:        "A",
+			},
+			{
+				Expr:         promHistogramQuantile("0.50", validation),
+				LegendFormat: "p50",
+				RefID:        "B",
+			},
+		})
+
+	dashboard.Panels = append(dashboard.Panels, table, latency)
+	cursor.ID += 2
+	cursor.Y += 2 * cursor.Height
+}
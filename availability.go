@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultAvailabilityWindows are the windows of the availability gauge
+var defaultAvailabilityWindows = []string{"30d", "90d"}
+
+// defaultAvailabilityTarget colors the gauge without --slo-target or a
+// configured target
+const defaultAvailabilityTarget = 99.9
+
+// AvailabilityConfig tunes the composite availability gauge of
+// --availability-panel, in the availability section of the config file
+type AvailabilityConfig struct {
+	// Target is the availability (percent) below which the gauge turns red
+	Target float64 `yaml:"target"`
+	// Windows are the windows the availability is computed over
+	Windows []string `yaml:"windows"`
+	// Weights weigh operations by tag or by operation (operationId or
+	// "METHOD path"), the operation entry replacing the tag's; operations
+	// weigh 1 by default and 0 leaves an operation out
+	Weights struct {
+		Tags       map[string]float64 `yaml:"tags"`
+		Operations map[string]float64 `yaml:"operations"`
+	} `yaml:"weights"`
+}
+
+// withDefaults fills in the windows and the target, --slo-target when set
+func (c AvailabilityConfig) withDefaults(sloTarget float64) AvailabilityConfig {
+	if len(c.Windows) == 0 {
+		c.Windows = defaultAvailabilityWindows
+	}
+	if c.Target == 0 {
+		c.Target = sloTarget
+	}
+	if c.Target == 0 {
+		c.Target = defaultAvailabilityTarget
+	}
+	return c
+}
+
+func (c AvailabilityConfig) validate() error {
+	if c.Target < 0 || c.Target >= 100 {
+		return fmt.Errorf("target: must be a percentage below 100, e.g. 99.9")
+	}
+	for _, window := range c.Windows {
+		if !promDurationPattern.MatchString(window) {
+			return fmt.Errorf("invalid window %q: must be a Prometheus duration such as 30d", window)
+		}
+	}
+	for tag, weight := range c.Weights.Tags {
+		if weight < 0 {
+			return fmt.Errorf("weights.tags.%s: must not be negative", tag)
+		}
+	}
+	for key, weight := range c.Weights.Operations {
+		if weight < 0 {
+			return fmt.Errorf("weights.operations.%s: must not be negative", key)
+		}
+	}
+	return nil
+}
+
+// weight returns the weight of an operation in the composite availability
+func (c AvailabilityConfig) weight(op OperationInfo) float64 {
+	for _, key := range []string{op.Key(), strings.ToUpper(op.Method) + " " + op.Path} {
+		if weight, ok := c.Weights.Operations[key]; ok {
+			return weight
+		}
+	}
+	if weight, ok := c.Weights.Tags[op.Tag]; ok && op.Tag != "" {
+		return weight
+	}
+	return 1
+}
+
+// availabilityExpr computes the weighted mean of the share of non-5xx
+// responses of the operations over a window, in percent. Operations without
+// requests in the window count as available.
+func availabilityExpr(ops []OperationInfo, config AvailabilityConfig, scope []string, window string) string {
+	var terms []string
+	total := 0.0
+	for _, op := range ops {
+		weight := config.weight(op)
+		if weight == 0 || streamProtocol(op.Operation) != "" {
+			continue
+		}
+		requests := operationMatch{Path: op.Path, Method: strings.ToUpper(op.Method), Scope: scope}.selector("http_requests_total")
+		failed := promSum(promOverTime("increase", requests.regex("status_code", "5.."), window))
+		availability := fmt.Sprintf(`((1 - (%s or vector(0)) / %s) or vector(1))`, failed, promSum(promOverTime("increase", requests, window)))
+		if weight != 1 {
+			availability = fmt.Sprintf("%g * %s", weight, availability)
+		}
+		terms = append(terms, availability)
+		total += weight
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("(%s) / %g * 100", strings.Join(terms, " + "), total)
+}
+
+// addAvailabilityPanels appends an "API Availability" row with a gauge of
+// the weighted availability of the operations per window
+func addAvailabilityPanels(dashboard *GrafanaDashboard, ops []OperationInfo, config *Config, cursor *panelCursor) {
+	availability := config.fileConfig().Availability.withDefaults(config.SLOTarget)
+	var targets []Target
+	for i, window := range availability.Windows {
+		expr := availabilityExpr(ops, availability, config.queryScope(), window)
+		if expr == "" {
+			return
+		}
+		targets = append(targets, Target{
+			Expr:         expr,
+			LegendFormat: window,
+			RefID:        string(rune('A' + i)),
+			Instant:      true,
+		})
+	}
+
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("API Availability", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	dashboard.Panels = append(dashboard.Panels, Panel{
+		ID:          cursor.ID,
+		Title:       "Composite Availability",
+		Description: fmt.Sprintf("Weighted share of non-5xx responses across all operations over the last %s; target %g%%", strings.Join(availability.Windows, " and "), availability.Target),
+		Type:        "gauge",
+		Datasource:  map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		GridPos:     GridPos{H: cursor.Height, W: 24, X: 0, Y: cursor.Y},
+		Targets:     targets,
+		Options: Options{
+			ReduceOptions: ReduceOptions{
+				Values: false,
+				Fields: "",
+				Calcs:  []string{"lastNotNull"},
+			},
+			Orientation:          "auto",
+			ShowThresholdLabels:  false,
+			ShowThresholdMarkers: true,
+		},
+		FieldConfig: FieldConfig{
+			Defaults: FieldConfigDefaults{
+				Color: ColorOptions{Mode: "thresholds"},
+				Unit:  "percent",
+				// The gauge spans ten error budgets below 100%
+				Min: floatPtr(max(0, roundThreshold(100-10*(100-availability.Target)))),
+				Max: floatPtr(100),
+				Thresholds: ThresholdOptions{
+					Mode: "absolute",
+					Steps: []ThresholdStep{
+						{Color: "red", Value: nil},
+						{Color: "yellow", Value: floatPtr(roundThreshold(availability.Target - (100-availability.Target)/2))},
+						{Color: "green", Value: floatPtr(availability.Target)},
+					},
+				},
+			},
+		},
+	})
+	cursor.ID++
+	cursor.Y += cursor.Height
+}
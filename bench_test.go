@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkBudget runs TestPerformanceBudget, which is too slow for every go
+// test run; make test runs it:
+//
+//	go test -run TestPerformanceBudget -budget
+var checkBudget = flag.Bool("budget", false, "check generation of a 10k operation spec against the performance budget")
+
+// performanceBudget is the time generating, validating and writing the
+// dashboard of a parsed spec of budgetOperations operations may take. Spec
+// parsing, done by kin-openapi, is benchmarked but left out of the budget.
+const (
+	performanceBudget = 2 * time.Second
+	budgetOperations  = 10000
+)
+
+// benchmarkSizes are the operation counts of the synthetic benchmark specs
+var benchmarkSizes = []int{100, 1000, 10000}
+
+// syntheticSpec returns an OpenAPI spec of n operations spread over paths of
+// up to four methods, with tags, path parameters and error responses so
+// every panel builder of the default configuration runs
+func syntheticSpec(n int) []byte {
+	methods := []string{"get", "post", "put", "delete"}
+	var b strings.Builder
+	b.WriteString("openapi: 3.0.3\ninfo:\n  title: Synthetic API\n  version: 1.0.0\npaths:\n")
+	for op := 0; op < n; {
+		resource := op / len(methods)
+		fmt.Fprintf(&b, "  /resources%d/{id}/items:\n", resource)
+		for _, method := range methods {
+			if op == n {
+				break
+			}
+			fmt.Fprintf(&b, "    %s:\n", method)
+			fmt.Fprintf(&b, "      operationId: %s%d\n", method, resource)
+			fmt.Fprintf(&b, "      summary: %s resource %d items\n", method, resource)
+			fmt.Fprintf(&b, "      tags: [group%d]\n", resource%20)
+			b.WriteString("      parameters:\n")
+			b.WriteString("        - {name: id, in: path, required: true, schema: {type: string}}\n")
+			b.WriteString("      responses:\n")
+			b.WriteString("        '200': {description: OK}\n")
+			b.WriteString("        '404': {description: Not found}\n")
+			b.WriteString("        '500': {description: Internal error}\n")
+			op++
+		}
+	}
+	return []byte(b.String())
+}
+
+// syntheticInput parses a synthetic spec of n operations into the input of
+// generateDashboard
+func syntheticInput(tb testing.TB, n int, config *Config) (*GenerationInput, string) {
+	tb.Helper()
+	spec, err := parseSpec("synthetic.yaml", syntheticSpec(n), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	specs := []LoadedSpec{spec}
+	input, err := prepareGenerationInput(context.Background(), specs, config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return input, calculateSpecHash(specs)
+}
+
+// BenchmarkGenerateDashboard measures generating, validating and writing a
+// dashboard from parsed specs of 100, 1k and 10k operations:
+//
+//	go test -run '^$' -bench GenerateDashboard -benchmem -memprofile mem.out
+func BenchmarkGenerateDashboard(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("operations=%d", n), func(b *testing.B) {
+			config := defaultConfig()
+			input, specHash := syntheticInput(b, n, config)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				dashboard := generateDashboard(context.Background(), input, config, specHash)
+				if err := checkDashboard(&dashboard); err != nil {
+					b.Fatal(err)
+				}
+				if err := writeDashboardJSON(io.Discard, dashboard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkParseSpec measures parsing the synthetic specs
+func BenchmarkParseSpec(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("operations=%d", n), func(b *testing.B) {
+			data := syntheticSpec(n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := parseSpec("synthetic.yaml", data, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestPerformanceBudget fails when the dashboard of a spec of
+// budgetOperations operations takes longer than performanceBudget
+func TestPerformanceBudget(t *testing.T) {
+	if !*checkBudget {
+		t.Skip("run with -budget to check the performance budget")
+	}
+	config := defaultConfig()
+	input, specHash := syntheticInput(t, budgetOperations, config)
+	start := time.Now()
+	dashboard := generateDashboard(context.Background(), input, config, specHash)
+	if err := checkDashboard(&dashboard); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDashboardJSON(io.Discard, dashboard); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > performanceBudget {
+		t.Errorf("%d operations took %v, over the %v budget", budgetOperations, elapsed.Round(time.Millisecond), performanceBudget)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import "fmt"
+
+// createHTTPBreakdownPanels builds the panel set for one HTTP operation with
+// client and server errors separated: 4xx and 5xx get their own rate panels
+// and thresholds, plus a stacked timeseries of traffic per status class.
+func createHTTPBreakdownPanels(title string, match operationMatch, thresholds ThresholdConfig, panelID, height, yPos int) []Panel {
+	return []Panel{
+		createRequestRatePanel(title, match, panelID, height, yPos),
+		createLatencyPanel(title, match, thresholds, panelID+1, height, yPos+height),
+		createStatusClassRatePanel(title, match, "4", thresholds.ClientErrorWarning, thresholds.ClientErrorCritical, panelID+2, height, yPos+2*height),
+		createStatusClassRatePanel(title, match, "5", thresholds.ErrorWarning, thresholds.ErrorCritical, panelID+3, height, yPos+3*height),
+		createStatusClassesPanel(title, match, panelID+4, height, yPos+4*height),
+		createThroughputPanel(title, match, panelID+5, height, yPos+5*height),
+	}
+}
+
+// createStatusClassRatePanel shows the share of responses in one status
+// class ("4" or "5") over time
+func createStatusClassRatePanel(title string, match operationMatch, class string, warning, critical float64, panelID, height, yPos int) Panel {
+	kind := "Server"
+	if class == "4" {
+		kind = "Client"
+	}
+
+	return Panel{
+		ID:         panelID,
+		Title:      fmt.Sprintf("%s - %sxx Rate", title, class),
+		Type:       "timeseries",
+		Datasource: map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		GridPos:    GridPos{H: height, W: 12, X: 0, Y: yPos},
+		Targets: []Target{
+			{
+				Expr:         promPercent(promSum(promRate(match.selector("http_requests_total", `status_code=~"`+class+`.."`)), match.by()...), promSum(promRate(match.selector("http_requests_total")), match.by()...)),
+				LegendFormat: match.legend(class + "xx"),
+				RefID:        "A",
+			},
+		},
+		Options: Options{
+			Legend: LegendOptions{
+				DisplayMode: "list",
+				Placement:   "bottom",
+			},
+			Tooltip: TooltipOptions{
+				Mode: "multi",
+			},
+		},
+		FieldConfig: FieldConfig{
+			Defaults: FieldConfigDefaults{
+				Color: ColorOptions{Mode: "palette-classic"},
+				Unit:  "percent",
+				Min:   floatPtr(0),
+				Thresholds: ThresholdOptions{
+					Mode: "absolute",
+					Steps: []ThresholdStep{
+						{Color: "green", Value: nil},
+						{Color: "yellow", Value: floatPtr(warning)},
+						{Color: "red", Value: floatPtr(critical)},
+					},
+				},
+			},
+		},
+		Description: fmt.Sprintf("%s error (%sxx) rate percentage", kind, class),
+	}
+}
+
+// createStatusClassesPanel stacks the request rate per status class (2xx, 3xx, ...)
+func createStatusClassesPanel(title string, match operationMatch, panelID, height, yPos int) Panel {
+	return Panel{
+		ID:         panelID,
+		Title:      title + " - Status Classes",
+		Type:       "timeseries",
+		Datasource: map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		GridPos:    GridPos{H: height, W: 12, X: 0, Y: yPos},
+		Targets: []Target{
+			{
+				Expr:         promSumBy(match.by("status_class"), fmt.Sprintf(`label_replace(%s, "status_class", "${1}xx", "status_code", "([0-9])..")`, promRate(match.selector("http_requests_total")))),
+				LegendFormat: match.legend("{{status_class}}"),
+				RefID:        "A",
+			},
+		},
+		Options: Options{
+			Legend: LegendOptions{
+				DisplayMode: "list",
+				Placement:   "bottom",
+			},
+			Tooltip: TooltipOptions{
+				Mode: "multi",
+			},
+		},
+		FieldConfig: FieldConfig{
+			Defaults: FieldConfigDefaults{
+				Color: ColorOptions{Mode: "palette-classic"},
+				Custom: &FieldCustom{
+					FillOpacity: 30,
+					Stacking:    &StackingOptions{Mode: "normal", Group: "A"},
+				},
+				Unit: metricUnit("http_requests_total"),
+				Thresholds: ThresholdOptions{
+					Mode: "absolute",
+					Steps: []ThresholdStep{
+						{Color: "green", Value: nil},
+					},
+				},
+			},
+		},
+		Description: "Request rate per status class, stacked",
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+)
+
+// BusinessQuery is an entry of the x-grafana-queries operation extension, a
+// product KPI shown next to the operation's health
+type BusinessQuery struct {
+	Expr   string `json:"expr"`
+	Legend string `json:"legend"`
+	Unit   string `json:"unit"`
+	// Title names the panel, the legend when empty
+	Title string `json:"title"`
+}
+
+// operationBusinessQueries reads the x-grafana-queries extension of an
+// operation, skipping entries without an expression
+func operationBusinessQueries(op OperationInfo) []BusinessQuery {
+	ext, ok := op.Operation.Extensions["x-grafana-queries"]
+	if !ok {
+		return nil
+	}
+	var queries []BusinessQuery
+	data, err := json.Marshal(ext)
+	if err == nil {
+		err = json.Unmarshal(data, &queries)
+	}
+	if err != nil {
+		slog.Warn("ignoring invalid x-grafana-queries", "operation", op.Key(), "error", err)
+		return nil
+	}
+	valid := queries[:0]
+	for _, query := range queries {
+		if strings.TrimSpace(query.Expr) == "" {
+			slog.Warn("ignoring x-grafana-queries entry without expr", "operation", op.Key(), "legend", query.Legend)
+			continue
+		}
+		valid = append(valid, query)
+	}
+	return valid
+}
+
+// createBusinessQueryPanel graphs an x-grafana-queries expression as is
+func createBusinessQueryPanel(title string, query BusinessQuery, panelID, height, yPos int) Panel {
+	name := query.Title
+	if name == "" {
+		name = query.Legend
+	}
+	if name == "" {
+		name = "Business Metric"
+	}
+	unit := query.Unit
+	if unit == "" {
+		unit = "short"
+	}
+	return createStreamingPanel(panelID, title+" - "+name, "Declared in x-grafana-queries", unit, height, yPos, []Target{
+		{
+			Expr:         query.Expr,
+			LegendFormat: query.Legend,
+			RefID:        "A",
+		},
+	})
+}
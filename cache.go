@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Default metrics of cache hit ratio panels
+const (
+	defaultCacheHitsMetric   = "http_cache_hits_total"
+	defaultCacheMissesMetric = "http_cache_misses_total"
+)
+
+// CacheConfig names the metrics cache hit ratio panels query, in the cache
+// section of the config file
+type CacheConfig struct {
+	HitsMetric   string `yaml:"hits_metric"`
+	MissesMetric string `yaml:"misses_metric"`
+}
+
+// withDefaults fills in the metrics that are not configured
+func (c CacheConfig) withDefaults() CacheConfig {
+	if c.HitsMetric == "" {
+		c.HitsMetric = defaultCacheHitsMetric
+	}
+	if c.MissesMetric == "" {
+		c.MissesMetric = defaultCacheMissesMetric
+	}
+	return c
+}
+
+// cacheable reports whether an operation gets a cache hit ratio panel: an
+// x-cacheable extension decides, otherwise --cache-panels selects GET
+// operations
+func (c *Config) cacheable(op OperationInfo) bool {
+	if cacheable, ok := op.Operation.Extensions["x-cacheable"].(bool); ok {
+		return cacheable
+	}
+	return c.CachePanels && strings.EqualFold(op.Method, http.MethodGet)
+}
+
+// createCacheHitRatioPanel shows the share of the requests of an operation
+// served from cache
+func createCacheHitRatioPanel(title string, match operationMatch, metrics CacheConfig, panelID, height, yPos int) Panel {
+	hits := promSum(promRate(match.selector(metrics.HitsMetric)), match.by()...)
+	misses := promSum(promRate(match.selector(metrics.MissesMetric)), match.by()...)
+	panel := createStreamingPanel(panelID, title+" - Cache Hit Ratio",
+		"Share of requests served from cache; a drop sends the traffic to the origin", "percent", height, yPos, []Target{
+			{
+				Expr:         promPercent(hits, "("+hits+" + "+misses+")"),
+				LegendFormat: match.legend("Hit ratio"),
+				RefID:        "A",
+			},
+		})
+	panel.FieldConfig.Defaults.Min = floatPtr(0)
+	panel.FieldConfig.Defaults.Max = floatPtr(100)
+	return panel
+}
@@ -0,0 +1,58 @@
+package main
+
+import "fmt"
+
+// Values of the --canary-label label telling the canary deployment apart
+// from the stable one
+const (
+	canaryValue = "canary"
+	stableValue = "stable"
+)
+
+// validateCanaryLabel checks the --canary-label value is a label name
+func validateCanaryLabel(label string) error {
+	if label != "" && !labelNamePattern.MatchString(label) {
+		return fmt.Errorf("invalid --canary-label value %q: must be a label name, e.g. version", label)
+	}
+	return nil
+}
+
+// createCanaryPanels compares the request rate, error rate and p99 latency
+// of an operation between its canary and stable deployments, told apart by
+// label. The error rate and latency panels also chart the canary's delta to
+// stable, which progressive delivery analysis can threshold on.
+func createCanaryPanels(title string, match operationMatch, label string, panelID, height, yPos int) []Panel {
+	requests := func(value string) promSelector {
+		return match.selector("http_requests_total").eq(label, value)
+	}
+	errorRate := func(value string) string {
+		return "(" + promPercent(promSum(promRate(requests(value).regex("status_code", "5..")), match.by()...), promSum(promRate(requests(value)), match.by()...)) + ")"
+	}
+	latency := func(value string) string {
+		return promHistogramQuantile("0.99", match.selector("http_request_duration_seconds").eq(label, value), match.by()...)
+	}
+	delta := match.legend(canaryValue + " - " + stableValue)
+
+	return []Panel{
+		createStreamingPanel(panelID, title+" - Canary Request Rate",
+			fmt.Sprintf("Request rate of the %s and %s deployments, by %s", canaryValue, stableValue, label),
+			metricUnit("http_requests_total"), height, yPos, []Target{
+				{Expr: promSum(promRate(requests(canaryValue)), match.by()...), LegendFormat: match.legend(canaryValue), RefID: "A"},
+				{Expr: promSum(promRate(requests(stableValue)), match.by()...), LegendFormat: match.legend(stableValue), RefID: "B"},
+			}),
+		createStreamingPanel(panelID+1, title+" - Canary Error Rate",
+			fmt.Sprintf("5xx error rate of the %s and %s deployments, by %s, and their difference", canaryValue, stableValue, label),
+			"percent", height, yPos+height, []Target{
+				{Expr: errorRate(canaryValue), LegendFormat: match.legend(canaryValue), RefID: "A"},
+				{Expr: errorRate(stableValue), LegendFormat: match.legend(stableValue), RefID: "B"},
+				{Expr: errorRate(canaryValue) + " - " + errorRate(stableValue), LegendFormat: delta, RefID: "C"},
+			}),
+		createStreamingPanel(panelID+2, title+" - Canary Latency",
+			fmt.Sprintf("p99 latency of the %s and %s deployments, by %s, and their difference", canaryValue, stableValue, label),
+			metricUnit("http_request_duration_seconds"), height, yPos+2*height, []Target{
+				{Expr: latency(canaryValue), LegendFormat: match.legend(canaryValue), RefID: "A"},
+				{Expr: latency(stableValue), LegendFormat: match.legend(stableValue), RefID: "B"},
+				{Expr: latency(canaryValue) + " - " + latency(stableValue), LegendFormat: delta, RefID: "C"},
+			}),
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cardinality modes of --cardinality-mode
+const (
+	cardinalityModeFail = "fail"
+	cardinalityModeWarn = "warn"
+)
+
+// histogramBuckets is the bucket count of the default client histograms,
+// including +Inf
+const histogramBuckets = 12
+
+// defaultStatusCodes is assumed when the specs document no status codes
+const defaultStatusCodes = 5
+
+// seriesLookupWindow is how far back live series counts look
+const seriesLookupWindow = time.Hour
+
+// cardinalityEstimator estimates how many series the selectors of a query
+// touch, from the specs or from live Prometheus series counts
+type cardinalityEstimator struct {
+	services int
+	routes   int
+	statuses int
+	// prometheus is nil without --prometheus-url
+	prometheus *PrometheusClient
+	live       map[string]int
+}
+
+// newCardinalityEstimator derives the static factors from the selected
+// operations: services × routes × status codes
+func newCardinalityEstimator(input *GenerationInput, config *Config) *cardinalityEstimator {
+	ops, shared := config.selectedOperations(input.Specs, config.SortOrder)
+	statuses := make(map[string]bool)
+	for _, op := range append(append([]OperationInfo{}, ops...), shared...) {
+		if op.Operation.Responses == nil {
+			continue
+		}
+		for code := range op.Operation.Responses.Map() {
+			if code != "default" {
+				statuses[code] = true
+			}
+		}
+	}
+
+	e := &cardinalityEstimator{
+		services: len(input.Specs),
+		routes:   len(ops) + len(shared),
+		statuses: len(statuses),
+		live:     make(map[string]int),
+	}
+	if e.services == 0 {
+		e.services = 1
+	}
+	if e.routes == 0 {
+		e.routes = 1
+	}
+	if e.statuses == 0 {
+		e.statuses = defaultStatusCodes
+	}
+	if config.PrometheusURL != "" {
+		e.prometheus = NewPrometheusClient(config.PrometheusURL)
+	}
+	return e
+}
+
+// estimateQuery sums the estimates of the selectors of a query not in seen;
+// queries of one panel share seen so their common series count once
+func (e *cardinalityEstimator) estimateQuery(ctx context.Context, expr string, seen map[string]bool) int {
+	total := 0
+	for _, match := range selectorPattern.FindAllStringSubmatch(expr, -1) {
+		if seen[match[0]] {
+			continue
+		}
+		seen[match[0]] = true
+		matchers, err := parseExtraSelector(match[2])
+		if err != nil {
+			continue
+		}
+		total += e.estimateSelector(ctx, match[1], matchers)
+	}
+	return total
+}
+
+// estimateSelector returns the live series count of a selector, falling back
+// to the static estimate when Prometheus is not configured or unreachable
+func (e *cardinalityEstimator) estimateSelector(ctx context.Context, metric string, matchers []labelMatcher) int {
+	if e.prometheus != nil {
+		selector := liveSelector(metric, matchers)
+		if count, ok := e.live[selector]; ok {
+			return count
+		}
+		count, err := e.prometheus.SeriesCount(ctx, selector, seriesLookupWindow)
+		if err == nil {
+			e.live[selector] = count
+			return count
+		}
+		slog.Warn("could not count series, using static estimates", "selector", selector, "error", err)
+		e.prometheus = nil
+	}
+
+	exact := make(map[string]int)
+	for _, m := range matchers {
+		switch {
+		case m.Op == "=" && !variableReferencePattern.MatchString(m.Value):
+			exact[m.Label] = 1
+		case m.Op == "=~" && !variableReferencePattern.MatchString(m.Value) && !strings.ContainsAny(m.Value, ".*+?[()"):
+			exact[m.Label] = len(strings.Split(m.Value, "|"))
+		}
+	}
+	factor := func(label string, values int) int {
+		if n, ok := exact[label]; ok {
+			return n
+		}
+		return values
+	}
+
+	estimate := factor("service", e.services)
+	if strings.HasPrefix(metric, "http_") {
+		// An exact path leaves at most a few methods, counted as one route
+		if _, ok := exact["path"]; !ok {
+			estimate *= e.routes
+		}
+		if strings.HasPrefix(metric, "http_requests_total") {
+			estimate *= factor("status_code", e.statuses)
+		}
+	}
+	if strings.HasSuffix(metric, "_bucket") {
+		estimate *= histogramBuckets
+	}
+	return estimate
+}
+
+// liveSelector turns a generated selector into one Prometheus can count:
+// matchers on dashboard variables match every value, as with "All" selected
+func liveSelector(metric string, matchers []labelMatcher) string {
+	var parts []string
+	for _, m := range matchers {
+		if variableReferencePattern.MatchString(m.Value) {
+			if strings.HasPrefix(m.Op, "!") {
+				continue
+			}
+			m = labelMatcher{Label: m.Label, Op: "=~", Value: ".*"}
+		}
+		parts = append(parts, m.String())
+	}
+	return metric + "{" + strings.Join(parts, ", ") + "}"
+}
+
+// panelCardinality is the estimated series count of one panel
+type panelCardinality struct {
+	Dashboard string
+	Panel     string
+	Series    int
+}
+
+// estimateDashboard estimates the series every panel of a dashboard touches
+func (e *cardinalityEstimator) estimateDashboard(ctx context.Context, dashboard *GrafanaDashboard) []panelCardinality {
+	var estimates []panelCardinality
+	applyToPanels(dashboard.Panels, func(panel *Panel) {
+		if len(panel.Targets) == 0 {
+			return
+		}
+		series := 0
+		seen := make(map[string]bool)
+		for _, target := range panel.Targets {
+			if !target.Hide {
+				series += e.estimateQuery(ctx, target.Expr, seen)
+			}
+		}
+		estimates = append(estimates, panelCardinality{Dashboard: dashboard.UID, Panel: panel.Title, Series: series})
+	})
+	return estimates
+}
+
+// checkCardinality reports panels estimated to touch more than
+// --max-cardinality series, failing the run unless the mode is warn
+func checkCardinality(ctx context.Context, input *GenerationInput, config *Config, dashboards []GrafanaDashboard) error {
+	if config.MaxCardinality <= 0 {
+		return nil
+	}
+	estimator := newCardinalityEstimator(input, config)
+	var heavy []panelCardinality
+	for i := range dashboards {
+		for _, estimate := range estimator.estimateDashboard(ctx, &dashboards[i]) {
+			if estimate.Series > config.MaxCardinality {
+				heavy = append(heavy, estimate)
+			}
+		}
+	}
+	if len(heavy) == 0 {
+		return nil
+	}
+	sort.SliceStable(heavy, func(i, j int) bool { return heavy[i].Series > heavy[j].Series })
+	for _, estimate := range heavy {
+		slog.Warn("panel touches more series than --max-cardinality",
+			"dashboard", estimate.Dashboard, "panel", estimate.Panel, "series", estimate.Series, "max_cardinality", config.MaxCardinality)
+	}
+	if config.CardinalityMode == cardinalityModeWarn {
+		return nil
+	}
+	return fmt.Errorf("%d panels exceed --max-cardinality %d, the heaviest touches about %d series (use --cardinality-mode warn to write anyway)",
+		len(heavy), config.MaxCardinality, heavy[0].Series)
+}
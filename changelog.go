@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// SpecChangelog lists the operations added, removed and modified between the
+// previous version of a spec and the current one
+type SpecChangelog struct {
+	Title string
+	// From and To are the info.version of the previous and current spec
+	From     string
+	To       string
+	Added    []OperationChange
+	Removed  []OperationChange
+	Modified []OperationChange
+}
+
+// OperationChange is an operation of the changelog; Changes names the parts
+// of a modified operation that differ, e.g. parameters
+type OperationChange struct {
+	Method  string
+	Path    string
+	Summary string
+	Changes []string
+}
+
+// empty reports whether no operation changed
+func (c *SpecChangelog) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Modified) == 0
+}
+
+// diffSpecs compares the operations of two specs by method and path, so a
+// renamed operationId shows up as a modification
+func diffSpecs(previous, current *openapi3.T) *SpecChangelog {
+	changelog := &SpecChangelog{}
+	if current.Info != nil {
+		changelog.Title = current.Info.Title
+		changelog.To = current.Info.Version
+	}
+	if previous.Info != nil {
+		changelog.From = previous.Info.Version
+	}
+
+	before := make(map[string]OperationInfo)
+	for _, op := range collectOperations(previous, "path") {
+		before[strings.ToUpper(op.Method)+" "+op.Path] = op
+	}
+	seen := make(map[string]bool)
+	for _, op := range collectOperations(current, "path") {
+		key := strings.ToUpper(op.Method) + " " + op.Path
+		seen[key] = true
+		old, ok := before[key]
+		if !ok {
+			changelog.Added = append(changelog.Added, newOperationChange(op))
+			continue
+		}
+		if changes := operationChanges(old.Operation, op.Operation); len(changes) > 0 {
+			change := newOperationChange(op)
+			change.Changes = changes
+			changelog.Modified = append(changelog.Modified, change)
+		}
+	}
+	for _, op := range collectOperations(previous, "path") {
+		if !seen[strings.ToUpper(op.Method)+" "+op.Path] {
+			changelog.Removed = append(changelog.Removed, newOperationChange(op))
+		}
+	}
+	return changelog
+}
+
+func newOperationChange(op OperationInfo) OperationChange {
+	return OperationChange{Method: strings.ToUpper(op.Method), Path: op.Path, Summary: op.Operation.Summary}
+}
+
+// operationChanges names the parts of an operation that differ between two
+// versions of it
+func operationChanges(previous, current *openapi3.Operation) []string {
+	var changes []string
+	for _, part := range []struct {
+		name   string
+		before interface{}
+		after  interface{}
+	}{
+		{"operationId", previous.OperationID, current.OperationID},
+		{"summary", previous.Summary, current.Summary},
+		{"description", previous.Description, current.Description},
+		{"tags", previous.Tags, current.Tags},
+		{"parameters", previous.Parameters, current.Parameters},
+		{"request body", previous.RequestBody, current.RequestBody},
+		{"responses", previous.Responses, current.Responses},
+		{"security", previous.Security, current.Security},
+		{"deprecated", previous.Deprecated, current.Deprecated},
+		{"extensions", previous.Extensions, current.Extensions},
+	} {
+		before, _ := json.Marshal(part.before)
+		after, _ := json.Marshal(part.after)
+		if string(before) != string(after) {
+			changes = append(changes, part.name)
+		}
+	}
+	return changes
+}
+
+// renderChangelog renders the changelog as Markdown, sections at the given
+// heading level
+func renderChangelog(changelog *SpecChangelog, level int) string {
+	heading := strings.Repeat("#", level)
+	var b strings.Builder
+	title := changelog.Title
+	if title == "" {
+		title = "Spec"
+	}
+	fmt.Fprintf(&b, "%s %s changelog", heading, title)
+	if changelog.From != "" || changelog.To != "" {
+		fmt.Fprintf(&b, " (%s → %s)", changelog.From, changelog.To)
+	}
+	b.WriteString("\n\n")
+	if changelog.empty() {
+		b.WriteString("No operations were added, removed or modified.\n")
+		return b.String()
+	}
+
+	for _, section := range []struct {
+		name       string
+		operations []OperationChange
+		note       string
+	}{
+		{"Added", changelog.Added, "panels were added for these operations"},
+		{"Removed", changelog.Removed, "their panels were removed"},
+		{"Modified", changelog.Modified, ""},
+	} {
+		if len(section.operations) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s# %s (%d)\n\n", heading, section.name, len(section.operations))
+		if section.note != "" {
+			fmt.Fprintf(&b, "_%s%s_\n\n", strings.ToUpper(section.note[:1]), section.note[1:])
+		}
+		for _, op := range section.operations {
+			fmt.Fprintf(&b, "- `%s %s`", op.Method, op.Path)
+			if op.Summary != "" {
+				fmt.Fprintf(&b, " %s", markdownCell(op.Summary))
+			}
+			if len(op.Changes) > 0 {
+				fmt.Fprintf(&b, ": %s changed", strings.Join(op.Changes, ", "))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// addChangelogPanels appends a "Spec Changelog" row with the changelog as a
+// Markdown text panel
+func addChangelogPanels(dashboard *GrafanaDashboard, changelog *SpecChangelog, cursor *panelCursor) {
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Spec Changelog", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	dashboard.Panels = append(dashboard.Panels, Panel{
+		ID:          cursor.ID,
+		Title:       "Changes Since the Previous Spec",
+		Description: "Operations added, removed or modified since the spec given with --previous-spec",
+		Type:        "text",
+		GridPos:     GridPos{H: cursor.Height, W: 24, X: 0, Y: cursor.Y},
+		Options: Options{
+			Mode:    "markdown",
+			Content: strings.TrimSpace(renderChangelog(changelog, 3)),
+		},
+	})
+	cursor.ID++
+	cursor.Y += cursor.Height
+}
+
+// writeChangelog writes the changelog as a Markdown report
+func writeChangelog(path string, changelog *SpecChangelog) error {
+	if err := os.WriteFile(path, []byte(renderChangelog(changelog, 1)), 0644); err != nil {
+		return fmt.Errorf("error writing changelog: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig is the YAML configuration file given with --config
+type FileConfig struct {
+	Thresholds ThresholdsConfig `yaml:"thresholds"`
+	// Alerts adds latency and error rate alerts to operations outside of SLO
+	// mode
+	Alerts bool `yaml:"alerts"`
+	// Units maps metric names or globs to Grafana units
+	Units map[string]string `yaml:"units"`
+	// DurationUnit is the unit duration metrics are recorded in, s or ms
+	DurationUnit string `yaml:"duration_unit"`
+	// Variables replace the service variable and filter every generated selector
+	Variables []VariableConfig `yaml:"variables"`
+	// ExtraSelector holds label matchers injected into every generated query
+	ExtraSelector string `yaml:"extra_selector"`
+	// Query tunes generated queries for query frontends
+	Query QueryOptions `yaml:"query"`
+	// Permissions replace the permissions of pushed dashboards
+	Permissions PermissionsConfig `yaml:"permissions"`
+	// Annotations replace the default deploy markers; an empty list disables them
+	Annotations []AnnotationConfig `yaml:"annotations"`
+	// Layout selects the layout mode and panel sizes
+	Layout LayoutConfig `yaml:"layout"`
+	// Notifications route alerts to contact points, resolved when pushing
+	Notifications NotificationsConfig `yaml:"notifications"`
+	// Theme is the dashboard style, dark (the default) or light
+	Theme string `yaml:"theme"`
+	// Colors override the theme's state colors and palette
+	Colors ColorsConfig `yaml:"colors"`
+	// Webhooks names the delivery metrics of callback and webhook panels
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	// RequestValidation names the metric of --validation-panels
+	RequestValidation RequestValidationConfig `yaml:"request_validation"`
+	// RateLimits names the metrics of throttling panels
+	RateLimits RateLimitsConfig `yaml:"rate_limits"`
+	// Cache names the metrics of cache hit ratio panels
+	Cache CacheConfig `yaml:"cache"`
+	// Dependencies names the client metrics of x-dependencies panels
+	Dependencies DependenciesConfig `yaml:"dependencies"`
+	// SummaryLatency names the metric presets exposing latency as summaries,
+	// queried by their quantile label instead of histogram_quantile
+	SummaryLatency []string `yaml:"summary_latency"`
+	// Availability weighs operations in the --availability-panel gauge
+	Availability AvailabilityConfig `yaml:"availability"`
+	// Instances are the Grafana instances --push publishes to, each with its
+	// own overrides
+	Instances []GrafanaInstance `yaml:"grafana_instances"`
+	// GrafanaAuth sets how to authenticate to Grafana, flags taking precedence
+	GrafanaAuth GrafanaAuth `yaml:"grafana_auth"`
+	// Mixins include hand-written dashboard fragments at given positions
+	Mixins []MixinConfig `yaml:"mixins"`
+	// SyntheticChecks sets the blackbox exporter of --synthetic-checks and
+	// --emit-probes
+	SyntheticChecks SyntheticChecksConfig `yaml:"synthetic_checks"`
+	// MultiRegion names the region and cluster labels of --multi-region
+	MultiRegion MultiRegionConfig `yaml:"multi_region"`
+	// Teams maps tags to the teams owning their operations, for dashboard
+	// tags, alert labels and runbook links
+	Teams map[string]string `yaml:"teams"`
+	// TeamRunbooks maps teams to their runbook URLs, linked from their panels
+	TeamRunbooks map[string]string `yaml:"team_runbooks"`
+	// Maintenance windows mute the notifications of generated alerts, as
+	// Grafana mute timings pushed with the dashboards
+	Maintenance []MaintenanceWindow `yaml:"maintenance"`
+	// Transforms are JSON Patches and jq expressions applied in order to
+	// every generated dashboard before it is written or pushed
+	Transforms []TransformConfig `yaml:"transforms"`
+	// Plugins are openapi2grafana-plugin-* executables, by name or path,
+	// contributing panel factories, broker presets and output encodings
+	Plugins []string `yaml:"plugins"`
+	// Time sets the refresh, time range, timezone and week start, flags
+	// taking precedence
+	Time TimeSettings `yaml:"time"`
+	// Titles shortens the panel titles of operations with long paths, flags
+	// taking precedence
+	Titles TitleSettings `yaml:"titles"`
+	// Visibility sets the thresholds and alert severity of public and
+	// internal operations
+	Visibility VisibilitySettings `yaml:"visibility"`
+}
+
+// ThresholdsConfig holds a global threshold default with per-tag and
+// per-operation (operationId or "METHOD path") overrides
+type ThresholdsConfig struct {
+	Default    ThresholdOverride            `yaml:"default"`
+	Tags       map[string]ThresholdOverride `yaml:"tags"`
+	Operations map[string]ThresholdOverride `yaml:"operations"`
+}
+
+// ThresholdOverride replaces the thresholds that are set and keeps the rest.
+// It is also the format of the x-grafana-thresholds operation extension.
+type ThresholdOverride struct {
+	LatencyWarning      *float64 `yaml:"latency_warning" json:"latency_warning"`
+	LatencyCritical     *float64 `yaml:"latency_critical" json:"latency_critical"`
+	ErrorWarning        *float64 `yaml:"error_warning" json:"error_warning"`
+	ErrorCritical       *float64 `yaml:"error_critical" json:"error_critical"`
+	ClientErrorWarning  *float64 `yaml:"client_error_warning" json:"client_error_warning"`
+	ClientErrorCritical *float64 `yaml:"client_error_critical" json:"client_error_critical"`
+}
+
+// thresholdOverride sets every threshold of t, for printing resolved
+// thresholds in the config file format
+func thresholdOverride(t ThresholdConfig) ThresholdOverride {
+	return ThresholdOverride{
+		LatencyWarning:      floatPtr(t.LatencyWarning),
+		LatencyCritical:     floatPtr(t.LatencyCritical),
+		ErrorWarning:        floatPtr(t.ErrorWarning),
+		ErrorCritical:       floatPtr(t.ErrorCritical),
+		ClientErrorWarning:  floatPtr(t.ClientErrorWarning),
+		ClientErrorCritical: floatPtr(t.ClientErrorCritical),
+	}
+}
+
+func (o ThresholdOverride) apply(t ThresholdConfig) ThresholdConfig {
+	for _, field := range []struct {
+		value  *float64
+		target *float64
+	}{
+		{o.LatencyWarning, &t.LatencyWarning},
+		{o.LatencyCritical, &t.LatencyCritical},
+		{o.ErrorWarning, &t.ErrorWarning},
+		{o.ErrorCritical, &t.ErrorCritical},
+		{o.ClientErrorWarning, &t.ClientErrorWarning},
+		{o.ClientErrorCritical, &t.ClientErrorCritical},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+	return t
+}
+
+// loadFileConfig reads the --config file into config.File
+func loadFileConfig(config *Config) error {
+	if config.ConfigFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(config.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+	file := &FileConfig{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", config.ConfigFile, err)
+	}
+	if err := validateVariables(file.Variables); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	if _, err := parseExtraSelector(file.ExtraSelector); err != nil {
+		return fmt.Errorf("error in config file %s: extra_selector: %w", config.ConfigFile, err)
+	}
+	if err := file.Query.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: query: %w", config.ConfigFile, err)
+	}
+	if err := validateAnnotations(file.Annotations); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	if err := file.Layout.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: layout: %w", config.ConfigFile, err)
+	}
+	if err := file.Permissions.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: permissions: %w", config.ConfigFile, err)
+	}
+	if err := validateTheme(file.Theme); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	if err := file.Notifications.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: notifications: %w", config.ConfigFile, err)
+	}
+	if err := file.Webhooks.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: webhooks: %w", config.ConfigFile, err)
+	}
+	if err := file.RequestValidation.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: request_validation: %w", config.ConfigFile, err)
+	}
+	if err := file.RateLimits.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: rate_limits: %w", config.ConfigFile, err)
+	}
+	if err := file.Dependencies.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: dependencies: %w", config.ConfigFile, err)
+	}
+	if err := file.Availability.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: availability: %w", config.ConfigFile, err)
+	}
+	// Config files are loaded before interrupts are handled, which end the
+	// process and the plugins with it
+	if err := loadPlugins(context.Background(), file.Plugins, config.ConfigFile); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	if err := loadMixins(file.Mixins, config.ConfigFile); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	if err := file.SyntheticChecks.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: synthetic_checks: %w", config.ConfigFile, err)
+	}
+	if err := file.MultiRegion.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: multi_region: %w", config.ConfigFile, err)
+	}
+	if err := validateTeams(file.Teams, file.TeamRunbooks); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	if err := validateMaintenance(file.Maintenance); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	if err := loadTransforms(file.Transforms); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	if err := file.Time.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: time: %w", config.ConfigFile, err)
+	}
+	if err := file.Titles.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: titles: %w", config.ConfigFile, err)
+	}
+	if err := file.Visibility.validate(); err != nil {
+		return fmt.Errorf("error in config file %s: visibility: %w", config.ConfigFile, err)
+	}
+	if err := validateSummaryLatency(file.SummaryLatency); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	if err := validateInstances(file.Instances); err != nil {
+		return fmt.Errorf("error in config file %s: %w", config.ConfigFile, err)
+	}
+	config.File = file
+	return nil
+}
+
+// fileConfig returns the loaded config file, or an empty one
+func (c *Config) fileConfig() *FileConfig {
+	if c.File == nil {
+		return &FileConfig{}
+	}
+	return c.File
+}
+
+// baseThresholds returns the global thresholds of the config file
+func (c *Config) baseThresholds() ThresholdConfig {
+	return c.fileConfig().Thresholds.Default.apply(defaultThresholds)
+}
+
+// operationThresholds resolves the thresholds of one operation, from least
+// to most specific: built-in defaults, the config file default, the
+// visibility override, the tag override, the x-grafana-thresholds extension
+// and the operation override
+func (c *Config) operationThresholds(op OperationInfo) ThresholdConfig {
+	thresholds := c.visibilityThresholds(op)
+	if override, ok := c.fileConfig().Thresholds.Tags[op.Tag]; ok && op.Tag != "" {
+		thresholds = override.apply(thresholds)
+		slog.Debug("applied threshold override", "operation", op.Key(), "source", "config tag "+op.Tag)
+	}
+
+	if ext, ok := op.Operation.Extensions["x-grafana-thresholds"]; ok {
+		var override ThresholdOverride
+		data, err := json.Marshal(ext)
+		if err == nil {
+			err = json.Unmarshal(data, &override)
+		}
+		if err != nil {
+			slog.Warn("ignoring invalid x-grafana-thresholds", "operation", op.Key(), "error", err)
+		} else {
+			thresholds = override.apply(thresholds)
+			slog.Debug("applied threshold override", "operation", op.Key(), "source", "x-grafana-thresholds")
+		}
+	}
+
+	for _, key := range []string{strings.ToUpper(op.Method) + " " + op.Path, op.Key()} {
+		if override, ok := c.fileConfig().Thresholds.Operations[key]; ok {
+			thresholds = override.apply(thresholds)
+			slog.Debug("applied threshold override", "operation", op.Key(), "source", "config operation "+key)
+		}
+	}
+	return thresholds
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Route is an HTTP method and path as recorded in http_requests_total labels
+type Route struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+func (r Route) String() string {
+	return r.Method + " " + r.Path
+}
+
+// CoverageReport compares the documented routes with the routes serving traffic
+type CoverageReport struct {
+	Window     string `json:"window"`
+	Documented int    `json:"documented"`
+	Serving    int    `json:"serving"`
+	// Undocumented routes receive traffic but are missing from the specs
+	Undocumented []Route `json:"undocumented"`
+	// Unused routes are documented but received no traffic in the window
+	Unused []Route `json:"unused"`
+}
+
+// documentedRoutes lists the routes of every HTTP operation in the specs,
+// sorted and without duplicates
+func documentedRoutes(specs []LoadedSpec) []Route {
+	ops, shared := collectMergedOperations(specs, "path")
+	seen := make(map[Route]bool)
+	var routes []Route
+	for _, op := range append(ops, shared...) {
+		route := Route{Method: strings.ToUpper(op.Method), Path: op.Path}
+		if !seen[route] {
+			seen[route] = true
+			routes = append(routes, route)
+		}
+	}
+	sortRoutes(routes)
+	return routes
+}
+
+func sortRoutes(routes []Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+}
+
+// documentedRoutesExpr builds a constant vector with one series per
+// documented route, so it can be matched against traffic on (method, path)
+func documentedRoutesExpr(routes []Route) string {
+	series := make([]string, len(routes))
+	for i, route := range routes {
+		series[i] = promConstant("method", route.Method, "path", route.Path)
+	}
+	return strings.Join(series, " or ")
+}
+
+// addCoveragePanels appends a "Contract Coverage" row with tables of
+// undocumented routes serving traffic and documented routes receiving none
+// over the dashboard time range
+func addCoveragePanels(dashboard *GrafanaDashboard, routes []Route, scope []string, cursor *panelCursor) {
+	if len(routes) == 0 {
+		return
+	}
+
+	traffic := promSumBy([]string{"method", "path"}, promOverTime("increase", selectorOf("http_requests_total", scope...), "$__range")) + " > 0"
+	documented := documentedRoutesExpr(routes)
+
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Contract Coverage", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	dashboard.Panels = append(dashboard.Panels,
+		createCoverageTablePanel(cursor.ID, "Undocumented Routes Serving Traffic",
+			"Routes receiving requests in the selected time range that are not defined in the spec",
+			fmt.Sprintf("%s unless on (method, path) (%s)", traffic, documented), cursor.Height, cursor.Y),
+		createCoverageTablePanel(cursor.ID+1, "Documented Routes Without Traffic",
+			"Routes defined in the spec that received no requests in the selected time range",
+			fmt.Sprintf("(%s) unless on (method, path) (%s)", documented, traffic), cursor.Height, cursor.Y+cursor.Height),
+	)
+	cursor.ID += 2
+	cursor.Y += 2 * cursor.Height
+}
+
+func createCoverageTablePanel(panelID int, title, description, expr string, height, yPos int) Panel {
+	return Panel{
+		ID:         panelID,
+		Title:      title,
+		Type:       "table",
+		Datasource: map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		GridPos:    GridPos{H: height, W: 12, X: 0, Y: yPos},
+		Targets: []Target{
+			{
+				Expr:    expr,
+				RefID:   "A",
+				Format:  "table",
+				Instant: true,
+			},
+		},
+		FieldConfig: FieldConfig{
+			Defaults: FieldConfigDefaults{
+				Color: ColorOptions{Mode: "thresholds"},
+				Thresholds: ThresholdOptions{
+					Mode: "absolute",
+					Steps: []ThresholdStep{
+						{Color: "green", Value: nil},
+					},
+				},
+			},
+		},
+		Description: description,
+	}
+}
+
+// checkCoverage queries which routes received traffic within window and
+// scope, see Config.liveScope, and compares them with the documented routes
+func checkCoverage(ctx context.Context, client *PrometheusClient, routes []Route, scope []string, window string) (*CoverageReport, error) {
+	samples, err := client.Query(ctx, promSumBy([]string{"method", "path"}, promOverTime("increase", selectorOf("http_requests_total", scope...), window))+" > 0")
+	if err != nil {
+		return nil, err
+	}
+
+	serving := make(map[Route]bool, len(samples))
+	for _, sample := range samples {
+		serving[Route{Method: strings.ToUpper(sample.Labels["method"]), Path: sample.Labels["path"]}] = true
+	}
+	documented := make(map[Route]bool, len(routes))
+	for _, route := range routes {
+		documented[route] = true
+	}
+
+	report := &CoverageReport{
+		Window:       window,
+		Documented:   len(routes),
+		Serving:      len(serving),
+		Undocumented: []Route{},
+		Unused:       []Route{},
+	}
+	for route := range serving {
+		if !documented[route] {
+			report.Undocumented = append(report.Undocumented, route)
+		}
+	}
+	for _, route := range routes {
+		if !serving[route] {
+			report.Unused = append(report.Unused, route)
+		}
+	}
+	sortRoutes(report.Undocumented)
+	return report, nil
+}
+
+// runCoverage implements the `coverage` subcommand
+func runCoverage(args []string) error {
+	var sources []string
+	prometheusURL := os.Getenv("PROMETHEUS_URL")
+	window := "7d"
+	asJSON := false
+	// The scope flags of generation: --extra-selector and the config file
+	config := defaultConfig()
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		case "--prometheus-url", "--window", "--extra-selector", "--config":
+			if i+1 >= len(args) {
+				return fmt.Errorf("missing value for %s", args[i])
+			}
+			switch args[i] {
+			case "--window":
+				window = args[i+1]
+			case "--extra-selector":
+				config.ExtraSelector = args[i+1]
+			case "--config":
+				config.ConfigFile = args[i+1]
+			default:
+				prometheusURL = args[i+1]
+			}
+			i++
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				return fmt.Errorf("unknown flag %q", args[i])
+			}
+			sources = append(sources, args[i])
+		}
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no spec given")
+	}
+	if prometheusURL == "" {
+		return fmt.Errorf("coverage requires --prometheus-url or PROMETHEUS_URL")
+	}
+	if _, err := parseExtraSelector(config.ExtraSelector); err != nil {
+		return fmt.Errorf("invalid --extra-selector: %w", err)
+	}
+	if err := loadFileConfig(config); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	specs, err := loadSpecs(ctx, NewSpecFetcher(""), sources)
+	if err != nil {
+		return err
+	}
+	report, err := checkCoverage(ctx, NewPrometheusClient(prometheusURL), documentedRoutes(specs), config.liveScope(), window)
+	if err != nil {
+		return fmt.Errorf("error checking coverage: %w", err)
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling coverage report: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Documented routes: %d, serving traffic in the last %s: %d\n", report.Documented, report.Window, report.Serving)
+	fmt.Printf("Undocumented routes serving traffic (%d):\n", len(report.Undocumented))
+	for _, route := range report.Undocumented {
+		fmt.Printf("  - %s\n", route)
+	}
+	fmt.Printf("Documented routes without traffic (%d):\n", len(report.Unused))
+	for _, route := range report.Unused {
+		fmt.Printf("  - %s\n", route)
+	}
+	return nil
+}
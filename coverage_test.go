@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// fakePrometheus answers instant queries with a fixed vector, recording the
+// queries it receives
+type fakePrometheus struct {
+	*httptest.Server
+	mu      sync.Mutex
+	queries []string
+}
+
+func newFakePrometheus(t *testing.T, result []map[string]interface{}) *fakePrometheus {
+	t.Helper()
+	prometheus := &fakePrometheus{}
+	prometheus.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prometheus.mu.Lock()
+		prometheus.queries = append(prometheus.queries, r.FormValue("query"))
+		prometheus.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"resultType": "vector", "result": result},
+		})
+	}))
+	t.Cleanup(prometheus.Close)
+	return prometheus
+}
+
+// lastQuery returns the last query received
+func (p *fakePrometheus) lastQuery() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queries) == 0 {
+		return ""
+	}
+	return p.queries[len(p.queries)-1]
+}
+
+// promSample is a series of a fake Prometheus result
+func promSample(value string, labels ...string) map[string]interface{} {
+	metric := make(map[string]string)
+	for i := 0; i+1 < len(labels); i += 2 {
+		metric[labels[i]] = labels[i+1]
+	}
+	return map[string]interface{}{"metric": metric, "value": []interface{}{1700000000, value}}
+}
+
+func TestDocumentedRoutes(t *testing.T) {
+	routes := documentedRoutes([]LoadedSpec{loadTestSpec(t, "orders.yaml", ordersSpec), loadTestSpec(t, "users.yaml", usersSpec)})
+	want := []Route{{"GET", "/healthz"}, {"GET", "/orders"}, {"GET", "/users"}}
+	if !slices.Equal(routes, want) {
+		t.Errorf("routes = %v, want %v", routes, want)
+	}
+}
+
+func TestCheckCoverage(t *testing.T) {
+	prometheus := newFakePrometheus(t, []map[string]interface{}{
+		promSample("12", "method", "get", "path", "/orders"),
+		promSample("3", "method", "DELETE", "path", "/orders/{id}"),
+		promSample("1", "method", "GET", "path", "/debug/pprof"),
+	})
+	routes := []Route{{"GET", "/healthz"}, {"GET", "/orders"}}
+
+	report, err := checkCoverage(context.Background(), NewPrometheusClient(prometheus.URL), routes, []string{`namespace="shop"`}, "1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prometheus.lastQuery(), `sum by (method, path) (increase(http_requests_total{namespace="shop"}[1d])) > 0`; got != want {
+		t.Errorf("query = %s, want %s", got, want)
+	}
+	if report.Documented != 2 || report.Serving != 3 || report.Window != "1d" {
+		t.Errorf("report = %+v", report)
+	}
+	if want := []Route{{"GET", "/debug/pprof"}, {"DELETE", "/orders/{id}"}}; !slices.Equal(report.Undocumented, want) {
+		t.Errorf("undocumented = %v, want %v", report.Undocumented, want)
+	}
+	if want := []Route{{"GET", "/healthz"}}; !slices.Equal(report.Unused, want) {
+		t.Errorf("unused = %v, want %v", report.Unused, want)
+	}
+}
+
+func TestRunCoverageFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no spec", []string{"--prometheus-url", "http://localhost:9090"}, "no spec given"},
+		{"missing value", []string{"spec.yaml", "--window"}, "missing value for --window"},
+		{"unknown flag", []string{"spec.yaml", "--verbose"}, `unknown flag "--verbose"`},
+		{"invalid selector", []string{"spec.yaml", "--prometheus-url", "http://localhost:9090", "--extra-selector", "tenant"}, `invalid --extra-selector: invalid label matcher "tenant"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runCoverage(tt.args); err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunCoverageScope checks the report is scoped like the generated
+// queries, leaving out the matchers of dashboard variables
+func TestRunCoverageScope(t *testing.T) {
+	prometheus := newFakePrometheus(t, nil)
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte(`extra_selector: cluster="eu-1"`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"testdata/specs/small.yaml", "--prometheus-url", prometheus.URL, "--extra-selector", `namespace="shop", env=~"$env"`, "--config", config, "--json"}
+	if err := runCoverage(args); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prometheus.lastQuery(), `sum by (method, path) (increase(http_requests_total{namespace="shop", cluster="eu-1"}[7d])) > 0`; got != want {
+		t.Errorf("query = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// prometheusDataSourceType is the data source type the generated queries
+// are written for
+const prometheusDataSourceType = "prometheus"
+
+// GrafanaDataSource is a data source of a Grafana instance
+type GrafanaDataSource struct {
+	UID       string `json:"uid"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	IsDefault bool   `json:"isDefault"`
+}
+
+// DataSources lists the data sources of the Grafana instance
+func (c *GrafanaClient) DataSources(ctx context.Context) ([]GrafanaDataSource, error) {
+	var sources []GrafanaDataSource
+	if err := c.do(ctx, http.MethodGet, "/api/datasources", nil, &sources); err != nil {
+		return nil, fmt.Errorf("error listing data sources: %w", err)
+	}
+	return sources, nil
+}
+
+// resolveDataSource finds the data source --datasource refers to, by name
+// or UID, or by type: the default data source of the type, or the only one
+func resolveDataSource(sources []GrafanaDataSource, ref string) (GrafanaDataSource, error) {
+	for _, source := range sources {
+		if source.Name == ref || source.UID == ref {
+			if source.Type != prometheusDataSourceType {
+				slog.Warn("data source is not a Prometheus data source, the generated queries may not work", "datasource", source.Name, "type", source.Type)
+			}
+			return source, nil
+		}
+	}
+
+	var matches []GrafanaDataSource
+	for _, source := range sources {
+		if source.Type == ref {
+			if source.IsDefault {
+				return source, nil
+			}
+			matches = append(matches, source)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+
+	err := &DataSourceError{Ref: ref}
+	for _, source := range sources {
+		if source.Type == prometheusDataSourceType {
+			err.Available = append(err.Available, source.Name)
+		}
+	}
+	if len(matches) > 1 {
+		err.Ambiguous = true
+	}
+	return GrafanaDataSource{}, err
+}
+
+// setDataSource points the data source variable, and the query variables
+// using the data source, at a resolved data source
+func setDataSource(dashboard *GrafanaDashboard, ref string, source GrafanaDataSource) {
+	for i := range dashboard.Templating.List {
+		variable := &dashboard.Templating.List[i]
+		switch {
+		case variable.Type == "datasource":
+			variable.Current = Current{Text: source.Name, Value: source.UID}
+			variable.Options = []Option{{Text: source.Name, Value: source.UID, Selected: true}}
+		case variable.Datasource == ref:
+			variable.Datasource = map[string]string{"type": source.Type, "uid": source.UID}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Kinds of downstream dependencies of x-dependencies
+const (
+	dependencyHTTP = "http"
+	dependencyGRPC = "grpc"
+)
+
+// DependencyMetrics names the client metrics of one kind of dependency
+type DependencyMetrics struct {
+	// RequestsMetric counts the calls, DurationMetric is their histogram
+	RequestsMetric string `yaml:"requests_metric"`
+	DurationMetric string `yaml:"duration_metric"`
+	// NameLabel carries the dependency name
+	NameLabel string `yaml:"name_label"`
+	// ErrorMatcher selects the failed calls
+	ErrorMatcher string `yaml:"error_matcher"`
+}
+
+// DependenciesConfig names the client metrics of dependency panels, in the
+// dependencies section of the config file
+type DependenciesConfig struct {
+	HTTP DependencyMetrics `yaml:"http"`
+	GRPC DependencyMetrics `yaml:"grpc"`
+}
+
+// defaultDependencyMetrics are the Micrometer HTTP client and go-grpc
+// client metrics
+var defaultDependencyMetrics = map[string]DependencyMetrics{
+	dependencyHTTP: {
+		RequestsMetric: "http_client_requests_seconds_count",
+		DurationMetric: "http_client_requests_seconds",
+		NameLabel:      "client_name",
+		ErrorMatcher:   `outcome!="SUCCESS"`,
+	},
+	dependencyGRPC: {
+		RequestsMetric: "grpc_client_handled_total",
+		DurationMetric: "grpc_client_handling_seconds",
+		NameLabel:      "grpc_service",
+		ErrorMatcher:   `grpc_code!="OK"`,
+	},
+}
+
+// metrics returns the metrics of a kind of dependency, defaults filled in
+func (c DependenciesConfig) metrics(kind string) DependencyMetrics {
+	metrics := c.HTTP
+	if kind == dependencyGRPC {
+		metrics = c.GRPC
+	}
+	defaults := defaultDependencyMetrics[kind]
+	for _, field := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&metrics.RequestsMetric, defaults.RequestsMetric},
+		{&metrics.DurationMetric, defaults.DurationMetric},
+		{&metrics.NameLabel, defaults.NameLabel},
+		{&metrics.ErrorMatcher, defaults.ErrorMatcher},
+	} {
+		if *field.value == "" {
+			*field.value = field.fallback
+		}
+	}
+	return metrics
+}
+
+func (c DependenciesConfig) validate() error {
+	for kind, metrics := range map[string]DependencyMetrics{dependencyHTTP: c.HTTP, dependencyGRPC: c.GRPC} {
+		if metrics.ErrorMatcher == "" {
+			continue
+		}
+		if _, err := parseExtraSelector(metrics.ErrorMatcher); err != nil {
+			return fmt.Errorf("%s.error_matcher: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// Dependency is a downstream service or datastore an operation calls
+type Dependency struct {
+	Name string
+	// Kind is http (the default) or grpc
+	Kind string
+}
+
+// operationDependencies reads the x-dependencies extension of an operation:
+// a list of names, or of objects with a name and a type
+func operationDependencies(op OperationInfo) []Dependency {
+	ext, ok := op.Operation.Extensions["x-dependencies"]
+	if !ok {
+		return nil
+	}
+	items, ok := ext.([]interface{})
+	if !ok {
+		slog.Warn("ignoring invalid x-dependencies, must be a list", "operation", op.Key())
+		return nil
+	}
+	var dependencies []Dependency
+	for _, item := range items {
+		dependency := Dependency{Kind: dependencyHTTP}
+		switch value := item.(type) {
+		case string:
+			dependency.Name = value
+		case map[string]interface{}:
+			dependency.Name, _ = value["name"].(string)
+			if kind, _ := value["type"].(string); kind != "" {
+				dependency.Kind = strings.ToLower(kind)
+			}
+		}
+		if dependency.Name == "" || (dependency.Kind != dependencyHTTP && dependency.Kind != dependencyGRPC) {
+			slog.Warn("ignoring invalid x-dependencies entry", "operation", op.Key(), "entry", item)
+			continue
+		}
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies
+}
+
+// createDependencyPanels shows the call rate, error rate and latency of the
+// calls to one dependency of an operation
+func createDependencyPanels(title string, dependency Dependency, config DependenciesConfig, scope []string, panelID, height, yPos int) []Panel {
+	metrics := config.metrics(dependency.Kind)
+	title = fmt.Sprintf("%s → %s", title, dependency.Name)
+	calls := selectorOf(metrics.RequestsMetric).eq(metrics.NameLabel, dependency.Name).with(scope...)
+	latency := selectorOf(metrics.DurationMetric).eq(metrics.NameLabel, dependency.Name).with(scope...)
+
+	return []Panel{
+		createStreamingPanel(panelID, title+" - Call Rate", "Calls per second to "+dependency.Name, "reqps", height, yPos, []Target{
+			{
+				Expr:         promSum(promRate(calls)),
+				LegendFormat: dependency.Name,
+				RefID:        "A",
+			},
+		}),
+		createStreamingPanel(panelID+1, title+" - Call Errors", "Percentage of failed calls to "+dependency.Name, "percent", height, yPos+height, []Target{
+			{
+				Expr:         promPercent(promSum(promRate(calls.with(metrics.ErrorMatcher))), promSum(promRate(calls))),
+				LegendFormat: "Errors",
+				RefID:        "A",
+			},
+		}),
+		createStreamingPanel(panelID+2, title+" - Call Latency", "Latency of the calls to "+dependency.Name, metricUnit(metrics.DurationMetric), height, yPos+2*height, []Target{
+			{
+				Expr:         promHistogramQuantile("0.99", latency),
+				LegendFormat: "p99",
+				RefID:        "A",
+			},
+			{
+				Expr:         promHistogramQuantile("0.50", latency),
+				LegendFormat: "p50",
+				RefID:        "B",
+			},
+		}),
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitDeprecated separates deprecated operations from the rest
+func splitDeprecated(ops []OperationInfo) (current, deprecated []OperationInfo) {
+	for _, op := range ops {
+		if op.Operation != nil && op.Operation.Deprecated {
+			deprecated = append(deprecated, op)
+		} else {
+			current = append(current, op)
+		}
+	}
+	return current, deprecated
+}
+
+// addDeprecatedPanels appends a "Deprecated Endpoints" row tracking the
+// traffic still reaching deprecated operations, which get no panel set of
+// their own, to follow up on deprecation campaigns
+func addDeprecatedPanels(dashboard *GrafanaDashboard, ops []OperationInfo, config *Config, cursor *panelCursor) {
+	if len(ops) == 0 {
+		return
+	}
+
+	seen := make(map[Route]bool, len(ops))
+	var routes []Route
+	for _, op := range ops {
+		route := Route{Method: strings.ToUpper(op.Method), Path: op.Path}
+		if !seen[route] {
+			seen[route] = true
+			routes = append(routes, route)
+		}
+	}
+	sortRoutes(routes)
+	deprecated := documentedRoutesExpr(routes)
+
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Deprecated Endpoints", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	requests := selectorOf("http_requests_total", config.queryScope()...)
+	rate := createRequestRatePanel("Deprecated Endpoints", operationMatch{}, cursor.ID, cursor.Height, cursor.Y)
+	rate.Targets = []Target{
+		{
+			Expr:         fmt.Sprintf(`%s and on (method, path) (%s)`, promSumBy([]string{"method", "path"}, promRate(requests)), deprecated),
+			LegendFormat: "{{method}} {{path}}",
+			RefID:        "A",
+		},
+	}
+	rate.GridPos.W = 24
+	rate.FieldConfig.Overrides = append(rate.FieldConfig.Overrides, config.operationLegendOverrides(ops)...)
+	rate.Description = fmt.Sprintf("Request rate per deprecated operation (%d deprecated)", len(routes))
+
+	table := createCoverageTablePanel(cursor.ID+1, "Deprecated Endpoints Still Receiving Traffic",
+		"Deprecated operations that received requests in the selected time range",
+		fmt.Sprintf(`(%s > 0) and on (method, path) (%s)`, promSumBy([]string{"method", "path"}, promOverTime("increase", requests, "$__range")), deprecated),
+		cursor.Height, cursor.Y+cursor.Height)
+	table.GridPos.W = 24
+
+	dashboard.Panels = append(dashboard.Panels, rate, table)
+	cursor.ID += 2
+	cursor.Y += 2 * cursor.Height
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// addDriftPanels appends a "Spec Drift" row with a table of every path
+// label value of http_requests_total receiving traffic in the dashboard time
+// range, marked documented or undocumented against the paths of the specs
+func addDriftPanels(dashboard *GrafanaDashboard, routes []Route, scope []string, cursor *panelCursor) {
+	if len(routes) == 0 {
+		return
+	}
+
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Spec Drift", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	dashboard.Panels = append(dashboard.Panels, createDriftPanel(cursor.ID, routes, scope, cursor.Height, cursor.Y))
+	cursor.ID++
+	cursor.Y += cursor.Height
+}
+
+// documentedPathsExpr builds a constant vector with one series per
+// documented path, so it can be matched against traffic on path
+func documentedPathsExpr(routes []Route) string {
+	seen := make(map[string]bool)
+	var series []string
+	for _, route := range routes {
+		if seen[route.Path] {
+			continue
+		}
+		seen[route.Path] = true
+		series = append(series, promConstant("path", route.Path))
+	}
+	return strings.Join(series, " or ")
+}
+
+// createDriftPanel builds the drift table: the requests per path label value
+// with a status column, undocumented paths highlighted in red
+func createDriftPanel(panelID int, routes []Route, scope []string, height, yPos int) Panel {
+	traffic := promSumBy([]string{"path"}, promOverTime("increase", selectorOf("http_requests_total", scope...), "$__range")) + " > 0"
+	documented := documentedPathsExpr(routes)
+	expr := fmt.Sprintf(`label_replace(%s unless on (path) (%s), "status", "undocumented", "", "") or label_replace(%s and on (path) (%s), "status", "documented", "", "")`,
+		traffic, documented, traffic, documented)
+
+	panel := createCoverageTablePanel(panelID, "Paths Serving Traffic",
+		"Paths receiving requests in the selected time range, compared with the paths defined in the spec; undocumented paths are highlighted",
+		expr, height, yPos)
+	panel.Transformations = []Transformation{
+		{
+			ID: "organize",
+			Options: map[string]interface{}{
+				"excludeByName": map[string]bool{"Time": true},
+				"indexByName":   map[string]int{"path": 0, "status": 1, "Value": 2},
+				"renameByName":  map[string]string{"path": "Path", "status": "Status", "Value": "Requests"},
+			},
+		},
+	}
+	panel.FieldConfig.Overrides = []FieldOverride{
+		{
+			Matcher: FieldMatcher{ID: "byName", Options: "Status"},
+			Properties: []FieldProperty{
+				{ID: "custom.cellOptions", Value: map[string]string{"type": "color-background"}},
+				{ID: "mappings", Value: []map[string]interface{}{
+					{
+						"type": "value",
+						"options": map[string]interface{}{
+							"documented":   map[string]interface{}{"color": "green", "index": 0, "text": "Documented"},
+							"undocumented": map[string]interface{}{"color": "red", "index": 1, "text": "Undocumented"},
+						},
+					},
+				}},
+			},
+		},
+	}
+	return panel
+}
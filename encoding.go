@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output encodings selected with --output-encoding (or --output-format);
+// grafana-operator writes dashboards as GrafanaDashboard resources in YAML
+const (
+	outputEncodingJSON     = "json"
+	outputEncodingYAML     = "yaml"
+	outputEncodingOperator = "grafana-operator"
+)
+
+// Resource of the grafana-operator dashboards are wrapped in
+const (
+	operatorAPIVersion    = "grafana.integreatly.org/v1beta1"
+	operatorDashboardKind = "GrafanaDashboard"
+)
+
+// operatorInstanceLabel selects the Grafana instances of the operator a
+// dashboard resource is applied to, as in the operator's examples
+var operatorInstanceLabel = map[string]string{"dashboards": "grafana"}
+
+// OperatorDashboard is a grafana-operator GrafanaDashboard resource carrying
+// a generated dashboard as JSON
+type OperatorDashboard struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Metadata   OperatorMetadata      `json:"metadata"`
+	Spec       OperatorDashboardSpec `json:"spec"`
+}
+
+type OperatorMetadata struct {
+	Name string `json:"name"`
+}
+
+type OperatorDashboardSpec struct {
+	InstanceSelector OperatorLabelSelector `json:"instanceSelector"`
+	JSON             string                `json:"json"`
+}
+
+type OperatorLabelSelector struct {
+	MatchLabels map[string]string `json:"matchLabels"`
+}
+
+// operatorDashboard wraps a dashboard in a GrafanaDashboard resource named
+// after its UID
+func operatorDashboard(dashboard GrafanaDashboard) (OperatorDashboard, error) {
+	data, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return OperatorDashboard{}, err
+	}
+	return OperatorDashboard{
+		APIVersion: operatorAPIVersion,
+		Kind:       operatorDashboardKind,
+		Metadata:   OperatorMetadata{Name: slugify(dashboard.UID)},
+		Spec: OperatorDashboardSpec{
+			InstanceSelector: OperatorLabelSelector{MatchLabels: operatorInstanceLabel},
+			JSON:             string(data) + "\n",
+		},
+	}, nil
+}
+
+// encodeOutput marshals a generated object in the requested encoding. YAML
+// is converted from the JSON form so json tags and field order are kept;
+// map keys are sorted, so diffs between runs stay minimal.
+func encodeOutput(ctx context.Context, v interface{}, encoding string) ([]byte, error) {
+	if plugin := pluginOutputEncodings[encoding]; plugin != nil {
+		return pluginEncode(ctx, plugin, v, encoding)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil || encoding == outputEncodingJSON {
+		return data, err
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	resetYAMLStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// streamBatchSize is the number of panels writeDashboardJSON marshals at once
+const streamBatchSize = 256
+
+// marshaled is the JSON encoding of one value
+type marshaled struct {
+	data []byte
+	err  error
+}
+
+// writeDashboardJSON writes a dashboard as indented JSON like encodeOutput,
+// marshaling its panels one at a time rather than the whole dashboard into
+// a single buffer
+func writeDashboardJSON(w io.Writer, dashboard GrafanaDashboard) error {
+	if len(dashboard.transforms) > 0 {
+		// Transforms need the whole document
+		data, err := json.MarshalIndent(dashboard, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	panels := dashboard.Panels
+	dashboard.Panels = nil
+	data, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return err
+	}
+	head, tail, ok := bytes.Cut(data, []byte(`"panels": null`))
+	if !ok {
+		return fmt.Errorf("panels missing from the marshaled dashboard")
+	}
+
+	out := bufio.NewWriter(w)
+	out.Write(head)
+	if len(panels) == 0 {
+		out.WriteString(`"panels": []`)
+	} else {
+		out.WriteString("\"panels\": [\n")
+		// Batches of panels are marshaled concurrently, bounding the memory
+		// held by encoded panels
+		for start := 0; start < len(panels); start += streamBatchSize {
+			batch := panels[start:min(start+streamBatchSize, len(panels))]
+			encoded := buildConcurrently(batch, func(panel Panel) marshaled {
+				data, err := json.MarshalIndent(panel, "    ", "  ")
+				return marshaled{data, err}
+			})
+			for i, panel := range encoded {
+				if panel.err != nil {
+					return panel.err
+				}
+				out.WriteString("    ")
+				out.Write(panel.data)
+				if start+i < len(panels)-1 {
+					out.WriteString(",")
+				}
+				out.WriteString("\n")
+			}
+		}
+		out.WriteString("  ]")
+	}
+	out.Write(tail)
+	return out.Flush()
+}
+
+// resetYAMLStyle drops the flow and quoting styles carried over from JSON so
+// the output is block-style YAML; strings that need quoting stay quoted
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
+
+// decodeDashboard reads a previously generated dashboard, unwrapping it
+// from a GrafanaDashboard resource
+func decodeDashboard(data []byte, dashboard *GrafanaDashboard) error {
+	var resource OperatorDashboard
+	if err := decodeOutput(data, &resource); err == nil && resource.Kind == operatorDashboardKind {
+		return json.Unmarshal([]byte(resource.Spec.JSON), dashboard)
+	}
+	return decodeOutput(data, dashboard)
+}
+
+// decodeOutput reads a previously generated JSON or YAML object
+func decodeOutput(data []byte, v interface{}) error {
+	if json.Valid(data) {
+		return json.Unmarshal(data, v)
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	converted, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("unsupported YAML content: %w", err)
+	}
+	return json.Unmarshal(converted, v)
+}
+
+// outputExtension returns the file extension for an encoding
+func outputExtension(encoding string) string {
+	if extension := pluginExtensions[encoding]; extension != "" {
+		return extension
+	}
+	if encoding == outputEncodingYAML || encoding == outputEncodingOperator {
+		return ".yaml"
+	}
+	return ".json"
+}
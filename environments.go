@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// EnvironmentOption is one value of the environment variable
+type EnvironmentOption struct {
+	Text  string
+	Value string
+}
+
+// defaultEnvironments are used when neither --environments nor the specs
+// name any environment
+var defaultEnvironments = []EnvironmentOption{
+	{Text: "Production", Value: "prod"},
+	{Text: "Staging", Value: "stage"},
+	{Text: "Development", Value: "dev"},
+}
+
+// parseEnvironments parses --environments: comma-separated label values,
+// optionally with a display name as "Name=value"
+func parseEnvironments(value string) []EnvironmentOption {
+	var options []EnvironmentOption
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		option := EnvironmentOption{Text: entry, Value: entry}
+		if text, value, ok := strings.Cut(entry, "="); ok {
+			option = EnvironmentOption{Text: strings.TrimSpace(text), Value: strings.TrimSpace(value)}
+		}
+		options = append(options, option)
+	}
+	return options
+}
+
+// specEnvironments derives environments from the servers of every spec. A
+// server's x-environment extension gives the label value; otherwise it is
+// the slugified description, or the server host.
+func specEnvironments(specs []LoadedSpec) []EnvironmentOption {
+	seen := make(map[string]bool)
+	var options []EnvironmentOption
+	for _, spec := range specs {
+		if spec.Doc == nil {
+			continue
+		}
+		for _, server := range spec.Doc.Servers {
+			option := EnvironmentOption{Text: server.Description}
+			if env, ok := server.Extensions["x-environment"].(string); ok && env != "" {
+				option.Value = env
+			} else if server.Description != "" {
+				option.Value = slugify(server.Description)
+			} else if u, err := url.Parse(server.URL); err == nil && u.Hostname() != "" {
+				option.Value = u.Hostname()
+			} else {
+				continue
+			}
+			if option.Text == "" {
+				option.Text = option.Value
+			}
+			if !seen[option.Value] {
+				seen[option.Value] = true
+				options = append(options, option)
+			}
+		}
+	}
+	return options
+}
+
+// environmentOptions returns the environments of the dashboard: the
+// --environments flag, the spec servers or the defaults, in that order
+func (c *Config) environmentOptions(specs []LoadedSpec) []EnvironmentOption {
+	if len(c.Environments) > 0 {
+		return c.Environments
+	}
+	if options := specEnvironments(specs); len(options) > 0 {
+		return options
+	}
+	return defaultEnvironments
+}
+
+// createEnvironmentVariable builds the multi-value environment variable
+func createEnvironmentVariable(environments []EnvironmentOption) Variable {
+	options := []Option{{Text: "All", Value: "$__all", Selected: true}}
+	query := make([]string, len(environments))
+	for i, env := range environments {
+		options = append(options, Option{Text: env.Text, Value: env.Value})
+		query[i] = env.Text + " : " + env.Value
+	}
+	return Variable{
+		Name:       "environment",
+		Label:      "Environment",
+		Type:       "custom",
+		Query:      strings.Join(query, ","),
+		Current:    Current{Text: "All", Value: "$__all"},
+		Options:    options,
+		IncludeAll: true,
+		AllValue:   ".*",
+		Multi:      true,
+		Refresh:    0,
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SpecLoadError reports a spec that could not be read, fetched or parsed
+type SpecLoadError struct {
+	Source string
+	// Op describes the failed step, e.g. "fetching OpenAPI spec"
+	Op string
+	// StatusCode is the HTTP status of a failed remote fetch, 0 otherwise
+	StatusCode int
+	Err        error
+}
+
+func (e *SpecLoadError) Error() string {
+	return fmt.Sprintf("error %s %s: %v", e.Op, e.Source, e.Err)
+}
+
+func (e *SpecLoadError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedFeatureError reports input relying on something the generator
+// does not support, such as an unknown panel factory or broker preset
+type UnsupportedFeatureError struct {
+	Feature string
+	Value   string
+}
+
+func (e *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("unsupported %s %q", e.Feature, e.Value)
+}
+
+// PushError reports a failed Grafana API request
+type PushError struct {
+	Method string
+	Path   string
+	// StatusCode is the HTTP status returned by Grafana, 0 when no response was received
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+func (e *PushError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("grafana request failed: %v", e.Err)
+	}
+	return fmt.Sprintf("grafana %s %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+func (e *PushError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError reports a generated dashboard that failed validation
+type ValidationError struct {
+	UID    string
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		messages[i] = issue.Path + ": " + issue.Message
+	}
+	return fmt.Sprintf("dashboard %s failed validation: %s", e.UID, strings.Join(messages, "; "))
+}
+
+// ConfigError reports invalid flags or an invalid config file
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// OverwriteError reports a dashboard in Grafana that was not generated by
+// this tool and would be overwritten by a push
+type OverwriteError struct {
+	UID   string
+	Title string
+}
+
+func (e *OverwriteError) Error() string {
+	return fmt.Sprintf("dashboard %s (%q) in Grafana was not generated by openapi2grafana, refusing to overwrite it without --force", e.UID, e.Title)
+}
+
+// DataSourceError reports a --datasource Grafana has no data source for,
+// or several of its type and none marked default
+type DataSourceError struct {
+	Ref string
+	// Available lists the Prometheus data sources of the instance
+	Available []string
+	Ambiguous bool
+}
+
+func (e *DataSourceError) Error() string {
+	if e.Ambiguous {
+		return fmt.Sprintf("data source %q matches several data sources and none is the default, name one of: %s", e.Ref, strings.Join(e.Available, ", "))
+	}
+	if len(e.Available) == 0 {
+		return fmt.Sprintf("data source %q not found, Grafana has no Prometheus data source", e.Ref)
+	}
+	return fmt.Sprintf("data source %q not found, available Prometheus data sources: %s", e.Ref, strings.Join(e.Available, ", "))
+}
+
+// fetchStatusError is an unexpected HTTP status while fetching a spec
+type fetchStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *fetchStatusError) Error() string {
+	return "unexpected status " + e.Status
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// errorCodePattern matches the documented error responses of an operation,
+// exact codes or ranges such as 4XX
+var errorCodePattern = regexp.MustCompile(`^[45]([0-9]{2}|XX)$`)
+
+// declaredErrorCodes returns the error responses an operation documents as
+// status_code regex alternatives, e.g. 404 or 4.. for 4XX: the client error
+// ones and all of them, sorted
+func declaredErrorCodes(op OperationInfo) (client, all []string) {
+	if op.Operation.Responses == nil {
+		return nil, nil
+	}
+	for code := range op.Operation.Responses.Map() {
+		code = strings.ToUpper(code)
+		if !errorCodePattern.MatchString(code) {
+			continue
+		}
+		code = strings.ReplaceAll(code, "X", ".")
+		all = append(all, code)
+		if code[0] == '4' {
+			client = append(client, code)
+		}
+	}
+	sort.Strings(client)
+	sort.Strings(all)
+	return client, all
+}
+
+// createExpectedErrorPanels splits the errors of an operation by whether the
+// spec documents them: the share of responses with an undocumented 4xx or
+// 5xx code, and the rate of the documented client errors by code, such as
+// the 404s of a lookup endpoint
+func createExpectedErrorPanels(title string, match operationMatch, client, all []string, thresholds ThresholdConfig, panelID, height, yPos int) []Panel {
+	requests := match.selector("http_requests_total")
+	unexpected := createStreamingPanel(panelID, title+" - Unexpected Error Rate",
+		"Share of responses with a 4xx or 5xx code the spec does not document ("+strings.Join(all, ", ")+" are documented)",
+		"percent", height, yPos, []Target{
+			{
+				Expr:         promPercent("("+promSum(promRate(requests.regex("status_code", "[45]..").notRegex("status_code", strings.Join(all, "|"))))+" or vector(0))", promSum(promRate(requests))),
+				LegendFormat: "Unexpected",
+				RefID:        "A",
+			},
+		})
+	unexpected.FieldConfig.Defaults.Min = floatPtr(0)
+	unexpected.FieldConfig.Defaults.Thresholds.Steps = []ThresholdStep{
+		{Color: "green", Value: nil},
+		{Color: "yellow", Value: floatPtr(thresholds.ErrorWarning)},
+		{Color: "red", Value: floatPtr(thresholds.ErrorCritical)},
+	}
+	panels := []Panel{unexpected}
+	if len(client) == 0 {
+		return panels
+	}
+
+	return append(panels, createStreamingPanel(panelID+1, title+" - Expected Client Errors",
+		"Rate of the client errors the spec documents, by status code",
+		metricUnit("http_requests_total"), height, yPos+height, []Target{
+			{
+				Expr:         promSum(promRate(requests.regex("status_code", strings.Join(client, "|"))), "status_code"),
+				LegendFormat: "{{status_code}}",
+				RefID:        "A",
+			},
+		}))
+}
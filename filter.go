@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// regexPatternPrefix marks a filter pattern as a regular expression instead of a glob
+const regexPatternPrefix = "re:"
+
+// OperationFilter selects the HTTP operations that get panels. Patterns are
+// globs where * matches any characters, including /, or regular expressions
+// when prefixed with "re:"; both must match the whole path or tag.
+type OperationFilter struct {
+	IncludePaths      []string
+	ExcludePaths      []string
+	IncludeTags       []string
+	ExcludeTags       []string
+	ExcludeDeprecated bool
+	// ExcludeInternal leaves out the operations marked internal, set by
+	// --public
+	ExcludeInternal bool
+}
+
+// compileFilterPattern turns a glob or re: pattern into an anchored regexp
+func compileFilterPattern(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, regexPatternPrefix); ok {
+		return regexp.Compile("^(?:" + expr + ")$")
+	}
+	var expr strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return regexp.Compile("^" + expr.String() + "$")
+}
+
+// validate reports the first pattern that does not compile
+func (f OperationFilter) validate() error {
+	for _, patterns := range [][]string{f.IncludePaths, f.ExcludePaths, f.IncludeTags, f.ExcludeTags} {
+		for _, pattern := range patterns {
+			if _, err := compileFilterPattern(pattern); err != nil {
+				return fmt.Errorf("invalid filter pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether any pattern matches any of the values
+func matchAny(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		re, err := compileFilterPattern(pattern)
+		if err != nil {
+			// Rejected by validateConfig
+			continue
+		}
+		for _, value := range values {
+			if re.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Match reports whether an operation passes the filter. An operation is
+// matched by tag if any of its tags matches.
+func (f OperationFilter) Match(op OperationInfo) bool {
+	return f.rejection(op) == ""
+}
+
+// rejection returns the flag filtering an operation out, "" if it passes
+func (f OperationFilter) rejection(op OperationInfo) string {
+	var tags []string
+	deprecated := false
+	if op.Operation != nil {
+		tags = op.Operation.Tags
+		deprecated = op.Operation.Deprecated
+	}
+
+	switch {
+	case f.ExcludeDeprecated && deprecated:
+		return "--exclude-deprecated"
+	case f.ExcludeInternal && internalOperation(op):
+		return "--public"
+	case len(f.IncludePaths) > 0 && !matchAny(f.IncludePaths, op.Path):
+		return "--include-paths"
+	case matchAny(f.ExcludePaths, op.Path):
+		return "--exclude-paths"
+	case len(f.IncludeTags) > 0 && !matchAny(f.IncludeTags, tags...):
+		return "--include-tags"
+	case matchAny(f.ExcludeTags, tags...):
+		return "--exclude-tags"
+	}
+	return ""
+}
+
+// internalOperation reports whether an operation is marked x-internal: true
+// or x-visibility: internal, not to be shown outside the organization
+func internalOperation(op OperationInfo) bool {
+	return operationVisibility(op) == visibilityInternal
+}
+
+// filterOperations returns the operations passing the filter
+func filterOperations(ops []OperationInfo, filter OperationFilter) []OperationInfo {
+	var kept []OperationInfo
+	for _, op := range ops {
+		if reason := filter.rejection(op); reason != "" {
+			slog.Debug("skipping operation", "operation", op.Key(), "reason", reason)
+			continue
+		}
+		kept = append(kept, op)
+	}
+	return kept
+}
+
+// selectedOperations collects the operations of the specs that pass the
+// configured filters, see collectMergedOperations
+func (c *Config) selectedOperations(specs []LoadedSpec, sortOrder string) (ops []OperationInfo, shared []OperationInfo) {
+	ops, shared = collectMergedOperations(specs, sortOrder)
+	return filterOperations(ops, c.Filter), filterOperations(shared, c.Filter)
+}
+
+// appendPatterns adds the comma-separated patterns of a filter flag
+func appendPatterns(patterns []string, value string) []string {
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
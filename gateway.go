@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// gatewayExtension marks grpc-gateway specs and operations. At the top level
+// it is true, false to turn detection off, or {package: helloworld} to
+// qualify service names; on an operation it names the gRPC method,
+// "helloworld.Greeter/SayHello" or {service: helloworld.Greeter, method:
+// SayHello}.
+const gatewayExtension = "x-grpc-gateway"
+
+// gatewayStatusSchemas are the google.rpc.Status schemas protoc-gen-openapiv2
+// and protoc-gen-openapi add to every spec they generate
+var gatewayStatusSchemas = []string{"rpcStatus", "googlerpcStatus", "GoogleRpcStatus"}
+
+var (
+	// gatewayOperationIDPattern matches the Service_Method operationIds of
+	// generated specs, the service possibly qualified
+	gatewayOperationIDPattern = regexp.MustCompile(`^([A-Za-z][\w.]*)_([A-Za-z]\w*)$`)
+	// gatewayPathPattern matches the google.api.http path templates that
+	// bind a field to a pattern, e.g. /v1/{name=projects/*/books/*}
+	gatewayPathPattern = regexp.MustCompile(`\{[^}=]+=[^}]*\}`)
+)
+
+// gatewayMethods maps the routes ("METHOD path") of grpc-gateway specs to
+// the gRPC methods serving them
+func gatewayMethods(specs []LoadedSpec) map[string]GRPCMethod {
+	methods := make(map[string]GRPCMethod)
+	for _, spec := range specs {
+		if spec.Doc == nil {
+			continue
+		}
+		pkg, detected := detectGateway(spec.Doc)
+		for _, op := range collectOperations(spec.Doc, "path") {
+			method, ok := operationGatewayMethod(op, pkg, detected)
+			if !ok || streamProtocol(op.Operation) != "" {
+				continue
+			}
+			methods[strings.ToUpper(op.Method)+" "+op.Path] = method
+		}
+	}
+	return methods
+}
+
+// detectGateway reports whether a spec was generated for grpc-gateway, from
+// its extension, its status schema or its path templates, and the package
+// qualifying its service names if known
+func detectGateway(doc *openapi3.T) (string, bool) {
+	switch value := doc.Extensions[gatewayExtension].(type) {
+	case bool:
+		return "", value
+	case map[string]interface{}:
+		pkg, _ := value["package"].(string)
+		return pkg, true
+	}
+	if doc.Components != nil {
+		for _, name := range gatewayStatusSchemas {
+			if _, ok := doc.Components.Schemas[name]; ok {
+				return "", true
+			}
+		}
+	}
+	if doc.Paths != nil {
+		for path := range doc.Paths.Map() {
+			if gatewayPathPattern.MatchString(path) {
+				return "", true
+			}
+		}
+	}
+	return "", false
+}
+
+// operationGatewayMethod returns the gRPC method behind an operation: the
+// one its extension names, or in detected specs the one its operationId
+// names
+func operationGatewayMethod(op OperationInfo, pkg string, detected bool) (GRPCMethod, bool) {
+	switch value := op.Operation.Extensions[gatewayExtension].(type) {
+	case string:
+		service, method, ok := strings.Cut(value, "/")
+		return GRPCMethod{Service: service, Method: method}, ok && service != "" && method != ""
+	case map[string]interface{}:
+		service, _ := value["service"].(string)
+		method, _ := value["method"].(string)
+		return GRPCMethod{Service: service, Method: method}, service != "" && method != ""
+	}
+	if !detected {
+		return GRPCMethod{}, false
+	}
+	m := gatewayOperationIDPattern.FindStringSubmatch(op.Operation.OperationID)
+	if m == nil {
+		return GRPCMethod{}, false
+	}
+	service := m[1]
+	if pkg != "" && !strings.Contains(service, ".") {
+		service = pkg + "." + service
+	}
+	return GRPCMethod{Service: service, Method: m[2]}, true
+}
+
+// gatewayPaired reports whether a gRPC method is paired with a route,
+// unqualified gateway services pairing with the service in any package
+func gatewayPaired(routes map[string]GRPCMethod) func(GRPCMethod) bool {
+	paired := make(map[GRPCMethod]bool, len(routes))
+	for _, method := range routes {
+		paired[method] = true
+	}
+	return func(method GRPCMethod) bool {
+		service := method.Service[strings.LastIndex(method.Service, ".")+1:]
+		return paired[GRPCMethod{Service: method.Service, Method: method.Method}] ||
+			paired[GRPCMethod{Service: service, Method: method.Method}]
+	}
+}
+
+// gatewayServiceMatcher matches the grpc_service label of a method's
+// service; unqualified names match the service in any package
+func gatewayServiceMatcher(service string) string {
+	if strings.Contains(service, ".") {
+		return promMatcher("grpc_service", "=", service)
+	}
+	return promMatcher("grpc_service", "=~", `(.+\.)?`+regexp.QuoteMeta(service))
+}
+
+// createGatewayPanels pairs the panels of a REST route with the request rate
+// and latency of the gRPC method serving it, the descriptions of both
+// naming the other side
+func createGatewayPanels(title string, op OperationInfo, method grpcMatch, thresholds ThresholdConfig, panelID, height, yPos int) []Panel {
+	route := fmt.Sprintf("`%s %s`", strings.ToUpper(op.Method), op.Path)
+	name := fmt.Sprintf("`%s/%s`", method.Service, method.Method)
+	method.ServiceMatcher = gatewayServiceMatcher(method.Service)
+	panels := []Panel{
+		createGRPCRequestPanel(title, method, panelID, height, yPos),
+		createGRPCLatencyPanel(title, method, thresholds, panelID+1, height, yPos+height),
+	}
+	for i, kind := range []string{"gRPC Request Rate", "gRPC Latency"} {
+		panel := &panels[i]
+		panel.Title = title + " - " + kind
+		panel.Description = fmt.Sprintf("%s of %s, serving %s through grpc-gateway", panel.Description, name, route)
+	}
+	return panels
+}
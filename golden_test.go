@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// updateGolden rewrites the golden dashboards and cases instead of comparing
+// them:
+//
+//	make update-golden
+var updateGolden = flag.Bool("update", false, "rewrite testdata/golden from the current generator")
+
+// TestGoldenDashboards generates a dashboard from every fixture spec in
+// testdata/specs with the default configuration and compares it with
+// testdata/golden/<fixture>.json
+func TestGoldenDashboards(t *testing.T) {
+	specs, err := filepath.Glob(filepath.Join("testdata", "specs", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) == 0 {
+		t.Fatal("no fixture specs in testdata/specs")
+	}
+
+	for _, spec := range specs {
+		name := strings.TrimSuffix(filepath.Base(spec), filepath.Ext(spec))
+		t.Run(name, func(t *testing.T) {
+			compareGolden(t, filepath.Join("testdata", "golden", name+".json"), generateGolden(t, []string{spec}, name))
+		})
+	}
+}
+
+// TestGoldenCases generates the dashboards of every case in testdata/cases
+// and compares them with testdata/golden/cases/<case>.json. A case is a
+// <case>.args file holding the command line of a generation run, spec
+// first, over one or more lines; lines starting with # are comments.
+func TestGoldenCases(t *testing.T) {
+	cases, err := filepath.Glob(filepath.Join("testdata", "cases", "*.args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("no cases in testdata/cases")
+	}
+
+	for _, file := range cases {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		t.Run(name, func(t *testing.T) {
+			args, err := readGoldenArgs(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, filepath.Join("testdata", "golden", "cases", name+".json"), generateGolden(t, args, name))
+		})
+	}
+}
+
+// readGoldenArgs reads the arguments of a golden case, split on whitespace
+func readGoldenArgs(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			args = append(args, strings.Fields(line)...)
+		}
+	}
+	return args, nil
+}
+
+// compareGolden compares generated output with a golden file, or rewrites
+// it with -update
+func compareGolden(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("dashboard differs from %s (run go test -update if the change is intended):\n%s", golden, firstDifference(want, got))
+	}
+}
+
+// goldenOutput is the golden file of a run writing several dashboards or
+// library panels
+type goldenOutput struct {
+	Dashboards    []GrafanaDashboard `json:"dashboards"`
+	LibraryPanels []LibraryElement   `json:"libraryPanels,omitempty"`
+}
+
+// generateGolden generates the dashboards of a command line as the CLI
+// would write them, with the UID golden-<name> unless the arguments set
+// one: the dashboard itself, or every dashboard and library panel of a
+// split or --library-panels run
+func generateGolden(t *testing.T, args []string, name string) []byte {
+	t.Helper()
+	ctx := context.Background()
+	withPluginRegistry(t)
+	config, err := parseArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(args, "--uid") {
+		config.DashboardUID = "golden-" + name
+	}
+
+	input, err := loadGenerationInput(ctx, NewSpecFetcher(""), config.specSources(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dashboard := generateDashboard(ctx, input, config, calculateSpecHash(input.Specs))
+	dashboards, libraryPanels := outputDashboards(dashboard, config)
+	for i := range dashboards {
+		if err := checkDashboard(&dashboards[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var output interface{} = dashboards[0]
+	if len(dashboards) > 1 || len(libraryPanels) > 0 {
+		output = goldenOutput{Dashboards: dashboards, LibraryPanels: libraryPanels}
+	}
+	data, err := encodeOutput(ctx, output, outputEncodingJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, '\n')
+}
+
+// firstDifference describes the first line where two outputs differ
+func firstDifference(want, got []byte) string {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return "outputs differ in length"
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GrafanaClient pushes generated dashboards to a Grafana instance
+type GrafanaClient struct {
+	BaseURL string
+	Token   string
+	// User and Password are the basic auth credentials used without a token
+	User       string
+	Password   string
+	HTTPClient *http.Client
+	// tokens supplies OAuth tokens, replacing Token
+	tokens *oauthTokenSource
+}
+
+// PushResult is Grafana's response to a dashboard save
+type PushResult struct {
+	ID      int    `json:"id"`
+	UID     string `json:"uid"`
+	URL     string `json:"url"`
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+	Slug    string `json:"slug"`
+}
+
+type dashboardSaveRequest struct {
+	Dashboard GrafanaDashboard `json:"dashboard"`
+	FolderUID string           `json:"folderUid,omitempty"`
+	Message   string           `json:"message,omitempty"`
+	Overwrite bool             `json:"overwrite"`
+}
+
+// NewGrafanaClient creates a client for the Grafana instance at baseURL,
+// authenticating with a service account or API token when one is given
+func NewGrafanaClient(baseURL, token string) *GrafanaClient {
+	return &GrafanaClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// PushDashboard creates or overwrites the dashboard with the same UID
+func (c *GrafanaClient) PushDashboard(ctx context.Context, dashboard GrafanaDashboard, folderUID, message string) (*PushResult, error) {
+	// Grafana assigns versions itself and rejects a stale one, so let it
+	// overwrite whatever is stored under the UID
+	dashboard.Version = 0
+
+	body, err := json.Marshal(dashboardSaveRequest{
+		Dashboard: dashboard,
+		FolderUID: folderUID,
+		Message:   message,
+		Overwrite: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling dashboard: %w", err)
+	}
+
+	var result PushResult
+	if err := c.do(ctx, http.MethodPost, "/api/dashboards/db", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// storedDashboard is the part of a dashboard stored in Grafana telling
+// whether and from which spec this tool generated it. Hand-built dashboards
+// need not decode as a GrafanaDashboard.
+type storedDashboard struct {
+	Title   string   `json:"title"`
+	Tags    []string `json:"tags"`
+	Version int      `json:"version"`
+	// Panels are decoded on demand, see panels
+	Panels json.RawMessage `json:"panels"`
+}
+
+// panels decodes the panels of the dashboard, nil when they do not decode
+// as generated panels
+func (d storedDashboard) panels() []Panel {
+	if len(d.Panels) == 0 {
+		return nil
+	}
+	var panels []Panel
+	if err := json.Unmarshal(d.Panels, &panels); err != nil {
+		slog.Warn("ignoring the panels of the previous dashboard", "dashboard", d.Title, "error", err)
+		return nil
+	}
+	return panels
+}
+
+// generated reports whether the dashboard carries the spec hash or the
+// generator version tag every generated dashboard is pushed with
+func (d storedDashboard) generated() bool {
+	if specHashFromTags(d.Tags) != "" {
+		return true
+	}
+	for _, tag := range d.Tags {
+		if strings.HasPrefix(tag, generatorTagPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDashboard returns the dashboard stored under uid, or nil when there is
+// none
+func (c *GrafanaClient) GetDashboard(ctx context.Context, uid string) (*storedDashboard, error) {
+	var result struct {
+		Dashboard storedDashboard `json:"dashboard"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/dashboards/uid/"+url.PathEscape(uid), nil, &result)
+	var pushErr *PushError
+	if errors.As(err, &pushErr) && pushErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking up dashboard %s: %w", uid, err)
+	}
+	return &result.Dashboard, nil
+}
+
+// CheckOverwrite fails with an OverwriteError when a dashboard not generated
+// by this tool is stored under uid
+func (c *GrafanaClient) CheckOverwrite(ctx context.Context, uid string) error {
+	dashboard, err := c.GetDashboard(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if dashboard != nil && !dashboard.generated() {
+		return &OverwriteError{UID: uid, Title: dashboard.Title}
+	}
+	return nil
+}
+
+// SnapshotResult is Grafana's response to a snapshot creation
+type SnapshotResult struct {
+	ID        int    `json:"id"`
+	Key       string `json:"key"`
+	URL       string `json:"url"`
+	DeleteKey string `json:"deleteKey"`
+	DeleteURL string `json:"deleteUrl"`
+}
+
+type snapshotCreateRequest struct {
+	Dashboard GrafanaDashboard `json:"dashboard"`
+	Name      string           `json:"name,omitempty"`
+	// Expires is the snapshot lifetime in seconds, 0 keeps it forever
+	Expires  int64 `json:"expires,omitempty"`
+	External bool  `json:"external,omitempty"`
+}
+
+// CreateSnapshot publishes a snapshot of the dashboard, on the external
+// snapshot server Grafana is configured with when external is set
+func (c *GrafanaClient) CreateSnapshot(ctx context.Context, dashboard GrafanaDashboard, expires time.Duration, external bool) (*SnapshotResult, error) {
+	body, err := json.Marshal(snapshotCreateRequest{
+		Dashboard: dashboard,
+		Name:      dashboard.Title,
+		Expires:   int64(expires / time.Second),
+		External:  external,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling snapshot: %w", err)
+	}
+
+	var result SnapshotResult
+	if err := c.do(ctx, http.MethodPost, "/api/snapshots", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *GrafanaClient) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case c.tokens != nil:
+		token, err := c.tokens.Token(ctx)
+		if err != nil {
+			return &PushError{Method: method, Path: path, Err: err}
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.User != "":
+		req.SetBasicAuth(c.User, c.Password)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return &PushError{Method: method, Path: path, Err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading grafana response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &PushError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("error decoding grafana response: %w", err)
+		}
+	}
+	return nil
+}
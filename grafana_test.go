@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+// TestStoredDashboardGenerated checks only the generation metadata tags mark
+// a stored dashboard as owned by the generator
+func TestStoredDashboardGenerated(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want bool
+	}{
+		{"spec hash", []string{"api", specHashTagPrefix + "576db97c328d"}, true},
+		{"generator", []string{generatorTagPrefix + "v1.4.0"}, true},
+		{"generated tag only", []string{"generated", "api", "monitoring"}, false},
+		{"no tags", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (storedDashboard{Tags: tt.tags}).generated(); got != tt.want {
+				t.Errorf("generated() = %v for tags %v, want %v", got, tt.tags, tt.want)
+			}
+		})
+	}
+}
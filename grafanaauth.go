@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GrafanaAuth configures how the push client authenticates to and reaches
+// Grafana, from flags, the grafana_auth section of the config file and the
+// auth of grafana_instances entries. From most to least preferred, requests
+// carry an OAuth token, the token of the token file, the bearer token or
+// basic auth credentials.
+type GrafanaAuth struct {
+	// User authenticates with basic auth, with the password of PasswordEnv
+	// (GRAFANA_PASSWORD by default)
+	User        string `yaml:"user"`
+	PasswordEnv string `yaml:"password_env"`
+	// TokenFile holds the token, e.g. a mounted service account token
+	TokenFile string `yaml:"token_file"`
+	// CertFile and KeyFile are the client certificate of mTLS, CAFile the
+	// CA bundle Grafana's certificate is verified against
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	CAFile   string `yaml:"ca_file"`
+	// Proxy is the URL of the proxy to Grafana, HTTPS_PROXY when empty
+	Proxy string `yaml:"proxy"`
+	// OAuth exchanges client credentials for the tokens of requests
+	OAuth OAuthConfig `yaml:"oauth"`
+}
+
+// OAuthConfig is an OAuth 2.0 client credentials grant
+type OAuthConfig struct {
+	TokenURL string `yaml:"token_url"`
+	ClientID string `yaml:"client_id"`
+	// ClientSecretEnv names the variable holding the client secret,
+	// GRAFANA_OAUTH_CLIENT_SECRET by default
+	ClientSecretEnv string   `yaml:"client_secret_env"`
+	Scopes          []string `yaml:"scopes"`
+}
+
+// grafanaAuth returns the Grafana auth settings of the config file with
+// the flags applied
+func (c *Config) grafanaAuth() GrafanaAuth {
+	return c.fileConfig().GrafanaAuth.merge(c.GrafanaAuth)
+}
+
+// merge returns the settings with the ones set in override replaced
+func (a GrafanaAuth) merge(override GrafanaAuth) GrafanaAuth {
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{override.User, &a.User},
+		{override.PasswordEnv, &a.PasswordEnv},
+		{override.TokenFile, &a.TokenFile},
+		{override.CertFile, &a.CertFile},
+		{override.KeyFile, &a.KeyFile},
+		{override.CAFile, &a.CAFile},
+		{override.Proxy, &a.Proxy},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	if override.OAuth.TokenURL != "" {
+		a.OAuth = override.OAuth
+	}
+	return a
+}
+
+func (a GrafanaAuth) validate() error {
+	if (a.CertFile == "") != (a.KeyFile == "") {
+		return fmt.Errorf("a client certificate needs both a cert and a key file")
+	}
+	if a.Proxy != "" {
+		if u, err := url.Parse(a.Proxy); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid proxy %q: must be a URL", a.Proxy)
+		}
+	}
+	if a.OAuth.TokenURL != "" && a.OAuth.ClientID == "" {
+		return fmt.Errorf("oauth: client_id is required with token_url")
+	}
+	return nil
+}
+
+// password returns the basic auth password from the environment
+func (a GrafanaAuth) password() string {
+	name := a.PasswordEnv
+	if name == "" {
+		name = "GRAFANA_PASSWORD"
+	}
+	return os.Getenv(name)
+}
+
+// transport returns the transport of the push client, with the proxy and
+// TLS settings
+func (a GrafanaAuth) transport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if a.Proxy != "" {
+		proxy, err := url.Parse(a.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grafana proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if a.CertFile == "" && a.CAFile == "" {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if a.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(a.CertFile, a.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading grafana client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if a.CAFile != "" {
+		data, err := os.ReadFile(a.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading grafana CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in grafana CA file %s", a.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// newAuthenticatedClient creates a client for the Grafana instance at
+// baseURL authenticating as configured, token being the bearer token
+func newAuthenticatedClient(baseURL, token string, auth GrafanaAuth) (*GrafanaClient, error) {
+	client := NewGrafanaClient(baseURL, token)
+	transport, err := auth.transport()
+	if err != nil {
+		return nil, err
+	}
+	client.HTTPClient.Transport = transport
+
+	if auth.TokenFile != "" {
+		data, err := os.ReadFile(auth.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading grafana token file: %w", err)
+		}
+		client.Token = strings.TrimSpace(string(data))
+	}
+	if auth.User != "" {
+		client.User, client.Password = auth.User, auth.password()
+	}
+	if auth.OAuth.TokenURL != "" {
+		client.tokens = &oauthTokenSource{config: auth.OAuth, client: client.HTTPClient}
+	}
+	return client, nil
+}
+
+// oauthTokenSource fetches client credentials tokens, reusing each until
+// shortly before it expires
+type oauthTokenSource struct {
+	config OAuthConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// oauthExpiryMargin renews tokens before they expire mid-request
+const oauthExpiryMargin = 30 * time.Second
+
+func (s *oauthTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	secretEnv := s.config.ClientSecretEnv
+	if secretEnv == "" {
+		secretEnv = "GRAFANA_OAUTH_CLIENT_SECRET"
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.config.ClientID},
+		"client_secret": {os.Getenv(secretEnv)},
+	}
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting oauth token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading oauth token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oauth token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.AccessToken == "" {
+		return "", fmt.Errorf("oauth token endpoint returned no access token")
+	}
+	s.token = result.AccessToken
+	s.expires = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - oauthExpiryMargin)
+	return s.token, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// currentSchemaMajorVersion is the first Grafana major version whose
+// dashboard schema the generator emits with --grafana-version
+const currentSchemaMajorVersion = 10
+
+// grafanaMajorVersion parses the major version of a Grafana release such as
+// "10", "10.4" or "v11.2.0"; an empty version is 0
+func grafanaMajorVersion(version string) (int, error) {
+	if version == "" {
+		return 0, nil
+	}
+	major, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	value, err := strconv.Atoi(major)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("%q is not a Grafana version such as 10.4 or 11", version)
+	}
+	return value, nil
+}
+
+// adaptForGrafanaVersion rewrites the dashboard for the schema of the given
+// Grafana version. From Grafana 10 the dashboard uses the current
+// schemaVersion, drops the removed style field, references datasources as
+// objects everywhere and no longer carries legacy panel alerts, which were
+// replaced by unified alerting.
+func adaptForGrafanaVersion(dashboard *GrafanaDashboard, version string) {
+	major, _ := grafanaMajorVersion(version)
+	if major < currentSchemaMajorVersion {
+		return
+	}
+
+	dashboard.SchemaVersion = supportedSchemaVersions[len(supportedSchemaVersions)-1]
+	dashboard.Style = ""
+
+	for i := range dashboard.Annotations.List {
+		annotation := &dashboard.Annotations.List[i]
+		if annotation.BuiltIn == 1 || annotation.Datasource == "-- Grafana --" {
+			annotation.Datasource = map[string]string{"type": "grafana", "uid": "-- Grafana --"}
+		}
+	}
+	for i := range dashboard.Templating.List {
+		variable := &dashboard.Templating.List[i]
+		if variable.Type == "query" {
+			variable.Datasource = map[string]string{"type": "prometheus", "uid": "${datasource}"}
+		}
+	}
+
+	dropped := 0
+	for i := range dashboard.Panels {
+		if dashboard.Panels[i].Alert != nil {
+			dashboard.Panels[i].Alert = nil
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		slog.Warn("dropped legacy panel alerts, which this Grafana version no longer supports; define them as Grafana-managed alert rules instead",
+			"alerts", dropped, "grafana_version", version)
+	}
+}
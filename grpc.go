@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// grpcReflectTimeout bounds a complete reflection session against one server
+const grpcReflectTimeout = 30 * time.Second
+
+// GRPCMethod is a gRPC method to generate panels for. Service is the fully
+// qualified service name, as used by the grpc_service metric label.
+type GRPCMethod struct {
+	Service         string
+	Method          string
+	ClientStreaming bool
+	ServerStreaming bool
+}
+
+// loadGRPCMethods collects gRPC methods from the x-grpc extension of every
+// spec, from compiled descriptor sets and from server reflection, returning
+// them deduplicated and sorted
+func loadGRPCMethods(ctx context.Context, specs []LoadedSpec, config *Config) ([]GRPCMethod, error) {
+	if !config.IncludeGRPC {
+		return nil, nil
+	}
+
+	var methods []GRPCMethod
+	for _, spec := range specs {
+		methods = append(methods, grpcMethodsFromExtension(spec.Doc)...)
+	}
+
+	for _, file := range config.ProtoFiles {
+		found, err := grpcMethodsFromDescriptorSet(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading descriptor set %s: %w", file, err)
+		}
+		methods = append(methods, found...)
+	}
+
+	for _, target := range config.GRPCReflect {
+		found, err := grpcMethodsFromReflection(ctx, target, config.GRPCReflectTLS)
+		if err != nil {
+			return nil, fmt.Errorf("error reflecting gRPC services on %s: %w", target, err)
+		}
+		methods = append(methods, found...)
+	}
+
+	return dedupeGRPCMethods(methods), nil
+}
+
+// match selects the series of the method within scope
+func (m GRPCMethod) match(scope []string) grpcMatch {
+	return grpcMatch{Service: m.Service, Method: m.Method, Scope: scope}
+}
+
+// grpcType is the grpc_type label value of the method: unary,
+// client_stream, server_stream or bidi_stream
+func (m GRPCMethod) grpcType() string {
+	switch {
+	case m.ClientStreaming && m.ServerStreaming:
+		return "bidi_stream"
+	case m.ClientStreaming:
+		return "client_stream"
+	case m.ServerStreaming:
+		return "server_stream"
+	}
+	return "unary"
+}
+
+// grpcMethodsFromExtension reads the x-grpc extension, a map of service
+// names to maps of method names, whose values may mark streaming methods
+// with client_streaming and server_streaming like descriptors do
+func grpcMethodsFromExtension(doc *openapi3.T) []GRPCMethod {
+	grpcServices, ok := doc.Extensions["x-grpc"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var methods []GRPCMethod
+	for _, serviceName := range sortedKeys(grpcServices) {
+		methodMap, ok := grpcServices[serviceName].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, methodName := range sortedKeys(methodMap) {
+			method := GRPCMethod{Service: serviceName, Method: methodName}
+			if options, ok := methodMap[methodName].(map[string]interface{}); ok {
+				method.ClientStreaming = isTruthy(options["client_streaming"])
+				method.ServerStreaming = isTruthy(options["server_streaming"])
+			}
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// grpcMethodsFromDescriptorSet reads a FileDescriptorSet as produced by
+// `protoc --descriptor_set_out` or `buf build -o`
+func grpcMethodsFromDescriptorSet(path string) ([]GRPCMethod, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("not a FileDescriptorSet: %w", err)
+	}
+
+	var methods []GRPCMethod
+	for _, file := range set.GetFile() {
+		methods = append(methods, grpcMethodsFromFile(file, nil)...)
+	}
+	return methods, nil
+}
+
+// grpcMethodsFromFile lists the methods of the services declared in file.
+// When only is non-nil, services not in it are skipped.
+func grpcMethodsFromFile(file *descriptorpb.FileDescriptorProto, only map[string]bool) []GRPCMethod {
+	var methods []GRPCMethod
+	for _, service := range file.GetService() {
+		name := service.GetName()
+		if pkg := file.GetPackage(); pkg != "" {
+			name = pkg + "." + name
+		}
+		if only != nil && !only[name] {
+			continue
+		}
+		for _, method := range service.GetMethod() {
+			methods = append(methods, GRPCMethod{
+				Service:         name,
+				Method:          method.GetName(),
+				ClientStreaming: method.GetClientStreaming(),
+				ServerStreaming: method.GetServerStreaming(),
+			})
+		}
+	}
+	return methods
+}
+
+// grpcMethodsFromReflection lists the services of a running server through
+// the gRPC server reflection API
+func grpcMethodsFromReflection(ctx context.Context, target string, useTLS bool) ([]GRPCMethod, error) {
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, grpcReflectTimeout)
+	defer cancel()
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	resp, err := reflectionRoundTrip(stream, &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]bool)
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		if !strings.HasPrefix(service.GetName(), "grpc.reflection.") {
+			services[service.GetName()] = true
+		}
+	}
+
+	var methods []GRPCMethod
+	for _, service := range sortedBoolKeys(services) {
+		resp, err := reflectionRoundTrip(stream, &reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			var file descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(raw, &file); err != nil {
+				return nil, fmt.Errorf("invalid file descriptor for %s: %w", service, err)
+			}
+			methods = append(methods, grpcMethodsFromFile(&file, map[string]bool{service: true})...)
+		}
+	}
+	return methods, nil
+}
+
+func reflectionRoundTrip(stream reflectionpb.ServerReflection_ServerReflectionInfoClient, req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return nil, fmt.Errorf("reflection error %d: %s", errResp.GetErrorCode(), errResp.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+func dedupeGRPCMethods(methods []GRPCMethod) []GRPCMethod {
+	seen := make(map[string]bool, len(methods))
+	var unique []GRPCMethod
+	for _, m := range methods {
+		key := m.Service + "/" + m.Method
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, m)
+	}
+
+	sort.SliceStable(unique, func(i, j int) bool {
+		if unique[i].Service != unique[j].Service {
+			return unique[i].Service < unique[j].Service
+		}
+		return unique[i].Method < unique[j].Method
+	})
+	return unique
+}
+
+func sortedBoolKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
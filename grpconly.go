@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// grpcOnlyTitle titles dashboards of several gRPC services given without an
+// OpenAPI spec
+const grpcOnlyTitle = "gRPC Services"
+
+// validateGRPCOnly checks the input of runs without an OpenAPI spec, which
+// need gRPC services from descriptor sets or reflection
+func validateGRPCOnly(config *Config) error {
+	if config.InputFile != "" {
+		return nil
+	}
+	if len(config.ProtoFiles) == 0 && len(config.GRPCReflect) == 0 {
+		return fmt.Errorf("missing OpenAPI spec: give a spec file, or --proto or --grpc-reflect for a dashboard of gRPC services")
+	}
+	if len(config.MergeFiles) > 0 {
+		return fmt.Errorf("--merge needs an OpenAPI spec to merge into")
+	}
+	if config.PreviousSpec != "" {
+		return fmt.Errorf("--previous-spec needs an OpenAPI spec to compare with")
+	}
+	return nil
+}
+
+// specSources returns the OpenAPI spec and the specs merged into it, none
+// in gRPC-only mode
+func (c *Config) specSources() []string {
+	if c.InputFile == "" {
+		return nil
+	}
+	return append([]string{c.InputFile}, c.MergeFiles...)
+}
+
+// inputDescription names what the dashboards are generated from
+func (c *Config) inputDescription() string {
+	if c.InputFile != "" {
+		return c.InputFile
+	}
+	return strings.Join(append(append([]string{}, c.ProtoFiles...), c.GRPCReflect...), ", ")
+}
+
+// grpcOnlySpec stands in for the OpenAPI spec of gRPC-only dashboards: a
+// document without paths titled after the service, or gRPC Services for
+// several, whose data is the method list so the spec hash follows the
+// services
+func grpcOnlySpec(methods []GRPCMethod, config *Config) LoadedSpec {
+	var services []string
+	var data strings.Builder
+	for _, method := range methods {
+		services = appendUnique(services, method.Service)
+		fmt.Fprintf(&data, "%s/%s %s\n", method.Service, method.Method, method.grpcType())
+	}
+	title := grpcOnlyTitle
+	if len(services) == 1 {
+		title = services[0]
+	}
+
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info:    &openapi3.Info{Title: title},
+		Paths:   openapi3.NewPaths(),
+	}
+	return LoadedSpec{
+		Service:  slugify(title),
+		Doc:      doc,
+		Data:     []byte(data.String()),
+		Source:   SpecSource{Source: config.inputDescription()},
+		GRPCOnly: true,
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultInitOutput is the config file init writes without --output
+const defaultInitOutput = "openapi2grafana.yaml"
+
+// initSplitOperations is the operation count above which init suggests a
+// dashboard per tag
+const initSplitOperations = 25
+
+// specSurvey is what init detects in the specs
+type specSurvey struct {
+	Title      string
+	Version    string
+	Operations int
+	// Tags counts the operations of every tag
+	Tags       map[string]int
+	Servers    []string
+	Extensions []string
+	// Operations with rate limits, cache settings, dependencies, streaming
+	// protocols and security, and the callbacks and webhooks
+	RateLimited  int
+	Cacheable    int
+	Dependencies int
+	Streaming    int
+	Secured      int
+	Outbound     int
+}
+
+// runInit implements the init subcommand, scaffolding a commented config
+// file from a spec
+func runInit(args []string) error {
+	var sources []string
+	output := defaultInitOutput
+	force := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--force":
+			force = true
+		case "--output":
+			if i+1 >= len(args) {
+				return fmt.Errorf("missing value for %s", args[i])
+			}
+			output = args[i+1]
+			i++
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				return fmt.Errorf("unknown flag %q", args[i])
+			}
+			sources = append(sources, args[i])
+		}
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no spec given")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	specs, err := loadSpecs(ctx, NewSpecFetcher(""), sources)
+	if err != nil {
+		return err
+	}
+	content, err := scaffoldConfig(surveySpecs(specs), sources)
+	if err != nil {
+		return err
+	}
+
+	if output == stdoutOutput {
+		_, err := os.Stdout.WriteString(content)
+		return err
+	}
+	if _, err := os.Stat(output); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", output)
+	}
+	if err := os.WriteFile(output, []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	fmt.Printf("Wrote %s, use it with --config %s\n", output, output)
+	return nil
+}
+
+// surveySpecs detects the tags, servers, extensions and metric conventions
+// of the specs
+func surveySpecs(specs []LoadedSpec) specSurvey {
+	survey := specSurvey{Tags: make(map[string]int)}
+	extensions := make(map[string]bool)
+	addExtensions := func(values map[string]interface{}) {
+		for name := range values {
+			if strings.HasPrefix(name, "x-") {
+				extensions[name] = true
+			}
+		}
+	}
+	for _, spec := range specs {
+		if spec.Doc == nil {
+			continue
+		}
+		if survey.Title == "" && spec.Doc.Info != nil {
+			survey.Title, survey.Version = spec.Doc.Info.Title, spec.Doc.Info.Version
+		}
+		for _, server := range spec.Doc.Servers {
+			survey.Servers = appendUnique(survey.Servers, server.URL)
+			addExtensions(server.Extensions)
+		}
+		addExtensions(spec.Doc.Extensions)
+	}
+
+	config := defaultConfig()
+	ops, shared := config.selectedOperations(specs, config.SortOrder)
+	ops = append(ops, shared...)
+	survey.Operations = len(ops)
+	for _, op := range ops {
+		survey.Tags[op.Tag]++
+		addExtensions(op.Operation.Extensions)
+		if _, ok := operationRateLimit(op.Operation); ok {
+			survey.RateLimited++
+		}
+		if cacheable, ok := op.Operation.Extensions["x-cacheable"].(bool); ok && cacheable {
+			survey.Cacheable++
+		}
+		if len(operationDependencies(op)) > 0 {
+			survey.Dependencies++
+		}
+		if streamProtocol(op.Operation) != "" {
+			survey.Streaming++
+		}
+		if len(op.SecuritySchemes) > 0 {
+			survey.Secured++
+		}
+	}
+	survey.Outbound = len(collectOutboundCalls(specs, ops))
+	for name := range extensions {
+		survey.Extensions = append(survey.Extensions, name)
+	}
+	sort.Strings(survey.Extensions)
+	return survey
+}
+
+// scaffoldConfig writes the starter config: detected facts as comments, the
+// default thresholds, placeholders per tag and the metric sections of the
+// conventions the specs use, commented out with their defaults
+func scaffoldConfig(survey specSurvey, sources []string) (string, error) {
+	var b strings.Builder
+	spec := strings.Join(sources, " ")
+	fmt.Fprintf(&b, "# openapi2grafana config for %s %s (%s)\n", survey.Title, survey.Version, spec)
+	fmt.Fprintf(&b, "# Generated by `openapi2grafana init`; use it with --config. Every section\n")
+	fmt.Fprintf(&b, "# is optional: uncomment and adjust what applies.\n#\n")
+	tags := sortedTags(survey.Tags)
+	fmt.Fprintf(&b, "# Detected: %d operations in %d tags, %d servers\n", survey.Operations, len(tags), len(survey.Servers))
+	for _, server := range survey.Servers {
+		fmt.Fprintf(&b, "#   server %s\n", server)
+	}
+	if len(survey.Extensions) > 0 {
+		fmt.Fprintf(&b, "# Extensions: %s\n", strings.Join(survey.Extensions, ", "))
+	}
+
+	b.WriteString("\n")
+	switch {
+	case survey.Operations > initSplitOperations && len(tags) > 1:
+		fmt.Fprintf(&b, "# Suggested dashboards: %d operations make a long dashboard; generate one\n", survey.Operations)
+		fmt.Fprintf(&b, "# per tag with --include-tags, or an overview with a dashboard per\n")
+		fmt.Fprintf(&b, "# operation with --split-dir:\n")
+		for _, tag := range tags {
+			fmt.Fprintf(&b, "#   openapi2grafana %s %s.json --config %s --include-tags %s   # %d operations\n",
+				spec, slugify(tag), defaultInitOutput, shellQuote(tag), survey.Tags[tag])
+		}
+	case survey.Operations > initSplitOperations:
+		fmt.Fprintf(&b, "# Suggested dashboards: %d operations make a long dashboard; consider\n", survey.Operations)
+		fmt.Fprintf(&b, "# --split-dir for an overview with a dashboard per operation, or\n")
+		fmt.Fprintf(&b, "# --max-panels to summarize them.\n")
+	default:
+		fmt.Fprintf(&b, "# Suggested dashboards: %d operations fit a single dashboard.\n", survey.Operations)
+	}
+
+	b.WriteString("\n# Latency in seconds, error rates in percent; these are the defaults\n")
+	if err := writeYAMLSection(&b, "thresholds", map[string]interface{}{"default": thresholdOverride(defaultThresholds)}, false); err != nil {
+		return "", err
+	}
+	if len(tags) > 0 {
+		b.WriteString("  # Per-tag overrides\n  # tags:\n")
+		for _, tag := range tags {
+			fmt.Fprintf(&b, "  #   %s:\n  #     latency_warning: %g\n  #     latency_critical: %g\n",
+				yamlKey(tag), defaultThresholds.LatencyWarning, defaultThresholds.LatencyCritical)
+		}
+
+		b.WriteString("\n# Teams owning the operations of each tag, for dashboard tags, alert labels\n# and runbook links\n# teams:\n")
+		for _, tag := range tags {
+			fmt.Fprintf(&b, "#   %s: <team>\n", yamlKey(tag))
+		}
+		b.WriteString("# team_runbooks:\n#   <team>: https://runbooks.example.com/<team>\n")
+	}
+
+	b.WriteString("\n# Unit duration histograms are recorded in, s (the default) or ms\n# duration_unit: s\n")
+	b.WriteString("\n# Metric presets exposing latency as summaries rather than histograms\n# summary_latency: [http]\n")
+
+	sections := []struct {
+		count   int
+		what    string
+		key     string
+		section interface{}
+	}{
+		{survey.RateLimited, "operations declare rate limits", "rate_limits", RateLimitsConfig{}.withDefaults()},
+		{survey.Cacheable, "operations are cacheable", "cache", CacheConfig{}.withDefaults()},
+		{survey.Dependencies, "operations declare dependencies", "dependencies", DependenciesConfig{
+			HTTP: DependenciesConfig{}.metrics(dependencyHTTP),
+			GRPC: DependenciesConfig{}.metrics(dependencyGRPC),
+		}},
+		{survey.Outbound, "callbacks and webhooks are sent", "webhooks", WebhooksConfig{}.withDefaults()},
+	}
+	for _, section := range sections {
+		if section.count == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n# %d %s; these are the metrics queried by default\n", section.count, section.what)
+		if err := writeYAMLSection(&b, section.key, section.section, true); err != nil {
+			return "", err
+		}
+	}
+	if survey.Streaming > 0 {
+		fmt.Fprintf(&b, "\n# %d streaming operations are charted from the stream_* metrics\n", survey.Streaming)
+	}
+	if survey.Secured > 0 {
+		fmt.Fprintf(&b, "\n# %d secured operations get token validation panels from\n# auth_token_validation_duration_seconds\n", survey.Secured)
+	}
+	return b.String(), nil
+}
+
+// writeYAMLSection writes a config section, commented out when commented
+func writeYAMLSection(b *strings.Builder, key string, section interface{}, commented bool) error {
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]interface{}{key: section}); err != nil {
+		return fmt.Errorf("error marshaling %s: %w", key, err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if commented {
+			b.WriteString("# ")
+		}
+		b.WriteString(line + "\n")
+	}
+	return nil
+}
+
+// shellQuote quotes a tag for the suggested command lines when needed
+func shellQuote(s string) string {
+	if strings.ContainsAny(s, " '\"$&|;<>()*?") {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	return s
+}
+
+// sortedTags returns the tags of the survey, leaving out untagged operations
+func sortedTags(counts map[string]int) []string {
+	var tags []string
+	for tag := range counts {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// yamlKey quotes a tag when it is not a plain YAML key
+func yamlKey(tag string) string {
+	data, err := yaml.Marshal(tag)
+	if err != nil {
+		return tag
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+)
+
+// GrafanaInstance is a Grafana --push publishes the dashboards to, from the
+// grafana_instances section of the config file, with its own overrides
+type GrafanaInstance struct {
+	// Name identifies the instance in logs and the run summary, e.g. prod
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// TokenEnv names the environment variable holding the instance's token;
+	// --grafana-token is used when empty
+	TokenEnv  string `yaml:"token_env"`
+	FolderUID string `yaml:"folder_uid"`
+	// DataSource replaces --datasource in the dashboards pushed here
+	DataSource string `yaml:"datasource"`
+	// TitleSuffix is appended to the titles of the dashboards pushed here
+	TitleSuffix string `yaml:"title_suffix"`
+	// Auth overrides the grafana_auth settings for the instance
+	Auth GrafanaAuth `yaml:"auth"`
+}
+
+// validateInstances checks that every instance has a unique name and a URL
+func validateInstances(instances []GrafanaInstance) error {
+	seen := make(map[string]bool, len(instances))
+	for i, instance := range instances {
+		if instance.Name == "" {
+			return fmt.Errorf("grafana_instances[%d]: name is required", i)
+		}
+		if seen[instance.Name] {
+			return fmt.Errorf("grafana_instances: duplicate name %q", instance.Name)
+		}
+		seen[instance.Name] = true
+		if instance.URL == "" {
+			return fmt.Errorf("grafana_instances.%s: url is required", instance.Name)
+		}
+		if err := instance.Auth.validate(); err != nil {
+			return fmt.Errorf("grafana_instances.%s: auth: %w", instance.Name, err)
+		}
+	}
+	return nil
+}
+
+// pushTargets returns the Grafana instances --push publishes to: the
+// configured instances, or the one of --grafana-url. Instances default to
+// --grafana-token and --folder-uid.
+func (c *Config) pushTargets() []GrafanaInstance {
+	instances := c.fileConfig().Instances
+	if len(instances) == 0 {
+		return []GrafanaInstance{{URL: c.GrafanaURL, FolderUID: c.FolderUID}}
+	}
+	targets := slices.Clone(instances)
+	for i := range targets {
+		if targets[i].FolderUID == "" {
+			targets[i].FolderUID = c.FolderUID
+		}
+	}
+	return targets
+}
+
+// wrapError names the instance in errors when pushing to several
+func (i GrafanaInstance) wrapError(err error) error {
+	if i.Name == "" {
+		return err
+	}
+	return fmt.Errorf("grafana instance %s: %w", i.Name, err)
+}
+
+// client returns a Grafana client for the instance
+func (i GrafanaInstance) client(config *Config) (*GrafanaClient, error) {
+	token := config.GrafanaToken
+	if i.TokenEnv != "" {
+		token = os.Getenv(i.TokenEnv)
+	}
+	return newAuthenticatedClient(i.URL, token, config.grafanaAuth().merge(i.Auth))
+}
+
+// dataSource returns the data source the dashboards use on the instance
+func (i GrafanaInstance) dataSource(config *Config) string {
+	if i.DataSource != "" {
+		return i.DataSource
+	}
+	return config.DataSource
+}
+
+// resolveDataSource looks the instance's data source up in Grafana
+func (i GrafanaInstance) resolveDataSource(ctx context.Context, client *GrafanaClient, config *Config) (*GrafanaDataSource, error) {
+	sources, err := client.DataSources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	source, err := resolveDataSource(sources, i.dataSource(config))
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("resolved data source", "instance", i.Name, "datasource", source.Name, "uid", source.UID)
+	return &source, nil
+}
+
+// apply returns the dashboard with the instance's title suffix and data
+// source, the resolved one when it was looked up, leaving the original
+// untouched
+func (i GrafanaInstance) apply(dashboard GrafanaDashboard, config *Config, source *GrafanaDataSource) GrafanaDashboard {
+	dashboard.Title += i.TitleSuffix
+	if source == nil && i.dataSource(config) == config.DataSource {
+		return dashboard
+	}
+	dashboard.Templating.List = slices.Clone(dashboard.Templating.List)
+	if source != nil {
+		setDataSource(&dashboard, config.DataSource, *source)
+		return dashboard
+	}
+	for j := range dashboard.Templating.List {
+		variable := &dashboard.Templating.List[j]
+		switch {
+		case variable.Type == "datasource":
+			variable.Current = Current{Text: i.DataSource, Value: i.DataSource}
+			variable.Options = []Option{{Text: i.DataSource, Value: i.DataSource, Selected: true}}
+		case variable.Datasource == config.DataSource:
+			variable.Datasource = i.DataSource
+		}
+	}
+	return dashboard
+}
+
+// pushToInstance pushes the library panels and dashboards to one Grafana
+// instance through its client, with its data source when resolved and the
+// version message, creating snapshots, public dashboards and permissions as
+// configured
+func pushToInstance(ctx context.Context, config *Config, instance GrafanaInstance, client *GrafanaClient, source *GrafanaDataSource, dashboards []GrafanaDashboard, libraryPanels []LibraryElement, message string, summary *RunSummary) error {
+	logger := slog.Default()
+	if instance.Name != "" {
+		logger = logger.With("instance", instance.Name)
+	}
+
+	// Library panels must exist before dashboards referencing them
+	for _, element := range libraryPanels {
+		element.FolderUID = instance.FolderUID
+		if err := client.PushLibraryPanel(ctx, element); err != nil {
+			return fmt.Errorf("error pushing library panel %s: %w", element.Name, err)
+		}
+	}
+	if err := resolveAlertNotifications(ctx, client, dashboards); err != nil {
+		return err
+	}
+	if err := pushMaintenance(ctx, client, config.fileConfig().Maintenance, dashboards); err != nil {
+		return err
+	}
+	uids := make([]string, 0, len(dashboards))
+	for _, dashboard := range dashboards {
+		dashboard = instance.apply(dashboard, config, source)
+		result, err := client.PushDashboard(ctx, dashboard, instance.FolderUID, message)
+		if err != nil {
+			return fmt.Errorf("error pushing dashboard: %w", err)
+		}
+		logger.Info("pushed dashboard", "url", client.BaseURL+result.URL, "version", result.Version)
+		summary.Pushed = append(summary.Pushed, PushSummary{Instance: instance.Name, UID: result.UID, URL: client.BaseURL + result.URL, Version: result.Version})
+		if config.Snapshot {
+			snapshot, err := client.CreateSnapshot(ctx, dashboard, config.SnapshotExpires, config.SnapshotExternal)
+			if err != nil {
+				return fmt.Errorf("error creating snapshot of %s: %w", dashboard.UID, err)
+			}
+			logger.Info("created snapshot", "url", snapshot.URL)
+		}
+		if config.Public {
+			public, err := client.EnablePublicDashboard(ctx, result.UID)
+			if err != nil {
+				return fmt.Errorf("error sharing %s publicly: %w", result.UID, err)
+			}
+			logger.Info("enabled public dashboard", "url", client.BaseURL+"/public-dashboards/"+public.AccessToken)
+		}
+		uids = append(uids, result.UID)
+	}
+	if permissions := config.fileConfig().Permissions; !permissions.empty() {
+		if err := applyPermissions(ctx, client, permissions, uids); err != nil {
+			return err
+		}
+		logger.Info("applied permissions", "dashboards", len(uids))
+	}
+	return nil
+}
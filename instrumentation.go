@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// Languages of --emit-instrumentation
+const (
+	instrumentationGo      = "go"
+	instrumentationGeneric = "generic"
+)
+
+// instrumentationData describes the metrics the dashboard of one spec's
+// service queries
+type instrumentationData struct {
+	Title   string
+	Service string
+	Routes  []Route
+	// DurationMillis records durations in milliseconds (duration_unit: ms)
+	DurationMillis bool
+	Streaming      bool
+	Secured        bool
+	// TargetLabels are the other labels the dashboard filters on, usually
+	// added by the scrape config or relabeling
+	TargetLabels []string
+}
+
+// newInstrumentationData collects the metrics expected from the service of
+// the first spec, the one the dashboard is generated for
+func newInstrumentationData(spec LoadedSpec, config *Config) instrumentationData {
+	data := instrumentationData{
+		Title:          spec.Service,
+		Service:        spec.Service,
+		Routes:         documentedRoutes([]LoadedSpec{spec}),
+		DurationMillis: config.fileConfig().DurationUnit == "ms",
+	}
+	if spec.Doc.Info != nil && spec.Doc.Info.Title != "" {
+		data.Title = spec.Doc.Info.Title
+	}
+	for _, op := range collectOperations(spec.Doc, "path") {
+		if streamProtocol(op.Operation) != "" {
+			data.Streaming = true
+		}
+		if len(op.SecuritySchemes) > 0 {
+			data.Secured = true
+		}
+	}
+	for _, label := range config.filterLabels() {
+		if label != "service" {
+			data.TargetLabels = append(data.TargetLabels, label)
+		}
+	}
+	return data
+}
+
+// instrumentationFile returns the file the instrumentation scaffolding of
+// the output file is written to
+func instrumentationFile(config *Config) string {
+	base := config.outputBase()
+	if config.SplitDir != "" {
+		base = filepath.Join(config.SplitDir, "instrumentation")
+	}
+	if config.Instrumentation == instrumentationGo {
+		return base + "_metrics.go"
+	}
+	return base + ".instrumentation.md"
+}
+
+// writeInstrumentation writes a Go metrics middleware or a language-neutral
+// guide declaring exactly the metrics and labels the dashboard queries
+func writeInstrumentation(path string, spec LoadedSpec, config *Config) error {
+	tmpl := instrumentationGuideTemplate
+	if config.Instrumentation == instrumentationGo {
+		tmpl = instrumentationGoTemplate
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, newInstrumentationData(spec, config)); err != nil {
+		return fmt.Errorf("error rendering instrumentation: %w", err)
+	}
+	data := b.Bytes()
+	if config.Instrumentation == instrumentationGo {
+		formatted, err := format.Source(data)
+		if err != nil {
+			return fmt.Errorf("error formatting instrumentation: %w", err)
+		}
+		data = formatted
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing instrumentation file: %w", err)
+	}
+	return nil
+}
+
+var instrumentationGoTemplate = template.Must(template.New("go").Parse(`// Code generated by openapi2grafana from the {{.Title}} spec. DO NOT EDIT.
+
+// Package metrics records the Prometheus metrics the generated {{.Title}}
+// dashboard queries, with exactly the metric and label names it expects.
+//
+// Wrap the router with Middleware, passing the route template of the
+// matched request so the path label matches the spec's paths:
+//
+//	// chi
+//	r.Use(metrics.Middleware(func(r *http.Request) string {
+//		return chi.RouteContext(r.Context()).RoutePattern()
+//	}))
+//
+//	// gorilla/mux
+//	r.Use(metrics.Middleware(func(r *http.Request) string {
+//		template, _ := mux.CurrentRoute(r).GetPathTemplate()
+//		return template
+//	}))
+{{- if .TargetLabels}}
+//
+// The dashboard also filters on {{range $i, $l := .TargetLabels}}{{if $i}}, {{end}}{{$l}}{{end}}, which
+// the scrape config or relabeling is expected to add.
+{{- end}}
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Service is the service label value the dashboard filters on
+const Service = "{{.Service}}"
+
+// unmatchedPath labels requests no route matched, keeping the path label
+// bounded
+const unmatchedPath = "unmatched"
+
+var (
+	// RequestsTotal counts requests by method, path template and status code
+	RequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "http_requests_total", Help: "Total number of HTTP requests"},
+		[]string{"method", "path", "status_code", "service"},
+	)
+	// RequestDuration observes request latency{{if .DurationMillis}} in milliseconds (duration_unit: ms){{end}}
+	RequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "http_request_duration_seconds", Help: "HTTP request duration", Buckets: {{if .DurationMillis}}[]float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}{{else}}prometheus.DefBuckets{{end}}},
+		[]string{"method", "path", "service"},
+	)
+{{- if .Secured}}
+	// TokenValidationDuration observes credential validation latency
+	TokenValidationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "auth_token_validation_duration_seconds", Help: "Token validation duration", Buckets: prometheus.DefBuckets},
+		[]string{"service"},
+	)
+{{- end}}
+{{- if .Streaming}}
+	// StreamConnectionsActive tracks open WebSocket and SSE connections;
+	// protocol is websocket or sse
+	StreamConnectionsActive = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{Name: "stream_connections_active", Help: "Open streaming connections"},
+		[]string{"path", "protocol", "service"},
+	)
+	// StreamMessagesTotal counts streamed messages; direction is in or out
+	StreamMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "stream_messages_total", Help: "Streamed messages"},
+		[]string{"path", "protocol", "direction", "service"},
+	)
+	// StreamConnectionDuration observes connection lifetimes
+	StreamConnectionDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "stream_connection_duration_seconds", Help: "Streaming connection duration", Buckets: prometheus.ExponentialBuckets(1, 4, 8)},
+		[]string{"path", "protocol", "service"},
+	)
+{{- end}}
+)
+
+func init() {
+	prometheus.MustRegister(RequestsTotal, RequestDuration)
+{{- if .Secured}}
+	prometheus.MustRegister(TokenValidationDuration)
+{{- end}}
+{{- if .Streaming}}
+	prometheus.MustRegister(StreamConnectionsActive, StreamMessagesTotal, StreamConnectionDuration)
+{{- end}}
+}
+
+// Middleware records the count and duration of every request, labeled with
+// the route template routePattern returns for it once it was served
+func Middleware(routePattern func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			path := routePattern(r)
+			if path == "" {
+				path = unmatchedPath
+			}
+			RequestsTotal.WithLabelValues(r.Method, path, strconv.Itoa(recorder.status), Service).Inc()
+			RequestDuration.WithLabelValues(r.Method, path, Service).Observe({{if .DurationMillis}}float64(time.Since(start).Microseconds()) / 1000{{else}}time.Since(start).Seconds(){{end}})
+		})
+	}
+}
+
+// statusRecorder captures the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+`))
+
+var instrumentationGuideTemplate = template.Must(template.New("guide").Parse(`# {{.Title}} instrumentation
+
+The generated dashboard queries the metrics below. Record them with exactly
+these names and labels, whatever the language or framework.
+
+| Metric | Type | Labels |
+|---|---|---|
+| ` + "`http_requests_total`" + ` | counter | method, path, status_code, service |
+| ` + "`http_request_duration_seconds`" + ` | histogram | method, path, service |
+{{- if .Secured}}
+| ` + "`auth_token_validation_duration_seconds`" + ` | histogram | service |
+{{- end}}
+{{- if .Streaming}}
+| ` + "`stream_connections_active`" + ` | gauge | path, protocol, service |
+| ` + "`stream_messages_total`" + ` | counter | path, protocol, direction, service |
+| ` + "`stream_connection_duration_seconds`" + ` | histogram | path, protocol, service |
+{{- end}}
+
+- ` + "`service`" + ` is ` + "`{{.Service}}`" + `.
+- ` + "`method`" + ` is the upper-case HTTP method and ` + "`status_code`" + ` the numeric response status.
+- ` + "`path`" + ` is the route template as written in the spec, never the raw URL.
+{{- if .DurationMillis}}
+- Durations are recorded in milliseconds (` + "`duration_unit: ms`" + `).
+{{- else}}
+- Durations are recorded in seconds.
+{{- end}}
+{{- if .Streaming}}
+- ` + "`protocol`" + ` is ` + "`websocket`" + ` or ` + "`sse`" + `, ` + "`direction`" + ` is ` + "`in`" + ` or ` + "`out`" + `.
+{{- end}}
+{{- if .TargetLabels}}
+- The dashboard also filters on {{range $i, $l := .TargetLabels}}{{if $i}}, {{end}}` + "`{{$l}}`" + `{{end}}, usually added by the scrape config or relabeling.
+{{- end}}
+
+## Documented routes
+
+| Method | Path |
+|---|---|
+{{- range .Routes}}
+| {{.Method}} | ` + "`{{.Path}}`" + ` |
+{{- end}}
+`))
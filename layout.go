@@ -0,0 +1,160 @@
+package main
+
+import "fmt"
+
+// Layout modes of --layout
+const (
+	layoutCompact = "compact"
+	layoutWide    = "wide"
+	layoutRows    = "rows"
+)
+
+// defaultPanelKind sizes panel types a layout does not list
+const defaultPanelKind = "default"
+
+// PanelSize is the grid size of a panel kind
+type PanelSize struct {
+	Width  int `yaml:"width"`
+	Height int `yaml:"height"`
+}
+
+// layoutPresets size every panel kind per layout mode: wide puts two graphs
+// or four stats side by side, compact three graphs or six stats, and rows
+// gives every panel the full width
+var layoutPresets = map[string]map[string]PanelSize{
+	layoutWide: {
+		"timeseries":     {Width: 12, Height: 8},
+		"stat":           {Width: 6, Height: 8},
+		"table":          {Width: 12, Height: 8},
+		"text":           {Width: 12, Height: 8},
+		defaultPanelKind: {Width: 12, Height: 8},
+	},
+	layoutCompact: {
+		"timeseries":     {Width: 8, Height: 7},
+		"stat":           {Width: 4, Height: 7},
+		"table":          {Width: 12, Height: 7},
+		"text":           {Width: 8, Height: 7},
+		defaultPanelKind: {Width: 8, Height: 7},
+	},
+	layoutRows: {
+		"timeseries":     {Width: 24, Height: 8},
+		"stat":           {Width: 24, Height: 4},
+		"table":          {Width: 24, Height: 8},
+		"text":           {Width: 24, Height: 8},
+		defaultPanelKind: {Width: 24, Height: 8},
+	},
+}
+
+// LayoutConfig selects the layout mode and overrides the size of panel
+// kinds, keyed by panel type (timeseries, stat, ...) or "default"
+type LayoutConfig struct {
+	Mode   string               `yaml:"mode"`
+	Panels map[string]PanelSize `yaml:"panels"`
+}
+
+// validateLayoutMode checks a --layout or layout.mode value
+func validateLayoutMode(mode string) error {
+	if _, ok := layoutPresets[mode]; mode != "" && !ok {
+		return fmt.Errorf("invalid layout %q: must be compact, wide or rows", mode)
+	}
+	return nil
+}
+
+// validate checks the mode and panel sizes
+func (l LayoutConfig) validate() error {
+	if err := validateLayoutMode(l.Mode); err != nil {
+		return err
+	}
+	for kind, size := range l.Panels {
+		if size.Width < 1 || size.Width > gridColumns || size.Height < 1 {
+			return fmt.Errorf("panels.%s: width must be 1-%d and height positive", kind, gridColumns)
+		}
+	}
+	return nil
+}
+
+// layout returns the layout of the config file with --layout overriding its mode
+func (c *Config) layout() LayoutConfig {
+	layout := c.fileConfig().Layout
+	if c.Layout != "" {
+		layout.Mode = c.Layout
+	}
+	if layout.Mode == "" {
+		layout.Mode = layoutWide
+	}
+	return layout
+}
+
+// size returns the size of a panel: its own when the spec author fixed it,
+// otherwise the configured or preset size of its kind
+func (l LayoutConfig) size(panel *Panel) PanelSize {
+	if panel.fixedSize {
+		return PanelSize{Width: min(panel.GridPos.W, gridColumns), Height: panel.GridPos.H}
+	}
+	preset := layoutPresets[l.Mode]
+	for _, sizes := range []map[string]PanelSize{l.Panels, preset} {
+		if size, ok := sizes[panel.Type]; ok {
+			return size
+		}
+	}
+	if size, ok := l.Panels[defaultPanelKind]; ok {
+		return size
+	}
+	return preset[defaultPanelKind]
+}
+
+// gridPacker places panels left to right on lines of the dashboard grid,
+// starting a new line when a panel does not fit or a new group begins
+type gridPacker struct {
+	x, y       int
+	lineHeight int
+	group      string
+}
+
+func (p *gridPacker) newLine() {
+	if p.x > 0 {
+		p.y += p.lineHeight
+		p.x, p.lineHeight = 0, 0
+	}
+}
+
+func (p *gridPacker) place(panel *Panel, size PanelSize, group string) {
+	if p.x > 0 && (group != p.group || p.x+size.Width > gridColumns) {
+		p.newLine()
+	}
+	panel.GridPos = GridPos{H: size.Height, W: size.Width, X: p.x, Y: p.y}
+	p.x += size.Width
+	p.lineHeight = max(p.lineHeight, size.Height)
+	p.group = group
+}
+
+// applyLayout re-positions every panel: rows span the grid, and the panels
+// of each operation are packed onto lines of their own
+func applyLayout(dashboard *GrafanaDashboard, layout LayoutConfig) {
+	groups := make(map[int]string)
+	for key, group := range dashboard.operations {
+		for _, id := range group.PanelIDs {
+			groups[id] = key
+		}
+	}
+
+	packer := &gridPacker{}
+	for i := range dashboard.Panels {
+		panel := &dashboard.Panels[i]
+		if panel.Type != "row" {
+			packer.place(panel, layout.size(panel), groups[panel.ID])
+			continue
+		}
+		packer.newLine()
+		panel.GridPos = GridPos{H: 1, W: gridColumns, X: 0, Y: packer.y}
+		packer.y++
+		packer.group = ""
+		// A collapsed row occupies one line; its panels are laid out below
+		// it for when it is expanded
+		children := &gridPacker{y: packer.y}
+		for j := range panel.Panels {
+			child := &panel.Panels[j]
+			children.place(child, layout.size(child), groups[child.ID])
+		}
+	}
+}
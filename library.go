@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// libraryPanelKind is the Grafana library element kind of panels
+const libraryPanelKind = 1
+
+// LibraryPanelRef points a dashboard panel at a library panel
+type LibraryPanelRef struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+}
+
+// LibraryElement is a Grafana library panel definition
+type LibraryElement struct {
+	UID       string `json:"uid"`
+	Name      string `json:"name"`
+	Kind      int    `json:"kind"`
+	FolderUID string `json:"folderUid,omitempty"`
+	Model     Panel  `json:"model"`
+}
+
+// MarshalJSON emits only the reference fields for panels backed by a
+// library panel; Grafana fills in the rest from the library element.
+// Hand-written panels are emitted as given.
+func (p Panel) MarshalJSON() ([]byte, error) {
+	type plain Panel
+	if p.raw != nil {
+		return json.Marshal(p.rawJSON())
+	}
+	if p.LibraryPanel == nil {
+		return json.Marshal(plain(p))
+	}
+	return json.Marshal(struct {
+		ID           int              `json:"id"`
+		Title        string           `json:"title"`
+		GridPos      GridPos          `json:"gridPos"`
+		LibraryPanel *LibraryPanelRef `json:"libraryPanel"`
+	}{p.ID, p.Title, p.GridPos, p.LibraryPanel})
+}
+
+// libraryPanelUID derives a UID from the operation and panel kind only, so
+// every dashboard generated for the operation references the same element
+func libraryPanelUID(key, title string) string {
+	kind := title
+	if i := strings.LastIndex(title, " - "); i >= 0 {
+		kind = title[i+3:]
+	}
+	sum := sha256.Sum256([]byte(key + "|" + kind))
+	return "lp-" + hex.EncodeToString(sum[:10])
+}
+
+// convertToLibraryPanels replaces the operation panels of a dashboard with
+// library panel references and returns the referenced library elements
+func convertToLibraryPanels(dashboard *GrafanaDashboard, folderUID string) []LibraryElement {
+	owner := make(map[int]string)
+	for _, group := range dashboard.operations {
+		for _, id := range group.PanelIDs {
+			owner[id] = group.Key
+		}
+	}
+
+	var elements []LibraryElement
+	for i, panel := range dashboard.Panels {
+		key, ok := owner[panel.ID]
+		if !ok {
+			continue
+		}
+		ref := &LibraryPanelRef{UID: libraryPanelUID(key, panel.Title), Name: panel.Title}
+
+		model := panel
+		model.LibraryPanel = nil
+		elements = append(elements, LibraryElement{
+			UID:       ref.UID,
+			Name:      ref.Name,
+			Kind:      libraryPanelKind,
+			FolderUID: folderUID,
+			Model:     model,
+		})
+		dashboard.Panels[i].LibraryPanel = ref
+	}
+	return elements
+}
+
+// dedupeLibraryElements drops repeated elements, keeping the first of each UID
+func dedupeLibraryElements(elements []LibraryElement) []LibraryElement {
+	seen := make(map[string]bool, len(elements))
+	var unique []LibraryElement
+	for _, element := range elements {
+		if !seen[element.UID] {
+			seen[element.UID] = true
+			unique = append(unique, element)
+		}
+	}
+	return unique
+}
+
+// libraryPanelsFile returns where library elements are written next to the dashboard output
+func libraryPanelsFile(config *Config) string {
+	if config.SplitDir != "" {
+		return filepath.Join(config.SplitDir, "library-panels"+outputExtension(config.OutputEncoding))
+	}
+	return config.outputBase() + ".library-panels" + outputExtension(config.OutputEncoding)
+}
+
+// libraryElementResponse wraps library element API results
+type libraryElementResponse struct {
+	Result struct {
+		UID     string `json:"uid"`
+		Version int    `json:"version"`
+	} `json:"result"`
+}
+
+// PushLibraryPanel creates the library panel, or updates it when the UID exists
+func (c *GrafanaClient) PushLibraryPanel(ctx context.Context, element LibraryElement) error {
+	var existing libraryElementResponse
+	err := c.do(ctx, http.MethodGet, "/api/library-elements/"+element.UID, nil, &existing)
+
+	var pushErr *PushError
+	switch {
+	case errors.As(err, &pushErr) && pushErr.StatusCode == http.StatusNotFound:
+		body, err := json.Marshal(element)
+		if err != nil {
+			return fmt.Errorf("error marshaling library panel: %w", err)
+		}
+		return c.do(ctx, http.MethodPost, "/api/library-elements", body, nil)
+	case err != nil:
+		return err
+	}
+
+	body, err := json.Marshal(struct {
+		LibraryElement
+		Version int `json:"version"`
+	}{element, existing.Result.Version})
+	if err != nil {
+		return fmt.Errorf("error marshaling library panel: %w", err)
+	}
+	return c.do(ctx, http.MethodPatch, "/api/library-elements/"+element.UID, body, nil)
+}
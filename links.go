@@ -0,0 +1,75 @@
+package main
+
+import "strings"
+
+// runbookExtension names the runbook of a spec, at the root or in info
+const runbookExtension = "x-runbook"
+
+// dashboardLinks builds the links of a generated dashboard: the runbook,
+// documentation, contact and servers of every spec, followed by a dropdown
+// of the related generated dashboards
+func dashboardLinks(specs []LoadedSpec) []Link {
+	seen := make(map[string]bool)
+	var links []Link
+	add := func(title, url, icon string) {
+		if url == "" || seen[url] {
+			return
+		}
+		seen[url] = true
+		links = append(links, Link{
+			Icon:        icon,
+			Tags:        []string{},
+			Title:       title,
+			Type:        "link",
+			URL:         url,
+			TargetBlank: true,
+		})
+	}
+
+	for _, spec := range specs {
+		doc := spec.Doc
+		if doc == nil {
+			continue
+		}
+		runbook, _ := doc.Extensions[runbookExtension].(string)
+		if doc.Info != nil && runbook == "" {
+			runbook, _ = doc.Info.Extensions[runbookExtension].(string)
+		}
+		add("Runbook", runbook, "bolt")
+		if doc.ExternalDocs != nil {
+			title := doc.ExternalDocs.Description
+			if title == "" {
+				title = "API Documentation"
+			}
+			add(title, doc.ExternalDocs.URL, "doc")
+		}
+		if doc.Info != nil && doc.Info.Contact != nil {
+			title := doc.Info.Contact.Name
+			if title == "" {
+				title = "Contact"
+			}
+			add(title, doc.Info.Contact.URL, "info")
+		}
+		for _, server := range doc.Servers {
+			// Templated server URLs cannot be opened as they are
+			if strings.Contains(server.URL, "{") {
+				continue
+			}
+			title := server.Description
+			if title == "" {
+				title = server.URL
+			}
+			add(title, server.URL, "cloud")
+		}
+	}
+
+	return append(links, Link{
+		AsDropdown:  true,
+		Icon:        "external link",
+		IncludeVars: true,
+		KeepTime:    true,
+		Tags:        []string{"generated", "api"},
+		Title:       "Related Dashboards",
+		Type:        "dashboards",
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+// ListedOperation is an operation of the spec and what the current flags and
+// config generate for it
+type ListedOperation struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Tag         string   `json:"tag"`
+	OperationID string   `json:"operationId"`
+	Panels      []string `json:"panels"`
+	Alerts      []string `json:"alerts"`
+	// Thresholds are the latency (seconds) and error rate (percent)
+	// thresholds resolved for the operation
+	Thresholds ThresholdOverride `json:"thresholds"`
+	// Note tells why the operation has no panels of its own: the filter flag
+	// excluding it, or how the dashboard was summarized
+	Note string `json:"note,omitempty"`
+}
+
+// runList implements the list subcommand: it generates the dashboard with
+// the generation flags and config, writes nothing, and prints every
+// operation of the spec with its panels and alerts
+func runList(args []string) error {
+	asJSON := false
+	var rest []string
+	for _, arg := range args {
+		if arg == "--json" {
+			asJSON = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	if len(rest) == 0 || strings.HasPrefix(rest[0], "--") {
+		return fmt.Errorf("usage: openapi2grafana list <spec> [generation flags] [--json]")
+	}
+
+	config, err := parseArgs(rest)
+	if err != nil {
+		return err
+	}
+	logger, err := newLogger(os.Stderr, config.LogLevel, config.LogFormat)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fetcher := NewSpecFetcher("")
+	fetcher.SkipValidation = config.SkipValidation
+	fetcher.Refs = config.refOptions()
+	input, err := loadGenerationInput(ctx, fetcher, append([]string{config.InputFile}, config.MergeFiles...), config)
+	if err != nil {
+		return err
+	}
+	dashboard := generateDashboard(ctx, input, config, calculateSpecHash(input.Specs))
+	listed := listOperations(input.Specs, config, &dashboard)
+
+	if asJSON {
+		data, err := json.MarshalIndent(listed, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling operations: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printOperations(listed)
+	return nil
+}
+
+// listOperations lists every operation of the specs, filtered out or not,
+// with the panel kinds and alerts of the dashboard's group for it
+func listOperations(specs []LoadedSpec, config *Config, dashboard *GrafanaDashboard) []ListedOperation {
+	ops, shared := collectMergedOperations(specs, config.SortOrder)
+	listed := make([]ListedOperation, 0, len(ops)+len(shared))
+	for _, op := range append(ops, shared...) {
+		entry := ListedOperation{
+			Method:     strings.ToUpper(op.Method),
+			Path:       op.Path,
+			Tag:        op.Tag,
+			Panels:     []string{},
+			Alerts:     []string{},
+			Thresholds: thresholdOverride(config.operationThresholds(op)),
+		}
+		if op.Operation != nil {
+			entry.OperationID = op.Operation.OperationID
+		}
+
+		if reason := config.Filter.rejection(op); reason != "" {
+			entry.Note = "excluded by " + reason
+			listed = append(listed, entry)
+			continue
+		}
+		key := op.Key()
+		if _, ok := dashboard.operations[key]; !ok && config.AggregateBy != "" {
+			for groupKey, group := range dashboard.operations {
+				if group.Path == op.Path {
+					key = groupKey
+					entry.Note = "aggregated by path into " + groupKey
+				}
+			}
+		}
+		_, panels, ok := dashboard.OperationPanels(key)
+		if expanded := expandPathEnums([]OperationInfo{op}); !ok && config.PathEnums == pathEnumsExpand && len(expanded) > 1 {
+			for _, concrete := range expanded {
+				_, concretePanels, found := dashboard.OperationPanels(concrete.Key())
+				panels = append(panels, concretePanels...)
+				ok = ok || found
+			}
+			entry.Note = fmt.Sprintf("expanded into %d enum paths", len(expanded))
+		}
+		switch {
+		case ok:
+		case slices.Contains(dashboard.collapsed, entry.Method+" "+op.Path):
+			entry.Note = "collapsed by --max-panels (" + dashboard.summarized + ")"
+		case dashboard.summarized != "":
+			entry.Note = "summarized by --max-panels (" + dashboard.summarized + ")"
+		default:
+			entry.Note = "no panels"
+		}
+		for _, panel := range panels {
+			kind := panel.Title
+			if i := strings.LastIndex(kind, " - "); i >= 0 {
+				kind = kind[i+3:]
+			}
+			entry.Panels = append(entry.Panels, kind)
+			if panel.Alert != nil {
+				entry.Alerts = append(entry.Alerts, panel.Alert.Name)
+			}
+		}
+		listed = append(listed, entry)
+	}
+	return listed
+}
+
+// printOperations prints the operations as a table
+func printOperations(listed []ListedOperation) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tTAG\tOPERATION ID\tLATENCY\tERRORS\tPANELS\tALERTS")
+	panels, alerts := 0, 0
+	for _, op := range listed {
+		content := strings.Join(op.Panels, ", ")
+		if op.Note != "" {
+			content = strings.TrimPrefix(content+"; "+op.Note, "; ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%gs/%gs\t%g%%/%g%%\t%s\t%s\n",
+			op.Method, op.Path, dashIfEmpty(op.Tag), dashIfEmpty(op.OperationID),
+			*op.Thresholds.LatencyWarning, *op.Thresholds.LatencyCritical,
+			*op.Thresholds.ErrorWarning, *op.Thresholds.ErrorCritical,
+			dashIfEmpty(content), dashIfEmpty(strings.Join(op.Alerts, ", ")))
+		panels += len(op.Panels)
+		alerts += len(op.Alerts)
+	}
+	w.Flush()
+	fmt.Printf("\n%d operations, %d operation panels, %d alerts\n", len(listed), panels, alerts)
+}
+
+// dashIfEmpty fills empty table cells
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package main
+
+// k6 names the requests of a load test by their name tag; scripts set it to
+// the operationId, or "METHOD path" for operations without one, to be
+// matched with the spec. testIDVariable selects the test run by its testid
+// tag.
+const (
+	k6NameLabel    = "name"
+	testIDVariable = "testid"
+)
+
+// k6TestVariable lists the test runs written by k6's Prometheus remote write
+// output
+func k6TestVariable() VariableConfig {
+	return VariableConfig{
+		Name:        testIDVariable,
+		Label:       "Test Run",
+		Query:       "label_values(k6_vus, testid)",
+		Description: "k6 test run, from the testid tag",
+	}
+}
+
+// addLoadTestPanels appends a "Load Test (k6)" row with the virtual users
+// of the test runs and, per operation, the request rate, latency
+// percentiles and failure rate of the k6 requests named after it. The
+// latency panels query the p95 and p99 trend stats, which k6 writes when
+// K6_PROMETHEUS_RW_TREND_STATS includes p(95),p(99).
+func addLoadTestPanels(dashboard *GrafanaDashboard, ops []OperationInfo, cursor *panelCursor) {
+	var tested []OperationInfo
+	for _, op := range ops {
+		if streamProtocol(op.Operation) == "" {
+			tested = append(tested, op)
+		}
+	}
+	if len(tested) == 0 {
+		return
+	}
+	run := func(metric string) promSelector {
+		return selectorOf(metric, testIDVariable+`=~"$`+testIDVariable+`"`)
+	}
+
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Load Test (k6)", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	dashboard.Panels = append(dashboard.Panels, createStreamingPanel(cursor.ID, "Virtual Users",
+		"Virtual users of the selected test runs", "short", cursor.Height, cursor.Y, []Target{
+			{Expr: promSum(run("k6_vus").String(), testIDVariable), LegendFormat: "{{" + testIDVariable + "}}", RefID: "A"},
+		}))
+	cursor.ID++
+	cursor.Y += cursor.Height
+
+	for _, op := range tested {
+		name := op.Key()
+		requests := run("k6_http_reqs_total").eq(k6NameLabel, name)
+		title := name + " - Load Test"
+
+		panels := []Panel{
+			createStreamingPanel(cursor.ID, title+" Request Rate",
+				"Requests per second k6 sent to the operation, by status", "reqps", cursor.Height, cursor.Y, []Target{
+					{Expr: promSum(promRate(requests), "status"), LegendFormat: "Status {{status}}", RefID: "A"},
+				}),
+			createStreamingPanel(cursor.ID+1, title+" Latency",
+				"Request duration percentiles measured by k6, the highest of its series", "s", cursor.Height, cursor.Y+cursor.Height, []Target{
+					{Expr: "max(" + run("k6_http_req_duration_p99").eq(k6NameLabel, name).String() + ")", LegendFormat: "p99", RefID: "A"},
+					{Expr: "max(" + run("k6_http_req_duration_p95").eq(k6NameLabel, name).String() + ")", LegendFormat: "p95", RefID: "B"},
+				}),
+			createStreamingPanel(cursor.ID+2, title+" Failure Rate",
+				"Share of the k6 requests that failed, per k6's expected statuses", "percentunit", cursor.Height, cursor.Y+2*cursor.Height, []Target{
+					{Expr: "avg(" + run("k6_http_req_failed_rate").eq(k6NameLabel, name).String() + ")", LegendFormat: "Failed", RefID: "A"},
+				}),
+		}
+		dashboard.Panels = append(dashboard.Panels, panels...)
+		cursor.ID += len(panels)
+		cursor.Y += len(panels) * cursor.Height
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Formats of --log-format
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// parseLogLevel parses a --log-level value, info when empty
+func parseLogLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("invalid --log-level value %q: must be debug, info, warn or error", level)
+	}
+	return parsed, nil
+}
+
+// validateLogging checks the --log-level and --log-format values
+func validateLogging(level, format string) error {
+	if _, err := parseLogLevel(level); err != nil {
+		return err
+	}
+	if format != "" && format != logFormatText && format != logFormatJSON {
+		return fmt.Errorf("invalid --log-format value %q: must be \"text\" or \"json\"", format)
+	}
+	return nil
+}
+
+// newLogger returns a logger writing the records at or above level to w,
+// as logfmt text or JSON
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	if err := validateLogging(level, format); err != nil {
+		return nil, err
+	}
+	parsed, _ := parseLogLevel(level)
+	options := &slog.HandlerOptions{Level: parsed}
+	if format == logFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, options)), nil
+}
+
+// fatal logs an error ending the run and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(exitError)
+}
+
+// summaryHandler records the warnings logged during a run in the run
+// summary, passing every record on
+type summaryHandler struct {
+	slog.Handler
+	summary *RunSummary
+	mu      *sync.Mutex
+}
+
+func newSummaryHandler(handler slog.Handler, summary *RunSummary) *summaryHandler {
+	return &summaryHandler{Handler: handler, summary: summary, mu: &sync.Mutex{}}
+}
+
+func (h *summaryHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelWarn {
+		warning := []string{record.Message}
+		record.Attrs(func(attr slog.Attr) bool {
+			warning = append(warning, attr.String())
+			return true
+		})
+		h.mu.Lock()
+		h.summary.Warnings = append(h.summary.Warnings, strings.Join(warning, " "))
+		h.mu.Unlock()
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *summaryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &summaryHandler{Handler: h.Handler.WithAttrs(attrs), summary: h.summary, mu: h.mu}
+}
+
+func (h *summaryHandler) WithGroup(name string) slog.Handler {
+	return &summaryHandler{Handler: h.Handler.WithGroup(name), summary: h.summary, mu: h.mu}
+}
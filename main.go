@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -15,40 +23,299 @@ import (
 
 // Config holds the configuration for dashboard generation
 type Config struct {
-	InputFile      string
-	OutputFile     string
-	DashboardUID   string
-	DashboardTitle string
-	DataSource     string
-	Environment    string
-	UpdateMode     bool
-	IncludeGRPC    bool
+	InputFile       string
+	OutputFile      string
+	DashboardUID    string
+	DashboardTitle  string
+	DataSource      string
+	Environment     string
+	UpdateMode      bool
+	IncludeGRPC     bool
+	SortOrder       string
+	MergeFiles      []string
+	Push            bool
+	GrafanaURL      string
+	GrafanaToken    string
+	FolderUID       string
+	ProtoFiles      []string
+	GRPCReflect     []string
+	GRPCReflectTLS  bool
+	SpecCacheDir    string
+	BrokerPreset    string
+	SLOTarget       float64
+	SLOWindow       string
+	PrometheusURL   string
+	Coverage        bool
+	StatusBreakdown bool
+	Variant         string
+	RulesOutput     string
+	SplitDir        string
+	OutputEncoding  string
+	LibraryPanels   bool
+	// Timeout bounds a whole generation run, including pushes; 0 means none
+	Timeout    time.Duration
+	ConfigFile string
+	File       *FileConfig
+	// GrafanaVersion selects the dashboard schema to emit; empty keeps schemaVersion 30
+	GrafanaVersion string
+	// DryRun prints the generation plan instead of writing files or pushing
+	DryRun bool
+	Filter OperationFilter
+	// DeprecatedRow tracks deprecated operations in a single row instead of full panel sets
+	DeprecatedRow bool
+	// Environments overrides the environment variable options derived from the specs
+	Environments []EnvironmentOption
+	// ExtraSelector holds label matchers injected into every generated query
+	ExtraSelector string
+	// QueryFrontend tunes queries for Thanos/Mimir query frontends
+	QueryFrontend bool
+	// MaxCardinality is the series count a panel may touch, 0 means unchecked
+	MaxCardinality int
+	// SkipValidation generates from specs that fail validation, as long as
+	// they load
+	SkipValidation bool
+	// ExpectedErrors separates the error responses the spec documents from
+	// the undocumented ones
+	ExpectedErrors bool
+	// NativeHistograms queries Prometheus native histograms instead of
+	// classic _bucket series
+	NativeHistograms bool
+	// CachePanels adds cache hit ratio panels to GET operations
+	CachePanels bool
+	// AvailabilityPanel adds a gauge of the weighted availability of all
+	// operations at the top of the dashboard
+	AvailabilityPanel bool
+	// RateLimitPanels adds throttling panels to every operation, not only
+	// those declaring a rate limit
+	RateLimitPanels bool
+	// ValidationPanels adds request validation failure panels to the
+	// operations with parameters or a request body
+	ValidationPanels bool
+	// CanaryLabel adds panels comparing the canary and stable deployments of
+	// every operation, told apart by this label
+	CanaryLabel string
+	// MultiRegion adds per-region panels to every operation, with region
+	// and cluster variables
+	MultiRegion bool
+	// RemoteRefs is allow or block for $refs to http(s) URLs; empty allows
+	// them in remote specs only
+	RemoteRefs string
+	// RefBaseDir is the directory relative file $refs resolve against
+	RefBaseDir string
+	// RefHeaders are "[host=]Name: value" headers sent when fetching remote
+	// specs and $refs
+	RefHeaders []string
+	// MaxPanels is the panel count above which operations are summarized per
+	// tag or as repeated rows, 0 means unlimited
+	MaxPanels int
+	// CardinalityMode is fail (the default) or warn
+	CardinalityMode string
+	// Snapshot creates a Grafana snapshot of every pushed dashboard
+	Snapshot         bool
+	SnapshotExternal bool
+	// SnapshotExpires is the snapshot lifetime, 0 keeps snapshots forever
+	SnapshotExpires time.Duration
+	// GrafanaAuth holds the other ways to authenticate to and reach Grafana
+	GrafanaAuth GrafanaAuth
+	// Time holds the refresh, time range, timezone and week start flags
+	Time TimeSettings
+	// Titles holds the panel title template, path prefix and length flags
+	Titles TitleSettings
+	// SkipDataSourceCheck pushes without looking the data source up in
+	// Grafana, keeping the --datasource name
+	SkipDataSourceCheck bool
+	// Public leaves internal operations and panels out and enables public
+	// sharing of pushed dashboards
+	Public bool
+	// RunbookPanels adds a Markdown documentation panel to every operation
+	RunbookPanels bool
+	// AggregateBy collapses the methods of a path into one panel set when "path"
+	AggregateBy string
+	// PathEnums handles path parameters with an enum: "expand" generates a
+	// panel set per value, "variable" a dashboard variable of the values
+	PathEnums string
+	// Layout is the layout mode, overriding the config file's
+	Layout string
+	// StaleWindow adds a panel per operation flagging it when it received no
+	// requests over this Prometheus duration, and no-traffic alerts with alerts on
+	StaleWindow string
+	// Drift adds a table comparing the paths receiving traffic with the spec
+	Drift bool
+	// ScrapeConfigOutput is the file the scrape config stub is written to
+	ScrapeConfigOutput string
+	// ScrapeConfigFormat is prometheus (the default) or otel
+	ScrapeConfigFormat string
+	// SyntheticChecks adds blackbox exporter probe panels for the endpoints
+	// of the spec's servers
+	SyntheticChecks bool
+	// LoadTestPanels adds panels of k6 load test results per operation
+	LoadTestPanels bool
+	// ProbeConfigOutput is the file the blackbox exporter scrape config is
+	// written to
+	ProbeConfigOutput string
+	// Instrumentation emits metrics scaffolding for the service: go or generic
+	Instrumentation string
+	// Theme is the dashboard style, dark or light, overriding the config file's
+	Theme string
+	// UIDTemplate and TitleTemplate name the dashboard from the spec, see NameTemplateData
+	UIDTemplate   string
+	TitleTemplate string
+	// PanelTitles is what operation panels, legends and alerts are named
+	// after: "operation-id" (the default) or "path"
+	PanelTitles string
+	// Force pushes over dashboards that were not generated by this tool
+	Force bool
+	// PreviousSpec is the spec version the dashboard was generated from
+	// before, diffed against the input spec for the changelog
+	PreviousSpec string
+	// ChangelogOutput is the file the Markdown changelog is written to
+	ChangelogOutput string
+	// ChangelogPanel adds the changelog to the dashboard as a text panel
+	ChangelogPanel bool
+	// SummaryJSON prints a JSON summary of the run to stdout
+	SummaryJSON bool
+	// LogLevel and LogFormat configure the logger on stderr: debug, info
+	// (the default), warn or error, as text (the default) or json
+	LogLevel  string
+	LogFormat string
+	// Prune is what --update does with the panels of operations removed from
+	// the spec: delete (the default), keep or orphan
+	Prune string
+	// CPUProfile and MemProfile are the files the CPU and heap profiles of
+	// the run are written to
+	CPUProfile string
+	MemProfile string
 }
 
-// DashboardMetadata tracks dashboard versions and updates
-type DashboardMetadata struct {
-	Version     int       `json:"version"`
-	Generated   time.Time `json:"generated"`
-	SpecHash    string    `json:"spec_hash"`
-	LastUpdated time.Time `json:"last_updated"`
+// OperationInfo describes a single HTTP operation discovered in the spec
+type OperationInfo struct {
+	Path      string
+	Method    string
+	Tag       string
+	Operation *openapi3.Operation
+	// Services lists every merged spec that defines this operation; more
+	// than one entry means the operation is shared
+	Services []string
+	// SecuritySchemes names the schemes securing the operation, if any
+	SecuritySchemes []string
+	// Methods lists the methods collapsed into this operation by
+	// --aggregate-by path; Method is then their alternation, e.g. GET|POST
+	Methods []string
+	// PathParameters are the parameters of the path item, shared by its
+	// operations
+	PathParameters openapi3.Parameters
+}
+
+// OperationPanels returns the panels generated for the operation with the given key
+func (d *GrafanaDashboard) OperationPanels(key string) (OperationPanels, []Panel, bool) {
+	group, ok := d.operations[key]
+	if !ok {
+		return OperationPanels{}, nil, false
+	}
+
+	ids := make(map[int]bool, len(group.PanelIDs))
+	for _, id := range group.PanelIDs {
+		ids[id] = true
+	}
+	var panels []Panel
+	for _, panel := range d.Panels {
+		if ids[panel.ID] {
+			panels = append(panels, panel)
+		}
+	}
+	return group, panels, true
+}
+
+// Key returns the operationId, falling back to "METHOD path"
+func (op OperationInfo) Key() string {
+	if op.Operation != nil && op.Operation.OperationID != "" {
+		return op.Operation.OperationID
+	}
+	return strings.ToUpper(op.Method) + " " + op.Path
+}
+
+// LoadedSpec is a parsed OpenAPI document and the service it describes
+type LoadedSpec struct {
+	File    string
+	Service string
+	Doc     *openapi3.T
+	Data    []byte
+	Source  SpecSource
+	// Async is set when the spec is an AsyncAPI document
+	Async *AsyncAPIDoc
+	// GRPCOnly is set when the spec stands in for gRPC services given
+	// without an OpenAPI spec
+	GRPCOnly bool
+}
+
+// GenerationInput is everything a dashboard is generated from
+type GenerationInput struct {
+	Specs       []LoadedSpec
+	GRPCMethods []GRPCMethod
+	// ErrorBudgets holds the live error budget per "METHOD path" in SLO mode
+	ErrorBudgets map[string]ErrorBudget
+	// Changelog holds the changes since --previous-spec, if given
+	Changelog *SpecChangelog
+	// TitlePrefix is left out of paths in panel titles
+	TitlePrefix string
+	// Visibility is set when the specs mark operations public or internal,
+	// whose alerts are then labeled with a severity
+	Visibility bool
+	// GatewayMethods maps the routes ("METHOD path") of grpc-gateway specs
+	// to the gRPC methods serving them
+	GatewayMethods map[string]GRPCMethod
+}
+
+// panelCursor tracks the next panel ID and vertical position while laying out panels
+type panelCursor struct {
+	ID     int
+	Y      int
+	Height int
 }
 
 type GrafanaDashboard struct {
-	Title         string            `json:"title"`
-	Panels        []Panel           `json:"panels"`
-	Templating    Templating        `json:"templating"`
-	Time          Time              `json:"time"`
-	Timepicker    Timepicker        `json:"timepicker"`
-	Tags          []string          `json:"tags"`
-	Style         string            `json:"style"`
-	Editable      bool              `json:"editable"`
-	UID           string            `json:"uid"`
-	SchemaVersion int               `json:"schemaVersion"`
-	Version       int               `json:"version"`
-	Annotations   Annotations       `json:"annotations"`
-	Links         []Link            `json:"links"`
-	Refresh       string            `json:"refresh"`
-	Meta          DashboardMetadata `json:"meta"`
+	Title         string      `json:"title"`
+	Panels        []Panel     `json:"panels"`
+	Templating    Templating  `json:"templating"`
+	Time          Time        `json:"time"`
+	Timepicker    Timepicker  `json:"timepicker"`
+	Tags          []string    `json:"tags"`
+	Style         string      `json:"style,omitempty"`
+	Editable      bool        `json:"editable"`
+	UID           string      `json:"uid"`
+	SchemaVersion int         `json:"schemaVersion"`
+	Version       int         `json:"version"`
+	Annotations   Annotations `json:"annotations"`
+	Links         []Link      `json:"links"`
+	Refresh       string      `json:"refresh"`
+	Timezone      string      `json:"timezone,omitempty"`
+	WeekStart     string      `json:"weekStart,omitempty"`
+
+	// operations maps each operation key to its generated panel group
+	operations map[string]OperationPanels
+	// summarized is how the panels were summarized to fit --max-panels, tag
+	// or repeat, and collapsed lists the operations without their own panels
+	summarized string
+	collapsed  []string
+	// placedMixins are the indexes of the mixins already inserted
+	placedMixins map[int]bool
+	// transforms are applied to the marshaled dashboard
+	transforms []TransformConfig
+}
+
+// OperationPanels identifies the panels generated for one operation
+type OperationPanels struct {
+	Key      string `json:"operationId"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	PanelIDs []int  `json:"panelIds"`
+	// Title is what the panels of the operation are titled after
+	Title string `json:"title,omitempty"`
+}
+
+// operation returns "METHOD path", which the panels of the operation record
+func (g OperationPanels) operation() string {
+	return g.Method + " " + g.Path
 }
 
 type Templating struct {
@@ -60,13 +327,23 @@ type Annotations struct {
 }
 
 type Annotation struct {
-	BuiltIn    int    `json:"builtIn"`
-	Datasource string `json:"datasource"`
-	Enable     bool   `json:"enable"`
-	Hide       bool   `json:"hide"`
-	IconColor  string `json:"iconColor"`
-	Name       string `json:"name"`
-	Type       string `json:"type"`
+	BuiltIn    int         `json:"builtIn"`
+	Datasource interface{} `json:"datasource"`
+	Enable     bool        `json:"enable"`
+	Hide       bool        `json:"hide"`
+	IconColor  string      `json:"iconColor"`
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+
+	// Tags and Limit filter Grafana annotations (type tags)
+	Tags  []string `json:"tags,omitempty"`
+	Limit int      `json:"limit,omitempty"`
+	// Expr and the formats define Prometheus and Loki annotation queries
+	Expr        string `json:"expr,omitempty"`
+	Step        string `json:"step,omitempty"`
+	TitleFormat string `json:"titleFormat,omitempty"`
+	TextFormat  string `json:"textFormat,omitempty"`
+	TagKeys     string `json:"tagKeys,omitempty"`
 }
 
 type Link struct {
@@ -78,6 +355,7 @@ type Link struct {
 	Title       string   `json:"title"`
 	Type        string   `json:"type"`
 	URL         string   `json:"url"`
+	TargetBlank bool     `json:"targetBlank,omitempty"`
 }
 
 type Panel struct {
@@ -95,6 +373,21 @@ type Panel struct {
 	Description string           `json:"description,omitempty"`
 	Thresholds  *PanelThresholds `json:"thresholds,omitempty"`
 	Alert       *Alert           `json:"alert,omitempty"`
+	// LibraryPanel makes this panel a reference to a library panel
+	LibraryPanel *LibraryPanelRef `json:"libraryPanel,omitempty"`
+	// MaxDataPoints caps the points per series requested, 0 leaves it to Grafana
+	MaxDataPoints int `json:"maxDataPoints,omitempty"`
+	// Transformations reshape the query results before display
+	Transformations []Transformation `json:"transformations,omitempty"`
+	// Repeat repeats the panel, a row with its panels, per value of a variable
+	Repeat string `json:"repeat,omitempty"`
+	// Links are the links of the panel header
+	Links []DataLink `json:"links,omitempty"`
+	// fixedSize keeps a size given by the spec author through layout changes
+	fixedSize bool
+	// raw is the definition of a hand-written panel, written out as given
+	// apart from its id and gridPos, see rawJSON
+	raw map[string]interface{}
 }
 
 type PanelThresholds struct {
@@ -116,6 +409,10 @@ type Alert struct {
 	For                 string              `json:"for"`
 	NoDataState         string              `json:"noDataState"`
 	Notifications       []AlertNotification `json:"notifications"`
+	AlertRuleTags       map[string]string   `json:"alertRuleTags,omitempty"`
+	// contactPoints name the contact points Notifications are resolved
+	// from when pushing
+	contactPoints []string
 }
 
 type AlertCondition struct {
@@ -147,7 +444,8 @@ type AlertReducer struct {
 }
 
 type AlertNotification struct {
-	ID int `json:"id"`
+	ID  int    `json:"id,omitempty"`
+	UID string `json:"uid,omitempty"`
 }
 
 type Target struct {
@@ -179,6 +477,9 @@ type Options struct {
 	ShowThresholdLabels  bool           `json:"showThresholdLabels,omitempty"`
 	ShowThresholdMarkers bool           `json:"showThresholdMarkers,omitempty"`
 	Text                 TextOptions    `json:"text,omitempty"`
+	// Mode and Content are the options of text panels
+	Mode    string `json:"mode,omitempty"`
+	Content string `json:"content,omitempty"`
 }
 
 type LegendOptions struct {
@@ -209,19 +510,37 @@ type FieldConfig struct {
 
 type FieldConfigDefaults struct {
 	Color       ColorOptions     `json:"color"`
+	Custom      *FieldCustom     `json:"custom,omitempty"`
 	Thresholds  ThresholdOptions `json:"thresholds"`
 	Unit        string           `json:"unit,omitempty"`
 	Min         *float64         `json:"min,omitempty"`
 	Max         *float64         `json:"max,omitempty"`
 	Decimals    *int             `json:"decimals,omitempty"`
+	Links       []DataLink       `json:"links,omitempty"`
 	DisplayName string           `json:"displayName,omitempty"`
 }
 
+type FieldCustom struct {
+	FillOpacity int              `json:"fillOpacity,omitempty"`
+	Stacking    *StackingOptions `json:"stacking,omitempty"`
+}
+
+type StackingOptions struct {
+	Mode  string `json:"mode"`
+	Group string `json:"group"`
+}
+
 type FieldOverride struct {
 	Matcher    FieldMatcher    `json:"matcher"`
 	Properties []FieldProperty `json:"properties"`
 }
 
+// Transformation is a Grafana panel transformation, e.g. organize
+type Transformation struct {
+	ID      string                 `json:"id"`
+	Options map[string]interface{} `json:"options"`
+}
+
 type FieldMatcher struct {
 	ID      string `json:"id"`
 	Options string `json:"options"`
@@ -247,21 +566,21 @@ type ThresholdStep struct {
 }
 
 type Variable struct {
-	Name        string   `json:"name"`
-	Label       string   `json:"label"`
-	Query       string   `json:"query"`
-	Current     Current  `json:"current"`
-	Type        string   `json:"type"`
-	Options     []Option `json:"options"`
-	Datasource  string   `json:"datasource,omitempty"`
-	Refresh     int      `json:"refresh"`
-	IncludeAll  bool     `json:"includeAll"`
-	AllValue    string   `json:"allValue,omitempty"`
-	Sort        int      `json:"sort,omitempty"`
-	Multi       bool     `json:"multi,omitempty"`
-	Definition  string   `json:"definition,omitempty"`
-	Description string   `json:"description,omitempty"`
-	Hide        int      `json:"hide,omitempty"`
+	Name        string      `json:"name"`
+	Label       string      `json:"label"`
+	Query       string      `json:"query"`
+	Current     Current     `json:"current"`
+	Type        string      `json:"type"`
+	Options     []Option    `json:"options"`
+	Datasource  interface{} `json:"datasource,omitempty"`
+	Refresh     int         `json:"refresh"`
+	IncludeAll  bool        `json:"includeAll"`
+	AllValue    string      `json:"allValue,omitempty"`
+	Sort        int         `json:"sort,omitempty"`
+	Multi       bool        `json:"multi,omitempty"`
+	Definition  string      `json:"definition,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Hide        int         `json:"hide,omitempty"`
 }
 
 type Current struct {
@@ -287,109 +606,965 @@ type Timepicker struct {
 }
 
 func main() {
-	config := parseArgs()
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(exitValidationError)
+	}
+	switch os.Args[1] {
+	case "version":
+		if err := runVersion(os.Args[2:]); err != nil {
+			fatal("failed", err)
+		}
+		return
+	case "coverage":
+		if err := runCoverage(os.Args[2:]); err != nil {
+			fatal("failed", err)
+		}
+		return
+	case "validate":
+		if err := runValidate(os.Args[2:]); err != nil {
+			fatal("failed", err)
+		}
+		return
+	case "serve":
+		if err := runServe(os.Args[2:]); err != nil {
+			fatal("server failed", err)
+		}
+		return
+	case "init":
+		if err := runInit(os.Args[2:]); err != nil {
+			fatal("failed", err)
+		}
+		return
+	case "list":
+		if err := runList(os.Args[2:]); err != nil {
+			fatal("failed", err)
+		}
+		return
+	case "plugins":
+		if err := runPlugins(os.Args[2:]); err != nil {
+			fatal("failed", err)
+		}
+		return
+	}
+
+	config, err := parseArgs(os.Args[1:])
+	summary := newRunSummary()
+	if config.SummaryJSON || config.writesToStdout() {
+		// Keep stdout for the dashboard or the summary, everything else is
+		// printed to stderr
+		resultStdout = os.Stdout
+		os.Stdout = os.Stderr
+	}
+	logger, logErr := newLogger(os.Stderr, config.LogLevel, config.LogFormat)
+	if logErr != nil {
+		// Reported by parseArgs, log it with the defaults
+		logger, _ = newLogger(os.Stderr, "", "")
+	}
+	if config.SummaryJSON {
+		logger = slog.New(newSummaryHandler(logger.Handler(), summary))
+	}
+	slog.SetDefault(logger)
 
-	if err := generateDashboardFromConfig(config); err != nil {
-		log.Fatalf("Error generating dashboard: %v", err)
+	if err == nil {
+		err = runGeneration(config, summary)
+	}
+	code := summary.finish(err)
+	if config.SummaryJSON {
+		if err := summary.write(resultStdout); err != nil {
+			slog.Error("writing run summary failed", "error", err)
+		}
+	}
+	if err != nil {
+		var specErr *SpecValidationError
+		if errors.As(err, &specErr) {
+			for _, issue := range specErr.Issues {
+				slog.Error("spec problem", "line", issue.Line, "pointer", issue.Pointer, "problem", issue.Message)
+			}
+		}
+		slog.Error("generating dashboard failed", "error", err)
+		os.Exit(code)
 	}
 }
 
-func parseArgs() *Config {
-	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run main.go <openapi-spec-file> [output-file] [--update] [--uid <uid>]")
+// runGeneration generates the dashboard of a parsed config, profiling the
+// run when requested
+func runGeneration(config *Config, summary *RunSummary) error {
+	// Interrupts cancel loading, Prometheus queries and pushes in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	stopProfiling, err := startProfiling(config.CPUProfile, config.MemProfile)
+	if err != nil {
+		return fmt.Errorf("profiling failed: %w", err)
+	}
+	err = generateDashboardFromConfig(ctx, config, summary)
+	if profileErr := stopProfiling(); profileErr != nil {
+		slog.Error("profiling failed", "error", profileErr)
 	}
+	return err
+}
 
-	config := &Config{
-		InputFile:      os.Args[1],
-		OutputFile:     "grafana_dashboard.json",
+const usage = `Usage: openapi2grafana <openapi-spec-file|-> [output-file|-] [--update] [--uid <uid>] [--sort tag|path] [--merge <spec>]...
+                       [--push] [--grafana-url <url>] [--grafana-token <token>] [--folder-uid <uid>]
+                       [--grafana-user <user>] [--grafana-token-file <file>] [--grafana-proxy <url>]
+                       [--grafana-cert <file> --grafana-key <file>] [--grafana-ca <file>]
+                       [--proto <descriptor-set>]... [--grpc-reflect <host:port>]... [--grpc-reflect-tls]
+                       [--spec-cache-dir <dir>] [--broker-preset kafka|rabbitmq|generic]
+                       [--slo-target <percent>] [--slo-window <duration>] [--prometheus-url <url>]
+                       [--coverage] [--drift] [--status-breakdown] [--expected-errors] [--native-histograms]
+                       [--refresh <interval>|off] [--time-from <time>] [--time-to <time>]
+                       [--timezone browser|utc|<zone>] [--week-start monday|saturday|sunday] [--variant operational|trends|repeat] [--rules-output <file>]
+                       [--split-dir <dir>] [--output-encoding json|yaml|grafana-operator]
+                       [--library-panels] [--timeout <duration>]
+                       [--config <file>] [--grafana-version <version>] [--dry-run]
+                       [--include-paths <patterns>] [--exclude-paths <patterns>]
+                       [--include-tags <patterns>] [--exclude-tags <patterns>] [--exclude-deprecated]
+                       [--deprecated-row] [--environments <[name=]value,...>]
+                       [--extra-selector <matchers>] [--query-frontend]
+                       [--max-cardinality <series>] [--cardinality-mode fail|warn] [--max-panels <count>]
+                       [--skip-validation] [--remote-refs allow|block] [--ref-base-dir <dir>]
+                       [--ref-header <[host=]Name: value>]... [--validation-panels] [--canary-label <label>]
+                       [--multi-region] [--synthetic-checks] [--emit-probes <file>]
+                       [--load-test-panels]
+                       [--rate-limit-panels] [--cache-panels] [--availability-panel]
+                       [--snapshot] [--snapshot-external] [--snapshot-expires <duration>] [--public] [--runbook-panels]
+                       [--aggregate-by path] [--path-enums expand|variable] [--layout compact|wide|rows] [--stale-window <duration>]
+                       [--emit-scrape-config <file>] [--scrape-config-format prometheus|otel]
+                       [--emit-instrumentation go|generic] [--theme dark|light]
+                       [--uid-template <template>] [--title-template <template>]
+                       [--panel-titles operation-id|path] [--panel-title-template <template>]
+                       [--strip-path-prefix <prefix>|auto] [--panel-title-max-length <n>] [--raw-path-titles]
+                       [--force]
+                       [--skip-datasource-check]
+                       [--previous-spec <file|url>] [--changelog <file>] [--changelog-panel]
+                       [--prune delete|keep|orphan] [--summary-json]
+                       [--log-level debug|info|warn|error] [--log-format text|json]
+                       [--cpuprofile <file>] [--memprofile <file>]
+       openapi2grafana (--proto <descriptor-set> | --grpc-reflect <host:port>)... [output-file|-] [generation flags]
+       openapi2grafana validate <dashboard>... [--json]
+       openapi2grafana coverage <spec>... [--prometheus-url <url>] [--window <duration>] [--json]
+       openapi2grafana serve [--addr <addr>] [--spec <file|url>]... [--auth-token <token>] [--webhook-secret <secret>]
+       openapi2grafana list <openapi-spec-file> [generation flags] [--json]
+       openapi2grafana init <spec>... [--output <file>] [--force]
+       openapi2grafana plugins
+       openapi2grafana version [--json]`
+
+// defaultConfig returns the generation defaults shared by all modes
+func defaultConfig() *Config {
+	return &Config{
+		OutputFile:     stdoutOutput,
 		DashboardUID:   "generated-api-dashboard",
 		DashboardTitle: "API Monitoring Dashboard",
 		DataSource:     "prometheus",
 		Environment:    "production",
 		UpdateMode:     false,
 		IncludeGRPC:    true,
+		SortOrder:      "tag",
+		Variant:        variantOperational,
+		OutputEncoding: outputEncodingJSON,
+		File:           &FileConfig{},
+		SLOWindow:      "30d",
+		GrafanaURL:     os.Getenv("GRAFANA_URL"),
+		GrafanaToken:   os.Getenv("GRAFANA_TOKEN"),
+		GrafanaAuth:    GrafanaAuth{User: os.Getenv("GRAFANA_USER")},
+	}
+}
+
+// parseArgs parses the arguments of a generation run. On error the config
+// holds what was parsed, so the error can still be logged and summarized as
+// requested.
+func parseArgs(args []string) (*Config, error) {
+	config := defaultConfig()
+	if len(args) < 1 {
+		return config, &ConfigError{Err: errors.New(usage)}
+	}
+
+	start := 1
+	if strings.HasPrefix(args[0], "--") {
+		// Without a spec the gRPC services of --proto and --grpc-reflect are
+		// the input
+		start = 0
+	} else {
+		config.InputFile = args[0]
 	}
 
 	// Parse additional arguments
-	for i := 2; i < len(os.Args); i++ {
-		switch os.Args[i] {
-		case "--update":
-			config.UpdateMode = true
-		case "--uid":
-			if i+1 < len(os.Args) {
-				config.DashboardUID = os.Args[i+1]
-				i++
+	for i := start; i < len(args); i++ {
+		if next, ok := parseGenerationFlag(config, args, i); ok {
+			i = next
+			continue
+		}
+		// If not a flag, treat as output file
+		if !strings.HasPrefix(args[i], "--") {
+			config.OutputFile = args[i]
+		}
+	}
+
+	// The config file is loaded first, it can provide the push targets
+	if err := loadFileConfig(config); err != nil {
+		return config, &ConfigError{Err: err}
+	}
+	if err := validateConfig(config); err != nil {
+		return config, &ConfigError{Err: err}
+	}
+	if err := validateGRPCOnly(config); err != nil {
+		return config, &ConfigError{Err: err}
+	}
+
+	return config, nil
+}
+
+// parseGenerationFlag applies args[i] if it is a dashboard generation flag,
+// returning the index of the last consumed argument
+func parseGenerationFlag(config *Config, args []string, i int) (int, bool) {
+	set := func(target *string) {
+		if i+1 < len(args) {
+			i++
+			*target = args[i]
+		}
+	}
+	// Filter flags are repeatable and take comma-separated patterns
+	addPatterns := func(target *[]string) {
+		var value string
+		set(&value)
+		*target = appendPatterns(*target, value)
+	}
+
+	switch args[i] {
+	case "--update":
+		config.UpdateMode = true
+	case "--uid":
+		set(&config.DashboardUID)
+	case "--datasource":
+		set(&config.DataSource)
+	case "--title":
+		set(&config.DashboardTitle)
+	case "--sort":
+		set(&config.SortOrder)
+	case "--merge":
+		var file string
+		if set(&file); file != "" {
+			config.MergeFiles = append(config.MergeFiles, file)
+		}
+	case "--push":
+		config.Push = true
+	case "--grafana-url":
+		set(&config.GrafanaURL)
+	case "--grafana-token":
+		set(&config.GrafanaToken)
+	case "--grafana-user":
+		set(&config.GrafanaAuth.User)
+	case "--grafana-token-file":
+		set(&config.GrafanaAuth.TokenFile)
+	case "--grafana-cert":
+		set(&config.GrafanaAuth.CertFile)
+	case "--grafana-key":
+		set(&config.GrafanaAuth.KeyFile)
+	case "--grafana-ca":
+		set(&config.GrafanaAuth.CAFile)
+	case "--grafana-proxy":
+		set(&config.GrafanaAuth.Proxy)
+	case "--folder-uid":
+		set(&config.FolderUID)
+	case "--proto":
+		var file string
+		if set(&file); file != "" {
+			config.ProtoFiles = append(config.ProtoFiles, file)
+		}
+	case "--grpc-reflect":
+		var target string
+		if set(&target); target != "" {
+			config.GRPCReflect = append(config.GRPCReflect, target)
+		}
+	case "--grpc-reflect-tls":
+		config.GRPCReflectTLS = true
+	case "--spec-cache-dir":
+		set(&config.SpecCacheDir)
+	case "--broker-preset":
+		set(&config.BrokerPreset)
+	case "--slo-target":
+		var target string
+		if set(&target); target != "" {
+			value, err := strconv.ParseFloat(target, 64)
+			if err != nil {
+				// Rejected by validateConfig
+				value = -1
+			}
+			config.SLOTarget = value
+		}
+	case "--slo-window":
+		set(&config.SLOWindow)
+	case "--prometheus-url":
+		set(&config.PrometheusURL)
+	case "--coverage":
+		config.Coverage = true
+	case "--drift":
+		config.Drift = true
+	case "--emit-scrape-config":
+		set(&config.ScrapeConfigOutput)
+	case "--scrape-config-format":
+		set(&config.ScrapeConfigFormat)
+	case "--synthetic-checks":
+		config.SyntheticChecks = true
+	case "--emit-probes":
+		set(&config.ProbeConfigOutput)
+	case "--load-test-panels":
+		config.LoadTestPanels = true
+	case "--emit-instrumentation":
+		set(&config.Instrumentation)
+	case "--theme":
+		set(&config.Theme)
+	case "--force":
+		config.Force = true
+	case "--previous-spec":
+		set(&config.PreviousSpec)
+	case "--changelog":
+		set(&config.ChangelogOutput)
+	case "--changelog-panel":
+		config.ChangelogPanel = true
+	case "--prune":
+		set(&config.Prune)
+	case "--summary-json":
+		config.SummaryJSON = true
+	case "--log-level":
+		set(&config.LogLevel)
+	case "--log-format":
+		set(&config.LogFormat)
+	case "--cpuprofile":
+		set(&config.CPUProfile)
+	case "--memprofile":
+		set(&config.MemProfile)
+	case "--uid-template":
+		set(&config.UIDTemplate)
+	case "--title-template":
+		set(&config.TitleTemplate)
+	case "--panel-titles":
+		set(&config.PanelTitles)
+	case "--panel-title-template":
+		set(&config.Titles.Template)
+	case "--strip-path-prefix":
+		set(&config.Titles.StripPrefix)
+	case "--raw-path-titles":
+		config.Titles.RawPaths = true
+	case "--panel-title-max-length":
+		var length string
+		if set(&length); length != "" {
+			value, err := strconv.Atoi(length)
+			if err != nil {
+				// Rejected by validateConfig
+				value = -1
 			}
-		case "--datasource":
-			if i+1 < len(os.Args) {
-				config.DataSource = os.Args[i+1]
-				i++
+			config.Titles.MaxLength = value
+		}
+	case "--status-breakdown":
+		config.StatusBreakdown = true
+	case "--expected-errors":
+		config.ExpectedErrors = true
+	case "--native-histograms":
+		config.NativeHistograms = true
+	case "--refresh":
+		set(&config.Time.Refresh)
+	case "--time-from":
+		set(&config.Time.From)
+	case "--time-to":
+		set(&config.Time.To)
+	case "--timezone":
+		set(&config.Time.Timezone)
+	case "--week-start":
+		set(&config.Time.WeekStart)
+	case "--variant":
+		set(&config.Variant)
+	case "--rules-output":
+		set(&config.RulesOutput)
+	case "--split-dir":
+		set(&config.SplitDir)
+	case "--output-encoding", "--output-format":
+		set(&config.OutputEncoding)
+	case "--config":
+		set(&config.ConfigFile)
+	case "--library-panels":
+		config.LibraryPanels = true
+	case "--timeout":
+		var timeout string
+		if set(&timeout); timeout != "" {
+			value, err := time.ParseDuration(timeout)
+			if err != nil {
+				// Rejected by validateConfig
+				value = -1
 			}
-		case "--title":
-			if i+1 < len(os.Args) {
-				config.DashboardTitle = os.Args[i+1]
-				i++
+			config.Timeout = value
+		}
+	case "--grafana-version":
+		set(&config.GrafanaVersion)
+	case "--dry-run":
+		config.DryRun = true
+	case "--include-paths":
+		addPatterns(&config.Filter.IncludePaths)
+	case "--exclude-paths":
+		addPatterns(&config.Filter.ExcludePaths)
+	case "--include-tags":
+		addPatterns(&config.Filter.IncludeTags)
+	case "--exclude-tags":
+		addPatterns(&config.Filter.ExcludeTags)
+	case "--skip-datasource-check":
+		config.SkipDataSourceCheck = true
+	case "--public":
+		config.Public = true
+		config.Filter.ExcludeInternal = true
+	case "--exclude-deprecated":
+		config.Filter.ExcludeDeprecated = true
+	case "--deprecated-row":
+		config.DeprecatedRow = true
+	case "--query-frontend":
+		config.QueryFrontend = true
+	case "--extra-selector":
+		set(&config.ExtraSelector)
+	case "--max-cardinality":
+		var limit string
+		if set(&limit); limit != "" {
+			value, err := strconv.Atoi(limit)
+			if err != nil {
+				// Rejected by validateConfig
+				value = -1
 			}
-		default:
-			// If not a flag, treat as output file
-			if !strings.HasPrefix(os.Args[i], "--") {
-				config.OutputFile = os.Args[i]
+			config.MaxCardinality = value
+		}
+	case "--skip-validation":
+		config.SkipValidation = true
+	case "--cache-panels":
+		config.CachePanels = true
+	case "--availability-panel":
+		config.AvailabilityPanel = true
+	case "--rate-limit-panels":
+		config.RateLimitPanels = true
+	case "--validation-panels":
+		config.ValidationPanels = true
+	case "--canary-label":
+		set(&config.CanaryLabel)
+	case "--multi-region":
+		config.MultiRegion = true
+	case "--remote-refs":
+		set(&config.RemoteRefs)
+	case "--ref-base-dir":
+		set(&config.RefBaseDir)
+	case "--ref-header":
+		var header string
+		if set(&header); header != "" {
+			config.RefHeaders = append(config.RefHeaders, header)
+		}
+	case "--max-panels":
+		var limit string
+		if set(&limit); limit != "" {
+			value, err := strconv.Atoi(limit)
+			if err != nil {
+				// Rejected by validateConfig
+				value = -1
 			}
+			config.MaxPanels = value
 		}
+	case "--cardinality-mode":
+		set(&config.CardinalityMode)
+	case "--layout":
+		set(&config.Layout)
+	case "--aggregate-by":
+		set(&config.AggregateBy)
+	case "--path-enums":
+		set(&config.PathEnums)
+	case "--runbook-panels":
+		config.RunbookPanels = true
+	case "--stale-window":
+		set(&config.StaleWindow)
+	case "--snapshot":
+		config.Snapshot = true
+	case "--snapshot-external":
+		config.Snapshot = true
+		config.SnapshotExternal = true
+	case "--snapshot-expires":
+		var expires string
+		if set(&expires); expires != "" {
+			value, err := time.ParseDuration(expires)
+			if err != nil {
+				// Rejected by validateConfig
+				value = -1
+			}
+			config.SnapshotExpires = value
+		}
+	case "--environments":
+		var environments string
+		set(&environments)
+		config.Environments = append(config.Environments, parseEnvironments(environments)...)
+	default:
+		return i, false
 	}
+	return i, true
+}
 
-	return config
+func validateConfig(config *Config) error {
+	if config.SortOrder != "tag" && config.SortOrder != "path" {
+		return fmt.Errorf("invalid --sort value %q: must be \"tag\" or \"path\"", config.SortOrder)
+	}
+	if _, ok := brokerPresets[config.BrokerPreset]; config.BrokerPreset != "" && !ok && pluginBrokerPresets[config.BrokerPreset] == nil {
+		return fmt.Errorf("invalid --broker-preset value %q: must be kafka, rabbitmq, generic or a preset of a plugin", config.BrokerPreset)
+	}
+	if config.Variant != variantOperational && config.Variant != variantTrends && config.Variant != variantRepeat {
+		return fmt.Errorf("invalid --variant value %q: must be \"operational\", \"trends\" or \"repeat\"", config.Variant)
+	}
+	if config.OutputEncoding != outputEncodingJSON && config.OutputEncoding != outputEncodingYAML && config.OutputEncoding != outputEncodingOperator && pluginOutputEncodings[config.OutputEncoding] == nil {
+		return fmt.Errorf("invalid --output-encoding value %q: must be \"json\", \"yaml\", \"grafana-operator\" or an encoding of a plugin", config.OutputEncoding)
+	}
+	if config.SLOTarget < 0 || config.SLOTarget >= 100 {
+		return fmt.Errorf("invalid --slo-target: must be a percentage below 100, e.g. 99.9")
+	}
+	if config.Timeout < 0 {
+		return fmt.Errorf("invalid --timeout: must be a duration such as 30s or 2m")
+	}
+	if err := validateCanaryLabel(config.CanaryLabel); err != nil {
+		return err
+	}
+	if config.AggregateBy != "" && config.AggregateBy != aggregateByPath {
+		return fmt.Errorf("invalid --aggregate-by value %q: must be \"path\"", config.AggregateBy)
+	}
+	if config.PathEnums != "" && config.PathEnums != pathEnumsExpand && config.PathEnums != pathEnumsVariable {
+		return fmt.Errorf("invalid --path-enums value %q: must be \"expand\" or \"variable\"", config.PathEnums)
+	}
+	if err := validateLayoutMode(config.Layout); err != nil {
+		return fmt.Errorf("invalid --layout: %w", err)
+	}
+	if err := validateTheme(config.Theme); err != nil {
+		return fmt.Errorf("invalid --theme: %w", err)
+	}
+	if err := validateNameTemplate(config.UIDTemplate); err != nil {
+		return fmt.Errorf("invalid --uid-template: %w", err)
+	}
+	if config.PanelTitles != "" && config.PanelTitles != panelTitlesOperationID && config.PanelTitles != panelTitlesPath {
+		return fmt.Errorf("invalid --panel-titles value %q: must be \"operation-id\" or \"path\"", config.PanelTitles)
+	}
+	if err := validateNameTemplate(config.TitleTemplate); err != nil {
+		return fmt.Errorf("invalid --title-template: %w", err)
+	}
+	if config.MaxCardinality < 0 {
+		return fmt.Errorf("invalid --max-cardinality: must be a positive series count")
+	}
+	if config.RemoteRefs != "" && config.RemoteRefs != remoteRefsAllow && config.RemoteRefs != remoteRefsBlock {
+		return fmt.Errorf("invalid --remote-refs value %q: must be \"allow\" or \"block\"", config.RemoteRefs)
+	}
+	for _, header := range config.RefHeaders {
+		if _, err := parseRefHeader(header); err != nil {
+			return err
+		}
+	}
+	if config.RefBaseDir != "" {
+		if info, err := os.Stat(config.RefBaseDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("invalid --ref-base-dir %q: must be a directory", config.RefBaseDir)
+		}
+	}
+	if config.MaxPanels < 0 {
+		return fmt.Errorf("invalid --max-panels: must be a positive panel count")
+	}
+	if config.CardinalityMode != "" && config.CardinalityMode != cardinalityModeFail && config.CardinalityMode != cardinalityModeWarn {
+		return fmt.Errorf("invalid --cardinality-mode value %q: must be \"fail\" or \"warn\"", config.CardinalityMode)
+	}
+	if _, err := parseExtraSelector(config.ExtraSelector); err != nil {
+		return fmt.Errorf("invalid --extra-selector: %w", err)
+	}
+	if err := config.Filter.validate(); err != nil {
+		return err
+	}
+	if _, err := grafanaMajorVersion(config.GrafanaVersion); err != nil {
+		return fmt.Errorf("invalid --grafana-version: %w", err)
+	}
+	if err := config.Titles.validate(); err != nil {
+		return fmt.Errorf("invalid title flags: %w", err)
+	}
+	if err := config.Time.validate(); err != nil {
+		return fmt.Errorf("invalid time flags: %w", err)
+	}
+	if err := config.grafanaAuth().validate(); err != nil {
+		return fmt.Errorf("invalid Grafana auth: %w", err)
+	}
+	if config.Push && config.GrafanaURL == "" && len(config.fileConfig().Instances) == 0 {
+		return fmt.Errorf("--push requires --grafana-url, GRAFANA_URL or grafana_instances in the config file")
+	}
+	if config.Snapshot && !config.Push {
+		return fmt.Errorf("--snapshot requires --push")
+	}
+	if config.SnapshotExpires < 0 {
+		return fmt.Errorf("invalid --snapshot-expires: must be a duration such as 24h")
+	}
+	if config.ScrapeConfigFormat != "" && config.ScrapeConfigFormat != scrapeFormatPrometheus && config.ScrapeConfigFormat != scrapeFormatOTel {
+		return fmt.Errorf("invalid --scrape-config-format value %q: must be \"prometheus\" or \"otel\"", config.ScrapeConfigFormat)
+	}
+	if config.Instrumentation != "" && config.Instrumentation != instrumentationGo && config.Instrumentation != instrumentationGeneric {
+		return fmt.Errorf("invalid --emit-instrumentation value %q: must be \"go\" or \"generic\"", config.Instrumentation)
+	}
+	if config.StaleWindow != "" && !promDurationPattern.MatchString(config.StaleWindow) {
+		return fmt.Errorf("invalid --stale-window value %q: must be a Prometheus duration such as 7d", config.StaleWindow)
+	}
+	if (config.ChangelogOutput != "" || config.ChangelogPanel) && config.PreviousSpec == "" {
+		return fmt.Errorf("--changelog and --changelog-panel require --previous-spec")
+	}
+	if config.Prune != "" && config.Prune != pruneDelete && config.Prune != pruneKeep && config.Prune != pruneOrphan {
+		return fmt.Errorf("invalid --prune value %q: must be \"delete\", \"keep\" or \"orphan\"", config.Prune)
+	}
+	if config.Prune != "" && !config.UpdateMode {
+		return fmt.Errorf("--prune requires --update")
+	}
+	if err := validateLogging(config.LogLevel, config.LogFormat); err != nil {
+		return err
+	}
+	if config.SummaryJSON && config.writesToStdout() {
+		return fmt.Errorf("--summary-json prints to stdout, give an output file for the dashboard")
+	}
+	return nil
 }
 
-func generateDashboardFromConfig(config *Config) error {
-	// Load OpenAPI spec
-	loader := openapi3.NewLoader()
-	doc, err := loader.LoadFromFile(config.InputFile)
+func generateDashboardFromConfig(ctx context.Context, config *Config, summary *RunSummary) error {
+	// Load OpenAPI spec and any specs merged into it
+	fetcher := NewSpecFetcher(config.SpecCacheDir)
+	fetcher.SkipValidation = config.SkipValidation
+	fetcher.Refs = config.refOptions()
+	if config.DryRun {
+		// Leave the spec cache untouched
+		fetcher.CacheDir = ""
+	}
+	input, err := loadGenerationInput(ctx, fetcher, config.specSources(), config)
 	if err != nil {
-		return fmt.Errorf("error loading OpenAPI spec: %w", err)
+		return err
+	}
+	for _, spec := range input.Specs {
+		logSpecSource(spec.Source)
+		summary.Specs = append(summary.Specs, spec.Source.Source)
 	}
 
 	// Calculate spec hash for versioning
-	specHash, err := calculateSpecHash(config.InputFile)
-	if err != nil {
-		return fmt.Errorf("error calculating spec hash: %w", err)
-	}
+	specHash := calculateSpecHash(input.Specs)
 
-	// Check if dashboard exists and should be updated
-	var existingDashboard *GrafanaDashboard
+	// Generate new dashboard
+	dashboard := generateDashboard(ctx, input, config, specHash)
+
+	// Continue the version of the dashboard being updated
+	var existingDashboard *storedDashboard
 	if config.UpdateMode {
-		existingDashboard, _ = loadExistingDashboard(config.OutputFile)
+		existingDashboard = previousDashboard(ctx, config, dashboard.UID)
+		if existingDashboard != nil {
+			dashboard.Version = existingDashboard.Version + 1
+			if removed := applyPrunePolicy(&dashboard, existingDashboard.panels(), config.Prune); removed > 0 {
+				slog.Info("pruned panels of operations removed from the spec", "panels", removed, "policy", pruneDescription(config.Prune))
+			}
+		}
 	}
 
-	// Generate new dashboard
-	dashboard := generateDashboard(doc, config, specHash, existingDashboard)
+	dashboards, libraryPanels := outputDashboards(dashboard, config)
+	summary.addDashboards(dashboards)
 
-	// Save dashboard to file
-	dashboardJSON, err := json.MarshalIndent(dashboard, "", "  ")
+	// Refuse to write dashboards Grafana would reject or mis-render
+	for i := range dashboards {
+		if err := checkDashboard(&dashboards[i]); err != nil {
+			return err
+		}
+	}
+	if err := checkCardinality(ctx, input, config, dashboards); err != nil {
+		return err
+	}
+	if config.DryRun {
+		printPlan(input, config, dashboards, libraryPanels)
+		return nil
+	}
+
+	if config.SplitDir != "" {
+		files, err := writeSplitDashboards(ctx, config.SplitDir, dashboards[0], dashboards[1:], config.OutputEncoding)
+		if err != nil {
+			return err
+		}
+		slog.Info("generated dashboards", "dashboards", len(files), "dir", config.SplitDir)
+	} else {
+		// Save dashboard to file
+		if err := writeDashboardFile(ctx, config.OutputFile, dashboards[0], config.OutputEncoding); err != nil {
+			return err
+		}
+		slog.Info("generated dashboard", "file", config.OutputFile)
+	}
+	if config.LibraryPanels {
+		data, err := encodeOutput(ctx, libraryPanels, config.OutputEncoding)
+		if err != nil {
+			return fmt.Errorf("error marshaling library panels: %w", err)
+		}
+		file := libraryPanelsFile(config)
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return fmt.Errorf("error writing library panels file: %w", err)
+		}
+		slog.Info("wrote library panels", "panels", len(libraryPanels), "file", file)
+	}
+	if config.RulesOutput != "" {
+		if err := writeRecordingRules(config.RulesOutput, config.filterLabels(), config.NativeHistograms); err != nil {
+			return err
+		}
+		slog.Info("wrote trend recording rules", "file", config.RulesOutput)
+	}
+	if config.ScrapeConfigOutput != "" {
+		if err := writeScrapeConfig(config.ScrapeConfigOutput, input.Specs, config.ScrapeConfigFormat); err != nil {
+			return err
+		}
+		slog.Info("wrote scrape config", "file", config.ScrapeConfigOutput)
+	}
+	if config.ProbeConfigOutput != "" {
+		ops, shared := config.selectedOperations(input.Specs, config.SortOrder)
+		probes := probes(input.Specs, append(ops, shared...))
+		if err := writeProbeConfig(config.ProbeConfigOutput, probes, config.fileConfig().SyntheticChecks.withDefaults()); err != nil {
+			return err
+		}
+		slog.Info("wrote probe config", "file", config.ProbeConfigOutput, "probes", len(probes))
+	}
+	if config.Instrumentation != "" {
+		file := instrumentationFile(config)
+		if err := writeInstrumentation(file, input.Specs[0], config); err != nil {
+			return err
+		}
+		slog.Info("wrote instrumentation", "file", file)
+	}
+	if config.ChangelogOutput != "" && input.Changelog != nil {
+		if err := writeChangelog(config.ChangelogOutput, input.Changelog); err != nil {
+			return err
+		}
+		slog.Info("wrote changelog", "file", config.ChangelogOutput)
+	}
+	for _, file := range plannedFiles(config, dashboards) {
+		if file != stdoutOutput {
+			summary.Files = append(summary.Files, file)
+		}
+	}
+	if config.UpdateMode && existingDashboard != nil {
+		if specHashFromTags(existingDashboard.Tags) == specHashFromTags(dashboard.Tags) {
+			slog.Info("spec unchanged", "since_version", existingDashboard.Version)
+		}
+		slog.Info("updated dashboard", "from_version", existingDashboard.Version, "to_version", dashboard.Version)
+	}
+
+	if config.Push {
+		return pushDashboards(ctx, config, dashboards, libraryPanels, "Generated from "+config.inputDescription(), summary)
+	}
+	return nil
+}
+
+// outputDashboards returns the dashboards a generated dashboard is written
+// and pushed as: an overview and one dashboard per operation with
+// --split-dir, itself otherwise, and with --library-panels the library
+// panels they were converted to
+func outputDashboards(dashboard GrafanaDashboard, config *Config) ([]GrafanaDashboard, []LibraryElement) {
+	dashboards := []GrafanaDashboard{dashboard}
+	if config.SplitDir != "" {
+		overview, details := splitDashboard(dashboard)
+		dashboards = append([]GrafanaDashboard{overview}, details...)
+	}
+
+	var libraryPanels []LibraryElement
+	if config.LibraryPanels {
+		for i := range dashboards {
+			libraryPanels = append(libraryPanels, convertToLibraryPanels(&dashboards[i], config.FolderUID)...)
+		}
+		libraryPanels = dedupeLibraryElements(libraryPanels)
+	}
+	return dashboards, libraryPanels
+}
+
+// pushDashboards pushes the dashboards and library panels to every push
+// target, recording them in the summary. Every UID and data source is
+// checked on every instance before anything is pushed.
+func pushDashboards(ctx context.Context, config *Config, dashboards []GrafanaDashboard, libraryPanels []LibraryElement, message string, summary *RunSummary) error {
+	targets := config.pushTargets()
+	clients := make([]*GrafanaClient, len(targets))
+	sources := make([]*GrafanaDataSource, len(targets))
+	for i, target := range targets {
+		client, err := target.client(config)
+		if err != nil {
+			return target.wrapError(err)
+		}
+		clients[i] = client
+		if !config.Force {
+			for _, dashboard := range dashboards {
+				if err := client.CheckOverwrite(ctx, dashboard.UID); err != nil {
+					return target.wrapError(err)
+				}
+			}
+		}
+		if !config.SkipDataSourceCheck {
+			source, err := target.resolveDataSource(ctx, client, config)
+			if err != nil {
+				return target.wrapError(err)
+			}
+			sources[i] = source
+		}
+	}
+	for i, target := range targets {
+		if err := pushToInstance(ctx, config, target, clients[i], sources[i], dashboards, libraryPanels, message, summary); err != nil {
+			return target.wrapError(err)
+		}
+	}
+	return nil
+}
+
+// loadGenerationInput loads the specs and everything else generation needs
+func loadGenerationInput(ctx context.Context, fetcher *SpecFetcher, sources []string, config *Config) (*GenerationInput, error) {
+	specs, err := loadSpecs(ctx, fetcher, sources)
 	if err != nil {
-		return fmt.Errorf("error marshaling dashboard: %w", err)
+		return nil, err
 	}
+	input, err := prepareGenerationInput(ctx, specs, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PreviousSpec != "" && len(specs) > 0 && specs[0].Doc != nil {
+		previous, err := loadSpecs(ctx, fetcher, []string{config.PreviousSpec})
+		if err != nil {
+			return nil, fmt.Errorf("error loading previous spec: %w", err)
+		}
+		if previous[0].Doc == nil {
+			return nil, fmt.Errorf("previous spec %s is not an OpenAPI spec", config.PreviousSpec)
+		}
+		input.Changelog = diffSpecs(previous[0].Doc, specs[0].Doc)
+	}
+	return input, nil
+}
 
-	err = os.WriteFile(config.OutputFile, dashboardJSON, 0644)
+// prepareGenerationInput completes already loaded specs with gRPC methods
+// and, in SLO mode with a Prometheus URL, the live error budgets
+func prepareGenerationInput(ctx context.Context, specs []LoadedSpec, config *Config) (*GenerationInput, error) {
+	input := &GenerationInput{Specs: specs, TitlePrefix: config.titleSettings().pathPrefix(specs)}
+
+	grpcMethods, err := loadGRPCMethods(ctx, specs, config)
 	if err != nil {
-		return fmt.Errorf("error writing dashboard file: %w", err)
+		return nil, err
+	}
+	input.GRPCMethods = grpcMethods
+	if len(specs) == 0 {
+		// gRPC-only mode, the services stand in for the spec
+		if len(grpcMethods) == 0 {
+			return nil, fmt.Errorf("no gRPC services found in the descriptor sets or by reflection")
+		}
+		input.Specs = []LoadedSpec{grpcOnlySpec(grpcMethods, config)}
+	}
+	input.Visibility = visibilityMarked(input.Specs)
+	if config.IncludeGRPC {
+		input.GatewayMethods = gatewayMethods(specs)
 	}
 
-	fmt.Printf("Successfully generated Grafana dashboard: %s\n", config.OutputFile)
-	if config.UpdateMode && existingDashboard != nil {
-		fmt.Printf("Dashboard updated from version %d to %d\n", existingDashboard.Version, dashboard.Version)
+	if config.SLOTarget > 0 && config.PrometheusURL != "" {
+		budgets, err := fetchErrorBudgets(ctx, NewPrometheusClient(config.PrometheusURL), config.SLOTarget, config.SLOWindow, config.liveScope())
+		if err != nil {
+			return nil, fmt.Errorf("error fetching error budgets: %w", err)
+		}
+		input.ErrorBudgets = budgets
 	}
-	return nil
+	return input, nil
 }
 
-func calculateSpecHash(filePath string) (string, error) {
-	data, err := os.ReadFile(filePath)
+// logSpecSource reports which upstream version of a spec was used
+func logSpecSource(source SpecSource) {
+	attrs := []any{"source", source.Source}
+	if source.Version != "" {
+		attrs = append(attrs, "version", source.Version)
+	}
+	if source.ETag != "" {
+		attrs = append(attrs, "etag", source.ETag)
+	}
+	if source.NotModified {
+		attrs = append(attrs, "cached", true)
+	}
+	slog.Info("loaded spec", attrs...)
+}
+
+func calculateSpecHash(specs []LoadedSpec) string {
+	hash := sha256.New()
+	for _, spec := range specs {
+		hash.Write(spec.Data)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// stdoutOutput writes the dashboard to standard output, the default without
+// an output file
+const stdoutOutput = "-"
+
+// resultStdout receives dashboards written to stdoutOutput and the run
+// summary
+var resultStdout io.Writer = os.Stdout
+
+// writesToStdout reports whether the dashboard is written to stdout
+func (c *Config) writesToStdout() bool {
+	return c.OutputFile == stdoutOutput && c.SplitDir == "" && !c.DryRun
+}
+
+// outputBase returns the output file without extension, the base name of
+// the files written next to it
+func (c *Config) outputBase() string {
+	if c.OutputFile == stdoutOutput {
+		return "dashboard"
+	}
+	return strings.TrimSuffix(c.OutputFile, filepath.Ext(c.OutputFile))
+}
+
+// writeDashboardFile writes a dashboard as indented JSON or YAML, or as a
+// grafana-operator resource. JSON is streamed to the file panel by panel.
+func writeDashboardFile(ctx context.Context, path string, dashboard GrafanaDashboard, encoding string) error {
+	if encoding == outputEncodingJSON {
+		return streamDashboardFile(path, dashboard)
+	}
+
+	var v interface{} = dashboard
+	if encoding == outputEncodingOperator {
+		resource, err := operatorDashboard(dashboard)
+		if err != nil {
+			return fmt.Errorf("error marshaling dashboard: %w", err)
+		}
+		v = resource
+	}
+	data, err := encodeOutput(ctx, v, encoding)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("error marshaling dashboard: %w", err)
+	}
+	if path == stdoutOutput {
+		if _, err := resultStdout.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("error writing dashboard: %w", err)
+		}
+		return nil
 	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing dashboard file: %w", err)
+	}
+	return nil
+}
 
-	hash := sha256.Sum256(data)
-	return hex.EncodeToString(hash[:]), nil
+// streamDashboardFile writes a dashboard as indented JSON to a file or
+// stdout
+func streamDashboardFile(path string, dashboard GrafanaDashboard) error {
+	if path == stdoutOutput {
+		if err := writeDashboardJSON(resultStdout, dashboard); err != nil {
+			return fmt.Errorf("error writing dashboard: %w", err)
+		}
+		_, err := io.WriteString(resultStdout, "\n")
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error writing dashboard file: %w", err)
+	}
+	if err := writeDashboardJSON(file, dashboard); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing dashboard file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing dashboard file: %w", err)
+	}
+	return nil
 }
 
 func loadExistingDashboard(filePath string) (*GrafanaDashboard, error) {
@@ -403,36 +1578,39 @@ func loadExistingDashboard(filePath string) (*GrafanaDashboard, error) {
 	}
 
 	var dashboard GrafanaDashboard
-	if err := json.Unmarshal(data, &dashboard); err != nil {
+	if err := decodeDashboard(data, &dashboard); err != nil {
 		return nil, err
 	}
 
 	return &dashboard, nil
 }
 
-func generateDashboard(doc *openapi3.T, config *Config, specHash string, existingDashboard *GrafanaDashboard) GrafanaDashboard {
+func generateDashboard(ctx context.Context, input *GenerationInput, config *Config, specHash string) GrafanaDashboard {
+	dashboard := buildDashboard(ctx, input, config, specHash, "")
+	return fitPanelBudget(ctx, dashboard, input, config, specHash)
+}
+
+// buildDashboard generates the dashboard of the input; summarize "tag"
+// builds a panel set per tag instead of per HTTP operation
+func buildDashboard(ctx context.Context, input *GenerationInput, config *Config, specHash string, summarize string) GrafanaDashboard {
+	specs := input.Specs
+	doc := specs[0].Doc
 	title := config.DashboardTitle
 	if doc.Info != nil && doc.Info.Title != "" {
 		title = doc.Info.Title + " Monitoring"
 	}
 
-	version := 1
-	if existingDashboard != nil {
-		version = existingDashboard.Version + 1
-	}
-
 	dashboard := GrafanaDashboard{
 		Title:         title,
 		Editable:      true,
-		Style:         "dark",
-		Tags:          []string{"generated", "api", "monitoring"},
+		Tags:          append([]string{"generated", "api", "monitoring"}, metadataTags(specHash)...),
 		UID:           config.DashboardUID,
-		SchemaVersion: 30,
-		Version:       version,
-		Refresh:       "30s",
+		SchemaVersion: supportedSchemaVersions[0],
+		Version:       1,
+		Refresh:       defaultRefresh,
 		Time: Time{
-			From: "now-6h",
-			To:   "now",
+			From: defaultTimeFrom,
+			To:   defaultTimeTo,
 		},
 		Timepicker: Timepicker{
 			RefreshIntervals: []string{"5s", "10s", "30s", "1m", "5m", "15m", "30m", "1h", "2h", "1d"},
@@ -454,37 +1632,7 @@ func generateDashboard(doc *openapi3.T, config *Config, specHash string, existin
 					Refresh:    1,
 					Hide:       0,
 				},
-				{
-					Name:    "environment",
-					Label:   "Environment",
-					Type:    "custom",
-					Current: Current{Text: "All", Value: "$__all"},
-					Options: []Option{
-						{Text: "All", Value: "$__all", Selected: true},
-						{Text: "Production", Value: "prod"},
-						{Text: "Staging", Value: "stage"},
-						{Text: "Development", Value: "dev"},
-					},
-					IncludeAll: true,
-					AllValue:   ".*",
-					Multi:      true,
-					Refresh:    0,
-				},
-				{
-					Name:        "service",
-					Label:       "Service",
-					Type:        "query",
-					Query:       "label_values(http_requests_total, service)",
-					Current:     Current{Text: "All", Value: "$__all"},
-					Datasource:  config.DataSource,
-					IncludeAll:  true,
-					AllValue:    ".*",
-					Multi:       true,
-					Refresh:     1,
-					Sort:        1,
-					Definition:  "label_values(http_requests_total, service)",
-					Description: "Service name filter",
-				},
+				createEnvironmentVariable(config.environmentOptions(specs)),
 			},
 		},
 		Annotations: Annotations{
@@ -500,95 +1648,452 @@ func generateDashboard(doc *openapi3.T, config *Config, specHash string, existin
 				},
 			},
 		},
-		Links: []Link{
-			{
-				AsDropdown:  false,
-				Icon:        "external link",
-				IncludeVars: false,
-				KeepTime:    false,
-				Tags:        []string{"api", "monitoring"},
-				Title:       "API Documentation",
-				Type:        "dashboards",
-			},
-		},
-		Meta: DashboardMetadata{
-			Version:     version,
-			Generated:   time.Now(),
-			SpecHash:    specHash,
-			LastUpdated: time.Now(),
-		},
+		Links: dashboardLinks(specs),
+	}
+
+	ops, shared := config.selectedOperations(specs, config.SortOrder)
+	dashboard.Tags = append(dashboard.Tags, teamTags(config, append(append([]OperationInfo{}, ops...), shared...))...)
+	applyNameTemplates(&dashboard, config, newNameTemplateData(specs[0], append(append([]OperationInfo{}, ops...), shared...), config.Variant))
+	for _, variable := range config.queryVariables() {
+		dashboard.Templating.List = append(dashboard.Templating.List, createQueryVariable(variable, config.DataSource))
+	}
+	if config.LoadTestPanels {
+		dashboard.Templating.List = append(dashboard.Templating.List, createQueryVariable(k6TestVariable(), config.DataSource))
+	}
+	// The documented endpoints for repeated rows and ad-hoc panels
+	if endpoints := createEndpointVariable(append(append([]OperationInfo{}, ops...), shared...), config.titleSettings()); len(endpoints.Options) > 1 {
+		dashboard.Templating.List = append(dashboard.Templating.List, endpoints)
+	}
+	if config.PathEnums == pathEnumsVariable {
+		dashboard.Templating.List = append(dashboard.Templating.List, pathEnumVariables(append(append([]OperationInfo{}, ops...), shared...), config.definedVariables())...)
+	}
+	for _, annotation := range config.annotationConfigs() {
+		dashboard.Annotations.List = append(dashboard.Annotations.List, createAnnotation(annotation))
+	}
+
+	if config.Variant == variantTrends {
+		ops, shared := config.selectedOperations(specs, "tag")
+		buildTrendsDashboard(&dashboard, append(ops, shared...), config.queryScope())
+		finalizeDashboard(&dashboard, config)
+		return dashboard
+	}
+	if config.Variant == variantRepeat {
+		buildRepeatDashboard(&dashboard, config)
+		finalizeDashboard(&dashboard, config)
+		return dashboard
 	}
 
 	// Track panel positions
-	panelY := 0
-	panelHeight := 8
-	panelID := 1
+	cursor := &panelCursor{ID: 1, Y: 0, Height: 8}
 
-	// Add panels for HTTP endpoints
-	for path, pathItem := range doc.Paths.Map() {
-		for method, operation := range pathItem.Operations() {
-			panelTitle := fmt.Sprintf("%s %s", strings.ToUpper(method), path)
-			if operation.Summary != "" {
-				panelTitle = fmt.Sprintf("%s: %s", panelTitle, operation.Summary)
+	// The composite availability of the API heads the dashboard
+	if config.AvailabilityPanel {
+		addAvailabilityPanels(&dashboard, append(append([]OperationInfo{}, ops...), shared...), config, cursor)
+	}
+
+	// Custom rows from x-grafana-rows positioned before the generated panels
+	addCustomRows(ctx, &dashboard, specs, rowPositionTop, config.Public, config.queryScope(), cursor)
+	addMixins(ctx, &dashboard, config, rowPositionTop, cursor)
+
+	// Callbacks and webhooks of every selected operation, deprecated ones
+	// included
+	calls := collectOutboundCalls(specs, append(append([]OperationInfo{}, ops...), shared...))
+
+	// Add panels for HTTP endpoints; operations shared by several merged
+	// specs are generated once in their own row
+	var deprecatedOps, deprecatedShared []OperationInfo
+	if config.DeprecatedRow {
+		ops, deprecatedOps = splitDeprecated(ops)
+		shared, deprecatedShared = splitDeprecated(shared)
+	}
+	if config.PathEnums == pathEnumsExpand {
+		ops, shared = expandPathEnums(ops), expandPathEnums(shared)
+	}
+	if config.AggregateBy == aggregateByPath {
+		ops, shared = collapseMethods(ops), collapseMethods(shared)
+	}
+	addPanels := addOperationPanels
+	if summarize == summarizeByTag {
+		addPanels = addTagPanels
+	}
+	addVisibilitySections(ctx, &dashboard, ops, input, config, cursor, addPanels)
+
+	if len(shared) > 0 {
+		dashboard.Panels = append(dashboard.Panels, createRowPanel("Shared Endpoints", cursor.ID, cursor.Y))
+		cursor.ID++
+		cursor.Y++
+		addPanels(ctx, &dashboard, shared, input, config, cursor)
+	}
+
+	addDeprecatedPanels(&dashboard, append(deprecatedOps, deprecatedShared...), config, cursor)
+	addAuthPanels(&dashboard, append(append([]OperationInfo{}, ops...), shared...), config.queryScope(), cursor)
+	addThrottlingPanels(&dashboard, append(append([]OperationInfo{}, ops...), shared...), config, cursor)
+	if config.ValidationPanels {
+		addRequestValidationPanels(&dashboard, append(append([]OperationInfo{}, ops...), shared...), config, cursor)
+	}
+	addOutboundPanels(&dashboard, calls, config, cursor)
+	if config.SyntheticChecks {
+		addSyntheticCheckPanels(&dashboard, probes(specs, append(append([]OperationInfo{}, ops...), shared...)), config.queryScope(), cursor)
+	}
+	if config.LoadTestPanels {
+		addLoadTestPanels(&dashboard, append(append([]OperationInfo{}, ops...), shared...), cursor)
+	}
+
+	if config.Coverage {
+		addCoveragePanels(&dashboard, documentedRoutes(specs), config.queryScope(), cursor)
+	}
+	if config.Drift {
+		addDriftPanels(&dashboard, documentedRoutes(specs), config.queryScope(), cursor)
+	}
+	if config.ChangelogPanel && input.Changelog != nil {
+		addChangelogPanels(&dashboard, input.Changelog, cursor)
+	}
+
+	// Add channel panels for AsyncAPI specs
+	for _, spec := range specs {
+		if spec.Async == nil {
+			continue
+		}
+		preset, err := resolveBrokerPreset(ctx, config.BrokerPreset, spec.Async, config.queryScope())
+		if err != nil {
+			slog.Warn("skipping AsyncAPI channels", "spec", spec.File, "error", err)
+			continue
+		}
+		addAsyncAPIPanels(&dashboard, spec.Async, preset, config.queryScope(), cursor)
+	}
+
+	addCustomRows(ctx, &dashboard, specs, rowPositionAfterHTTP, config.Public, config.queryScope(), cursor)
+	addMixins(ctx, &dashboard, config, rowPositionAfterHTTP, cursor)
+
+	// Add gRPC panels for methods from x-grpc, descriptor sets and
+	// reflection, unless paired with a grpc-gateway route. Dashboards of
+	// gRPC services alone get a row per service.
+	paired := gatewayPaired(input.GatewayMethods)
+	service := ""
+	for _, method := range input.GRPCMethods {
+		if paired(method) {
+			continue
+		}
+		if specs[0].GRPCOnly && method.Service != service {
+			dashboard.Panels = append(dashboard.Panels, createRowPanel("Service: "+method.Service, cursor.ID, cursor.Y))
+			cursor.ID++
+			cursor.Y++
+			service = method.Service
+		}
+		addGRPCPanels(&dashboard, method, config, cursor)
+	}
+
+	addCustomRows(ctx, &dashboard, specs, rowPositionBottom, config.Public, config.queryScope(), cursor)
+	addMixins(ctx, &dashboard, config, rowPositionBottom, cursor)
+	addUnplacedMixins(ctx, &dashboard, config, cursor)
+
+	finalizeDashboard(&dashboard, config)
+	return dashboard
+}
+
+// finalizeDashboard applies the configuration affecting every generated
+// panel: variable matchers, units and the target Grafana version
+func finalizeDashboard(dashboard *GrafanaDashboard, config *Config) {
+	applyQueryOptions(dashboard, config.queryOptions())
+	// After the query options, which can add labels next to le
+	applySummaryLatency(dashboard, config.fileConfig())
+	if config.NativeHistograms {
+		applyNativeHistograms(dashboard)
+	}
+	applyUnits(dashboard, config.fileConfig())
+	applyLayout(dashboard, config.layout())
+	applyTimeSettings(dashboard, config.timeSettings())
+	if len(config.fileConfig().Maintenance) > 0 {
+		applyMaintenanceLabel(dashboard)
+	}
+	style, colors := config.theme()
+	applyTheme(dashboard, style, colors)
+	adaptForGrafanaVersion(dashboard, config.GrafanaVersion)
+	dashboard.transforms = config.fileConfig().Transforms
+}
+
+// addOperationPanels appends the standard panel set of every HTTP operation.
+// The sets are built concurrently, each at the top of the dashboard, then
+// moved below each other in the order of the operations.
+func addOperationPanels(ctx context.Context, dashboard *GrafanaDashboard, ops []OperationInfo, input *GenerationInput, config *Config, cursor *panelCursor) {
+	sets := buildConcurrently(ops, func(op OperationInfo) []Panel {
+		return buildOperationPanels(op, input, config, cursor.Height)
+	})
+	total := 0
+	for _, panels := range sets {
+		total += len(panels)
+	}
+	dashboard.Panels = slices.Grow(dashboard.Panels, total)
+	if dashboard.operations == nil {
+		dashboard.operations = make(map[string]OperationPanels, len(ops))
+	}
+
+	for i, op := range ops {
+		panels := sets[i]
+		group := OperationPanels{Key: op.Key(), Method: strings.ToUpper(op.Method), Path: op.Path, PanelIDs: make([]int, 0, len(panels)), Title: config.operationTitle(op, input.TitlePrefix)}
+		for _, panel := range panels {
+			panel.ID += cursor.ID
+			panel.GridPos.Y += cursor.Y
+			if len(op.Services) > 1 {
+				panel.Description = fmt.Sprintf("%s. Shared by services: %s (filter with $service)", panel.Description, strings.Join(op.Services, ", "))
 			}
+			panel.Description = describeOperation(panel.Description, group.operation())
+			dashboard.Panels = append(dashboard.Panels, panel)
+			group.PanelIDs = append(group.PanelIDs, panel.ID)
+		}
+		dashboard.operations[group.Key] = group
+		slog.Debug("generated operation panels", "operation", group.Key, "panels", len(panels))
+		cursor.ID += len(panels)
+		cursor.Y += len(panels) * cursor.Height
+		addTagMixins(ctx, dashboard, config, ops, i, cursor)
+	}
+}
 
-			// Request Rate panel
-			requestRatePanel := createRequestRatePanel(panelTitle, path, method, panelID, panelHeight, panelY)
-			dashboard.Panels = append(dashboard.Panels, requestRatePanel)
-			panelID++
-			panelY += panelHeight
-
-			// Enhanced Latency panel with P50, P90, P95, P99
-			latencyPanel := createLatencyPanel(panelTitle, path, method, panelID, panelHeight, panelY)
-			dashboard.Panels = append(dashboard.Panels, latencyPanel)
-			panelID++
-			panelY += panelHeight
-
-			// Error rate panel
-			errorRatePanel := createErrorRatePanel(panelTitle, path, method, panelID, panelHeight, panelY)
-			dashboard.Panels = append(dashboard.Panels, errorRatePanel)
-			panelID++
-			panelY += panelHeight
-
-			// Throughput panel
-			throughputPanel := createThroughputPanel(panelTitle, path, method, panelID, panelHeight, panelY)
-			dashboard.Panels = append(dashboard.Panels, throughputPanel)
-			panelID++
-			panelY += panelHeight
-		}
-	}
-
-	// Add gRPC panels if gRPC extensions exist and enabled
-	if config.IncludeGRPC && doc.Extensions != nil {
-		if grpcExt, ok := doc.Extensions["x-grpc"]; ok {
-			if grpcServices, ok := grpcExt.(map[string]interface{}); ok {
-				for serviceName, methods := range grpcServices {
-					if methodMap, ok := methods.(map[string]interface{}); ok {
-						for methodName := range methodMap {
-							panelTitle := fmt.Sprintf("gRPC %s/%s", serviceName, methodName)
-
-							// gRPC Request Rate panel
-							grpcRequestPanel := createGRPCRequestPanel(panelTitle, serviceName, methodName, panelID, panelHeight, panelY)
-							dashboard.Panels = append(dashboard.Panels, grpcRequestPanel)
-							panelID++
-							panelY += panelHeight
-
-							// gRPC Latency panel
-							grpcLatencyPanel := createGRPCLatencyPanel(panelTitle, serviceName, methodName, panelID, panelHeight, panelY)
-							dashboard.Panels = append(dashboard.Panels, grpcLatencyPanel)
-							panelID++
-							panelY += panelHeight
-						}
-					}
-				}
+// buildOperationPanels builds the standard panel set of one HTTP operation,
+// numbered from 0 at the top of the dashboard
+func buildOperationPanels(op OperationInfo, input *GenerationInput, config *Config, height int) []Panel {
+	cursor := &panelCursor{Height: height}
+	path, method, operation := op.Path, op.Method, op.Operation
+	panelTitle := config.operationTitle(op, input.TitlePrefix)
+	match := operationMatch{Path: path, Method: method, Methods: op.Methods, Scope: config.queryScope()}
+
+	var panels []Panel
+	if protocol := streamProtocol(operation); protocol != "" {
+		// Long-lived connections get connection-oriented panels instead
+		panels = createStreamingPanels(panelTitle, path, protocol, match.Scope, cursor.ID, cursor.Height, cursor.Y)
+	} else {
+		thresholds := config.operationThresholds(op)
+		var budget *ErrorBudget
+		if config.SLOTarget > 0 {
+			if b, ok := input.ErrorBudgets[strings.ToUpper(method)+" "+path]; ok {
+				budget = &b
+			}
+			thresholds = sloThresholds(thresholds, config.SLOTarget, budget)
+		}
+
+		if config.StatusBreakdown {
+			panels = createHTTPBreakdownPanels(panelTitle, match, thresholds, cursor.ID, cursor.Height, cursor.Y)
+		} else {
+			panels = createHTTPPanels(panelTitle, match, thresholds, cursor.ID, cursor.Height, cursor.Y)
+		}
+
+		if config.SLOTarget > 0 {
+			for i := range panels {
+				panels[i].Description += ". " + budgetDescription(config.SLOTarget, budget)
+			}
+		}
+		if config.SLOTarget > 0 || config.fileConfig().Alerts {
+			// The latency and 5xx error rate panels alert at the
+			// (budget-adjusted) critical levels
+			errorRate := &panels[2]
+			if config.StatusBreakdown {
+				errorRate = &panels[3]
+			}
+			contactPoints := config.fileConfig().Notifications.contactPoints(op)
+			panels[1].Alert = createLatencyAlert(panelTitle, thresholds, panels[1].Targets[0])
+			panels[1].Alert.contactPoints = contactPoints
+			errorRate.Alert = createErrorRateAlert(panelTitle, thresholds, errorRate.Targets[0])
+			errorRate.Alert.contactPoints = contactPoints
+		}
+
+		// Documented error responses are told apart from unexpected ones;
+		// collapsed paths mix the responses of several methods
+		if client, all := declaredErrorCodes(op); config.ExpectedErrors && len(all) > 0 && len(op.Methods) == 0 {
+			n := len(panels)
+			panels = append(panels, createExpectedErrorPanels(panelTitle, match, client, all, thresholds, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height)...)
+		}
+		// Routes of grpc-gateway specs are paired with their gRPC method
+		if grpcMethod, ok := input.GatewayMethods[strings.ToUpper(method)+" "+path]; ok {
+			for i := range panels {
+				panels[i].Description += fmt.Sprintf(". Served by gRPC method `%s/%s` through grpc-gateway", grpcMethod.Service, grpcMethod.Method)
+			}
+			n := len(panels)
+			panels = append(panels, createGatewayPanels(panelTitle, op, grpcMethod.match(match.Scope), thresholds, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height)...)
+		}
+		// Operations declaring a rate limit get a headroom panel; limits are
+		// per operation, so collapsed paths have none
+		if limit, ok := operationRateLimit(operation); ok && len(op.Methods) == 0 {
+			n := len(panels)
+			panels = append(panels, createHeadroomPanel(panelTitle, match, limit, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height))
+		}
+		// Rate limited operations get their throttled requests
+		if config.throttled(op) {
+			n := len(panels)
+			metrics := config.fileConfig().RateLimits.withDefaults()
+			panels = append(panels, createThrottlingPanels(panelTitle, match, metrics, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height)...)
+		}
+		// Cacheable operations get their cache hit ratio
+		if config.cacheable(op) {
+			n := len(panels)
+			metrics := config.fileConfig().Cache.withDefaults()
+			panels = append(panels, createCacheHitRatioPanel(panelTitle, match, metrics, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height))
+		}
+		// Downstream calls of x-dependencies, next to the operation's health
+		for _, dependency := range operationDependencies(op) {
+			n := len(panels)
+			panels = append(panels, createDependencyPanels(panelTitle, dependency, config.fileConfig().Dependencies, match.Scope, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height)...)
+		}
+		// Product KPIs of x-grafana-queries
+		for _, query := range operationBusinessQueries(op) {
+			n := len(panels)
+			panels = append(panels, createBusinessQueryPanel(panelTitle, query, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height))
+		}
+		// Secured operations get their 401/403 rates
+		if len(op.SecuritySchemes) > 0 {
+			n := len(panels)
+			panels = append(panels, createAuthFailurePanel(panelTitle, match, op.SecuritySchemes, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height))
+		}
+		// Operations with parameters or a body get their validation failures
+		if config.ValidationPanels && validatesRequests(op) {
+			n := len(panels)
+			metrics := config.fileConfig().RequestValidation.withDefaults()
+			panels = append(panels, createRequestValidationPanel(panelTitle, match, metrics, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height))
+		}
+		// Operations without requests over the stale window are flagged
+		if config.StaleWindow != "" {
+			n := len(panels)
+			stale := createStalePanel(panelTitle, match, config.StaleWindow, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height)
+			if config.SLOTarget > 0 || config.fileConfig().Alerts {
+				stale.Alert = createNoTrafficAlert(panelTitle, config.StaleWindow, stale.Targets[1])
+				stale.Alert.contactPoints = config.fileConfig().Notifications.contactPoints(op)
 			}
+			panels = append(panels, stale)
+		}
+		// Canary and stable deployments side by side
+		if config.CanaryLabel != "" {
+			n := len(panels)
+			panels = append(panels, createCanaryPanels(panelTitle, match, config.CanaryLabel, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height)...)
+		}
+		// Regions overlaid, and compared in a table
+		if config.MultiRegion {
+			n := len(panels)
+			labels := config.fileConfig().MultiRegion.withDefaults()
+			panels = append(panels, createRegionPanels(panelTitle, match, labels, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height)...)
+		}
+	}
+	if panelTitle != endpointTitle(op) {
+		// Titled by operationId, the endpoint is in the description
+		endpoint := fmt.Sprintf("`%s %s`", strings.ToUpper(method), path)
+		if operation.Summary != "" {
+			endpoint += ": " + operation.Summary
 		}
+		for i := range panels {
+			panels[i].Description += "\n\n" + endpoint
+		}
+	}
+	if schema := schemaDescription(op); schema != "" && len(op.Methods) == 0 {
+		// What the operation takes and returns, for responders hovering the
+		// info icon
+		for i := range panels {
+			panels[i].Description += "\n\n" + schema
+		}
+	}
+	if config.RunbookPanels {
+		n := len(panels)
+		panels = append(panels, createRunbookPanel(panelTitle, op, cursor.ID+n, cursor.Height, cursor.Y+n*cursor.Height))
+	}
+	if team := config.operationTeam(op); team != "" {
+		applyTeam(panels, team, config.fileConfig().TeamRunbooks[team])
+	}
+	if input.Visibility {
+		applySeverity(panels, config.operationSeverity(op))
 	}
+	if config.PathEnums == pathEnumsVariable && streamProtocol(operation) == "" {
+		applyPathEnumVariables(panels, op, config.definedVariables())
+	}
+	return panels
+}
 
-	return dashboard
+// createHTTPPanels builds the standard request/response panel set for an operation
+func createHTTPPanels(title string, match operationMatch, thresholds ThresholdConfig, panelID, height, yPos int) []Panel {
+	return []Panel{
+		// Request Rate panel
+		createRequestRatePanel(title, match, panelID, height, yPos),
+		// Enhanced Latency panel with P50, P90, P95, P99
+		createLatencyPanel(title, match, thresholds, panelID+1, height, yPos+height),
+		// Error rate panel
+		createErrorRatePanel(title, match, thresholds, panelID+2, height, yPos+2*height),
+		// Throughput panel
+		createThroughputPanel(title, match, panelID+3, height, yPos+3*height),
+	}
+}
+
+// addGRPCPanels appends the panel set for one gRPC method
+func addGRPCPanels(dashboard *GrafanaDashboard, method GRPCMethod, config *Config, cursor *panelCursor) {
+	panelTitle := fmt.Sprintf("gRPC %s/%s", method.Service, method.Method)
+
+	// Streaming methods get stream panels instead of request panels
+	if method.grpcType() != "unary" {
+		panels := createGRPCStreamingPanels(panelTitle, method, config.queryScope(), cursor.ID, cursor.Height, cursor.Y)
+		dashboard.Panels = append(dashboard.Panels, panels...)
+		cursor.ID += len(panels)
+		cursor.Y += len(panels) * cursor.Height
+		return
+	}
+
+	// gRPC Request Rate panel
+	dashboard.Panels = append(dashboard.Panels, createGRPCRequestPanel(panelTitle, method.match(config.queryScope()), cursor.ID, cursor.Height, cursor.Y))
+	cursor.ID++
+	cursor.Y += cursor.Height
+
+	// gRPC Latency panel
+	dashboard.Panels = append(dashboard.Panels, createGRPCLatencyPanel(panelTitle, method.match(config.queryScope()), config.baseThresholds(), cursor.ID, cursor.Height, cursor.Y))
+	cursor.ID++
+	cursor.Y += cursor.Height
+}
+
+// collectOperations returns every HTTP operation in the spec in a stable order.
+// With sortOrder "tag" operations are grouped by their first tag, then sorted by
+// path and method; with "path" the tag is ignored.
+func collectOperations(doc *openapi3.T, sortOrder string) []OperationInfo {
+	var ops []OperationInfo
+	if doc.Paths == nil {
+		return ops
+	}
+
+	for path, pathItem := range doc.Paths.Map() {
+		for method, operation := range pathItem.Operations() {
+			tag := ""
+			if len(operation.Tags) > 0 {
+				tag = operation.Tags[0]
+			}
+			ops = append(ops, OperationInfo{
+				Path:            path,
+				Method:          method,
+				Tag:             tag,
+				Operation:       operation,
+				SecuritySchemes: securitySchemes(doc, operation),
+				PathParameters:  pathItem.Parameters,
+			})
+		}
+	}
+
+	sortOperations(ops, sortOrder)
+	return ops
+}
+
+func sortOperations(ops []OperationInfo, sortOrder string) {
+	sort.Slice(ops, func(i, j int) bool {
+		if sortOrder == "tag" && ops[i].Tag != ops[j].Tag {
+			return ops[i].Tag < ops[j].Tag
+		}
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
 }
 
-func createRequestRatePanel(title, path, method string, panelID, height, yPos int) Panel {
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func createRequestRatePanel(title string, match operationMatch, panelID, height, yPos int) Panel {
 	return Panel{
 		ID:         panelID,
 		Title:      title + " - Request Rate",
@@ -597,8 +2102,8 @@ func createRequestRatePanel(title, path, method string, panelID, height, yPos in
 		GridPos:    GridPos{H: height, W: 12, X: 0, Y: yPos},
 		Targets: []Target{
 			{
-				Expr:         fmt.Sprintf(`sum(rate(http_requests_total{path="%s", method="%s", service=~"$service"}[$__rate_interval])) by (status_code)`, path, method),
-				LegendFormat: "Status {{status_code}}",
+				Expr:         promSum(promRate(match.selector("http_requests_total")), match.by("status_code")...),
+				LegendFormat: match.legend("Status {{status_code}}"),
 				RefID:        "A",
 			},
 		},
@@ -614,7 +2119,7 @@ func createRequestRatePanel(title, path, method string, panelID, height, yPos in
 		FieldConfig: FieldConfig{
 			Defaults: FieldConfigDefaults{
 				Color: ColorOptions{Mode: "palette-classic"},
-				Unit:  "reqps",
+				Unit:  metricUnit("http_requests_total"),
 				Thresholds: ThresholdOptions{
 					Mode: "absolute",
 					Steps: []ThresholdStep{
@@ -628,7 +2133,8 @@ func createRequestRatePanel(title, path, method string, panelID, height, yPos in
 	}
 }
 
-func createLatencyPanel(title, path, method string, panelID, height, yPos int) Panel {
+func createLatencyPanel(title string, match operationMatch, thresholds ThresholdConfig, panelID, height, yPos int) Panel {
+	latency := match.selector("http_request_duration_seconds")
 	return Panel{
 		ID:         panelID,
 		Title:      title + " - Latency Percentiles",
@@ -637,23 +2143,23 @@ func createLatencyPanel(title, path, method string, panelID, height, yPos int) P
 		GridPos:    GridPos{H: height, W: 12, X: 12, Y: yPos},
 		Targets: []Target{
 			{
-				Expr:         fmt.Sprintf(`histogram_quantile(0.99, sum(rate(http_request_duration_seconds_bucket{path="%s", method="%s", service=~"$service"}[$__rate_interval])) by (le))`, path, method),
-				LegendFormat: "p99",
+				Expr:         promHistogramQuantile("0.99", latency, match.by()...),
+				LegendFormat: match.legend("p99"),
 				RefID:        "A",
 			},
 			{
-				Expr:         fmt.Sprintf(`histogram_quantile(0.95, sum(rate(http_request_duration_seconds_bucket{path="%s", method="%s", service=~"$service"}[$__rate_interval])) by (le))`, path, method),
-				LegendFormat: "p95",
+				Expr:         promHistogramQuantile("0.95", latency, match.by()...),
+				LegendFormat: match.legend("p95"),
 				RefID:        "B",
 			},
 			{
-				Expr:         fmt.Sprintf(`histogram_quantile(0.90, sum(rate(http_request_duration_seconds_bucket{path="%s", method="%s", service=~"$service"}[$__rate_interval])) by (le))`, path, method),
-				LegendFormat: "p90",
+				Expr:         promHistogramQuantile("0.90", latency, match.by()...),
+				LegendFormat: match.legend("p90"),
 				RefID:        "C",
 			},
 			{
-				Expr:         fmt.Sprintf(`histogram_quantile(0.50, sum(rate(http_request_duration_seconds_bucket{path="%s", method="%s", service=~"$service"}[$__rate_interval])) by (le))`, path, method),
-				LegendFormat: "p50",
+				Expr:         promHistogramQuantile("0.50", latency, match.by()...),
+				LegendFormat: match.legend("p50"),
 				RefID:        "D",
 			},
 		},
@@ -669,13 +2175,13 @@ func createLatencyPanel(title, path, method string, panelID, height, yPos int) P
 		FieldConfig: FieldConfig{
 			Defaults: FieldConfigDefaults{
 				Color: ColorOptions{Mode: "palette-classic"},
-				Unit:  "s",
+				Unit:  metricUnit("http_request_duration_seconds"),
 				Thresholds: ThresholdOptions{
 					Mode: "absolute",
 					Steps: []ThresholdStep{
 						{Color: "green", Value: nil},
-						{Color: "yellow", Value: floatPtr(0.5)},
-						{Color: "red", Value: floatPtr(1.0)},
+						{Color: "yellow", Value: floatPtr(thresholds.LatencyWarning)},
+						{Color: "red", Value: floatPtr(thresholds.LatencyCritical)},
 					},
 				},
 			},
@@ -684,7 +2190,7 @@ func createLatencyPanel(title, path, method string, panelID, height, yPos int) P
 	}
 }
 
-func createErrorRatePanel(title, path, method string, panelID, height, yPos int) Panel {
+func createErrorRatePanel(title string, match operationMatch, thresholds ThresholdConfig, panelID, height, yPos int) Panel {
 	return Panel{
 		ID:         panelID,
 		Title:      title + " - Error Rate",
@@ -693,8 +2199,8 @@ func createErrorRatePanel(title, path, method string, panelID, height, yPos int)
 		GridPos:    GridPos{H: height, W: 6, X: 0, Y: yPos},
 		Targets: []Target{
 			{
-				Expr:         fmt.Sprintf(`sum(rate(http_requests_total{path="%s", method="%s", status_code=~"5..", service=~"$service"}[$__rate_interval])) / sum(rate(http_requests_total{path="%s", method="%s", service=~"$service"}[$__rate_interval])) * 100`, path, method, path, method),
-				LegendFormat: "Error Rate",
+				Expr:         promPercent(promSum(promRate(match.selector("http_requests_total", `status_code=~"5.."`)), match.by()...), promSum(promRate(match.selector("http_requests_total")), match.by()...)),
+				LegendFormat: match.legend("Error Rate"),
 				RefID:        "A",
 			},
 		},
@@ -722,8 +2228,8 @@ func createErrorRatePanel(title, path, method string, panelID, height, yPos int)
 					Mode: "absolute",
 					Steps: []ThresholdStep{
 						{Color: "green", Value: nil},
-						{Color: "yellow", Value: floatPtr(1)},
-						{Color: "red", Value: floatPtr(5)},
+						{Color: "yellow", Value: floatPtr(thresholds.ErrorWarning)},
+						{Color: "red", Value: floatPtr(thresholds.ErrorCritical)},
 					},
 				},
 			},
@@ -732,7 +2238,7 @@ func createErrorRatePanel(title, path, method string, panelID, height, yPos int)
 	}
 }
 
-func createThroughputPanel(title, path, method string, panelID, height, yPos int) Panel {
+func createThroughputPanel(title string, match operationMatch, panelID, height, yPos int) Panel {
 	return Panel{
 		ID:         panelID,
 		Title:      title + " - Throughput",
@@ -741,8 +2247,8 @@ func createThroughputPanel(title, path, method string, panelID, height, yPos int
 		GridPos:    GridPos{H: height, W: 6, X: 6, Y: yPos},
 		Targets: []Target{
 			{
-				Expr:         fmt.Sprintf(`sum(rate(http_requests_total{path="%s", method="%s", service=~"$service"}[$__rate_interval]))`, path, method),
-				LegendFormat: "Throughput",
+				Expr:         promSum(promRate(match.selector("http_requests_total")), match.by()...),
+				LegendFormat: match.legend("Throughput"),
 				RefID:        "A",
 			},
 		},
@@ -763,7 +2269,7 @@ func createThroughputPanel(title, path, method string, panelID, height, yPos int
 		FieldConfig: FieldConfig{
 			Defaults: FieldConfigDefaults{
 				Color: ColorOptions{Mode: "palette-classic"},
-				Unit:  "reqps",
+				Unit:  metricUnit("http_requests_total"),
 				Thresholds: ThresholdOptions{
 					Mode: "absolute",
 					Steps: []ThresholdStep{
@@ -776,11 +2282,21 @@ func createThroughputPanel(title, path, method string, panelID, height, yPos int
 	}
 }
 
+func createRowPanel(title string, panelID, yPos int) Panel {
+	return Panel{
+		ID:      panelID,
+		Title:   title,
+		Type:    "row",
+		GridPos: GridPos{H: 1, W: 24, X: 0, Y: yPos},
+		Panels:  []Panel{},
+	}
+}
+
 func floatPtr(f float64) *float64 {
 	return &f
 }
 
-func createGRPCRequestPanel(title, service, method string, panelID, height, yPos int) Panel {
+func createGRPCRequestPanel(title string, match grpcMatch, panelID, height, yPos int) Panel {
 	return Panel{
 		ID:         panelID,
 		Title:      title + " - Request Rate",
@@ -789,7 +2305,7 @@ func createGRPCRequestPanel(title, service, method string, panelID, height, yPos
 		GridPos:    GridPos{H: height, W: 12, X: 0, Y: yPos},
 		Targets: []Target{
 			{
-				Expr:         fmt.Sprintf(`sum(rate(grpc_server_handled_total{grpc_service="%s", grpc_method="%s"}[$__rate_interval])) by (grpc_code)`, service, method),
+				Expr:         promSum(promRate(match.selector("grpc_server_handled_total")), "grpc_code"),
 				LegendFormat: "Code {{grpc_code}}",
 				RefID:        "A",
 			},
@@ -806,7 +2322,7 @@ func createGRPCRequestPanel(title, service, method string, panelID, height, yPos
 		FieldConfig: FieldConfig{
 			Defaults: FieldConfigDefaults{
 				Color: ColorOptions{Mode: "palette-classic"},
-				Unit:  "reqps",
+				Unit:  metricUnit("grpc_server_handled_total"),
 				Thresholds: ThresholdOptions{
 					Mode: "absolute",
 					Steps: []ThresholdStep{
@@ -820,7 +2336,8 @@ func createGRPCRequestPanel(title, service, method string, panelID, height, yPos
 	}
 }
 
-func createGRPCLatencyPanel(title, service, method string, panelID, height, yPos int) Panel {
+func createGRPCLatencyPanel(title string, match grpcMatch, thresholds ThresholdConfig, panelID, height, yPos int) Panel {
+	latency := match.selector("grpc_server_handling_seconds")
 	return Panel{
 		ID:         panelID,
 		Title:      title + " - Latency",
@@ -829,22 +2346,22 @@ func createGRPCLatencyPanel(title, service, method string, panelID, height, yPos
 		GridPos:    GridPos{H: height, W: 12, X: 12, Y: yPos},
 		Targets: []Target{
 			{
-				Expr:         fmt.Sprintf(`histogram_quantile(0.99, sum(rate(grpc_server_handling_seconds_bucket{grpc_service="%s", grpc_method="%s"}[$__rate_interval])) by (le))`, service, method),
+				Expr:         promHistogramQuantile("0.99", latency),
 				LegendFormat: "p99",
 				RefID:        "A",
 			},
 			{
-				Expr:         fmt.Sprintf(`histogram_quantile(0.95, sum(rate(grpc_server_handling_seconds_bucket{grpc_service="%s", grpc_method="%s"}[$__rate_interval])) by (le))`, service, method),
+				Expr:         promHistogramQuantile("0.95", latency),
 				LegendFormat: "p95",
 				RefID:        "B",
 			},
 			{
-				Expr:         fmt.Sprintf(`histogram_quantile(0.90, sum(rate(grpc_server_handling_seconds_bucket{grpc_service="%s", grpc_method="%s"}[$__rate_interval])) by (le))`, service, method),
+				Expr:         promHistogramQuantile("0.90", latency),
 				LegendFormat: "p90",
 				RefID:        "C",
 			},
 			{
-				Expr:         fmt.Sprintf(`histogram_quantile(0.50, sum(rate(grpc_server_handling_seconds_bucket{grpc_service="%s", grpc_method="%s"}[$__rate_interval])) by (le))`, service, method),
+				Expr:         promHistogramQuantile("0.50", latency),
 				LegendFormat: "p50",
 				RefID:        "D",
 			},
@@ -861,13 +2378,13 @@ func createGRPCLatencyPanel(title, service, method string, panelID, height, yPos
 		FieldConfig: FieldConfig{
 			Defaults: FieldConfigDefaults{
 				Color: ColorOptions{Mode: "palette-classic"},
-				Unit:  "s",
+				Unit:  metricUnit("grpc_server_handling_seconds"),
 				Thresholds: ThresholdOptions{
 					Mode: "absolute",
 					Steps: []ThresholdStep{
 						{Color: "green", Value: nil},
-						{Color: "yellow", Value: floatPtr(0.5)},
-						{Color: "red", Value: floatPtr(1.0)},
+						{Color: "yellow", Value: floatPtr(thresholds.LatencyWarning)},
+						{Color: "red", Value: floatPtr(thresholds.LatencyCritical)},
 					},
 				},
 			},
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Label the generated alerts get when maintenance windows are configured,
+// matched by the notification policy route carrying the mute timings
+const (
+	managedByLabel = "managed_by"
+	managedByValue = "openapi2grafana"
+)
+
+// Names of the weekdays and months of cron schedules, in cron order
+var (
+	cronWeekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+	cronMonths   = []string{"january", "february", "march", "april", "may", "june", "july", "august", "september", "october", "november", "december"}
+)
+
+// MaintenanceWindow is a recurring maintenance window of the maintenance
+// section of the config file. Schedule is a cron expression, "minute hour
+// day-of-month month day-of-week", giving the start of the window.
+type MaintenanceWindow struct {
+	Name     string `yaml:"name"`
+	Schedule string `yaml:"schedule"`
+	Duration string `yaml:"duration"`
+	// Timezone is the zone of the schedule, UTC when empty
+	Timezone string `yaml:"timezone"`
+}
+
+// MuteTiming is a Grafana mute timing, silencing the notifications of the
+// routes it is attached to during its time intervals
+type MuteTiming struct {
+	Name          string         `json:"name"`
+	TimeIntervals []TimeInterval `json:"time_intervals"`
+}
+
+// TimeInterval is a recurring interval of a mute timing; empty fields match
+// any day
+type TimeInterval struct {
+	Times       []TimeRange `json:"times,omitempty"`
+	Weekdays    []string    `json:"weekdays,omitempty"`
+	DaysOfMonth []string    `json:"days_of_month,omitempty"`
+	Months      []string    `json:"months,omitempty"`
+	Location    string      `json:"location,omitempty"`
+}
+
+// TimeRange is a time of day range, HH:MM
+type TimeRange struct {
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+// validateMaintenance checks that the maintenance windows have unique names
+// and translate to mute timings
+func validateMaintenance(windows []MaintenanceWindow) error {
+	seen := make(map[string]bool, len(windows))
+	for i, window := range windows {
+		if window.Name == "" {
+			return fmt.Errorf("maintenance[%d]: name is required", i)
+		}
+		if seen[window.Name] {
+			return fmt.Errorf("maintenance: duplicate window %s", window.Name)
+		}
+		seen[window.Name] = true
+		if _, err := window.muteTiming(); err != nil {
+			return fmt.Errorf("maintenance: %s: %w", window.Name, err)
+		}
+	}
+	return nil
+}
+
+// muteTiming translates the window into a mute timing. A window crossing
+// midnight is split in two intervals, the second on the following weekdays,
+// which needs a schedule with any day of month and month.
+func (w MaintenanceWindow) muteTiming() (MuteTiming, error) {
+	fields := strings.Fields(w.Schedule)
+	if len(fields) != 5 {
+		return MuteTiming{}, fmt.Errorf("invalid schedule %q: must have 5 fields, minute hour day-of-month month day-of-week", w.Schedule)
+	}
+	minute, err := strconv.Atoi(fields[0])
+	if err != nil || minute < 0 || minute > 59 {
+		return MuteTiming{}, fmt.Errorf("invalid schedule minute %q: must be a single minute, 0-59", fields[0])
+	}
+	hour, err := strconv.Atoi(fields[1])
+	if err != nil || hour < 0 || hour > 23 {
+		return MuteTiming{}, fmt.Errorf("invalid schedule hour %q: must be a single hour, 0-23", fields[1])
+	}
+	days, err := parseCronField(fields[2], 1, 31, nil)
+	if err != nil {
+		return MuteTiming{}, fmt.Errorf("invalid schedule day of month: %w", err)
+	}
+	months, err := parseCronField(fields[3], 1, 12, cronMonths)
+	if err != nil {
+		return MuteTiming{}, fmt.Errorf("invalid schedule month: %w", err)
+	}
+	weekdays, err := parseCronField(fields[4], 0, 7, cronWeekdays)
+	if err != nil {
+		return MuteTiming{}, fmt.Errorf("invalid schedule day of week: %w", err)
+	}
+	// Sunday is both 0 and 7
+	if weekdays != nil && weekdays[7] {
+		weekdays[0] = true
+		delete(weekdays, 7)
+	}
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil || duration <= 0 || duration > 24*time.Hour || duration%time.Minute != 0 {
+		return MuteTiming{}, fmt.Errorf("invalid duration %q: must be whole minutes up to 24h, e.g. 90m", w.Duration)
+	}
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return MuteTiming{}, fmt.Errorf("invalid timezone %q", w.Timezone)
+		}
+	}
+
+	start := hour*60 + minute
+	end := start + int(duration/time.Minute)
+	interval := TimeInterval{
+		Weekdays:    cronRanges(weekdays, 0, 6, cronWeekdays),
+		DaysOfMonth: cronRanges(days, 1, 31, nil),
+		Months:      cronRanges(months, 1, 12, cronMonths),
+		Location:    w.Timezone,
+	}
+	first := interval
+	first.Times = []TimeRange{{StartTime: clockTime(start), EndTime: clockTime(min(end, 24*60))}}
+	timing := MuteTiming{Name: w.Name, TimeIntervals: []TimeInterval{first}}
+	if end <= 24*60 {
+		return timing, nil
+	}
+
+	if days != nil || months != nil {
+		return MuteTiming{}, fmt.Errorf("a window crossing midnight needs * as day of month and month")
+	}
+	next := interval
+	next.Times = []TimeRange{{StartTime: clockTime(0), EndTime: clockTime(end - 24*60)}}
+	if weekdays != nil {
+		shifted := make(map[int]bool, len(weekdays))
+		for day := range weekdays {
+			shifted[(day+1)%7] = true
+		}
+		next.Weekdays = cronRanges(shifted, 0, 6, cronWeekdays)
+	}
+	timing.TimeIntervals = append(timing.TimeIntervals, next)
+	return timing, nil
+}
+
+// parseCronField parses a cron field of values, a-b ranges and names into
+// the set of values it matches, nil for *
+func parseCronField(field string, low, high int, names []string) (map[int]bool, error) {
+	if field == "*" {
+		return nil, nil
+	}
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name[:3]) || strings.EqualFold(s, name) {
+				return i + low, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < low || n > high {
+			return 0, fmt.Errorf("%q is not in %d-%d", s, low, high)
+		}
+		return n, nil
+	}
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := value(from)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = value(to); err != nil {
+				return nil, err
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("range %q is reversed", part)
+		}
+		for n := first; n <= last; n++ {
+			values[n] = true
+		}
+	}
+	return values, nil
+}
+
+// cronRanges writes a set of values as Grafana ranges, "monday:friday" or
+// "1:5", nil for any value
+func cronRanges(values map[int]bool, low, high int, names []string) []string {
+	if values == nil {
+		return nil
+	}
+	format := func(n int) string {
+		if names != nil {
+			return names[n-low]
+		}
+		return strconv.Itoa(n)
+	}
+	var ranges []string
+	for n := low; n <= high; n++ {
+		if !values[n] {
+			continue
+		}
+		last := n
+		for last < high && values[last+1] {
+			last++
+		}
+		if last == n {
+			ranges = append(ranges, format(n))
+		} else {
+			ranges = append(ranges, format(n)+":"+format(last))
+		}
+		n = last
+	}
+	return ranges
+}
+
+// clockTime formats minutes after midnight as HH:MM, 24:00 for midnight at
+// the end of a range
+func clockTime(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// applyMaintenanceLabel labels the generated alerts so the notification
+// policy route carrying the mute timings matches them
+func applyMaintenanceLabel(dashboard *GrafanaDashboard) {
+	applyToPanels(dashboard.Panels, func(panel *Panel) {
+		if panel.Alert == nil {
+			return
+		}
+		if panel.Alert.AlertRuleTags == nil {
+			panel.Alert.AlertRuleTags = make(map[string]string)
+		}
+		panel.Alert.AlertRuleTags[managedByLabel] = managedByValue
+	})
+}
+
+// hasAlerts reports whether any dashboard has an alert
+func hasAlerts(dashboards []GrafanaDashboard) bool {
+	for _, dashboard := range dashboards {
+		found := false
+		applyToPanels(dashboard.Panels, func(panel *Panel) {
+			found = found || panel.Alert != nil
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// PushMuteTiming creates a mute timing or updates the one of the same name
+func (c *GrafanaClient) PushMuteTiming(ctx context.Context, timing MuteTiming) error {
+	path := "/api/v1/provisioning/mute-timings"
+	body, err := json.Marshal(timing)
+	if err != nil {
+		return fmt.Errorf("error marshaling mute timing: %w", err)
+	}
+	err = c.do(ctx, http.MethodGet, path+"/"+url.PathEscape(timing.Name), nil, nil)
+	var pushErr *PushError
+	if errors.As(err, &pushErr) && pushErr.StatusCode == http.StatusNotFound {
+		return c.do(ctx, http.MethodPost, path, body, nil)
+	}
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPut, path+"/"+url.PathEscape(timing.Name), body, nil)
+}
+
+// MuteGeneratedAlerts attaches mute timings to the notification policy route
+// of the generated alerts, the first child of the root policy matching
+// managed_by=openapi2grafana. The route is added when missing, inheriting
+// the default contact point; its other settings and child routes are kept.
+func (c *GrafanaClient) MuteGeneratedAlerts(ctx context.Context, names []string) error {
+	path := "/api/v1/provisioning/policies"
+	var tree map[string]interface{}
+	if err := c.do(ctx, http.MethodGet, path, nil, &tree); err != nil {
+		return err
+	}
+	matchers := []interface{}{[]interface{}{managedByLabel, "=", managedByValue}}
+	intervals := make([]interface{}, len(names))
+	for i, name := range names {
+		intervals[i] = name
+	}
+
+	routes, _ := tree["routes"].([]interface{})
+	var managed map[string]interface{}
+	for _, route := range routes {
+		if route, ok := route.(map[string]interface{}); ok && reflect.DeepEqual(route["object_matchers"], matchers) {
+			managed = route
+			break
+		}
+	}
+	if managed == nil {
+		managed = map[string]interface{}{"object_matchers": matchers}
+		tree["routes"] = append([]interface{}{managed}, routes...)
+	}
+	managed["mute_time_intervals"] = intervals
+
+	body, err := json.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("error marshaling notification policies: %w", err)
+	}
+	return c.do(ctx, http.MethodPut, path, body, nil)
+}
+
+// pushMaintenance pushes the mute timings of the maintenance windows and
+// attaches them to the generated alerts, when the dashboards have alerts
+func pushMaintenance(ctx context.Context, client *GrafanaClient, windows []MaintenanceWindow, dashboards []GrafanaDashboard) error {
+	if len(windows) == 0 || !hasAlerts(dashboards) {
+		return nil
+	}
+	names := make([]string, len(windows))
+	for i, window := range windows {
+		timing, err := window.muteTiming()
+		if err != nil {
+			return err
+		}
+		if err := client.PushMuteTiming(ctx, timing); err != nil {
+			return fmt.Errorf("error pushing mute timing %s: %w", window.Name, err)
+		}
+		names[i] = window.Name
+	}
+	if err := client.MuteGeneratedAlerts(ctx, names); err != nil {
+		return fmt.Errorf("error attaching mute timings to the notification policies: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// loadSpecs parses every spec source (file path or http(s) URL) and derives
+// the service each one describes
+func loadSpecs(ctx context.Context, fetcher *SpecFetcher, sources []string) ([]LoadedSpec, error) {
+	specs := make([]LoadedSpec, 0, len(sources))
+	for _, source := range sources {
+		spec, err := fetcher.Load(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// parseSpec parses raw spec data; source is used to resolve relative $refs.
+// External $refs are resolved with refs, and refused when it is nil.
+func parseSpec(source string, data []byte, refs *RefOptions) (LoadedSpec, error) {
+	if isAsyncAPI(data) {
+		return parseAsyncAPI(source, data)
+	}
+	if version := swaggerVersion(data); version != "" {
+		return LoadedSpec{}, &SpecLoadError{Source: source, Op: "loading OpenAPI spec", Err: &UnsupportedFeatureError{Feature: "Swagger version", Value: version}}
+	}
+
+	loader := openapi3.NewLoader()
+	var location *url.URL
+	if refs != nil {
+		loader.IsExternalRefsAllowed = true
+		loader.ReadFromURIFunc = refs.reader(source)
+		location = refs.location(source)
+	} else if isURL(source) {
+		location, _ = url.Parse(source)
+	} else {
+		location = &url.URL{Path: filepath.ToSlash(source)}
+	}
+
+	doc, err := loader.LoadFromDataWithPath(data, location)
+	if err != nil {
+		return LoadedSpec{}, &SpecLoadError{Source: source, Op: "loading OpenAPI spec", Err: err}
+	}
+
+	return LoadedSpec{
+		File:    source,
+		Service: specServiceName(source, doc),
+		Doc:     doc,
+		Data:    data,
+	}, nil
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// specServiceName returns the x-service-name extension, the slugified
+// info.title, or the file name, in that order of preference
+func specServiceName(file string, doc *openapi3.T) string {
+	if name, ok := doc.Extensions["x-service-name"].(string); ok && name != "" {
+		return name
+	}
+	if doc.Info != nil && doc.Info.Title != "" {
+		return slugify(doc.Info.Title)
+	}
+	return slugify(strings.TrimSuffix(path.Base(file), path.Ext(file)))
+}
+
+func slugify(s string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// collectMergedOperations returns the operations of every spec, sorted
+// across the specs like those of a single spec. Operations with the same method and path in several specs (e.g.
+// /healthz) select the same series; they are returned once in shared, with
+// the responses documented by any of the specs and Services listing every
+// spec defining them.
+func collectMergedOperations(specs []LoadedSpec, sortOrder string) (ops []OperationInfo, shared []OperationInfo) {
+	if len(specs) == 1 {
+		return collectOperations(specs[0].Doc, sortOrder), nil
+	}
+
+	byFingerprint := make(map[string]*OperationInfo)
+	var order []string
+	for _, spec := range specs {
+		for _, op := range collectOperations(spec.Doc, sortOrder) {
+			key := operationFingerprint(op)
+			if existing, ok := byFingerprint[key]; ok {
+				existing.Services = append(existing.Services, spec.Service)
+				mergeResponses(existing, op)
+				continue
+			}
+			op.Services = []string{spec.Service}
+			byFingerprint[key] = &op
+			order = append(order, key)
+		}
+	}
+
+	for _, key := range order {
+		op := *byFingerprint[key]
+		if len(op.Services) > 1 {
+			shared = append(shared, op)
+		} else {
+			ops = append(ops, op)
+		}
+	}
+
+	sortOperations(ops, sortOrder)
+	sortOperations(shared, sortOrder)
+	return ops, shared
+}
+
+// operationFingerprint identifies an operation independently of the spec it
+// came from, by the method and path its series are selected by
+func operationFingerprint(op OperationInfo) string {
+	return strings.ToUpper(op.Method) + " " + op.Path
+}
+
+// mergeResponses adds the responses of op that the merged operation does not
+// document yet, on a copy so the spec it came from is left untouched
+func mergeResponses(merged *OperationInfo, op OperationInfo) {
+	if op.Operation.Responses == nil {
+		return
+	}
+	var missing []string
+	for code := range op.Operation.Responses.Map() {
+		if merged.Operation.Responses == nil || merged.Operation.Responses.Value(code) == nil {
+			missing = append(missing, code)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	sort.Strings(missing)
+
+	operation := *merged.Operation
+	operation.Responses = openapi3.NewResponsesWithCapacity(operation.Responses.Len() + len(missing))
+	if merged.Operation.Responses != nil {
+		for code, response := range merged.Operation.Responses.Map() {
+			operation.Responses.Set(code, response)
+		}
+	}
+	for _, code := range missing {
+		operation.Responses.Set(code, op.Operation.Responses.Value(code))
+	}
+	merged.Operation = &operation
+}
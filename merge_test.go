@@ -0,0 +1,131 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// loadTestSpec parses a spec given inline
+func loadTestSpec(t *testing.T, source, data string) LoadedSpec {
+	t.Helper()
+	spec, err := parseSpec(source, []byte(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+const ordersSpec = `openapi: 3.0.3
+info:
+  title: Orders
+  version: 1.0.0
+paths:
+  /orders:
+    get:
+      tags: [orders]
+      responses:
+        "200":
+          description: OK
+  /healthz:
+    get:
+      tags: [health]
+      responses:
+        "200":
+          description: OK
+`
+
+const usersSpec = `openapi: 3.0.3
+info:
+  title: Users
+  version: 1.0.0
+paths:
+  /users:
+    get:
+      tags: [accounts]
+      responses:
+        "200":
+          description: OK
+  /healthz:
+    get:
+      tags: [health]
+      responses:
+        "503":
+          description: Unavailable
+`
+
+// operationKeys returns "METHOD path" of every operation, in order
+func operationKeys(ops []OperationInfo) []string {
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = operationFingerprint(op)
+	}
+	return keys
+}
+
+func TestCollectMergedOperations(t *testing.T) {
+	orders := loadTestSpec(t, "orders.yaml", ordersSpec)
+	users := loadTestSpec(t, "users.yaml", usersSpec)
+
+	ops, shared := collectMergedOperations([]LoadedSpec{orders, users}, "path")
+	if got, want := operationKeys(ops), []string{"GET /orders", "GET /users"}; !slices.Equal(got, want) {
+		t.Errorf("operations = %v, want %v", got, want)
+	}
+	if len(shared) != 1 || operationFingerprint(shared[0]) != "GET /healthz" {
+		t.Fatalf("shared = %v, want GET /healthz", operationKeys(shared))
+	}
+	if got, want := shared[0].Services, []string{"orders", "users"}; !slices.Equal(got, want) {
+		t.Errorf("services = %v, want %v", got, want)
+	}
+
+	// The shared operation documents the responses of both specs, without
+	// touching the first spec's
+	responses := shared[0].Operation.Responses
+	if responses.Value("200") == nil || responses.Value("503") == nil {
+		t.Errorf("merged responses = %v, want 200 and 503", sortedMapKeys(responses.Map()))
+	}
+	if orders.Doc.Paths.Find("/healthz").Get.Responses.Value("503") != nil {
+		t.Error("merging added a response to the spec the operation came from")
+	}
+}
+
+// TestCollectMergedOperationsByTag checks --sort tag groups the operations
+// of every spec by tag, not spec by spec
+func TestCollectMergedOperationsByTag(t *testing.T) {
+	orders := loadTestSpec(t, "orders.yaml", ordersSpec)
+	users := loadTestSpec(t, "users.yaml", usersSpec)
+
+	ops, _ := collectMergedOperations([]LoadedSpec{orders, users}, "tag")
+	if got, want := operationKeys(ops), []string{"GET /users", "GET /orders"}; !slices.Equal(got, want) {
+		t.Errorf("operations = %v, want %v, accounts before orders", got, want)
+	}
+}
+
+func TestCollectMergedOperationsSingleSpec(t *testing.T) {
+	ops, shared := collectMergedOperations([]LoadedSpec{loadTestSpec(t, "orders.yaml", ordersSpec)}, "tag")
+	if got, want := operationKeys(ops), []string{"GET /healthz", "GET /orders"}; !slices.Equal(got, want) {
+		t.Errorf("operations = %v, want %v", got, want)
+	}
+	if len(shared) != 0 {
+		t.Errorf("shared = %v, want none", operationKeys(shared))
+	}
+	if ops[0].Services != nil {
+		t.Errorf("services of a single spec = %v, want none", ops[0].Services)
+	}
+}
+
+func TestSpecServiceName(t *testing.T) {
+	tests := []struct {
+		name, source, spec, want string
+	}{
+		{"extension", "a.yaml", "openapi: 3.0.3\ninfo: {title: Orders API, version: '1'}\nx-service-name: order-svc\npaths: {}\n", "order-svc"},
+		{"title", "a.yaml", "openapi: 3.0.3\ninfo: {title: Orders API v2, version: '1'}\npaths: {}\n", "orders-api-v2"},
+		{"file name", "specs/Billing_API.yaml", "openapi: 3.0.3\ninfo: {title: '', version: '1'}\npaths: {}\n", "billing-api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadTestSpec(t, tt.source, tt.spec).Service; got != tt.want {
+				t.Errorf("service = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+)
+
+// Prefixes of the tags carrying generation metadata. Grafana keeps tags on
+// import and push, unlike fields it does not know about.
+const (
+	specHashTagPrefix  = "spec-hash:"
+	generatorTagPrefix = "generator:"
+)
+
+// specHashTagLength is the number of hex digits of the spec hash kept in its
+// tag, short enough for Grafana's tag length limit
+const specHashTagLength = 12
+
+// metadataTags returns the tags recording the hash of the specs and the
+// version of the generator
+func metadataTags(specHash string) []string {
+	if len(specHash) > specHashTagLength {
+		specHash = specHash[:specHashTagLength]
+	}
+	return []string{specHashTagPrefix + specHash, generatorTagPrefix + GetBuildInfo().Version}
+}
+
+// specHashFromTags returns the spec hash recorded in a dashboard's tags, or
+// "" for dashboards without one
+func specHashFromTags(tags []string) string {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, specHashTagPrefix) {
+			return strings.TrimPrefix(tag, specHashTagPrefix)
+		}
+	}
+	return ""
+}
+
+// previousDashboard returns the dashboard --update updates: the one stored
+// in Grafana under uid when pushing (on the first instance when pushing to
+// several), the output file otherwise, and nil when there is none
+func previousDashboard(ctx context.Context, config *Config, uid string) *storedDashboard {
+	if config.Push {
+		client, err := config.pushTargets()[0].client(config)
+		if err != nil {
+			slog.Warn("could not read the dashboard to update", "uid", uid, "error", err)
+			return nil
+		}
+		dashboard, err := client.GetDashboard(ctx, uid)
+		if err != nil {
+			slog.Warn("could not read the dashboard to update", "uid", uid, "error", err)
+		}
+		return dashboard
+	}
+	dashboard, _ := loadExistingDashboard(config.OutputFile)
+	if dashboard == nil {
+		return nil
+	}
+	panels, _ := json.Marshal(dashboard.Panels)
+	return &storedDashboard{Title: dashboard.Title, Tags: dashboard.Tags, Version: dashboard.Version, Panels: panels}
+}
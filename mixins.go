@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mixinAfterTagPrefix places a mixin after the panels of a tag's operations,
+// e.g. "after-tag:orders"
+const mixinAfterTagPrefix = "after-tag:"
+
+// MixinConfig includes a hand-written dashboard fragment, a JSON or YAML
+// file, at a position of the generated dashboard: top, after-http, bottom
+// (the default) or after-tag:<tag>
+type MixinConfig struct {
+	File     string `yaml:"file"`
+	Position string `yaml:"position"`
+	// fragment is the parsed file, read when the config is loaded
+	fragment *MixinFragment
+}
+
+// MixinFragment is the content of a mixin file: Grafana panels, under a row
+// when it has a title
+type MixinFragment struct {
+	Title     string            `json:"title"`
+	Collapsed bool              `json:"collapsed"`
+	Panels    []json.RawMessage `json:"panels"`
+}
+
+// loadMixins reads the fragment of every mixin, relative paths resolving
+// against the directory of the config file
+func loadMixins(mixins []MixinConfig, configFile string) error {
+	for i := range mixins {
+		mixin := &mixins[i]
+		switch {
+		case mixin.Position == "":
+			mixin.Position = rowPositionBottom
+		case mixin.Position == rowPositionTop, mixin.Position == rowPositionAfterHTTP, mixin.Position == rowPositionBottom:
+		case strings.HasPrefix(mixin.Position, mixinAfterTagPrefix) && len(mixin.Position) > len(mixinAfterTagPrefix):
+		default:
+			return fmt.Errorf("mixins[%d]: invalid position %q: must be %s, %s, %s or %s<tag>",
+				i, mixin.Position, rowPositionTop, rowPositionAfterHTTP, rowPositionBottom, mixinAfterTagPrefix)
+		}
+		if mixin.File == "" {
+			return fmt.Errorf("mixins[%d]: file is required", i)
+		}
+
+		file := mixin.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(configFile), file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("mixins[%d]: %w", i, err)
+		}
+		// YAML is a superset of JSON; panels are re-encoded as JSON
+		var content interface{}
+		if err := yaml.Unmarshal(data, &content); err != nil {
+			return fmt.Errorf("mixins[%d]: error parsing %s: %w", i, mixin.File, err)
+		}
+		if panels, ok := content.([]interface{}); ok {
+			content = map[string]interface{}{"panels": panels}
+		}
+		encoded, err := json.Marshal(content)
+		if err != nil {
+			return fmt.Errorf("mixins[%d]: error parsing %s: %w", i, mixin.File, err)
+		}
+		fragment := &MixinFragment{}
+		if err := json.Unmarshal(encoded, fragment); err != nil {
+			return fmt.Errorf("mixins[%d]: %s must hold a list of panels or an object with panels: %w", i, mixin.File, err)
+		}
+		if len(fragment.Panels) == 0 {
+			return fmt.Errorf("mixins[%d]: %s has no panels", i, mixin.File)
+		}
+		for j, raw := range fragment.Panels {
+			var panel Panel
+			if err := json.Unmarshal(raw, &panel); err != nil {
+				return fmt.Errorf("mixins[%d]: %s: panels[%d]: %w", i, mixin.File, j, err)
+			}
+		}
+		mixin.fragment = fragment
+	}
+	return nil
+}
+
+// addMixins inserts the mixins of a position at the cursor. Each is placed
+// once, the first time its position is reached.
+func addMixins(ctx context.Context, dashboard *GrafanaDashboard, config *Config, position string, cursor *panelCursor) {
+	for i, mixin := range config.fileConfig().Mixins {
+		if mixin.Position != position || mixin.fragment == nil || dashboard.placedMixins[i] {
+			continue
+		}
+		if dashboard.placedMixins == nil {
+			dashboard.placedMixins = make(map[int]bool)
+		}
+		dashboard.placedMixins[i] = true
+		addMixin(ctx, dashboard, mixin, cursor)
+	}
+}
+
+// addMixin inserts the panels of a mixin, numbered and positioned like raw
+// custom row panels, under a row when the fragment has a title
+func addMixin(ctx context.Context, dashboard *GrafanaDashboard, mixin MixinConfig, cursor *panelCursor) {
+	row := CustomRow{Title: mixin.fragment.Title, Collapsed: mixin.fragment.Collapsed}
+	for _, raw := range mixin.fragment.Panels {
+		row.Panels = append(row.Panels, CustomRowPanel{Raw: raw})
+	}
+	if row.Title != "" {
+		addCustomRow(ctx, dashboard, row, nil, cursor)
+		return
+	}
+	for _, ref := range row.Panels {
+		panel, err := buildCustomRowPanel(ctx, ref, nil, cursor)
+		if err != nil {
+			slog.Warn("skipping panel in mixin", "file", mixin.File, "error", err)
+			continue
+		}
+		dashboard.Panels = append(dashboard.Panels, panel)
+	}
+}
+
+// addTagMixins inserts the mixins placed after a tag once the last of ops
+// with that tag is reached; i indexes the operation just added
+func addTagMixins(ctx context.Context, dashboard *GrafanaDashboard, config *Config, ops []OperationInfo, i int, cursor *panelCursor) {
+	tag := ops[i].Tag
+	if tag == "" {
+		return
+	}
+	for _, op := range ops[i+1:] {
+		if op.Tag == tag {
+			return
+		}
+	}
+	addMixins(ctx, dashboard, config, mixinAfterTagPrefix+tag, cursor)
+}
+
+// addUnplacedMixins appends the mixins whose tag has no operation on the
+// dashboard at the bottom
+func addUnplacedMixins(ctx context.Context, dashboard *GrafanaDashboard, config *Config, cursor *panelCursor) {
+	for i, mixin := range config.fileConfig().Mixins {
+		if mixin.fragment == nil || dashboard.placedMixins[i] || !strings.HasPrefix(mixin.Position, mixinAfterTagPrefix) {
+			continue
+		}
+		slog.Warn("no operation has the tag of the mixin, adding it at the bottom", "file", mixin.File, "position", mixin.Position)
+		if dashboard.placedMixins == nil {
+			dashboard.placedMixins = make(map[int]bool)
+		}
+		dashboard.placedMixins[i] = true
+		addMixin(ctx, dashboard, mixin, cursor)
+	}
+}
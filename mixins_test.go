@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeMixin writes a mixin file into dir
+func writeMixin(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadMixins(t *testing.T) {
+	dir := t.TempDir()
+	writeMixin(t, dir, "list.json", `[{"type": "text", "title": "About"}]`)
+	writeMixin(t, dir, "row.yaml", "title: Capacity\ncollapsed: true\npanels:\n  - type: stat\n    title: Queue\n")
+
+	mixins := []MixinConfig{{File: "list.json"}, {File: "row.yaml", Position: "after-tag:orders"}}
+	if err := loadMixins(mixins, filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if mixins[0].Position != rowPositionBottom {
+		t.Errorf("default position = %q, want %s", mixins[0].Position, rowPositionBottom)
+	}
+	if fragment := mixins[0].fragment; fragment.Title != "" || len(fragment.Panels) != 1 {
+		t.Errorf("list fragment = %+v, want one panel without a row", fragment)
+	}
+	if fragment := mixins[1].fragment; fragment.Title != "Capacity" || !fragment.Collapsed || len(fragment.Panels) != 1 {
+		t.Errorf("row fragment = %+v, want a collapsed Capacity row with one panel", fragment)
+	}
+}
+
+func TestLoadMixinsErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeMixin(t, dir, "empty.json", `{"title": "Empty", "panels": []}`)
+	writeMixin(t, dir, "invalid.yaml", "panels: [\n")
+	writeMixin(t, dir, "scalar.yaml", "just text\n")
+
+	tests := []struct {
+		name  string
+		mixin MixinConfig
+		want  string
+	}{
+		{"position", MixinConfig{File: "empty.json", Position: "middle"}, `invalid position "middle"`},
+		{"tag missing", MixinConfig{File: "empty.json", Position: "after-tag:"}, `invalid position "after-tag:"`},
+		{"no file", MixinConfig{}, "file is required"},
+		{"missing file", MixinConfig{File: "missing.json"}, "no such file"},
+		{"no panels", MixinConfig{File: "empty.json"}, "empty.json has no panels"},
+		{"invalid", MixinConfig{File: "invalid.yaml"}, "error parsing invalid.yaml"},
+		{"not panels", MixinConfig{File: "scalar.yaml"}, "must hold a list of panels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadMixins([]MixinConfig{tt.mixin}, filepath.Join(dir, "config.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddMixins(t *testing.T) {
+	dir := t.TempDir()
+	writeMixin(t, dir, "top.json", `[{"type": "text", "title": "About", "gridPos": {"h": 3, "w": 24}}]`)
+	writeMixin(t, dir, "tag.json", `{"title": "Orders Extras", "panels": [{"type": "stat", "title": "Backlog"}]}`)
+	config := defaultConfig()
+	config.File = &FileConfig{Mixins: []MixinConfig{{File: "top.json", Position: rowPositionTop}, {File: "tag.json", Position: "after-tag:billing"}}}
+	if err := loadMixins(config.File.Mixins, filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	dashboard := &GrafanaDashboard{}
+	cursor := &panelCursor{ID: 1, Height: 8}
+	addMixins(context.Background(), dashboard, config, rowPositionTop, cursor)
+	addMixins(context.Background(), dashboard, config, rowPositionTop, cursor)
+	if len(dashboard.Panels) != 1 || dashboard.Panels[0].Title != "About" || dashboard.Panels[0].GridPos.H != 3 {
+		t.Fatalf("panels after the top mixin = %v, want the About panel once", panelTitles(dashboard.Panels))
+	}
+
+	// No operation has the tag: the mixin ends up at the bottom, once
+	addUnplacedMixins(context.Background(), dashboard, config, cursor)
+	addUnplacedMixins(context.Background(), dashboard, config, cursor)
+	if got, want := panelTitles(dashboard.Panels), []string{"About", "Orders Extras", "Backlog"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("panels = %v, want %v", got, want)
+	}
+	if cursor.ID != 4 || cursor.Y != 3+1+8 {
+		t.Errorf("cursor = id %d, y %d, want id 4, y 12", cursor.ID, cursor.Y)
+	}
+}
+
+// panelTitles returns the titles of panels, in order
+func panelTitles(panels []Panel) []string {
+	titles := make([]string, len(panels))
+	for i, panel := range panels {
+		titles[i] = panel.Title
+	}
+	return titles
+}
+
+// TestMixinPanelsVerbatim checks mixin panels are written as in the
+// fragment, only renumbered and placed
+func TestMixinPanelsVerbatim(t *testing.T) {
+	dir := t.TempDir()
+	writeMixin(t, dir, "stat.json", `[{
+		"type": "stat", "title": "Backlog", "interval": "1m", "pluginVersion": "10.4.0",
+		"options": {"colorMode": "background", "graphMode": "none"},
+		"fieldConfig": {"defaults": {"mappings": [{"type": "value", "options": {"0": {"text": "empty"}}}], "custom": {"lineWidth": 2}}, "overrides": []}
+	}]`)
+	config := defaultConfig()
+	config.File = &FileConfig{Mixins: []MixinConfig{{File: "stat.json", Position: rowPositionTop}}}
+	if err := loadMixins(config.File.Mixins, filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	dashboard := &GrafanaDashboard{}
+	addMixins(context.Background(), dashboard, config, rowPositionTop, &panelCursor{ID: 5, Y: 2, Height: 8})
+
+	data, err := json.Marshal(dashboard.Panels[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"type": "stat", "title": "Backlog", "interval": "1m", "pluginVersion": "10.4.0",
+		"options": map[string]any{"colorMode": "background", "graphMode": "none"},
+		"fieldConfig": map[string]any{
+			"defaults":  map[string]any{"mappings": []any{map[string]any{"type": "value", "options": map[string]any{"0": map[string]any{"text": "empty"}}}}, "custom": map[string]any{"lineWidth": 2.0}},
+			"overrides": []any{},
+		},
+		"id":         5.0,
+		"gridPos":    map[string]any{"h": 8.0, "w": 24.0, "x": 0.0, "y": 2.0},
+		"datasource": map[string]any{"type": "prometheus", "uid": "${datasource}"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("panel = %s", data)
+	}
+}
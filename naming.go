@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// nameTemplateFuncs are the functions available to --uid-template and
+// --title-template
+var nameTemplateFuncs = template.FuncMap{
+	"slug":  slugify,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// NameTemplateData is the data --uid-template and --title-template are
+// executed with, e.g. "{{.Info.Title | slug}}-{{.Tag}}"
+type NameTemplateData struct {
+	Info *openapi3.Info
+	// Service is the x-service-name or slugified title of the first spec
+	Service string
+	// Tag is the tag shared by all selected operations, e.g. with
+	// --include-tags, and empty when they have several
+	Tag string
+	// Tags are the tags of the selected operations, sorted
+	Tags    []string
+	Variant string
+}
+
+// newNameTemplateData collects the template data of the first spec and the
+// selected operations
+func newNameTemplateData(spec LoadedSpec, ops []OperationInfo, variant string) NameTemplateData {
+	data := NameTemplateData{Info: spec.Doc.Info, Service: spec.Service, Variant: variant}
+	if data.Info == nil {
+		data.Info = &openapi3.Info{}
+	}
+	seen := make(map[string]bool)
+	for _, op := range ops {
+		if op.Tag != "" && !seen[op.Tag] {
+			seen[op.Tag] = true
+			data.Tags = append(data.Tags, op.Tag)
+		}
+	}
+	sort.Strings(data.Tags)
+	if len(data.Tags) == 1 {
+		data.Tag = data.Tags[0]
+	}
+	return data
+}
+
+// renderNameTemplate executes a UID or title template
+func renderNameTemplate(text string, data NameTemplateData) (string, error) {
+	tmpl, err := template.New("name").Funcs(nameTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// validateNameTemplate checks that a template parses and only refers to
+// fields of NameTemplateData
+func validateNameTemplate(text string) error {
+	_, err := renderNameTemplate(text, NameTemplateData{Info: &openapi3.Info{}})
+	return err
+}
+
+// applyNameTemplates sets the UID and title of a dashboard from the
+// configured templates. A template rendering empty keeps the default, as
+// does one failing on the spec, with a warning.
+func applyNameTemplates(dashboard *GrafanaDashboard, config *Config, data NameTemplateData) {
+	for _, name := range []struct {
+		flag     string
+		template string
+		target   *string
+	}{
+		{"--uid-template", config.UIDTemplate, &dashboard.UID},
+		{"--title-template", config.TitleTemplate, &dashboard.Title},
+	} {
+		if name.template == "" {
+			continue
+		}
+		value, err := renderNameTemplate(name.template, data)
+		if err != nil {
+			slog.Warn("ignoring name template", "flag", name.flag, "error", err)
+			continue
+		}
+		if value == "" {
+			slog.Warn("ignoring name template, it renders empty", "flag", name.flag, "service", data.Service)
+			continue
+		}
+		*name.target = value
+	}
+}
+
+// What --panel-titles names operation panels, legends and alerts after
+const (
+	panelTitlesOperationID = "operation-id"
+	panelTitlesPath        = "path"
+)
+
+// endpointTitle is "METHOD path" of an operation, followed by its summary
+func endpointTitle(op OperationInfo) string {
+	title := strings.ToUpper(op.Method) + " " + op.Path
+	if op.Operation != nil && op.Operation.Summary != "" {
+		title += ": " + op.Operation.Summary
+	}
+	return title
+}
+
+// operationLegendOverrides renames the series of panels legended
+// "{{method}} {{path}}" after the operationId of their operation
+func (c *Config) operationLegendOverrides(ops []OperationInfo) []FieldOverride {
+	if c.PanelTitles == panelTitlesPath {
+		return nil
+	}
+	var overrides []FieldOverride
+	seen := make(map[string]bool)
+	for _, op := range ops {
+		endpoint := strings.ToUpper(op.Method) + " " + op.Path
+		if op.Operation == nil || op.Operation.OperationID == "" || seen[endpoint] {
+			continue
+		}
+		seen[endpoint] = true
+		overrides = append(overrides, FieldOverride{
+			Matcher:    FieldMatcher{ID: "byName", Options: endpoint},
+			Properties: []FieldProperty{{ID: "displayName", Value: op.Operation.OperationID}},
+		})
+	}
+	return overrides
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Parts of classic histogram queries that native histograms do without:
+// the _bucket series, also in recorded series names, and the le grouping
+var (
+	bucketSeriesPattern = regexp.MustCompile(`_bucket([{\[:])`)
+	leGroupingPattern   = regexp.MustCompile(`(\s*)by\s*\(([^)]*)\)`)
+)
+
+// nativeHistogramExpr rewrites a classic histogram query for Prometheus
+// native histograms: histogram_quantile(0.99, sum(rate(x_bucket[5m])) by
+// (le)) becomes histogram_quantile(0.99, sum(rate(x[5m]))). Queries without
+// buckets are returned unchanged.
+func nativeHistogramExpr(expr string) string {
+	if !bucketSeriesPattern.MatchString(expr) {
+		return expr
+	}
+	expr = bucketSeriesPattern.ReplaceAllString(expr, "$1")
+	return leGroupingPattern.ReplaceAllStringFunc(expr, func(clause string) string {
+		match := leGroupingPattern.FindStringSubmatch(clause)
+		var labels []string
+		for _, label := range strings.Split(match[2], ",") {
+			if label = strings.TrimSpace(label); label != "" && label != "le" {
+				labels = append(labels, label)
+			}
+		}
+		if len(labels) == 0 {
+			return ""
+		}
+		return match[1] + "by (" + strings.Join(labels, ", ") + ")"
+	})
+}
+
+// applyNativeHistograms rewrites the histogram queries of every panel and
+// alert for native histograms
+func applyNativeHistograms(dashboard *GrafanaDashboard) {
+	applyToPanels(dashboard.Panels, func(panel *Panel) {
+		for i := range panel.Targets {
+			panel.Targets[i].Expr = nativeHistogramExpr(panel.Targets[i].Expr)
+		}
+		if panel.Alert == nil {
+			return
+		}
+		for i := range panel.Alert.Conditions {
+			model := &panel.Alert.Conditions[i].Query.Model
+			model.Expr = nativeHistogramExpr(model.Expr)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NotificationsConfig routes the alerts of operations to Grafana contact
+// points by name. An operation entry (operationId or "METHOD path") replaces
+// the entry of the operation's tag, which replaces the default.
+type NotificationsConfig struct {
+	Default    []string            `yaml:"default"`
+	Tags       map[string][]string `yaml:"tags"`
+	Operations map[string][]string `yaml:"operations"`
+}
+
+// validate checks that no contact point name is empty
+func (n NotificationsConfig) validate() error {
+	check := func(field string, names []string) error {
+		for _, name := range names {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("%s: empty contact point name", field)
+			}
+		}
+		return nil
+	}
+	if err := check("default", n.Default); err != nil {
+		return err
+	}
+	for tag, names := range n.Tags {
+		if err := check("tags."+tag, names); err != nil {
+			return err
+		}
+	}
+	for key, names := range n.Operations {
+		if err := check("operations."+key, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contactPoints returns the contact points the alerts of an operation notify
+func (n NotificationsConfig) contactPoints(op OperationInfo) []string {
+	for _, key := range []string{op.Key(), strings.ToUpper(op.Method) + " " + op.Path} {
+		if names, ok := n.Operations[key]; ok {
+			return names
+		}
+	}
+	if names, ok := n.Tags[op.Tag]; ok && op.Tag != "" {
+		return names
+	}
+	return n.Default
+}
+
+// alertContactPoints lists the contact points referenced by the alerts of
+// the dashboards, sorted
+func alertContactPoints(dashboards []GrafanaDashboard) []string {
+	seen := make(map[string]bool)
+	for _, dashboard := range dashboards {
+		for _, panel := range dashboard.Panels {
+			if panel.Alert == nil {
+				continue
+			}
+			for _, name := range panel.Alert.contactPoints {
+				seen[name] = true
+			}
+		}
+	}
+	return sortedMapKeys(seen)
+}
+
+type contactPoint struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+}
+
+// lookupContactPoint returns the UID of a contact point, or of the legacy
+// notification channel of that name on Grafana versions without the
+// alerting provisioning API
+func (c *GrafanaClient) lookupContactPoint(ctx context.Context, name string) (string, error) {
+	var points []contactPoint
+	err := c.do(ctx, http.MethodGet, "/api/v1/provisioning/contact-points?name="+url.QueryEscape(name), nil, &points)
+	var pushErr *PushError
+	if errors.As(err, &pushErr) && pushErr.StatusCode == http.StatusNotFound {
+		err = c.do(ctx, http.MethodGet, "/api/alert-notifications/lookup", nil, &points)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error looking up contact point %s: %w", name, err)
+	}
+	for _, point := range points {
+		if point.Name == name {
+			return point.UID, nil
+		}
+	}
+	return "", fmt.Errorf("contact point %s does not exist in Grafana", name)
+}
+
+// resolveAlertNotifications points the alerts of the dashboards at the
+// UIDs of their contact points, looking each name up once
+func resolveAlertNotifications(ctx context.Context, client *GrafanaClient, dashboards []GrafanaDashboard) error {
+	names := alertContactPoints(dashboards)
+	uids := make(map[string]string, len(names))
+	for _, name := range names {
+		uid, err := client.lookupContactPoint(ctx, name)
+		if err != nil {
+			return err
+		}
+		uids[name] = uid
+	}
+	for _, dashboard := range dashboards {
+		for _, panel := range dashboard.Panels {
+			if panel.Alert == nil {
+				continue
+			}
+			notifications := []AlertNotification{}
+			for _, name := range panel.Alert.contactPoints {
+				notifications = append(notifications, AlertNotification{UID: uids[name]})
+			}
+			panel.Alert.Notifications = notifications
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Summarization modes of a dashboard over the --max-panels budget
+const (
+	summarizeByTag  = "tag"
+	summarizeRepeat = "repeat"
+)
+
+// untaggedGroup names the group of the operations without tags
+const untaggedGroup = "untagged"
+
+// fitPanelBudget regenerates a dashboard with more panels than --max-panels
+// allows: first with a panel set per tag instead of per operation, then as
+// the repeat variant if the tags still need too many panels. The operations
+// whose panels were collapsed are recorded on the dashboard.
+func fitPanelBudget(ctx context.Context, dashboard GrafanaDashboard, input *GenerationInput, config *Config, specHash string) GrafanaDashboard {
+	panels, _, _ := countDashboard(dashboard.Panels)
+	if config.MaxPanels == 0 || panels <= config.MaxPanels || config.Variant != variantOperational {
+		return dashboard
+	}
+
+	ops, shared := config.selectedOperations(input.Specs, config.SortOrder)
+	var collapsed []string
+	for _, op := range append(ops, shared...) {
+		if streamProtocol(op.Operation) == "" {
+			collapsed = append(collapsed, strings.ToUpper(op.Method)+" "+op.Path)
+		}
+	}
+
+	summarized := buildDashboard(ctx, input, config, specHash, summarizeByTag)
+	mode := summarizeByTag
+	if count, _, _ := countDashboard(summarized.Panels); count > config.MaxPanels {
+		repeat := *config
+		repeat.Variant = variantRepeat
+		summarized = buildDashboard(ctx, input, &repeat, specHash, "")
+		mode = summarizeRepeat
+	}
+	count, _, _ := countDashboard(summarized.Panels)
+	slog.Warn("dashboard exceeds --max-panels, summarizing endpoints",
+		"panels", panels, "max_panels", config.MaxPanels, "summarized_by", mode, "summarized_panels", count, "collapsed_endpoints", len(collapsed))
+	for _, key := range collapsed {
+		slog.Debug("collapsed endpoint", "operation", key, "summarized_by", mode)
+	}
+	if count > config.MaxPanels {
+		slog.Warn("summarized dashboard still exceeds --max-panels", "panels", count, "max_panels", config.MaxPanels)
+	}
+	summarized.summarized = mode
+	summarized.collapsed = collapsed
+	return summarized
+}
+
+// addTagPanels appends a panel set per tag aggregating the operations of the
+// tag, in the order of their first operation, with a series per method.
+// Streaming operations keep their own panels.
+func addTagPanels(ctx context.Context, dashboard *GrafanaDashboard, ops []OperationInfo, input *GenerationInput, config *Config, cursor *panelCursor) {
+	var tags []string
+	byTag := make(map[string][]OperationInfo)
+	var streaming []OperationInfo
+	for _, op := range ops {
+		if streamProtocol(op.Operation) != "" {
+			streaming = append(streaming, op)
+			continue
+		}
+		tag := op.Tag
+		if tag == "" {
+			tag = untaggedGroup
+		}
+		if _, ok := byTag[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		byTag[tag] = append(byTag[tag], op)
+	}
+
+	for _, tag := range tags {
+		tagged := byTag[tag]
+		var endpoints, paths []string
+		seen := make(map[string]bool)
+		for _, op := range tagged {
+			endpoints = append(endpoints, strings.ToUpper(op.Method)+" "+op.Path)
+			if !seen[op.Path] {
+				seen[op.Path] = true
+				paths = append(paths, regexp.QuoteMeta(op.Path))
+			}
+		}
+
+		thresholds := config.baseThresholds()
+		if override, ok := config.fileConfig().Thresholds.Tags[tag]; ok {
+			thresholds = override.apply(thresholds)
+		}
+		title := fmt.Sprintf("Tag %s (%d endpoints)", tag, len(tagged))
+		match := operationMatch{PathPattern: strings.Join(paths, "|"), Scope: config.queryScope()}
+		panels := createHTTPPanels(title, match, thresholds, cursor.ID, cursor.Height, cursor.Y)
+		for i := range panels {
+			panels[i].Description = fmt.Sprintf("%s. Summarized to stay within --max-panels, aggregating: %s", panels[i].Description, strings.Join(endpoints, ", "))
+		}
+		dashboard.Panels = append(dashboard.Panels, panels...)
+		cursor.ID += len(panels)
+		cursor.Y += len(panels) * cursor.Height
+		if tag != untaggedGroup {
+			addMixins(ctx, dashboard, config, mixinAfterTagPrefix+tag, cursor)
+		}
+	}
+
+	if len(streaming) > 0 {
+		addOperationPanels(ctx, dashboard, streaming, input, config, cursor)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// parallelThreshold is the number of items below which building them one
+// after the other is faster than starting workers
+const parallelThreshold = 64
+
+// buildConcurrently applies build to every item on a pool of GOMAXPROCS
+// workers and returns the results in the order of the items. build must
+// not modify shared state.
+func buildConcurrently[T, R any](items []T, build func(T) R) []R {
+	results := make([]R, len(items))
+	workers := min(runtime.GOMAXPROCS(0), len(items))
+	if len(items) < parallelThreshold || workers < 2 {
+		for i, item := range items {
+			results[i] = build(item)
+		}
+		return results
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = build(items[i])
+			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
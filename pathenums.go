@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// --path-enums modes for path parameters with an enum: expand generates a
+// panel set per value, variable adds a dashboard variable of the values
+const (
+	pathEnumsExpand   = "expand"
+	pathEnumsVariable = "variable"
+)
+
+// maxEnumExpansions bounds the panel sets one operation expands into; larger
+// products of enum values keep a single panel set
+const maxEnumExpansions = 20
+
+// pathEnum is a path parameter with an enum and its values
+type pathEnum struct {
+	Name   string
+	Values []string
+}
+
+// pathEnums returns the path parameters of an operation with an enum, in
+// the order they appear in the path. Operation parameters override those of
+// the path item.
+func pathEnums(op OperationInfo) []pathEnum {
+	params := make(map[string]*openapi3.Parameter)
+	var operationParams openapi3.Parameters
+	if op.Operation != nil {
+		operationParams = op.Operation.Parameters
+	}
+	for _, list := range []openapi3.Parameters{op.PathParameters, operationParams} {
+		for _, ref := range list {
+			if ref != nil && ref.Value != nil && ref.Value.In == openapi3.ParameterInPath {
+				params[ref.Value.Name] = ref.Value
+			}
+		}
+	}
+
+	var enums []pathEnum
+	rest := op.Path
+	for {
+		start := strings.Index(rest, "{")
+		end := strings.Index(rest, "}")
+		if start < 0 || end < start {
+			return enums
+		}
+		name := rest[start+1 : end]
+		rest = rest[end+1:]
+		param := params[name]
+		if param == nil || param.Schema == nil || param.Schema.Value == nil || len(param.Schema.Value.Enum) == 0 {
+			continue
+		}
+		enum := pathEnum{Name: name}
+		for _, value := range param.Schema.Value.Enum {
+			enum.Values = appendUnique(enum.Values, fmt.Sprint(value))
+		}
+		enums = append(enums, enum)
+	}
+}
+
+// expandPathEnums replaces the operations with enum path parameters by one
+// operation per combination of values, on the concrete path. Like methods
+// collapsed by --aggregate-by path, expanded operations lose their
+// operationId, their key becoming "METHOD path". Streaming operations are
+// kept as they are.
+func expandPathEnums(ops []OperationInfo) []OperationInfo {
+	var expanded []OperationInfo
+	for _, op := range ops {
+		enums := pathEnums(op)
+		if len(enums) == 0 || streamProtocol(op.Operation) != "" {
+			expanded = append(expanded, op)
+			continue
+		}
+		combinations := 1
+		for _, enum := range enums {
+			combinations *= len(enum.Values)
+		}
+		if combinations > maxEnumExpansions {
+			slog.Warn("not expanding path enums, too many combinations", "operation", op.Key(), "combinations", combinations, "max", maxEnumExpansions)
+			expanded = append(expanded, op)
+			continue
+		}
+
+		paths := []string{op.Path}
+		for _, enum := range enums {
+			var next []string
+			for _, path := range paths {
+				for _, value := range enum.Values {
+					next = append(next, strings.Replace(path, "{"+enum.Name+"}", value, 1))
+				}
+			}
+			paths = next
+		}
+		operation := *op.Operation
+		operation.OperationID = ""
+		for _, path := range paths {
+			concrete := op
+			concrete.Path = path
+			concrete.Operation = &operation
+			expanded = append(expanded, concrete)
+		}
+	}
+	return expanded
+}
+
+// pathEnumVariables returns a custom variable per enum path parameter of
+// the operations, with the values of every operation using the name
+func pathEnumVariables(ops []OperationInfo, defined map[string]bool) []Variable {
+	var names []string
+	values := make(map[string][]string)
+	for _, op := range ops {
+		if streamProtocol(op.Operation) != "" {
+			continue
+		}
+		for _, enum := range pathEnums(op) {
+			if _, ok := values[enum.Name]; !ok {
+				names = append(names, enum.Name)
+			}
+			for _, value := range enum.Values {
+				values[enum.Name] = appendUnique(values[enum.Name], value)
+			}
+		}
+	}
+
+	var variables []Variable
+	for _, name := range names {
+		if defined[name] {
+			slog.Warn("path parameter shadowed by a variable, not adding its enum variable", "parameter", name)
+			continue
+		}
+		options := []Option{{Text: "All", Value: "$__all", Selected: true}}
+		for _, value := range values[name] {
+			options = append(options, Option{Text: value, Value: value})
+		}
+		variables = append(variables, Variable{
+			Name:        name,
+			Label:       name,
+			Type:        "custom",
+			Query:       strings.Join(mapSlice(values[name], customVariableValue), ","),
+			Current:     Current{Text: "All", Value: "$__all"},
+			Options:     options,
+			IncludeAll:  true,
+			Multi:       true,
+			Description: fmt.Sprintf("Values of the {%s} path parameter", name),
+		})
+	}
+	return variables
+}
+
+// definedVariables names the variables of the dashboard other than those of
+// path enums, which cannot take their names
+func (c *Config) definedVariables() map[string]bool {
+	defined := map[string]bool{"datasource": true, endpointVariable: true}
+	for _, variable := range c.queryVariables() {
+		defined[variable.Name] = true
+	}
+	if c.LoadTestPanels {
+		defined[testIDVariable] = true
+	}
+	return defined
+}
+
+// applyPathEnumVariables makes the panels of an operation with enum path
+// parameters match its concrete paths by regex, each enum segment filtered
+// by its variable. Alert queries cannot use variables and match every value,
+// like panels for parameters whose name another variable already has.
+func applyPathEnumVariables(panels []Panel, op OperationInfo, defined map[string]bool) {
+	enums := pathEnums(op)
+	if len(enums) == 0 {
+		return
+	}
+	var panelPattern, alertPattern strings.Builder
+	rest := op.Path
+	for _, enum := range enums {
+		placeholder := "{" + enum.Name + "}"
+		i := strings.Index(rest, placeholder)
+		literal := promRegexValue(rest[:i])
+		values := "(" + strings.Join(mapSlice(enum.Values, promRegexValue), "|") + ")"
+		if defined[enum.Name] {
+			panelPattern.WriteString(literal + values)
+		} else {
+			panelPattern.WriteString(literal + "($" + enum.Name + ")")
+		}
+		alertPattern.WriteString(literal + values)
+		rest = rest[i+len(placeholder):]
+	}
+	panelPattern.WriteString(promRegexValue(rest))
+	alertPattern.WriteString(promRegexValue(rest))
+
+	matcher := fmt.Sprintf(`path="%s"`, promLabelValue(op.Path))
+	panelMatcher := fmt.Sprintf(`path=~"%s"`, panelPattern.String())
+	alertMatcher := fmt.Sprintf(`path=~"%s"`, alertPattern.String())
+	applyToPanels(panels, func(panel *Panel) {
+		for i := range panel.Targets {
+			panel.Targets[i].Expr = strings.ReplaceAll(panel.Targets[i].Expr, matcher, panelMatcher)
+		}
+		if panel.Alert != nil {
+			for i := range panel.Alert.Conditions {
+				model := &panel.Alert.Conditions[i].Query.Model
+				model.Expr = strings.ReplaceAll(model.Expr, matcher, alertMatcher)
+			}
+		}
+	})
+}
+
+// mapSlice applies fn to every value
+func mapSlice(values []string, fn func(string) string) []string {
+	mapped := make([]string, len(values))
+	for i, value := range values {
+		mapped[i] = fn(value)
+	}
+	return mapped
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Grafana dashboard permission levels
+var permissionLevels = map[string]int{
+	"view":  1,
+	"edit":  2,
+	"admin": 4,
+}
+
+// permissionRoles are the organization roles dashboard permissions can be
+// granted to; admins always have full access
+var permissionRoles = map[string]bool{"Viewer": true, "Editor": true}
+
+// PermissionsConfig maps teams, users and organization roles to the
+// permission level (view, edit or admin) they get on pushed dashboards.
+// Applying it replaces the dashboard's permissions, so everyone not listed
+// loses access inherited from the default role permissions.
+type PermissionsConfig struct {
+	Teams map[string]string `yaml:"teams"`
+	// Users are keyed by login or email
+	Users map[string]string `yaml:"users"`
+	// Roles are keyed by Viewer or Editor
+	Roles map[string]string `yaml:"roles"`
+}
+
+// empty reports whether no permissions are configured, leaving pushed
+// dashboards with the permissions of their folder
+func (p PermissionsConfig) empty() bool {
+	return len(p.Teams) == 0 && len(p.Users) == 0 && len(p.Roles) == 0
+}
+
+// validate checks the permission levels and roles
+func (p PermissionsConfig) validate() error {
+	for _, group := range []struct {
+		name    string
+		entries map[string]string
+	}{{"teams", p.Teams}, {"users", p.Users}, {"roles", p.Roles}} {
+		for key, level := range group.entries {
+			if _, ok := permissionLevels[level]; !ok {
+				return fmt.Errorf("%s.%s: invalid permission %q, must be view, edit or admin", group.name, key, level)
+			}
+		}
+	}
+	for role := range p.Roles {
+		if !permissionRoles[role] {
+			return fmt.Errorf("roles.%s: must be Viewer or Editor", role)
+		}
+	}
+	return nil
+}
+
+// describe lists the configured grants for the dry-run plan
+func (p PermissionsConfig) describe() []string {
+	var grants []string
+	for _, group := range []struct {
+		kind    string
+		entries map[string]string
+	}{{"role", p.Roles}, {"team", p.Teams}, {"user", p.Users}} {
+		for _, key := range sortedMapKeys(group.entries) {
+			grants = append(grants, fmt.Sprintf("%s %s: %s", group.kind, key, group.entries[key]))
+		}
+	}
+	return grants
+}
+
+// DashboardPermission is one entry of the dashboard permissions API
+type DashboardPermission struct {
+	Role       string `json:"role,omitempty"`
+	TeamID     int    `json:"teamId,omitempty"`
+	UserID     int    `json:"userId,omitempty"`
+	Permission int    `json:"permission"`
+}
+
+type teamSearchResponse struct {
+	Teams []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"teams"`
+}
+
+// resolvePermissions looks up the team and user IDs of the configured
+// permissions, failing when one does not exist
+func (c *GrafanaClient) resolvePermissions(ctx context.Context, permissions PermissionsConfig) ([]DashboardPermission, error) {
+	var items []DashboardPermission
+	for _, role := range sortedMapKeys(permissions.Roles) {
+		items = append(items, DashboardPermission{Role: role, Permission: permissionLevels[permissions.Roles[role]]})
+	}
+	for _, team := range sortedMapKeys(permissions.Teams) {
+		var result teamSearchResponse
+		if err := c.do(ctx, http.MethodGet, "/api/teams/search?name="+url.QueryEscape(team), nil, &result); err != nil {
+			return nil, fmt.Errorf("error looking up team %s: %w", team, err)
+		}
+		id := 0
+		for _, t := range result.Teams {
+			if t.Name == team {
+				id = t.ID
+			}
+		}
+		if id == 0 {
+			return nil, fmt.Errorf("team %s does not exist in Grafana", team)
+		}
+		items = append(items, DashboardPermission{TeamID: id, Permission: permissionLevels[permissions.Teams[team]]})
+	}
+	for _, user := range sortedMapKeys(permissions.Users) {
+		var result struct {
+			ID int `json:"id"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/api/users/lookup?loginOrEmail="+url.QueryEscape(user), nil, &result); err != nil {
+			return nil, fmt.Errorf("error looking up user %s: %w", user, err)
+		}
+		items = append(items, DashboardPermission{UserID: result.ID, Permission: permissionLevels[permissions.Users[user]]})
+	}
+	return items, nil
+}
+
+// SetDashboardPermissions replaces the permissions of a dashboard
+func (c *GrafanaClient) SetDashboardPermissions(ctx context.Context, uid string, items []DashboardPermission) error {
+	body, err := json.Marshal(struct {
+		Items []DashboardPermission `json:"items"`
+	}{items})
+	if err != nil {
+		return fmt.Errorf("error marshaling permissions: %w", err)
+	}
+	return c.do(ctx, http.MethodPost, "/api/dashboards/uid/"+url.PathEscape(uid)+"/permissions", body, nil)
+}
+
+// applyPermissions sets the configured permissions on every pushed
+// dashboard, resolving teams and users once
+func applyPermissions(ctx context.Context, client *GrafanaClient, permissions PermissionsConfig, uids []string) error {
+	if permissions.empty() {
+		return nil
+	}
+	items, err := client.resolvePermissions(ctx, permissions)
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		if err := client.SetDashboardPermissions(ctx, uid, items); err != nil {
+			return fmt.Errorf("error setting permissions of dashboard %s: %w", uid, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxDashboardPanels is the panel count above which Grafana dashboards get
+// slow to load and render
+const maxDashboardPanels = 100
+
+// selectorPattern finds metric selectors and their label matchers
+var selectorPattern = regexp.MustCompile(`([a-zA-Z_:][a-zA-Z0-9_:]*)\{` + promMatchers + `\}`)
+
+// groupingPattern finds the labels of by (...) clauses
+var groupingPattern = regexp.MustCompile(`by\s*\(([^)]*)\)`)
+
+// highCardinalityLabels are labels with one value per route or pod;
+// aggregating by them without a matcher returns many series
+var highCardinalityLabels = []string{"path", "instance", "pod", "route", "endpoint"}
+
+// printPlan describes what a generation run would write and push, for --dry-run
+func printPlan(input *GenerationInput, config *Config, dashboards []GrafanaDashboard, libraryPanels []LibraryElement) {
+	allOps, allShared := collectMergedOperations(input.Specs, config.SortOrder)
+	ops, shared := config.selectedOperations(input.Specs, config.SortOrder)
+	streaming := 0
+	for _, op := range append(append([]OperationInfo{}, ops...), shared...) {
+		if streamProtocol(op.Operation) != "" {
+			streaming++
+		}
+	}
+	channels := 0
+	for _, spec := range input.Specs {
+		if spec.Async != nil {
+			channels += len(spec.Async.Channels)
+		}
+	}
+
+	fmt.Println("Dry run, nothing is written or pushed")
+	fmt.Printf("Specs: %d\n", len(input.Specs))
+	fmt.Printf("Operations: %d HTTP (%d shared, %d streaming, %d filtered out), %d gRPC methods, %d AsyncAPI channels\n",
+		len(ops)+len(shared), len(shared), streaming, len(allOps)+len(allShared)-len(ops)-len(shared), len(input.GRPCMethods), channels)
+
+	var warnings []string
+	totalPanels, totalQueries, totalAlerts := 0, 0, 0
+	fmt.Printf("Dashboards: %d\n", len(dashboards))
+	for _, dashboard := range dashboards {
+		panels, queries, alerts := countDashboard(dashboard.Panels)
+		totalPanels += panels
+		totalQueries += queries
+		totalAlerts += alerts
+		fmt.Printf("  - %s %q: %d panels, %d queries, %d alerts\n", dashboard.UID, dashboard.Title, panels, queries, alerts)
+		if dashboard.summarized != "" {
+			fmt.Printf("    summarized by %s to fit --max-panels, %d endpoints collapsed\n", dashboard.summarized, len(dashboard.collapsed))
+		}
+
+		if panels > maxDashboardPanels {
+			warnings = append(warnings, fmt.Sprintf("%s has %d panels, more than %d load slowly; consider --split-dir or --max-panels", dashboard.UID, panels, maxDashboardPanels))
+		}
+		warnings = append(warnings, cardinalityWarnings(dashboard)...)
+	}
+	fmt.Printf("Total: %d panels, %d queries, %d alerts", totalPanels, totalQueries, totalAlerts)
+	if config.LibraryPanels {
+		fmt.Printf(", %d library panels", len(libraryPanels))
+	}
+	fmt.Println()
+
+	fmt.Println("Would write:")
+	for _, file := range plannedFiles(config, dashboards) {
+		fmt.Printf("  - %s\n", file)
+	}
+	if config.Push {
+		fmt.Printf("Would push %d dashboards", len(dashboards))
+		if config.LibraryPanels {
+			fmt.Printf(" and %d library panels", len(libraryPanels))
+		}
+		fmt.Print(" to")
+		for i, target := range config.pushTargets() {
+			if i > 0 {
+				fmt.Print(",")
+			}
+			if target.Name != "" {
+				fmt.Printf(" %s", target.Name)
+			}
+			fmt.Printf(" %s", target.URL)
+			if target.FolderUID != "" {
+				fmt.Printf(" (folder %s)", target.FolderUID)
+			}
+		}
+		fmt.Println()
+		if permissions := config.fileConfig().Permissions; !permissions.empty() {
+			fmt.Printf("Would set permissions: %s\n", strings.Join(permissions.describe(), ", "))
+		}
+		if contactPoints := alertContactPoints(dashboards); len(contactPoints) > 0 {
+			fmt.Printf("Would route alerts to contact points: %s\n", strings.Join(contactPoints, ", "))
+		}
+		if windows := config.fileConfig().Maintenance; len(windows) > 0 && hasAlerts(dashboards) {
+			names := make([]string, len(windows))
+			for i, window := range windows {
+				names[i] = window.Name
+			}
+			fmt.Printf("Would mute alerts during maintenance windows: %s\n", strings.Join(names, ", "))
+		}
+		if config.Snapshot {
+			fmt.Printf("Would create %d snapshots", len(dashboards))
+			if config.SnapshotExternal {
+				fmt.Print(" on the external snapshot server")
+			}
+			fmt.Println()
+		}
+		if config.Public {
+			fmt.Printf("Would share %d dashboards publicly\n", len(dashboards))
+		}
+	}
+
+	if len(warnings) > 0 {
+		fmt.Printf("Warnings (%d):\n", len(warnings))
+		for _, warning := range warnings {
+			fmt.Printf("  - %s\n", warning)
+		}
+	}
+}
+
+// countDashboard counts panels (without rows), queries and legacy alerts
+func countDashboard(panels []Panel) (count, queries, alerts int) {
+	for _, panel := range panels {
+		if panel.Type == "row" {
+			c, q, a := countDashboard(panel.Panels)
+			count, queries, alerts = count+c, queries+q, alerts+a
+			continue
+		}
+		count++
+		queries += len(panel.Targets)
+		if panel.Alert != nil {
+			alerts++
+		}
+	}
+	return count, queries, alerts
+}
+
+// plannedFiles lists the files a generation run writes
+func plannedFiles(config *Config, dashboards []GrafanaDashboard) []string {
+	var files []string
+	if config.SplitDir != "" {
+		for _, dashboard := range dashboards {
+			files = append(files, filepath.Join(config.SplitDir, dashboard.UID+outputExtension(config.OutputEncoding)))
+		}
+	} else {
+		files = append(files, config.OutputFile)
+	}
+	if config.LibraryPanels {
+		files = append(files, libraryPanelsFile(config))
+	}
+	if config.RulesOutput != "" {
+		files = append(files, config.RulesOutput)
+	}
+	if config.ScrapeConfigOutput != "" {
+		files = append(files, config.ScrapeConfigOutput)
+	}
+	if config.ProbeConfigOutput != "" {
+		files = append(files, config.ProbeConfigOutput)
+	}
+	if config.ChangelogOutput != "" {
+		files = append(files, config.ChangelogOutput)
+	}
+	if config.Instrumentation != "" {
+		files = append(files, instrumentationFile(config))
+	}
+	return files
+}
+
+// cardinalityWarnings flags queries likely to return or touch many series:
+// selectors without label matchers, and aggregations by high-cardinality
+// labels the selector does not constrain. Identical warnings are reported once.
+func cardinalityWarnings(dashboard GrafanaDashboard) []string {
+	seen := make(map[string]bool)
+	var warnings []string
+	for _, panel := range dashboard.Panels {
+		for _, target := range panel.Targets {
+			for _, warning := range queryCardinalityWarnings(target.Expr) {
+				warning = fmt.Sprintf("%s: %s", panel.Title, warning)
+				if !seen[warning] {
+					seen[warning] = true
+					warnings = append(warnings, warning)
+				}
+			}
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+func queryCardinalityWarnings(expr string) []string {
+	var warnings []string
+	matched := make(map[string]bool)
+	for _, selector := range selectorPattern.FindAllStringSubmatch(expr, -1) {
+		if strings.TrimSpace(selector[2]) == "" {
+			warnings = append(warnings, fmt.Sprintf("%s is queried without label matchers", selector[1]))
+		}
+		for _, matcher := range strings.Split(selector[2], ",") {
+			if name, _, ok := strings.Cut(matcher, "="); ok {
+				matched[strings.Trim(strings.TrimSpace(name), "!~")] = true
+			}
+		}
+	}
+	for _, grouping := range groupingPattern.FindAllStringSubmatch(expr, -1) {
+		for _, label := range strings.Split(grouping[1], ",") {
+			label = strings.TrimSpace(label)
+			for _, high := range highCardinalityLabels {
+				if label == high && !matched[label] {
+					warnings = append(warnings, fmt.Sprintf("aggregates by %s without a %s matcher, one series per value", label, label))
+				}
+			}
+		}
+	}
+	return warnings
+}
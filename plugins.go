@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// pluginPrefix names plugin executables: the plugin "cost" is the
+// openapi2grafana-plugin-cost executable on the PATH
+const pluginPrefix = "openapi2grafana-plugin-"
+
+// pluginTimeout bounds every call to a plugin
+const pluginTimeout = 30 * time.Second
+
+// Methods of the plugin protocol: the executable is run with the method as
+// its only argument, reads a JSON request on stdin and writes its response
+// on stdout. Anything it writes to stderr is passed through; a non-zero exit
+// status fails the call.
+const (
+	pluginMethodDescribe     = "describe"
+	pluginMethodPanel        = "panel"
+	pluginMethodBrokerPreset = "broker-preset"
+	pluginMethodOutput       = "output"
+)
+
+// Plugin is an external executable contributing panel factories, broker
+// presets and output encodings
+type Plugin struct {
+	Name string
+	Path string
+	PluginDescription
+}
+
+// PluginDescription is the response of a plugin to describe: what it
+// contributes
+type PluginDescription struct {
+	// PanelFactories can be referenced by x-grafana-rows panels and mixins
+	PanelFactories []string `json:"panelFactories"`
+	// BrokerPresets can be selected with --broker-preset
+	BrokerPresets []string `json:"brokerPresets"`
+	// OutputEncodings can be selected with --output-encoding
+	OutputEncodings []PluginEncoding `json:"outputEncodings"`
+}
+
+// PluginEncoding is an output encoding of a plugin and the extension of the
+// files it writes
+type PluginEncoding struct {
+	Name      string `json:"name"`
+	Extension string `json:"extension"`
+}
+
+// Contributions of the loaded plugins, registered when the config file is
+// loaded, before any generation
+var (
+	pluginPanelFactories  = map[string]*Plugin{}
+	pluginBrokerPresets   = map[string]*Plugin{}
+	pluginOutputEncodings = map[string]*Plugin{}
+	pluginExtensions      = map[string]string{}
+)
+
+// pluginPanelRequest asks a plugin to build a panel of a factory
+type pluginPanelRequest struct {
+	Factory string         `json:"factory"`
+	Panel   CustomRowPanel `json:"panel"`
+	ID      int            `json:"id"`
+	Height  int            `json:"height"`
+	Y       int            `json:"y"`
+}
+
+// pluginBrokerPresetRequest asks a plugin for the queries of a broker preset
+// for every channel address, filtered on the scope matchers like the
+// generated queries, see Config.queryScope
+type pluginBrokerPresetRequest struct {
+	Preset    string   `json:"preset"`
+	Addresses []string `json:"addresses"`
+	Scope     []string `json:"scope"`
+}
+
+// pluginBrokerQueries are the queries of a broker preset for one channel
+type pluginBrokerQueries struct {
+	PublishRate       string `json:"publishRate"`
+	ConsumerLag       string `json:"consumerLag"`
+	ProcessingLatency string `json:"processingLatency"`
+}
+
+// pluginOutputRequest asks a plugin to encode a document, a dashboard or
+// library panels as generated in JSON
+type pluginOutputRequest struct {
+	Encoding string          `json:"encoding"`
+	Document json.RawMessage `json:"document"`
+}
+
+// loadPlugins finds the plugins of the config file, by name on the PATH or
+// by path relative to the config file, and registers what they contribute
+func loadPlugins(ctx context.Context, names []string, configFile string) error {
+	for i, name := range names {
+		path, err := findPlugin(name, configFile)
+		if err != nil {
+			return fmt.Errorf("plugins[%d]: %w", i, err)
+		}
+		plugin := &Plugin{Name: strings.TrimPrefix(filepath.Base(path), pluginPrefix), Path: path}
+		if err := plugin.call(ctx, pluginMethodDescribe, struct{}{}, &plugin.PluginDescription); err != nil {
+			return fmt.Errorf("plugins[%d]: %w", i, err)
+		}
+		if err := registerPlugin(plugin); err != nil {
+			return fmt.Errorf("plugins[%d]: %s: %w", i, name, err)
+		}
+		slog.Debug("loaded plugin", "plugin", plugin.Name, "path", path)
+	}
+	return nil
+}
+
+// findPlugin resolves a plugin name to the executable
+// openapi2grafana-plugin-<name> on the PATH; names with a slash are paths
+func findPlugin(name, configFile string) (string, error) {
+	if !strings.Contains(name, "/") {
+		path, err := exec.LookPath(pluginPrefix + name)
+		if err != nil {
+			return "", fmt.Errorf("plugin %q not found: %w", name, err)
+		}
+		return path, nil
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(configFile), name)
+	}
+	if _, err := os.Stat(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// registerPlugin adds the contributions of a plugin, which cannot replace
+// built-in ones or another plugin's
+func registerPlugin(plugin *Plugin) error {
+	for _, factory := range plugin.PanelFactories {
+		if _, ok := panelFactories[factory]; ok || pluginPanelFactories[factory] != nil {
+			return fmt.Errorf("panel factory %q already exists", factory)
+		}
+		pluginPanelFactories[factory] = plugin
+	}
+	for _, preset := range plugin.BrokerPresets {
+		if _, ok := brokerPresets[preset]; ok || pluginBrokerPresets[preset] != nil {
+			return fmt.Errorf("broker preset %q already exists", preset)
+		}
+		pluginBrokerPresets[preset] = plugin
+	}
+	for _, encoding := range plugin.OutputEncodings {
+		builtin := encoding.Name == outputEncodingJSON || encoding.Name == outputEncodingYAML || encoding.Name == outputEncodingOperator
+		if encoding.Name == "" || builtin || pluginOutputEncodings[encoding.Name] != nil {
+			return fmt.Errorf("output encoding %q already exists", encoding.Name)
+		}
+		pluginOutputEncodings[encoding.Name] = plugin
+		pluginExtensions[encoding.Name] = encoding.Extension
+	}
+	return nil
+}
+
+// call runs a method of the plugin, decoding its JSON response into
+// response
+func (p *Plugin) call(ctx context.Context, method string, request, response interface{}) error {
+	data, err := p.run(ctx, method, request)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("plugin %s: invalid %s response: %w", p.Name, method, err)
+	}
+	return nil
+}
+
+// run runs a method of the plugin and returns its raw response. The plugin
+// is killed once ctx is done, on an interrupt or --timeout, or after
+// pluginTimeout.
+func (p *Plugin) run(ctx context.Context, method string, request interface{}) ([]byte, error) {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, pluginTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Path, method)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	// Children of a killed plugin script may hold its output open
+	cmd.WaitDelay = time.Second
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %s failed: %w", p.Name, method, err)
+	}
+	return output, nil
+}
+
+// pluginPanel asks a plugin for the panel of one of its factories, as raw
+// Grafana panel JSON
+func pluginPanel(ctx context.Context, plugin *Plugin, ref CustomRowPanel, panelID, height, yPos int) (json.RawMessage, error) {
+	var panel json.RawMessage
+	request := pluginPanelRequest{Factory: ref.Factory, Panel: ref, ID: panelID, Height: height, Y: yPos}
+	if err := plugin.call(ctx, pluginMethodPanel, request, &panel); err != nil {
+		return nil, err
+	}
+	return panel, nil
+}
+
+// pluginBrokerPreset fetches the queries of a plugin broker preset for the
+// channels of an AsyncAPI spec, within scope; the plugin applies it, so the
+// scope the queries are later asked for is not used again
+func pluginBrokerPreset(ctx context.Context, plugin *Plugin, name string, async *AsyncAPIDoc, scope []string) (BrokerPreset, error) {
+	request := pluginBrokerPresetRequest{Preset: name, Scope: scope}
+	for _, channel := range async.Channels {
+		request.Addresses = append(request.Addresses, channel.Address)
+	}
+	queries := make(map[string]pluginBrokerQueries)
+	if err := plugin.call(ctx, pluginMethodBrokerPreset, request, &queries); err != nil {
+		return BrokerPreset{}, err
+	}
+	return BrokerPreset{
+		PublishRate:       func(address string, _ []string) string { return queries[address].PublishRate },
+		ConsumerLag:       func(address string, _ []string) string { return queries[address].ConsumerLag },
+		ProcessingLatency: func(address string, _ []string) string { return queries[address].ProcessingLatency },
+	}, nil
+}
+
+// pluginEncode encodes a document with a plugin output encoding
+func pluginEncode(ctx context.Context, plugin *Plugin, v interface{}, encoding string) ([]byte, error) {
+	document, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return plugin.run(ctx, pluginMethodOutput, pluginOutputRequest{Encoding: encoding, Document: document})
+}
+
+// discoverPlugins lists the plugin executables on the PATH, the first of
+// each name winning like command lookup
+func discoverPlugins() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		matches, _ := filepath.Glob(filepath.Join(dir, pluginPrefix+"*"))
+		sort.Strings(matches)
+		for _, match := range matches {
+			name := filepath.Base(match)
+			if info, err := os.Stat(match); err != nil || info.IsDir() || info.Mode()&0111 == 0 || seen[name] {
+				continue
+			}
+			seen[name] = true
+			paths = append(paths, match)
+		}
+	}
+	return paths
+}
+
+// runPlugins implements the plugins subcommand, listing the plugins on the
+// PATH and what each contributes
+func runPlugins(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: openapi2grafana plugins")
+	}
+	paths := discoverPlugins()
+	if len(paths) == 0 {
+		fmt.Printf("No %s* executables found on the PATH\n", pluginPrefix)
+		return nil
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for _, path := range paths {
+		plugin := &Plugin{Name: strings.TrimPrefix(filepath.Base(path), pluginPrefix), Path: path}
+		fmt.Printf("%s (%s)\n", plugin.Name, path)
+		if err := plugin.call(ctx, pluginMethodDescribe, struct{}{}, &plugin.PluginDescription); err != nil {
+			fmt.Printf("  error: %v\n", err)
+			continue
+		}
+		if len(plugin.PanelFactories) > 0 {
+			fmt.Printf("  panel factories:  %s\n", strings.Join(plugin.PanelFactories, ", "))
+		}
+		if len(plugin.BrokerPresets) > 0 {
+			fmt.Printf("  broker presets:   %s\n", strings.Join(plugin.BrokerPresets, ", "))
+		}
+		for _, encoding := range plugin.OutputEncodings {
+			fmt.Printf("  output encoding:  %s (%s)\n", encoding.Name, encoding.Extension)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withPluginRegistry empties the plugin registry for a test, restoring it
+// when the test ends
+func withPluginRegistry(t *testing.T) {
+	t.Helper()
+	factories, presets, encodings, extensions := pluginPanelFactories, pluginBrokerPresets, pluginOutputEncodings, pluginExtensions
+	pluginPanelFactories = map[string]*Plugin{}
+	pluginBrokerPresets = map[string]*Plugin{}
+	pluginOutputEncodings = map[string]*Plugin{}
+	pluginExtensions = map[string]string{}
+	t.Cleanup(func() {
+		pluginPanelFactories, pluginBrokerPresets, pluginOutputEncodings, pluginExtensions = factories, presets, encodings, extensions
+	})
+}
+
+// writePlugin writes a shell script plugin into a temporary directory,
+// answering each method with the given output, and returns its path
+func writePlugin(t *testing.T, responses map[string]string) string {
+	t.Helper()
+	script := "#!/bin/sh\ncat > \"$(dirname \"$0\")/request-$1.json\"\ncase \"$1\" in\n"
+	for method, response := range responses {
+		script += method + ")\n\tcat <<'EOF'\n" + response + "\nEOF\n\t;;\n"
+	}
+	script += "*)\n\texit 1\n\t;;\nesac\n"
+	path := filepath.Join(t.TempDir(), pluginPrefix+"test")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// pluginRequest returns the last request a plugin written by writePlugin
+// received for a method
+func pluginRequest(t *testing.T, path, method string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), "request-"+method+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLoadPlugins(t *testing.T) {
+	withPluginRegistry(t)
+	path := writePlugin(t, map[string]string{
+		pluginMethodDescribe: `{"panelFactories": ["cost"], "brokerPresets": ["nats"], "outputEncodings": [{"name": "jsonnet", "extension": ".jsonnet"}]}`,
+	})
+	if err := loadPlugins(context.Background(), []string{path}, "config.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if pluginPanelFactories["cost"] == nil || pluginBrokerPresets["nats"] == nil || pluginOutputEncodings["jsonnet"] == nil {
+		t.Fatalf("contributions not registered: factories %v, presets %v, encodings %v", pluginPanelFactories, pluginBrokerPresets, pluginOutputEncodings)
+	}
+	if got := pluginExtensions["jsonnet"]; got != ".jsonnet" {
+		t.Errorf("extension = %q, want .jsonnet", got)
+	}
+	if name := pluginPanelFactories["cost"].Name; name != "test" {
+		t.Errorf("plugin name = %q, want test", name)
+	}
+
+	// A second plugin cannot take over what is already registered
+	if err := loadPlugins(context.Background(), []string{path}, "config.yaml"); err == nil || !strings.Contains(err.Error(), `panel factory "cost" already exists`) {
+		t.Errorf("loading a plugin twice: error = %v", err)
+	}
+}
+
+func TestRegisterPluginRejectsBuiltins(t *testing.T) {
+	tests := []struct {
+		name        string
+		description PluginDescription
+		want        string
+	}{
+		{"panel factory", PluginDescription{PanelFactories: []string{"latency"}}, `panel factory "latency" already exists`},
+		{"broker preset", PluginDescription{BrokerPresets: []string{"kafka"}}, `broker preset "kafka" already exists`},
+		{"output encoding", PluginDescription{OutputEncodings: []PluginEncoding{{Name: outputEncodingYAML}}}, `output encoding "yaml" already exists`},
+		{"unnamed encoding", PluginDescription{OutputEncodings: []PluginEncoding{{Extension: ".txt"}}}, `output encoding "" already exists`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withPluginRegistry(t)
+			err := registerPlugin(&Plugin{Name: "test", PluginDescription: tt.description})
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPluginPanel(t *testing.T) {
+	withPluginRegistry(t)
+	path := writePlugin(t, map[string]string{
+		pluginMethodPanel: `{"type": "stat", "title": "Costs", "pluginVersion": "10.4.0", "options": {"colorMode": "background", "graphMode": "none"}}`,
+	})
+	plugin := &Plugin{Name: "test", Path: path}
+	pluginPanelFactories["cost"] = plugin
+
+	cursor := &panelCursor{ID: 7, Y: 3, Height: 8}
+	panel, err := buildCustomRowPanel(context.Background(), CustomRowPanel{Factory: "cost", Path: "/orders", Method: "get"}, nil, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if panel.ID != 7 || panel.GridPos.Y != 3 || panel.Title != "Costs" {
+		t.Errorf("panel = id %d, y %d, title %q, want the plugin panel at id 7, y 3", panel.ID, panel.GridPos.Y, panel.Title)
+	}
+	if cursor.ID != 8 || cursor.Y != 11 {
+		t.Errorf("cursor = id %d, y %d, want id 8, y 11", cursor.ID, cursor.Y)
+	}
+
+	// The panel is written as the plugin returned it, only placed
+	data, err := json.Marshal(panel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"datasource":{"type":"prometheus","uid":"${datasource}"},"gridPos":{"h":8,"w":24,"x":0,"y":3},"id":7,"options":{"colorMode":"background","graphMode":"none"},"pluginVersion":"10.4.0","title":"Costs","type":"stat"}`
+	if string(data) != want {
+		t.Errorf("panel JSON = %s, want %s", data, want)
+	}
+
+	var request pluginPanelRequest
+	if err := json.Unmarshal([]byte(pluginRequest(t, path, pluginMethodPanel)), &request); err != nil {
+		t.Fatal(err)
+	}
+	if request.Factory != "cost" || request.Panel.Title != "GET /orders" || request.ID != 7 || request.Y != 3 || request.Height != 8 {
+		t.Errorf("request = %+v", request)
+	}
+}
+
+func TestPluginBrokerPreset(t *testing.T) {
+	withPluginRegistry(t)
+	path := writePlugin(t, map[string]string{
+		pluginMethodBrokerPreset: `{"orders": {"publishRate": "rate(published{topic=\"orders\"}[5m])", "consumerLag": "max(lag)", "processingLatency": "avg(latency)"}}`,
+	})
+	async := &AsyncAPIDoc{Channels: []AsyncChannel{{Name: "orderCreated", Address: "orders"}}}
+	preset, err := pluginBrokerPreset(context.Background(), &Plugin{Name: "test", Path: path}, "nats", async, []string{`service=~"$service"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := preset.PublishRate("orders", nil), `rate(published{topic="orders"}[5m])`; got != want {
+		t.Errorf("publish rate = %q, want %q", got, want)
+	}
+	if got := preset.ConsumerLag("orders", nil); got != "max(lag)" {
+		t.Errorf("consumer lag = %q, want max(lag)", got)
+	}
+	if got := preset.ProcessingLatency("unknown", nil); got != "" {
+		t.Errorf("processing latency of an unknown address = %q, want none", got)
+	}
+	if request := pluginRequest(t, path, pluginMethodBrokerPreset); !strings.Contains(request, `"preset":"nats"`) || !strings.Contains(request, `"addresses":["orders"]`) || !strings.Contains(request, `"scope":["service=~\"$service\""]`) {
+		t.Errorf("request = %s", request)
+	}
+}
+
+func TestPluginFailure(t *testing.T) {
+	path := writePlugin(t, map[string]string{pluginMethodDescribe: `not json`})
+	plugin := &Plugin{Name: "test", Path: path}
+	var description PluginDescription
+	if err := plugin.call(context.Background(), pluginMethodDescribe, struct{}{}, &description); err == nil || !strings.Contains(err.Error(), "invalid describe response") {
+		t.Errorf("invalid response: error = %v", err)
+	}
+	if err := plugin.call(context.Background(), pluginMethodOutput, struct{}{}, &description); err == nil || !strings.Contains(err.Error(), "output failed") {
+		t.Errorf("failing method: error = %v", err)
+	}
+}
+
+// TestPluginCancelled checks a plugin is killed once its context is done
+func TestPluginCancelled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), pluginPrefix+"slow")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var description PluginDescription
+	err := (&Plugin{Name: "slow", Path: path}).call(ctx, pluginMethodDescribe, struct{}{}, &description)
+	if err == nil || !strings.Contains(err.Error(), "plugin slow: describe failed") {
+		t.Errorf("error = %v, want the describe call to fail", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("plugin ran for %s after its context was done", elapsed)
+	}
+}
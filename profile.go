@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling starts the CPU profile of --cpuprofile and returns the
+// function stopping it and writing the heap profile of --memprofile, both
+// readable with go tool pprof
+func startProfiling(cpuProfile, memProfile string) (func() error, error) {
+	var cpu *os.File
+	if cpuProfile != "" {
+		var err error
+		if cpu, err = os.Create(cpuProfile); err != nil {
+			return nil, fmt.Errorf("error creating CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("error starting CPU profile: %w", err)
+		}
+	}
+
+	return func() error {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				return fmt.Errorf("error writing CPU profile: %w", err)
+			}
+		}
+		if memProfile == "" {
+			return nil
+		}
+		mem, err := os.Create(memProfile)
+		if err != nil {
+			return fmt.Errorf("error creating memory profile: %w", err)
+		}
+		defer mem.Close()
+		// Collect garbage first so the profile shows live allocations
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(mem); err != nil {
+			return fmt.Errorf("error writing memory profile: %w", err)
+		}
+		return nil
+	}, nil
+}
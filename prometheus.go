@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrometheusClient runs instant queries and series lookups against the Prometheus HTTP API
+type PrometheusClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// PrometheusSample is one series of an instant vector result
+type PrometheusSample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+type prometheusResponse struct {
+	Status    string          `json:"status"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type prometheusVector struct {
+	ResultType string `json:"resultType"`
+	Result     []struct {
+		Metric map[string]string `json:"metric"`
+		Value  [2]interface{}    `json:"value"`
+	} `json:"result"`
+}
+
+// NewPrometheusClient creates a client for the Prometheus-compatible API at baseURL
+func NewPrometheusClient(baseURL string) *PrometheusClient {
+	return &PrometheusClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Query evaluates an instant vector query
+func (c *PrometheusClient) Query(ctx context.Context, query string) ([]PrometheusSample, error) {
+	data, err := c.post(ctx, "/api/v1/query", url.Values{"query": {query}})
+	if err != nil {
+		return nil, err
+	}
+	var vector prometheusVector
+	if err := json.Unmarshal(data, &vector); err != nil {
+		return nil, fmt.Errorf("error decoding prometheus result: %w", err)
+	}
+	if vector.ResultType != "vector" {
+		return nil, fmt.Errorf("unexpected prometheus result type %q", vector.ResultType)
+	}
+
+	samples := make([]PrometheusSample, 0, len(vector.Result))
+	for _, r := range vector.Result {
+		raw, ok := r.Value[1].(string)
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, PrometheusSample{Labels: r.Metric, Value: value})
+	}
+	return samples, nil
+}
+
+// SeriesCount returns how many series matched selector over the last window
+func (c *PrometheusClient) SeriesCount(ctx context.Context, selector string, window time.Duration) (int, error) {
+	now := time.Now()
+	data, err := c.post(ctx, "/api/v1/series", url.Values{
+		"match[]": {selector},
+		"start":   {strconv.FormatInt(now.Add(-window).Unix(), 10)},
+		"end":     {strconv.FormatInt(now.Unix(), 10)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var series []map[string]string
+	if err := json.Unmarshal(data, &series); err != nil {
+		return 0, fmt.Errorf("error decoding prometheus series: %w", err)
+	}
+	return len(series), nil
+}
+
+// post calls a Prometheus API endpoint and returns the data of a successful response
+func (c *PrometheusClient) post(ctx context.Context, endpoint string, form url.Values) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus query failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading prometheus response: %w", err)
+	}
+
+	var result prometheusResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("prometheus returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query error (%s): %s", result.ErrorType, result.Error)
+	}
+	return result.Data, nil
+}
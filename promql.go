@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// promMatchers matches the label matchers between the braces of a selector,
+// braces inside quoted values such as path="/users/{id}" included
+const promMatchers = `((?:[^}"]|"(?:[^"\\]|\\.)*")*)`
+
+// promLabelValue escapes a value for a double-quoted PromQL string, so
+// quotes, backslashes and control characters in e.g. an OpenAPI path keep
+// the query valid. PromQL strings take Go's escape sequences. Values with
+// nothing to escape, nearly all of them, are returned as is.
+func promLabelValue(value string) string {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < ' ' || c == '"' || c == '\\' || c >= 0x7f {
+			quoted := strconv.Quote(value)
+			return quoted[1 : len(quoted)-1]
+		}
+	}
+	return value
+}
+
+// promMatcher renders a label matcher, e.g. path="/items", escaping value
+func promMatcher(label, op, value string) string {
+	return label + op + `"` + promLabelValue(value) + `"`
+}
+
+// promRegexValue escapes a value for an exact match inside the regex of a
+// =~ matcher: regex metacharacters, then the string escapes of the result
+func promRegexValue(value string) string {
+	return promLabelValue(regexp.QuoteMeta(value))
+}
+
+// promSelector builds a metric selector, its label matchers in the order
+// they are added. Values added with eq and regex are escaped.
+type promSelector struct {
+	metric   string
+	matchers []string
+}
+
+// selectorOf returns a selector of metric with raw matchers, such as the
+// query scope or a configured error matcher; empty ones are skipped
+func selectorOf(metric string, matchers ...string) promSelector {
+	return promSelector{metric: metric}.with(matchers...)
+}
+
+// operationMatch selects the series of the HTTP operation a panel set
+// shows, within the query scope of the dashboard
+type operationMatch struct {
+	Path   string
+	Method string
+	// Methods are the methods of a path collapsed by --aggregate-by path,
+	// matched instead of Method; its series are broken down by method
+	Methods []string
+	// PathPattern is a regex of paths matched instead of Path, with any
+	// method, for panels aggregating several operations; their series are
+	// broken down by method
+	PathPattern string
+	// Scope are the matchers of the filtering variables and the extra
+	// selector, see Config.queryScope
+	Scope []string
+}
+
+// selector selects the series of metric for the operation: path and
+// method, the extra matchers, then the scope. Every query of every
+// operation takes one, so the matchers are collected in a single slice.
+func (m operationMatch) selector(metric string, matchers ...string) promSelector {
+	s := make([]string, 0, 2+len(matchers)+len(m.Scope))
+	switch {
+	case m.PathPattern != "":
+		s = append(s, promMatcher("path", "=~", m.PathPattern))
+	case len(m.Methods) > 0:
+		s = append(s, promMatcher("path", "=", m.Path), promMatcher("method", "=~", strings.Join(m.Methods, "|")))
+	default:
+		s = append(s, promMatcher("path", "=", m.Path), promMatcher("method", "=", m.Method))
+	}
+	return promSelector{metric: metric, matchers: appendMatchers(appendMatchers(s, matchers...), m.Scope...)}
+}
+
+// byMethod reports whether the series of the operation are broken down by
+// method
+func (m operationMatch) byMethod() bool {
+	return len(m.Methods) > 0 || m.PathPattern != ""
+}
+
+// by returns the labels to aggregate the series of the operation by, with
+// method when they are broken down by method
+func (m operationMatch) by(labels ...string) []string {
+	if !m.byMethod() {
+		return labels
+	}
+	return append(slices.Clip(labels), "method")
+}
+
+// legend returns the legend of a series of the operation, naming its
+// method when the series are broken down by method
+func (m operationMatch) legend(legend string) string {
+	if !m.byMethod() {
+		return legend
+	}
+	return strings.TrimSpace(legend + " {{method}}")
+}
+
+// grpcMatch selects the series of a gRPC method, within the query scope of
+// the dashboard
+type grpcMatch struct {
+	Service string
+	Method  string
+	// ServiceMatcher matches the grpc_service label instead of Service, e.g.
+	// in any package for an unqualified grpc-gateway service
+	ServiceMatcher string
+	// Scope are the matchers of the filtering variables and the extra
+	// selector, see Config.queryScope
+	Scope []string
+}
+
+// selector selects the series of metric for the method: service and
+// method, the extra matchers, then the scope
+func (m grpcMatch) selector(metric string, matchers ...string) promSelector {
+	service := m.ServiceMatcher
+	if service == "" {
+		service = promMatcher("grpc_service", "=", m.Service)
+	}
+	s := make([]string, 0, 2+len(matchers)+len(m.Scope))
+	s = append(s, service, promMatcher("grpc_method", "=", m.Method))
+	return promSelector{metric: metric, matchers: appendMatchers(appendMatchers(s, matchers...), m.Scope...)}
+}
+
+// with returns the selector with raw matchers appended, leaving s untouched
+func (s promSelector) with(matchers ...string) promSelector {
+	combined := make([]string, len(s.matchers), len(s.matchers)+len(matchers))
+	copy(combined, s.matchers)
+	return promSelector{metric: s.metric, matchers: appendMatchers(combined, matchers...)}
+}
+
+// appendMatchers appends the nonempty matchers to dst
+func appendMatchers(dst []string, matchers ...string) []string {
+	for _, matcher := range matchers {
+		if matcher != "" {
+			dst = append(dst, matcher)
+		}
+	}
+	return dst
+}
+
+// eq returns the selector with label="value" appended
+func (s promSelector) eq(label, value string) promSelector {
+	return s.with(promMatcher(label, "=", value))
+}
+
+// regex returns the selector with label=~"pattern" appended, the pattern
+// used as a regex as is
+func (s promSelector) regex(label, pattern string) promSelector {
+	return s.with(promMatcher(label, "=~", pattern))
+}
+
+// notRegex returns the selector with label!~"pattern" appended
+func (s promSelector) notRegex(label, pattern string) promSelector {
+	return s.with(promMatcher(label, "!~", pattern))
+}
+
+// bucket returns the selector of the _bucket series of a histogram
+func (s promSelector) bucket() promSelector {
+	return promSelector{metric: strings.TrimSuffix(s.metric, "_bucket") + "_bucket", matchers: s.matchers}
+}
+
+// String renders the selector, without braces when it has no matchers
+func (s promSelector) String() string {
+	if len(s.matchers) == 0 {
+		return s.metric
+	}
+	size := len(s.metric) + 2*len(s.matchers)
+	for _, matcher := range s.matchers {
+		size += len(matcher)
+	}
+	var b strings.Builder
+	b.Grow(size)
+	b.WriteString(s.metric)
+	for i, matcher := range s.matchers {
+		if i == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(matcher)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// promRate is the per-second rate of a selector over the panel's rate interval
+func promRate(s promSelector) string {
+	return "rate(" + s.String() + rateIntervalRange + ")"
+}
+
+// promOverTime applies a range function, e.g. increase, to a selector over window
+func promOverTime(function string, s promSelector, window string) string {
+	return fmt.Sprintf("%s(%s[%s])", function, s, window)
+}
+
+// promSum sums an expression, by labels when given: sum(expr) by (labels)
+func promSum(expr string, by ...string) string {
+	if len(by) == 0 {
+		return "sum(" + expr + ")"
+	}
+	return "sum(" + expr + ") by (" + strings.Join(by, ", ") + ")"
+}
+
+// promSumBy sums an expression by labels written before it: sum by (labels) (expr)
+func promSumBy(by []string, expr string) string {
+	return "sum by (" + strings.Join(by, ", ") + ") (" + expr + ")"
+}
+
+// promHistogramQuantile is a latency percentile of a histogram, e.g. "0.99",
+// over the panel's rate interval, by labels when given
+func promHistogramQuantile(quantile string, histogram promSelector, by ...string) string {
+	return "histogram_quantile(" + quantile + ", " + promSum(promRate(histogram.bucket()), append([]string{"le"}, by...)...) + ")"
+}
+
+// promRangeTotals is the increase of the series of a selector over the
+// dashboard's time range, by labels, nonzero ones largest first, for tables
+func promRangeTotals(by []string, s promSelector) string {
+	return "sort_desc(" + promSumBy(by, promOverTime("increase", s, "$__range")) + " > 0)"
+}
+
+// promConstant is a constant series of 1 carrying labels, given as name and
+// value pairs, to match other series against with and, unless or on
+func promConstant(labels ...string) string {
+	expr := "vector(1)"
+	for i := 0; i+1 < len(labels); i += 2 {
+		expr = fmt.Sprintf(`label_replace(%s, "%s", "%s", "", "")`, expr, labels[i], promLabelValue(labels[i+1]))
+	}
+	return expr
+}
+
+// promPercent is the share of part in total, in percent
+func promPercent(part, total string) string {
+	return part + " / " + total + " * 100"
+}
+
+// promClosers pairs the closing delimiters of PromQL with their openers
+var promClosers = map[byte]byte{')': '(', ']': '[', '}': '{'}
+
+// checkPromQL reports the lexical errors that make Prometheus reject a
+// query: unbalanced parentheses, brackets or braces, and unterminated or
+// wrongly escaped strings. It does not check functions or types.
+func checkPromQL(expr string) error {
+	var open []byte
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; c {
+		case '"', '\'', '`':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != c; end++ {
+				if expr[end] == '\\' && c != '`' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return fmt.Errorf("unterminated string at offset %d", i)
+			}
+			if c == '"' {
+				if _, err := strconv.Unquote(expr[i : end+1]); err != nil {
+					return fmt.Errorf("invalid escape in string %s", expr[i:end+1])
+				}
+			}
+			i = end
+		case '#':
+			// Comments run to the end of the line
+			for i < len(expr) && expr[i] != '\n' {
+				i++
+			}
+		case '(', '[', '{':
+			open = append(open, c)
+		case ')', ']', '}':
+			if len(open) == 0 || open[len(open)-1] != promClosers[c] {
+				return fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("unclosed %q", open[len(open)-1])
+	}
+	return nil
+}
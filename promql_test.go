@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// grafanaIntervals replaces the Grafana interval variables of a query with
+// durations, so Prometheus can parse it; other variables only appear in
+// label values, where they are plain strings
+var grafanaIntervals = strings.NewReplacer(
+	"$__rate_interval", "5m",
+	"$__interval", "1m",
+	"$__range", "1h",
+)
+
+// parsePromQL parses a generated query with the Prometheus parser
+func parsePromQL(t *testing.T, expr string) {
+	t.Helper()
+	if _, err := parser.ParseExpr(grafanaIntervals.Replace(expr)); err != nil {
+		t.Errorf("%s: %v", expr, err)
+	}
+}
+
+// TestPromQLBuilders parses the output of the query builders, with label
+// values that need escaping and the scope of filtering variables
+func TestPromQLBuilders(t *testing.T) {
+	scope := []string{`service=~"$service"`, `k8s_cluster=~"$cluster"`, `tenant="acme"`}
+	match := operationMatch{Path: `/files/{name}/"quoted"\raw`, Method: "GET", Scope: scope}
+	requests := match.selector("http_requests_total")
+	errors := match.selector("http_requests_total", `status_code=~"5.."`)
+	latency := match.selector("http_request_duration_seconds")
+
+	tests := map[string]string{
+		"bare selector":            selectorOf("up").String(),
+		"scoped selector":          selectorOf("up", scope...).String(),
+		"empty matchers":           selectorOf("up", "", `job="api"`, "").String(),
+		"operation":                requests.String(),
+		"regex":                    selectorOf("http_requests_total").regex("path", promRegexValue("/items/{id}.json")).String(),
+		"not regex":                selectorOf("http_requests_total").notRegex("status_code", "2..|3..").String(),
+		"rate":                     promRate(requests),
+		"sum":                      promSum(promRate(requests)),
+		"sum by":                   promSum(promRate(requests), "status_code", "method"),
+		"sum by before":            promSumBy([]string{"status_class"}, promRate(requests)),
+		"histogram quantile":       promHistogramQuantile("0.99", latency),
+		"bucket of bucket":         promHistogramQuantile("0.5", selectorOf("http_request_duration_seconds_bucket")),
+		"range totals":             promRangeTotals([]string{"method", "path"}, requests),
+		"over time":                promOverTime("avg_over_time", selectorOf("probe_success", scope...), "$__rate_interval"),
+		"percent":                  promPercent(promSum(promRate(errors)), promSum(promRate(requests))),
+		"constant":                 promConstant("path", `/a"b`, "method", "GET"),
+		"constant unless":          promSumBy([]string{"method", "path"}, promOverTime("increase", requests, "$__range")) + " unless on (method, path) " + promConstant("path", "/a", "method", "GET"),
+		"canary":                   createCanaryPanels("T", match, "version", 1, 8, 0)[1].Targets[2].Expr,
+		"status classes":           createStatusClassesPanel("T", match, 1, 8, 0).Targets[0].Expr,
+		"error rate":               createErrorRatePanel("T", match, defaultThresholds, 1, 8, 0).Targets[0].Expr,
+		"latency":                  createLatencyPanel("T", match, defaultThresholds, 1, 8, 0).Targets[0].Expr,
+		"grpc":                     createGRPCLatencyPanel("T", grpcMatch{Service: "users.v1.Users", Method: "Get", Scope: scope}, defaultThresholds, 1, 8, 0).Targets[0].Expr,
+		"grpc stream":              createGRPCStreamingPanels("T", GRPCMethod{Service: "Chat", Method: "Talk", ServerStreaming: true}, scope, 1, 8, 0)[0].Targets[0].Expr,
+		"unscoped operation":       operationMatch{Path: "/items", Method: "POST"}.selector("http_requests_total").String(),
+		"operation without method": operationMatch{Path: "/items"}.selector("http_requests_total").String(),
+	}
+	for name, expr := range tests {
+		t.Run(name, func(t *testing.T) {
+			parsePromQL(t, expr)
+		})
+	}
+}
+
+// goldenFiles returns the golden dashboards and golden cases
+func goldenFiles(t *testing.T) []string {
+	t.Helper()
+	goldens, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases, err := filepath.Glob(filepath.Join("testdata", "golden", "cases", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goldens = append(goldens, cases...)
+	if len(goldens) == 0 {
+		t.Fatal("no golden dashboards in testdata/golden")
+	}
+	return goldens
+}
+
+// goldenExprs returns the queries of a golden dashboard
+func goldenExprs(t *testing.T, golden string) []string {
+	t.Helper()
+	data, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dashboard interface{}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		t.Fatal(err)
+	}
+	return collectExprs(dashboard, nil)
+}
+
+// TestGoldenQueriesParse parses every query of the golden dashboards and
+// golden cases: panel targets, alert models and annotations
+func TestGoldenQueriesParse(t *testing.T) {
+	for _, golden := range goldenFiles(t) {
+		name, _ := filepath.Rel(filepath.Join("testdata", "golden"), golden)
+		t.Run(strings.TrimSuffix(name, ".json"), func(t *testing.T) {
+			exprs := goldenExprs(t, golden)
+			if len(exprs) == 0 {
+				t.Fatal("no queries in the golden dashboard")
+			}
+			for _, expr := range exprs {
+				parsePromQL(t, expr)
+			}
+		})
+	}
+}
+
+// TestGoldenQueriesFollowConventions checks every metric the golden
+// dashboards query is one of the conventions the version command reports.
+// The queries of rows and config-file come from their fixtures.
+func TestGoldenQueriesFollowConventions(t *testing.T) {
+	conventions := map[string]bool{}
+	for _, convention := range supportedConventions {
+		metric, _, _ := strings.Cut(convention, "{")
+		conventions[metric] = true
+	}
+	for _, golden := range goldenFiles(t) {
+		name, _ := filepath.Rel(filepath.Join("testdata", "golden"), golden)
+		name = strings.TrimSuffix(name, ".json")
+		if name == "rows" || name == filepath.Join("cases", "config-file") {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			for _, expr := range goldenExprs(t, golden) {
+				parsed, err := parser.ParseExpr(grafanaIntervals.Replace(expr))
+				if err != nil {
+					continue // reported by TestGoldenQueriesParse
+				}
+				parser.Inspect(parsed, func(node parser.Node, _ []parser.Node) error {
+					if selector, ok := node.(*parser.VectorSelector); ok && !conventions[selector.Name] {
+						t.Errorf("%s queries %s, not a supported convention", expr, selector.Name)
+					}
+					return nil
+				})
+			}
+		})
+	}
+}
+
+// collectExprs appends the nonempty expr fields found anywhere in a decoded
+// JSON document
+func collectExprs(value interface{}, exprs []string) []string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if expr, ok := field.(string); ok && key == "expr" && expr != "" {
+				exprs = append(exprs, expr)
+				continue
+			}
+			exprs = collectExprs(field, exprs)
+		}
+	case []interface{}:
+		for _, item := range v {
+			exprs = collectExprs(item, exprs)
+		}
+	}
+	return exprs
+}
@@ -0,0 +1,123 @@
+package main
+
+import "strings"
+
+// Policies of --prune for the panels of operations removed from the spec
+const (
+	pruneDelete = "delete"
+	pruneKeep   = "keep"
+	pruneOrphan = "orphan"
+)
+
+// removedFromSpecPrefix marks the titles of panels kept for removed operations
+const removedFromSpecPrefix = "Removed from spec: "
+
+// orphanedRowTitle is the collapsed row --prune orphan moves panels into
+const orphanedRowTitle = "Orphaned"
+
+// operationLinePrefix starts the last line of the descriptions of operation
+// panels, naming the operation so --prune finds it in the previous dashboard
+const operationLinePrefix = "Operation: "
+
+// describeOperation ends a panel description with the line naming the
+// operation, "METHOD path", the panel belongs to
+func describeOperation(description, operation string) string {
+	if description == "" {
+		return operationLinePrefix + operation
+	}
+	return description + "\n\n" + operationLinePrefix + operation
+}
+
+// panelOperation returns the operation the description of a panel names,
+// empty for panels of no operation
+func panelOperation(panel Panel) string {
+	line := panel.Description[strings.LastIndex(panel.Description, "\n")+1:]
+	operation, ok := strings.CutPrefix(line, operationLinePrefix)
+	if !ok {
+		return ""
+	}
+	return operation
+}
+
+// removedPanels returns the panels of the previous dashboard, out of their
+// rows, recorded for an operation the dashboard no longer has panels for
+func removedPanels(dashboard *GrafanaDashboard, previous []Panel) []Panel {
+	current := make(map[string]bool, len(dashboard.operations))
+	for _, group := range dashboard.operations {
+		current[group.operation()] = true
+	}
+	var removed []Panel
+	applyToPanels(previous, func(panel *Panel) {
+		if operation := panelOperation(*panel); operation != "" && !current[operation] {
+			removed = append(removed, *panel)
+		}
+	})
+	return removed
+}
+
+// applyPrunePolicy carries the panels of operations removed from the spec
+// over from the previous dashboard unless the policy deletes them: keep
+// appends them marked as removed, orphan moves them into a collapsed
+// "Orphaned" row. Their alerts are dropped, the operations no longer
+// receiving traffic. It returns the number of removed panels.
+func applyPrunePolicy(dashboard *GrafanaDashboard, previous []Panel, policy string) int {
+	removed := removedPanels(dashboard, previous)
+	if len(removed) == 0 || policy == "" || policy == pruneDelete {
+		return len(removed)
+	}
+
+	nextID, bottom := 0, 0
+	applyToPanels(dashboard.Panels, func(panel *Panel) {
+		nextID = max(nextID, panel.ID)
+	})
+	for _, panel := range dashboard.Panels {
+		bottom = max(bottom, panel.GridPos.Y+panel.GridPos.H)
+	}
+	rowID := nextID + 1
+	if policy == pruneOrphan {
+		nextID++
+		bottom++
+	}
+
+	// Lay the panels out again, they come from several rows
+	x, y, height := 0, bottom, 0
+	for i := range removed {
+		panel := &removed[i]
+		nextID++
+		panel.ID = nextID
+		panel.Alert = nil
+		if !strings.HasPrefix(panel.Title, removedFromSpecPrefix) {
+			panel.Title = removedFromSpecPrefix + panel.Title
+		}
+		panel.Description = describeOperation("The operation of this panel was removed from the spec", panelOperation(*panel))
+
+		if x+panel.GridPos.W > 24 {
+			x, y, height = 0, y+height, 0
+		}
+		panel.GridPos.X, panel.GridPos.Y = x, y
+		x += panel.GridPos.W
+		height = max(height, panel.GridPos.H)
+	}
+
+	if policy == pruneOrphan {
+		row := createRowPanel(orphanedRowTitle, rowID, bottom-1)
+		row.Collapsed = true
+		row.Panels = removed
+		dashboard.Panels = append(dashboard.Panels, row)
+	} else {
+		dashboard.Panels = append(dashboard.Panels, removed...)
+	}
+	return len(removed)
+}
+
+// pruneDescription tells what a policy did with the removed panels
+func pruneDescription(policy string) string {
+	switch policy {
+	case pruneKeep:
+		return "kept, marked as removed"
+	case pruneOrphan:
+		return "moved into the " + orphanedRowTitle + " row"
+	default:
+		return "deleted"
+	}
+}
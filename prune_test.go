@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestApplyPrunePolicy checks the panels of removed operations are found
+// by the operation line of their description in the stored dashboard, and
+// still are once kept
+func TestApplyPrunePolicy(t *testing.T) {
+	previous := []Panel{
+		{ID: 1, Title: "GET /orders - Request Rate", Description: describeOperation("Request rate per status code", "GET /orders"), GridPos: GridPos{H: 8, W: 12}},
+		{ID: 2, Title: "DELETE /orders/{id} - Request Rate", Description: describeOperation("Request rate per status code", "DELETE /orders/{id}"), GridPos: GridPos{H: 8, W: 12, Y: 8}, Alert: &Alert{Name: "errors"}},
+		{ID: 3, Title: "Notes", Type: "text", Description: "Hand-added", GridPos: GridPos{H: 4, W: 24, Y: 16}},
+	}
+	data, err := json.Marshal(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := storedDashboard{Panels: data}
+
+	current := func() *GrafanaDashboard {
+		return &GrafanaDashboard{
+			Panels:     []Panel{{ID: 1, Title: "GET /orders - Request Rate", GridPos: GridPos{H: 8, W: 12}}},
+			operations: map[string]OperationPanels{"listOrders": {Key: "listOrders", Method: "GET", Path: "/orders", PanelIDs: []int{1}}},
+		}
+	}
+	dashboard := current()
+	if removed := applyPrunePolicy(dashboard, stored.panels(), pruneKeep); removed != 1 {
+		t.Fatalf("removed %d panels, want the DELETE /orders/{id} one", removed)
+	}
+	kept := dashboard.Panels[len(dashboard.Panels)-1]
+	if kept.Title != removedFromSpecPrefix+"DELETE /orders/{id} - Request Rate" || kept.Alert != nil || kept.ID != 2 || kept.GridPos.Y != 8 {
+		t.Errorf("kept panel = %+v", kept)
+	}
+	if got := panelOperation(kept); got != "DELETE /orders/{id}" {
+		t.Errorf("kept panel operation = %q, want DELETE /orders/{id}", got)
+	}
+
+	// The next update finds the kept panel again, without prefixing it twice
+	data, err = json.Marshal(dashboard.Panels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := current()
+	if removed := applyPrunePolicy(next, storedDashboard{Panels: data}.panels(), pruneKeep); removed != 1 {
+		t.Fatalf("removed %d panels on the next update, want 1", removed)
+	}
+	if title := next.Panels[len(next.Panels)-1].Title; title != removedFromSpecPrefix+"DELETE /orders/{id} - Request Rate" {
+		t.Errorf("title on the next update = %q", title)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// PublicDashboard is the public sharing configuration of a dashboard
+type PublicDashboard struct {
+	UID         string `json:"uid,omitempty"`
+	AccessToken string `json:"accessToken,omitempty"`
+	IsEnabled   bool   `json:"isEnabled"`
+	Share       string `json:"share,omitempty"`
+}
+
+// EnablePublicDashboard shares a dashboard publicly, creating its public
+// dashboard or enabling the existing one. Grafana renders public dashboards
+// with the default values of their variables.
+func (c *GrafanaClient) EnablePublicDashboard(ctx context.Context, uid string) (*PublicDashboard, error) {
+	path := "/api/dashboards/uid/" + url.PathEscape(uid) + "/public-dashboards"
+	var existing PublicDashboard
+	err := c.do(ctx, http.MethodGet, path, nil, &existing)
+	var pushErr *PushError
+	if errors.As(err, &pushErr) && pushErr.StatusCode == http.StatusNotFound {
+		existing = PublicDashboard{}
+	} else if err != nil {
+		return nil, err
+	}
+	// Grafana answers 200 with an empty configuration for dashboards never
+	// shared
+	if existing.IsEnabled && existing.Share == "public" {
+		return &existing, nil
+	}
+
+	body, err := json.Marshal(PublicDashboard{IsEnabled: true, Share: "public"})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling public dashboard: %w", err)
+	}
+	var result PublicDashboard
+	if existing.UID == "" {
+		err = c.do(ctx, http.MethodPost, path, body, &result)
+	} else {
+		err = c.do(ctx, http.MethodPatch, path+"/"+url.PathEscape(existing.UID), body, &result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// rateIntervalRange is the range generated rate() and increase() queries use
+const rateIntervalRange = "[$__rate_interval]"
+
+// promDurationPattern matches a single-unit Prometheus duration such as 5m
+var promDurationPattern = regexp.MustCompile(`^[0-9]+(ms|s|m|h|d|w|y)$`)
+
+// QueryOptions tunes generated queries for query frontends such as Thanos
+// and Mimir, which are easily overloaded by fine-grained range queries over
+// every service
+type QueryOptions struct {
+	// Interval is the minimum step of every query, e.g. 1m
+	Interval string `yaml:"interval"`
+	// MaxDataPoints caps the points per series Grafana requests
+	MaxDataPoints int `yaml:"max_data_points"`
+	// RateRange replaces $__rate_interval with a fixed range, e.g. 5m
+	RateRange string `yaml:"rate_range"`
+	// SumBy adds labels to every by (...) clause, keeping them apart in the panels
+	SumBy []string `yaml:"sum_by"`
+}
+
+// queryFrontendPreset is applied with --query-frontend: a 1m minimum step
+// aligns queries with the frontend's results cache and caps the number of
+// points per series
+var queryFrontendPreset = QueryOptions{
+	Interval:      "1m",
+	MaxDataPoints: 500,
+}
+
+// validate checks the durations and labels of the options
+func (o QueryOptions) validate() error {
+	for _, duration := range []string{o.Interval, o.RateRange} {
+		if duration != "" && !promDurationPattern.MatchString(duration) {
+			return fmt.Errorf("invalid duration %q, expected e.g. 1m", duration)
+		}
+	}
+	if o.MaxDataPoints < 0 {
+		return fmt.Errorf("max_data_points must not be negative")
+	}
+	for _, label := range o.SumBy {
+		if !labelNamePattern.MatchString(label) {
+			return fmt.Errorf("invalid sum_by label %q", label)
+		}
+	}
+	return nil
+}
+
+// labelNamePattern matches a Prometheus label name
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// queryOptions returns the --query-frontend preset overridden by the
+// options of the config file
+func (c *Config) queryOptions() QueryOptions {
+	var options QueryOptions
+	if c.QueryFrontend {
+		options = queryFrontendPreset
+	}
+	file := c.fileConfig().Query
+	if file.Interval != "" {
+		options.Interval = file.Interval
+	}
+	if file.MaxDataPoints > 0 {
+		options.MaxDataPoints = file.MaxDataPoints
+	}
+	if file.RateRange != "" {
+		options.RateRange = file.RateRange
+	}
+	options.SumBy = append(options.SumBy, file.SumBy...)
+	return options
+}
+
+// applyQueryOptions applies the query options to every panel querying Prometheus
+func applyQueryOptions(dashboard *GrafanaDashboard, options QueryOptions) {
+	applyToPanels(dashboard.Panels, func(panel *Panel) {
+		if len(panel.Targets) == 0 {
+			return
+		}
+		if options.MaxDataPoints > 0 {
+			panel.MaxDataPoints = options.MaxDataPoints
+		}
+		for i := range panel.Targets {
+			target := &panel.Targets[i]
+			// Panels with their own resolution, such as trends, keep it
+			if options.Interval != "" && target.Interval == "" {
+				target.Interval = options.Interval
+			}
+			if options.RateRange != "" {
+				target.Expr = strings.ReplaceAll(target.Expr, rateIntervalRange, "["+options.RateRange+"]")
+			}
+			if len(options.SumBy) > 0 {
+				target.Expr, target.LegendFormat = addGroupingLabels(target.Expr, target.LegendFormat, options.SumBy)
+			}
+		}
+	})
+}
+
+// addGroupingLabels adds labels to every by (...) clause of a query and to
+// its legend, so the series they separate stay distinguishable
+func addGroupingLabels(expr, legend string, labels []string) (string, string) {
+	grouped := false
+	expr = groupingPattern.ReplaceAllStringFunc(expr, func(clause string) string {
+		grouped = true
+		existing := groupingPattern.FindStringSubmatch(clause)[1]
+		present := make(map[string]bool)
+		var names []string
+		for _, name := range strings.Split(existing, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				present[name] = true
+				names = append(names, name)
+			}
+		}
+		for _, label := range labels {
+			if !present[label] {
+				names = append(names, label)
+			}
+		}
+		return "by (" + strings.Join(names, ", ") + ")"
+	})
+	if grouped && legend != "" {
+		for _, label := range labels {
+			placeholder := "{{" + label + "}}"
+			if !strings.Contains(legend, placeholder) {
+				legend += " " + placeholder
+			}
+		}
+	}
+	return expr, legend
+}
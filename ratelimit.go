@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Utilization levels (percent of the rate limit) of headroom panels
+const (
+	headroomWarning  = 70
+	headroomCritical = 90
+)
+
+// RateLimit is a request limit declared for an operation
+type RateLimit struct {
+	Limit  float64
+	Period time.Duration
+}
+
+func (l RateLimit) String() string {
+	return fmt.Sprintf("%g requests per %s", l.Limit, l.Period)
+}
+
+// operationRateLimit reads the rate limit of an operation from an
+// x-rate-limit extension (a number of requests per second, or an object with
+// limit and period), falling back to the example or default of an
+// X-RateLimit-Limit response header, whose window is given by an
+// x-rate-limit-period extension on the header (default 1s)
+func operationRateLimit(operation *openapi3.Operation) (RateLimit, bool) {
+	if ext, ok := operation.Extensions["x-rate-limit"]; ok {
+		switch value := ext.(type) {
+		case float64:
+			return rateLimit(value, "")
+		case map[string]interface{}:
+			limit, _ := value["limit"].(float64)
+			period, _ := value["period"].(string)
+			return rateLimit(limit, period)
+		}
+	}
+
+	if operation.Responses == nil {
+		return RateLimit{}, false
+	}
+	for _, code := range sortedMapKeys(operation.Responses.Map()) {
+		response := operation.Responses.Value(code)
+		if response == nil || response.Value == nil {
+			continue
+		}
+		for name, header := range response.Value.Headers {
+			if !strings.EqualFold(name, "X-RateLimit-Limit") || header.Value == nil {
+				continue
+			}
+			period, _ := header.Value.Extensions["x-rate-limit-period"].(string)
+			if limit, ok := headerExampleValue(header.Value); ok {
+				return rateLimit(limit, period)
+			}
+		}
+	}
+	return RateLimit{}, false
+}
+
+func rateLimit(limit float64, period string) (RateLimit, bool) {
+	duration := time.Second
+	if period != "" {
+		parsed, err := time.ParseDuration(period)
+		if err != nil || parsed <= 0 {
+			return RateLimit{}, false
+		}
+		duration = parsed
+	}
+	if limit <= 0 {
+		return RateLimit{}, false
+	}
+	return RateLimit{Limit: limit, Period: duration}, true
+}
+
+// headerExampleValue returns the numeric example or schema default/example of a header
+func headerExampleValue(header *openapi3.Header) (float64, bool) {
+	candidates := []interface{}{header.Example}
+	if header.Schema != nil && header.Schema.Value != nil {
+		candidates = append(candidates, header.Schema.Value.Example, header.Schema.Value.Default)
+	}
+	for _, candidate := range candidates {
+		switch value := candidate.(type) {
+		case float64:
+			return value, true
+		case int:
+			return float64(value), true
+		case string:
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// createHeadroomPanel shows the current request rate as a percentage of the
+// rate limit, turning yellow at 70% and red at 90% before clients hit 429s
+func createHeadroomPanel(title string, match operationMatch, limit RateLimit, panelID, height, yPos int) Panel {
+	return Panel{
+		ID:         panelID,
+		Title:      title + " - Rate Limit Utilization",
+		Type:       "timeseries",
+		Datasource: map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		GridPos:    GridPos{H: height, W: 12, X: 0, Y: yPos},
+		Targets: []Target{
+			{
+				Expr:         fmt.Sprintf(`%s * %g / %g * 100`, promSum(promRate(match.selector("http_requests_total"))), limit.Period.Seconds(), limit.Limit),
+				LegendFormat: "Utilization",
+				RefID:        "A",
+			},
+		},
+		Options: Options{
+			Legend: LegendOptions{
+				DisplayMode: "list",
+				Placement:   "bottom",
+			},
+			Tooltip: TooltipOptions{
+				Mode: "multi",
+			},
+		},
+		FieldConfig: FieldConfig{
+			Defaults: FieldConfigDefaults{
+				Color: ColorOptions{Mode: "palette-classic"},
+				Unit:  "percent",
+				Min:   floatPtr(0),
+				Thresholds: ThresholdOptions{
+					Mode: "absolute",
+					Steps: []ThresholdStep{
+						{Color: "green", Value: nil},
+						{Color: "yellow", Value: floatPtr(headroomWarning)},
+						{Color: "red", Value: floatPtr(headroomCritical)},
+					},
+				},
+			},
+		},
+		Description: "Request rate as a percentage of the declared limit of " + limit.String(),
+	}
+}
+
+// Default metrics of throttling panels: responses with a 429 status and a
+// gauge of the requests left in the current rate limit window
+const (
+	defaultRequestsMetric   = "http_requests_total"
+	defaultThrottledMatcher = `status_code="429"`
+	defaultRemainingMetric  = "ratelimit_remaining"
+)
+
+// RateLimitsConfig names the metrics throttling panels query, in the
+// rate_limits section of the config file
+type RateLimitsConfig struct {
+	RequestsMetric string `yaml:"requests_metric"`
+	// ThrottledMatcher selects the throttled requests, e.g. status_code="429"
+	ThrottledMatcher string `yaml:"throttled_matcher"`
+	// RemainingMetric is the gauge of requests left before throttling
+	RemainingMetric string `yaml:"remaining_metric"`
+}
+
+// withDefaults fills in the metrics that are not configured
+func (c RateLimitsConfig) withDefaults() RateLimitsConfig {
+	if c.RequestsMetric == "" {
+		c.RequestsMetric = defaultRequestsMetric
+	}
+	if c.ThrottledMatcher == "" {
+		c.ThrottledMatcher = defaultThrottledMatcher
+	}
+	if c.RemainingMetric == "" {
+		c.RemainingMetric = defaultRemainingMetric
+	}
+	return c
+}
+
+func (c RateLimitsConfig) validate() error {
+	if c.ThrottledMatcher == "" {
+		return nil
+	}
+	if _, err := parseExtraSelector(c.ThrottledMatcher); err != nil {
+		return fmt.Errorf("throttled_matcher: %w", err)
+	}
+	return nil
+}
+
+// throttled reports whether an operation gets throttling panels: it declares
+// a rate limit, or --rate-limit-panels adds them to every operation
+func (c *Config) throttled(op OperationInfo) bool {
+	if c.RateLimitPanels {
+		return true
+	}
+	_, ok := operationRateLimit(op.Operation)
+	return ok
+}
+
+// createThrottlingPanels shows the throttled requests of an operation and
+// the requests left in its rate limit window
+func createThrottlingPanels(title string, match operationMatch, metrics RateLimitsConfig, panelID, height, yPos int) []Panel {
+	return []Panel{
+		createStreamingPanel(panelID, title+" - Throttled Requests",
+			"Requests rejected by rate limiting ("+metrics.ThrottledMatcher+")", "reqps", height, yPos, []Target{
+				{
+					Expr:         promSum(promRate(match.selector(metrics.RequestsMetric).with(metrics.ThrottledMatcher)), match.by()...),
+					LegendFormat: match.legend("Throttled"),
+					RefID:        "A",
+				},
+			}),
+		createStreamingPanel(panelID+1, title+" - Rate Limit Remaining",
+			"Lowest number of requests left in the current rate limit window across clients", metricUnit(metrics.RemainingMetric), height, yPos+height, []Target{
+				{
+					Expr:         "min(" + match.selector(metrics.RemainingMetric).String() + ")",
+					LegendFormat: "Remaining",
+					RefID:        "A",
+				},
+			}),
+	}
+}
+
+// addThrottlingPanels appends a "Rate Limiting" row with a table of the
+// endpoints being throttled, when any operation gets throttling panels
+func addThrottlingPanels(dashboard *GrafanaDashboard, ops []OperationInfo, config *Config, cursor *panelCursor) {
+	throttled := false
+	for _, op := range ops {
+		throttled = throttled || config.throttled(op)
+	}
+	if !throttled {
+		return
+	}
+	metrics := config.fileConfig().RateLimits.withDefaults()
+
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Rate Limiting", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	table := createCoverageTablePanel(cursor.ID, "Endpoints Being Throttled",
+		"Requests rejected by rate limiting per endpoint in the selected time range",
+		promRangeTotals([]string{"method", "path"}, selectorOf(metrics.RequestsMetric, config.queryScope()...).with(metrics.ThrottledMatcher)),
+		cursor.Height, cursor.Y)
+	dashboard.Panels = append(dashboard.Panels, table)
+	cursor.ID++
+	cursor.Y += cursor.Height
+}
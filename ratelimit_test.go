@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const rateLimitedSpec = `openapi: 3.0.3
+info:
+  title: Limits
+  version: 1.0.0
+paths:
+  /number:
+    get:
+      x-rate-limit: 20
+      responses:
+        "200":
+          description: OK
+  /object:
+    get:
+      x-rate-limit: {limit: 600, period: 1m}
+      responses:
+        "200":
+          description: OK
+  /header:
+    get:
+      responses:
+        "200":
+          description: OK
+          headers:
+            X-RateLimit-Limit:
+              x-rate-limit-period: 1h
+              schema: {type: integer, example: 5000}
+  /string-header:
+    get:
+      responses:
+        "200":
+          description: OK
+          headers:
+            x-ratelimit-limit:
+              example: "100"
+  /invalid-period:
+    get:
+      x-rate-limit: {limit: 10, period: soon}
+      responses:
+        "200":
+          description: OK
+  /none:
+    get:
+      responses:
+        "200":
+          description: OK
+`
+
+func TestOperationRateLimit(t *testing.T) {
+	doc := loadTestSpec(t, "limits.yaml", rateLimitedSpec).Doc
+	tests := []struct {
+		path string
+		want RateLimit
+		ok   bool
+	}{
+		{"/number", RateLimit{Limit: 20, Period: time.Second}, true},
+		{"/object", RateLimit{Limit: 600, Period: time.Minute}, true},
+		{"/header", RateLimit{Limit: 5000, Period: time.Hour}, true},
+		{"/string-header", RateLimit{Limit: 100, Period: time.Second}, true},
+		{"/invalid-period", RateLimit{}, false},
+		{"/none", RateLimit{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := operationRateLimit(doc.Paths.Find(tt.path).Get)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("rate limit = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestHeadroomPanel(t *testing.T) {
+	match := operationMatch{Path: "/orders", Method: "GET", Scope: []string{`env="prod"`}}
+	panel := createHeadroomPanel("GET /orders", match, RateLimit{Limit: 600, Period: time.Minute}, 1, 8, 0)
+	want := `sum(rate(http_requests_total{path="/orders", method="GET", env="prod"}[$__rate_interval])) * 60 / 600 * 100`
+	if got := panel.Targets[0].Expr; got != want {
+		t.Errorf("expr = %s, want %s", got, want)
+	}
+	if !strings.Contains(panel.Description, "600 requests per 1m0s") {
+		t.Errorf("description = %q, want the declared limit", panel.Description)
+	}
+}
+
+func TestThrottlingPanels(t *testing.T) {
+	metrics := RateLimitsConfig{RequestsMetric: "api_requests_total", RemainingMetric: "api_ratelimit_remaining"}.withDefaults()
+	if metrics.ThrottledMatcher != defaultThrottledMatcher {
+		t.Errorf("throttled matcher = %q, want the default %s", metrics.ThrottledMatcher, defaultThrottledMatcher)
+	}
+
+	match := operationMatch{Path: "/orders", Methods: []string{"GET", "POST"}}
+	panels := createThrottlingPanels("/orders", match, metrics, 5, 8, 10)
+	tests := []struct {
+		panel, want string
+	}{
+		{panels[0].Targets[0].Expr, `sum(rate(api_requests_total{path="/orders", method=~"GET|POST", status_code="429"}[$__rate_interval])) by (method)`},
+		{panels[1].Targets[0].Expr, `min(api_ratelimit_remaining{path="/orders", method=~"GET|POST"})`},
+	}
+	for _, tt := range tests {
+		if tt.panel != tt.want {
+			t.Errorf("expr = %s, want %s", tt.panel, tt.want)
+		}
+	}
+	if panels[1].ID != 6 || panels[1].GridPos.Y != 18 {
+		t.Errorf("remaining panel at id %d, y %d, want id 6, y 18", panels[1].ID, panels[1].GridPos.Y)
+	}
+}
+
+func TestRateLimitsConfigValidate(t *testing.T) {
+	if err := (RateLimitsConfig{ThrottledMatcher: `code="429"`}).validate(); err != nil {
+		t.Errorf("valid matcher: %v", err)
+	}
+	if err := (RateLimitsConfig{ThrottledMatcher: `code=`}).validate(); err == nil || !strings.HasPrefix(err.Error(), "throttled_matcher:") {
+		t.Errorf("invalid matcher: error = %v", err)
+	}
+}
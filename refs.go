@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Policies of --remote-refs for $refs to http(s) URLs
+const (
+	remoteRefsAllow = "allow"
+	remoteRefsBlock = "block"
+)
+
+// RefOptions controls how the external $refs of a spec are resolved
+type RefOptions struct {
+	// Remote is allow or block; empty allows remote refs in remote specs only
+	Remote string
+	// BaseDir is the directory relative file refs resolve against, and which
+	// they may not leave; empty resolves them against the spec's directory
+	BaseDir string
+	// Headers are added to the requests fetching remote specs and refs
+	Headers []RefHeader
+}
+
+// RefHeader is a --ref-header, sent to Host only when set
+type RefHeader struct {
+	Host  string
+	Name  string
+	Value string
+}
+
+// parseRefHeader parses a --ref-header value, "[host=]Name: value"
+func parseRefHeader(value string) (RefHeader, error) {
+	var header RefHeader
+	name, val, ok := strings.Cut(value, ":")
+	if !ok {
+		return header, fmt.Errorf("invalid --ref-header value %q: must be \"[host=]Name: value\"", value)
+	}
+	if host, rest, scoped := strings.Cut(name, "="); scoped {
+		header.Host, name = strings.TrimSpace(host), rest
+	}
+	header.Name, header.Value = strings.TrimSpace(name), strings.TrimSpace(val)
+	if header.Name == "" || strings.ContainsAny(header.Name, " \t") {
+		return header, fmt.Errorf("invalid --ref-header value %q: must be \"[host=]Name: value\"", value)
+	}
+	return header, nil
+}
+
+// applies reports whether the header is sent to the host of a URL
+func (h RefHeader) applies(location *url.URL) bool {
+	return h.Host == "" || strings.EqualFold(h.Host, location.Host) || strings.EqualFold(h.Host, location.Hostname())
+}
+
+// setHeaders adds the headers applying to the request's host
+func (o *RefOptions) setHeaders(req *http.Request) {
+	for _, header := range o.Headers {
+		if header.applies(req.URL) {
+			req.Header.Set(header.Name, header.Value)
+		}
+	}
+}
+
+// refHeaderTransport adds the --ref-header headers to ref requests
+type refHeaderTransport struct {
+	options *RefOptions
+	base    http.RoundTripper
+}
+
+func (t *refHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	t.options.setHeaders(req)
+	return t.base.RoundTrip(req)
+}
+
+// location returns the URL the refs of a spec resolve against
+func (o *RefOptions) location(source string) *url.URL {
+	if isURL(source) {
+		location, _ := url.Parse(source)
+		return location
+	}
+	if o.BaseDir != "" {
+		source = filepath.Join(o.BaseDir, filepath.Base(source))
+	}
+	return &url.URL{Path: filepath.ToSlash(source)}
+}
+
+// reader returns the function the loader reads the external refs of a spec
+// with, enforcing the remote policy and the base directory
+func (o *RefOptions) reader(source string) openapi3.ReadFromURIFunc {
+	remote := o.Remote == remoteRefsAllow || (o.Remote == "" && isURL(source))
+	client := &http.Client{
+		Timeout:   60 * time.Second,
+		Transport: &refHeaderTransport{options: o, base: http.DefaultTransport},
+	}
+	readHTTP := openapi3.ReadFromHTTP(client)
+
+	return openapi3.URIMapCache(openapi3.ReadFromURIs(
+		func(loader *openapi3.Loader, location *url.URL) ([]byte, error) {
+			if location.Host == "" {
+				return nil, openapi3.ErrURINotSupported
+			}
+			if !remote {
+				return nil, fmt.Errorf("remote $ref %s is blocked, allow it with --remote-refs allow", location)
+			}
+			return readHTTP(loader, location)
+		},
+		func(loader *openapi3.Loader, location *url.URL) ([]byte, error) {
+			if isURL(source) {
+				// A remote spec must not read local files
+				return nil, fmt.Errorf("file $ref %s is not allowed in remote spec", location)
+			}
+			if o.BaseDir != "" && !withinDir(o.BaseDir, filepath.FromSlash(location.Path)) {
+				return nil, fmt.Errorf("file $ref %s is outside the --ref-base-dir %s", location.Path, o.BaseDir)
+			}
+			return openapi3.ReadFromFile(loader, location)
+		},
+	))
+}
+
+// withinDir reports whether path is dir or below it
+func withinDir(dir, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// refOptions returns the ref resolution options of the flags
+func (c *Config) refOptions() *RefOptions {
+	options := &RefOptions{Remote: c.RemoteRefs, BaseDir: c.RefBaseDir}
+	for _, value := range c.RefHeaders {
+		if header, err := parseRefHeader(value); err == nil {
+			options.Headers = append(options.Headers, header)
+		}
+	}
+	return options
+}
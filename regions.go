@@ -0,0 +1,115 @@
+package main
+
+import "fmt"
+
+// Variables of --multi-region, and the default labels they filter on
+const (
+	regionVariable  = "region"
+	clusterVariable = "cluster"
+)
+
+// MultiRegionConfig names the labels --multi-region panels break down by,
+// in the multi_region section of the config file
+type MultiRegionConfig struct {
+	RegionLabel  string `yaml:"region_label"`
+	ClusterLabel string `yaml:"cluster_label"`
+}
+
+// withDefaults fills in the labels that are not configured
+func (c MultiRegionConfig) withDefaults() MultiRegionConfig {
+	if c.RegionLabel == "" {
+		c.RegionLabel = regionVariable
+	}
+	if c.ClusterLabel == "" {
+		c.ClusterLabel = clusterVariable
+	}
+	return c
+}
+
+func (c MultiRegionConfig) validate() error {
+	for field, label := range map[string]string{"region_label": c.RegionLabel, "cluster_label": c.ClusterLabel} {
+		if label != "" && !labelNamePattern.MatchString(label) {
+			return fmt.Errorf("%s: %q is not a label name", field, label)
+		}
+	}
+	return nil
+}
+
+// regionVariables returns the region and cluster variables of
+// --multi-region, the cluster one chained to the selected regions
+func regionVariables(labels MultiRegionConfig) []VariableConfig {
+	return []VariableConfig{
+		{
+			Name:        regionVariable,
+			Label:       "Region",
+			Query:       fmt.Sprintf("label_values(http_requests_total, %s)", labels.RegionLabel),
+			Description: "Region filter",
+			MatchLabel:  labels.RegionLabel,
+		},
+		{
+			Name:        clusterVariable,
+			Label:       "Cluster",
+			Query:       fmt.Sprintf("label_values(%s, %s)", selectorOf("http_requests_total", fmt.Sprintf(`%s=~"$%s"`, labels.RegionLabel, regionVariable)), labels.ClusterLabel),
+			Description: "Cluster filter",
+			MatchLabel:  labels.ClusterLabel,
+		},
+	}
+}
+
+// createRegionPanels overlays the request rate, error rate and p99 latency
+// of an operation per region, followed by a table comparing the regions
+func createRegionPanels(title string, match operationMatch, labels MultiRegionConfig, panelID, height, yPos int) []Panel {
+	region := labels.RegionLabel
+	requests := match.selector("http_requests_total")
+	latency := match.selector("http_request_duration_seconds")
+	rate := promSum(promRate(requests), match.by(region)...)
+	errorRate := promPercent(promSum(promRate(requests.regex("status_code", "5..")), match.by(region)...), rate)
+	p99 := promHistogramQuantile("0.99", latency, match.by(region)...)
+	legend := match.legend("{{" + region + "}}")
+
+	table := createCoverageTablePanel(panelID+3, title+" - Region Comparison",
+		"Request rate, 5xx error rate and p99 latency of the operation per "+region, rate, height, yPos+3*height)
+	table.Targets = []Target{
+		{Expr: rate, RefID: "A", Format: "table", Instant: true},
+		{Expr: errorRate, RefID: "B", Format: "table", Instant: true},
+		{Expr: p99, RefID: "C", Format: "table", Instant: true},
+	}
+	table.Transformations = []Transformation{
+		{ID: "merge", Options: map[string]interface{}{}},
+		{
+			ID: "organize",
+			Options: map[string]interface{}{
+				"excludeByName": map[string]bool{"Time": true},
+				"indexByName":   map[string]int{region: 0, "Value #A": 1, "Value #B": 2, "Value #C": 3},
+				"renameByName":  map[string]string{region: "Region", "Value #A": "Requests", "Value #B": "Error Rate", "Value #C": "p99 Latency"},
+			},
+		},
+	}
+	unit := func(column, unit string) FieldOverride {
+		return FieldOverride{
+			Matcher:    FieldMatcher{ID: "byName", Options: column},
+			Properties: []FieldProperty{{ID: "unit", Value: unit}},
+		}
+	}
+	table.FieldConfig.Overrides = []FieldOverride{
+		unit("Requests", metricUnit("http_requests_total")),
+		unit("Error Rate", "percent"),
+		unit("p99 Latency", metricUnit("http_request_duration_seconds")),
+	}
+
+	return []Panel{
+		createStreamingPanel(panelID, title+" - Request Rate by Region", "Request rate per "+region,
+			metricUnit("http_requests_total"), height, yPos, []Target{
+				{Expr: rate, LegendFormat: legend, RefID: "A"},
+			}),
+		createStreamingPanel(panelID+1, title+" - Error Rate by Region", "5xx error rate per "+region,
+			"percent", height, yPos+height, []Target{
+				{Expr: errorRate, LegendFormat: legend, RefID: "A"},
+			}),
+		createStreamingPanel(panelID+2, title+" - Latency by Region", "p99 latency per "+region,
+			metricUnit("http_request_duration_seconds"), height, yPos+2*height, []Target{
+				{Expr: p99, LegendFormat: legend, RefID: "A"},
+			}),
+		table,
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+// buildRepeatDashboard turns a dashboard skeleton into the repeat variant:
+// instead of a panel set per operation, a single row of panels repeated by
+// Grafana for every selected value of the endpoint variable. The JSON stays
+// the same size however many paths the spec has.
+func buildRepeatDashboard(dashboard *GrafanaDashboard, config *Config) {
+	title := "${" + endpointVariable + ":text}"
+	row := createRowPanel(title, 1, 0)
+	row.Repeat = endpointVariable
+	match := operationMatch{PathPattern: "${" + endpointVariable + ":pipe}", Scope: config.queryScope()}
+	panels := createHTTPPanels(title, match, config.baseThresholds(), 2, 8, 1)
+	dashboard.Panels = append([]Panel{row}, panels...)
+}
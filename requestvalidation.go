@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Default metric of request validation panels: requests rejected with a 400,
+// labelled with the reason they failed validation
+const (
+	defaultValidationMetric        = "http_requests_total"
+	defaultValidationReasonLabel   = "reason"
+	defaultValidationStatusMatcher = `status_code="400"`
+)
+
+// RequestValidationConfig names the metric request validation panels query,
+// in the request_validation section of the config file
+type RequestValidationConfig struct {
+	Metric string `yaml:"metric"`
+	// ReasonLabel is the label carrying the validation error, e.g.
+	// validation_error
+	ReasonLabel string `yaml:"reason_label"`
+	// StatusMatcher selects the rejected requests among those of the metric;
+	// set it to "" for a metric counting validation failures only
+	StatusMatcher *string `yaml:"status_matcher"`
+}
+
+// withDefaults fills in what is not configured
+func (c RequestValidationConfig) withDefaults() RequestValidationConfig {
+	if c.Metric == "" {
+		c.Metric = defaultValidationMetric
+	}
+	if c.ReasonLabel == "" {
+		c.ReasonLabel = defaultValidationReasonLabel
+	}
+	if c.StatusMatcher == nil {
+		matcher := defaultValidationStatusMatcher
+		c.StatusMatcher = &matcher
+	}
+	return c
+}
+
+func (c RequestValidationConfig) validate() error {
+	if c.StatusMatcher == nil || *c.StatusMatcher == "" {
+		return nil
+	}
+	if _, err := parseExtraSelector(*c.StatusMatcher); err != nil {
+		return fmt.Errorf("status_matcher: %w", err)
+	}
+	return nil
+}
+
+// selector returns the selector of the rejected requests among those of s
+func (c RequestValidationConfig) selector(s promSelector) promSelector {
+	return s.with(*c.StatusMatcher)
+}
+
+// validatesRequests reports whether an operation has input to validate:
+// parameters, path ones included, or a request body
+func validatesRequests(op OperationInfo) bool {
+	return len(op.Operation.Parameters) > 0 || op.Operation.RequestBody != nil || strings.Contains(op.Path, "{")
+}
+
+// createRequestValidationPanel shows the rejected requests of an operation
+// by validation error
+func createRequestValidationPanel(title string, match operationMatch, metrics RequestValidationConfig, panelID, height, yPos int) Panel {
+	rejected := metrics.selector(match.selector(metrics.Metric))
+	return createStreamingPanel(panelID, title+" - Validation Failures",
+		"Requests rejected by request validation, by "+metrics.ReasonLabel,
+		metricUnit(metrics.Metric), height, yPos, []Target{
+			{
+				Expr:         promSum(promRate(rejected), match.by(metrics.ReasonLabel)...),
+				LegendFormat: match.legend("{{" + metrics.ReasonLabel + "}}"),
+				RefID:        "A",
+			},
+		})
+}
+
+// addRequestValidationPanels appends a "Request Validation" row with a table
+// of validation failures by endpoint and reason, when any operation has
+// input to validate
+func addRequestValidationPanels(dashboard *GrafanaDashboard, ops []OperationInfo, config *Config, cursor *panelCursor) {
+	validated := false
+	for _, op := range ops {
+		validated = validated || validatesRequests(op)
+	}
+	if !validated {
+		return
+	}
+	metrics := config.fileConfig().RequestValidation.withDefaults()
+
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Request Validation", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	table := createCoverageTablePanel(cursor.ID, "Validation Failures by Endpoint",
+		"Requests rejected by request validation per endpoint and "+metrics.ReasonLabel+" in the selected time range",
+		promRangeTotals([]string{"method", "path", metrics.ReasonLabel}, metrics.selector(selectorOf(metrics.Metric, config.queryScope()...))),
+		cursor.Height, cursor.Y)
+	dashboard.Panels = append(dashboard.Panels, table)
+	cursor.ID++
+	cursor.Y += cursor.Height
+}
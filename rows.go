@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Positions at which x-grafana-rows rows can be merged into the dashboard
+const (
+	rowPositionTop       = "top"
+	rowPositionAfterHTTP = "after-http"
+	rowPositionBottom    = "bottom"
+)
+
+// CustomRow is a row defined by spec authors through the x-grafana-rows
+// document extension
+type CustomRow struct {
+	Title     string           `json:"title"`
+	Position  string           `json:"position"`
+	Collapsed bool             `json:"collapsed"`
+	Panels    []CustomRowPanel `json:"panels"`
+	// Internal rows are left out of --public dashboards
+	Internal bool `json:"internal"`
+}
+
+// CustomRowPanel references a built-in panel factory or carries a raw panel definition
+type CustomRowPanel struct {
+	Factory string          `json:"factory"`
+	Title   string          `json:"title"`
+	Path    string          `json:"path"`
+	Method  string          `json:"method"`
+	Service string          `json:"service"`
+	Height  int             `json:"height"`
+	Raw     json.RawMessage `json:"raw"`
+	// Internal panels are left out of --public dashboards
+	Internal bool `json:"internal"`
+}
+
+// match selects the series of the HTTP operation the panel references
+func (p CustomRowPanel) match(scope []string) operationMatch {
+	return operationMatch{Path: p.Path, Method: strings.ToUpper(p.Method), Scope: scope}
+}
+
+// panelFactory builds a panel from a custom row panel reference
+type panelFactory func(p CustomRowPanel, scope []string, panelID, height, yPos int) Panel
+
+var panelFactories = map[string]panelFactory{
+	"request-rate": func(p CustomRowPanel, scope []string, id, h, y int) Panel {
+		return createRequestRatePanel(p.Title, p.match(scope), id, h, y)
+	},
+	"latency": func(p CustomRowPanel, scope []string, id, h, y int) Panel {
+		return createLatencyPanel(p.Title, p.match(scope), defaultThresholds, id, h, y)
+	},
+	"error-rate": func(p CustomRowPanel, scope []string, id, h, y int) Panel {
+		return createErrorRatePanel(p.Title, p.match(scope), defaultThresholds, id, h, y)
+	},
+	"client-error-rate": func(p CustomRowPanel, scope []string, id, h, y int) Panel {
+		return createStatusClassRatePanel(p.Title, p.match(scope), "4", defaultThresholds.ClientErrorWarning, defaultThresholds.ClientErrorCritical, id, h, y)
+	},
+	"server-error-rate": func(p CustomRowPanel, scope []string, id, h, y int) Panel {
+		return createStatusClassRatePanel(p.Title, p.match(scope), "5", defaultThresholds.ErrorWarning, defaultThresholds.ErrorCritical, id, h, y)
+	},
+	"status-classes": func(p CustomRowPanel, scope []string, id, h, y int) Panel {
+		return createStatusClassesPanel(p.Title, p.match(scope), id, h, y)
+	},
+	"throughput": func(p CustomRowPanel, scope []string, id, h, y int) Panel {
+		return createThroughputPanel(p.Title, p.match(scope), id, h, y)
+	},
+	"grpc-request-rate": func(p CustomRowPanel, scope []string, id, h, y int) Panel {
+		return createGRPCRequestPanel(p.Title, GRPCMethod{Service: p.Service, Method: p.Method}.match(scope), id, h, y)
+	},
+	"grpc-latency": func(p CustomRowPanel, scope []string, id, h, y int) Panel {
+		return createGRPCLatencyPanel(p.Title, GRPCMethod{Service: p.Service, Method: p.Method}.match(scope), defaultThresholds, id, h, y)
+	},
+}
+
+// parseCustomRows reads the x-grafana-rows extension of a spec
+func parseCustomRows(doc *openapi3.T) ([]CustomRow, error) {
+	ext, ok := doc.Extensions["x-grafana-rows"]
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(ext)
+	if err != nil {
+		return nil, err
+	}
+	var rows []CustomRow
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("invalid x-grafana-rows: %w", err)
+	}
+
+	for i, row := range rows {
+		switch row.Position {
+		case "":
+			rows[i].Position = rowPositionBottom
+		case rowPositionTop, rowPositionAfterHTTP, rowPositionBottom:
+		default:
+			return nil, fmt.Errorf("invalid x-grafana-rows position %q for row %q: must be %s, %s or %s",
+				row.Position, row.Title, rowPositionTop, rowPositionAfterHTTP, rowPositionBottom)
+		}
+	}
+	return rows, nil
+}
+
+// addCustomRows appends every custom row declared at position, without the
+// internal rows and panels when the dashboard is public
+func addCustomRows(ctx context.Context, dashboard *GrafanaDashboard, specs []LoadedSpec, position string, public bool, scope []string, cursor *panelCursor) {
+	for _, spec := range specs {
+		rows, err := parseCustomRows(spec.Doc)
+		if err != nil {
+			slog.Warn("skipping custom rows", "spec", spec.File, "error", err)
+			continue
+		}
+		for _, row := range rows {
+			if row.Position != position {
+				continue
+			}
+			if public && row.Internal {
+				slog.Debug("skipping internal custom row", "row", row.Title)
+				continue
+			}
+			if public {
+				row.Panels = slices.DeleteFunc(row.Panels, func(p CustomRowPanel) bool { return p.Internal })
+			}
+			addCustomRow(ctx, dashboard, row, scope, cursor)
+		}
+	}
+}
+
+func addCustomRow(ctx context.Context, dashboard *GrafanaDashboard, row CustomRow, scope []string, cursor *panelCursor) {
+	rowPanel := createRowPanel(row.Title, cursor.ID, cursor.Y)
+	rowPanel.Collapsed = row.Collapsed
+	cursor.ID++
+	cursor.Y++
+
+	var panels []Panel
+	for _, ref := range row.Panels {
+		panel, err := buildCustomRowPanel(ctx, ref, scope, cursor)
+		if err != nil {
+			slog.Warn("skipping panel in custom row", "row", row.Title, "error", err)
+			continue
+		}
+		panels = append(panels, panel)
+	}
+
+	// Collapsed rows carry their panels, expanded rows are followed by them
+	if row.Collapsed {
+		rowPanel.Panels = panels
+		dashboard.Panels = append(dashboard.Panels, rowPanel)
+		return
+	}
+	dashboard.Panels = append(dashboard.Panels, rowPanel)
+	dashboard.Panels = append(dashboard.Panels, panels...)
+}
+
+func buildCustomRowPanel(ctx context.Context, ref CustomRowPanel, scope []string, cursor *panelCursor) (Panel, error) {
+	height := cursor.Height
+	if ref.Height > 0 {
+		height = ref.Height
+	}
+
+	var panel Panel
+	switch {
+	case len(ref.Raw) > 0:
+		// The decoded fields place and validate the panel, the raw definition
+		// is what gets written
+		if err := json.Unmarshal(ref.Raw, &panel); err != nil {
+			return Panel{}, fmt.Errorf("invalid raw panel: %w", err)
+		}
+		if err := json.Unmarshal(ref.Raw, &panel.raw); err != nil {
+			return Panel{}, fmt.Errorf("invalid raw panel: %w", err)
+		}
+		panel.ID = cursor.ID
+		panel.fixedSize = panel.GridPos.W > 0 || panel.GridPos.H > 0
+		if panel.GridPos.H == 0 {
+			panel.GridPos.H = height
+		}
+		if panel.GridPos.W == 0 {
+			panel.GridPos.W = 24
+		}
+		panel.GridPos.Y = cursor.Y
+		if panel.Datasource == nil {
+			panel.Datasource = map[string]string{"type": "prometheus", "uid": "${datasource}"}
+		}
+		height = panel.GridPos.H
+	case ref.Factory != "":
+		factory, ok := panelFactories[ref.Factory]
+		plugin := pluginPanelFactories[ref.Factory]
+		if !ok && plugin == nil {
+			return Panel{}, &UnsupportedFeatureError{Feature: "panel factory", Value: ref.Factory}
+		}
+		if ref.Title == "" && ref.Service != "" {
+			ref.Title = fmt.Sprintf("gRPC %s/%s", ref.Service, ref.Method)
+		} else if ref.Title == "" {
+			ref.Title = fmt.Sprintf("%s %s", strings.ToUpper(ref.Method), ref.Path)
+		}
+		if plugin != nil {
+			// Plugins return raw panels, numbered and positioned as such
+			raw, err := pluginPanel(ctx, plugin, ref, cursor.ID, height, cursor.Y)
+			if err != nil {
+				return Panel{}, err
+			}
+			ref.Factory, ref.Raw = "", raw
+			return buildCustomRowPanel(ctx, ref, scope, cursor)
+		}
+		panel = factory(ref, scope, cursor.ID, height, cursor.Y)
+	default:
+		return Panel{}, fmt.Errorf("panel needs either factory or raw")
+	}
+	// Sizes given by the spec author survive the dashboard layout
+	if ref.Height > 0 {
+		panel.fixedSize = true
+	}
+
+	cursor.ID++
+	cursor.Y += height
+	return panel, nil
+}
+
+// rawJSON returns the definition of a hand-written panel with the id and
+// grid position it got on the dashboard, and the dashboard's data source
+// when it names none. Everything else is left as the author wrote it.
+func (p Panel) rawJSON() map[string]interface{} {
+	raw := make(map[string]interface{}, len(p.raw)+3)
+	maps.Copy(raw, p.raw)
+	raw["id"] = p.ID
+	raw["gridPos"] = p.GridPos
+	if raw["datasource"] == nil {
+		raw["datasource"] = p.Datasource
+	}
+	return raw
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// createRunbookPanel renders the documentation of an operation as a
+// Markdown text panel: description, parameters, expected status codes and
+// its x-runbook, which is either Markdown or a runbook URL
+func createRunbookPanel(title string, op OperationInfo, panelID, height, yPos int) Panel {
+	operation := op.Operation
+	var b strings.Builder
+	if title != "" && op.Operation.OperationID == title {
+		fmt.Fprintf(&b, "### %s\n\n`%s %s`\n\n", title, strings.ToUpper(op.Method), op.Path)
+	} else {
+		fmt.Fprintf(&b, "### %s %s\n\n", strings.ToUpper(op.Method), op.Path)
+	}
+	if operation.Description != "" {
+		b.WriteString(strings.TrimSpace(operation.Description) + "\n\n")
+	} else if operation.Summary != "" {
+		b.WriteString(operation.Summary + "\n\n")
+	}
+	if operation.Deprecated {
+		b.WriteString("**Deprecated**\n\n")
+	}
+
+	if len(operation.Parameters) > 0 {
+		b.WriteString("**Parameters**\n\n| Name | In | Required | Description |\n|---|---|---|---|\n")
+		for _, ref := range operation.Parameters {
+			if p := ref.Value; p != nil {
+				required := "no"
+				if p.Required {
+					required = "yes"
+				}
+				fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", p.Name, p.In, required, markdownCell(p.Description))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	if operation.Responses != nil && operation.Responses.Len() > 0 {
+		b.WriteString("**Responses**\n\n")
+		for _, code := range sortedMapKeys(operation.Responses.Map()) {
+			description := ""
+			if response := operation.Responses.Value(code); response != nil && response.Value != nil && response.Value.Description != nil {
+				description = " " + *response.Value.Description
+			}
+			fmt.Fprintf(&b, "- `%s`%s\n", code, description)
+		}
+		b.WriteString("\n")
+	}
+
+	if runbook := operationRunbook(operation); runbook != "" {
+		b.WriteString("**Runbook**\n\n")
+		if strings.HasPrefix(runbook, "http://") || strings.HasPrefix(runbook, "https://") {
+			fmt.Fprintf(&b, "[%s](%s)\n", runbook, runbook)
+		} else {
+			b.WriteString(strings.TrimSpace(runbook) + "\n")
+		}
+	}
+
+	return Panel{
+		ID:      panelID,
+		Title:   title + " - Runbook",
+		Type:    "text",
+		GridPos: GridPos{H: height, W: 12, X: 0, Y: yPos},
+		Options: Options{
+			Mode:    "markdown",
+			Content: strings.TrimSpace(b.String()),
+		},
+	}
+}
+
+// operationRunbook returns the x-runbook extension of an operation
+func operationRunbook(operation *openapi3.Operation) string {
+	runbook, _ := operation.Extensions[runbookExtension].(string)
+	return runbook
+}
+
+// markdownCell keeps text on one line of a Markdown table
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "|", `\|`)
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// maxDescribedFields bounds the schema fields listed in panel descriptions
+const maxDescribedFields = 8
+
+// schemaDescription summarizes what an operation takes and returns for its
+// panel descriptions: required parameters, request body fields, the fields
+// of the main success response and the error status codes. It is "" when
+// the spec says nothing about them.
+func schemaDescription(op OperationInfo) string {
+	operation := op.Operation
+	var lines []string
+
+	var required []string
+	for _, ref := range operation.Parameters {
+		if ref.Value != nil && ref.Value.Required {
+			required = append(required, fmt.Sprintf("`%s` (%s)", ref.Value.Name, ref.Value.In))
+		}
+	}
+	// Path-level parameters are not on the operation, its template has them
+	for _, name := range pathParameterPattern.FindAllString(op.Path, -1) {
+		param := fmt.Sprintf("`%s` (path)", strings.Trim(name, "{}"))
+		if !slices.Contains(required, param) {
+			required = append(required, param)
+		}
+	}
+	if len(required) > 0 {
+		lines = append(lines, "Required parameters: "+strings.Join(required, ", "))
+	}
+
+	if body := operation.RequestBody; body != nil && body.Value != nil {
+		line := "Request body"
+		if body.Value.Required {
+			line += " (required)"
+		}
+		if fields := schemaFields(mainMediaType(body.Value.Content)); len(fields) > 0 {
+			line += ": " + strings.Join(fields, ", ")
+		}
+		lines = append(lines, line)
+	}
+
+	if operation.Responses != nil {
+		var success, failures []string
+		for code := range operation.Responses.Map() {
+			switch {
+			case strings.HasPrefix(code, "2"):
+				success = append(success, code)
+			case strings.HasPrefix(code, "4"), strings.HasPrefix(code, "5"):
+				failures = append(failures, code)
+			}
+		}
+		sort.Strings(success)
+		sort.Strings(failures)
+		if len(success) > 0 {
+			response := operation.Responses.Value(success[0])
+			if response != nil && response.Value != nil {
+				if fields := schemaFields(mainMediaType(response.Value.Content)); len(fields) > 0 {
+					lines = append(lines, fmt.Sprintf("Response %s: %s", success[0], strings.Join(fields, ", ")))
+				}
+			}
+		}
+		if len(failures) > 0 {
+			lines = append(lines, "Error responses: "+strings.Join(failures, ", "))
+		}
+	}
+	for i, line := range lines {
+		// A Markdown list, Grafana renders descriptions as Markdown
+		lines[i] = "- " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mainMediaType returns the schema of the JSON media type of a content map,
+// or of the first one
+func mainMediaType(content openapi3.Content) *openapi3.SchemaRef {
+	if media := content.Get("application/json"); media != nil {
+		return media.Schema
+	}
+	for _, name := range sortedMapKeys(content) {
+		if media := content[name]; media != nil && media.Schema != nil {
+			return media.Schema
+		}
+	}
+	return nil
+}
+
+// schemaFields lists the top-level properties of an object schema, or of
+// the items of an array schema, required ones first
+func schemaFields(ref *openapi3.SchemaRef) []string {
+	if ref == nil || ref.Value == nil {
+		return nil
+	}
+	schema := ref.Value
+	if schema.Items != nil && schema.Type.Is(openapi3.TypeArray) {
+		return schemaFields(schema.Items)
+	}
+
+	properties := make(map[string]bool)
+	required := make(map[string]bool)
+	for _, part := range append([]*openapi3.SchemaRef{ref}, schema.AllOf...) {
+		if part == nil || part.Value == nil {
+			continue
+		}
+		for name := range part.Value.Properties {
+			properties[name] = true
+		}
+		for _, name := range part.Value.Required {
+			required[name] = true
+		}
+	}
+
+	names := sortedMapKeys(properties)
+	sort.SliceStable(names, func(i, j int) bool { return required[names[i]] && !required[names[j]] })
+	var fields []string
+	for _, name := range names {
+		if len(fields) == maxDescribedFields {
+			fields = append(fields, "…")
+			break
+		}
+		fields = append(fields, "`"+name+"`")
+	}
+	return fields
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of --scrape-config-format
+const (
+	scrapeFormatPrometheus = "prometheus"
+	scrapeFormatOTel       = "otel"
+)
+
+// metricsPathExtension overrides the metrics path of a spec's service
+const metricsPathExtension = "x-metrics-path"
+
+// defaultScrapeTarget stands in for specs without usable servers
+const defaultScrapeTarget = "localhost:8080"
+
+// ScrapeConfig is a Prometheus scrape_config for the service of one spec
+type ScrapeConfig struct {
+	JobName       string         `yaml:"job_name"`
+	MetricsPath   string         `yaml:"metrics_path"`
+	Scheme        string         `yaml:"scheme"`
+	StaticConfigs []StaticConfig `yaml:"static_configs"`
+}
+
+// StaticConfig lists scrape targets and the labels added to their series
+type StaticConfig struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// specScrapeConfig builds the scrape config of a spec: the job is named
+// after the service, the targets are the hosts of its non-templated servers,
+// and the service label the dashboards filter on is added to every series
+func specScrapeConfig(spec LoadedSpec) ScrapeConfig {
+	config := ScrapeConfig{
+		JobName:     spec.Service,
+		MetricsPath: "/metrics",
+		Scheme:      "http",
+	}
+	if path, ok := spec.Doc.Extensions[metricsPathExtension].(string); ok && path != "" {
+		config.MetricsPath = path
+	}
+
+	seen := make(map[string]bool)
+	var targets []string
+	for _, server := range spec.Doc.Servers {
+		u, err := url.Parse(server.URL)
+		if err != nil || u.Host == "" || strings.Contains(server.URL, "{") {
+			continue
+		}
+		if len(targets) == 0 && u.Scheme == "https" {
+			config.Scheme = "https"
+		}
+		host := u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			host += ":" + port
+		}
+		if !seen[host] {
+			seen[host] = true
+			targets = append(targets, host)
+		}
+	}
+	if len(targets) == 0 {
+		slog.Warn("spec has no server to scrape, using the default target", "spec", spec.File, "target", defaultScrapeTarget)
+		targets = []string{defaultScrapeTarget}
+	}
+
+	config.StaticConfigs = []StaticConfig{{Targets: targets, Labels: map[string]string{"service": spec.Service}}}
+	return config
+}
+
+// scrapeConfigDocument wraps the scrape configs of the specs in a Prometheus
+// configuration, or in an OpenTelemetry Collector prometheus receiver
+func scrapeConfigDocument(specs []LoadedSpec, format string) interface{} {
+	var configs []ScrapeConfig
+	for _, spec := range specs {
+		if spec.Doc != nil {
+			configs = append(configs, specScrapeConfig(spec))
+		}
+	}
+	if format == scrapeFormatOTel {
+		return map[string]interface{}{
+			"receivers": map[string]interface{}{
+				"prometheus": map[string]interface{}{
+					"config": map[string]interface{}{"scrape_configs": configs},
+				},
+			},
+		}
+	}
+	return map[string]interface{}{"scrape_configs": configs}
+}
+
+// writeScrapeConfig writes the scrape config stub of the specs
+func writeScrapeConfig(path string, specs []LoadedSpec, format string) error {
+	data, err := yaml.Marshal(scrapeConfigDocument(specs, format))
+	if err != nil {
+		return fmt.Errorf("error marshaling scrape config: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing scrape config file: %w", err)
+	}
+	return nil
+}
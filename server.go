@@ -0,0 +1,603 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxSpecSize bounds the request body accepted by /generate
+const maxSpecSize = 10 << 20
+
+// maxGeneratedDashboards bounds the dashboards of /generate kept for the
+// operation panels endpoint; the least recently generated are evicted
+const maxGeneratedDashboards = 100
+
+// ServeConfig holds the configuration for `serve` mode
+type ServeConfig struct {
+	Addr          string
+	Specs         []string
+	AuthToken     string
+	WebhookSecret string
+	Generation    *Config
+}
+
+// Server exposes dashboard generation over HTTP
+type Server struct {
+	config  *ServeConfig
+	metrics *serverMetrics
+	mux     *http.ServeMux
+	fetcher *SpecFetcher
+
+	mu sync.RWMutex
+	// managed are the dashboards of the --spec sources, regenerated by the
+	// webhook
+	managed map[string]*GrafanaDashboard
+	// generated are the dashboards of /generate, apart from the managed
+	// ones so a uid parameter cannot replace them; generatedOrder lists
+	// their UIDs from the least recently generated
+	generated      map[string]*GrafanaDashboard
+	generatedOrder []string
+}
+
+func runServe(args []string) error {
+	config, err := parseServeArgs(args)
+	if err != nil {
+		return err
+	}
+
+	// Cancelled on SIGINT/SIGTERM; request contexts derive from it so
+	// generations in flight stop instead of holding up the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := NewServer(config)
+	if len(config.Specs) > 0 && config.WebhookSecret == "" && config.AuthToken == "" {
+		slog.Warn("webhook disabled, set --webhook-secret or --auth-token to enable it")
+	}
+	if len(config.Specs) > 0 {
+		genCtx, cancel := generationContext(ctx, config.Generation)
+		input, err := loadGenerationInput(genCtx, server.fetcher, config.Specs, config.Generation)
+		if err != nil {
+			cancel()
+			return err
+		}
+		dashboard := generateDashboard(genCtx, input, config.Generation, calculateSpecHash(input.Specs))
+		cancel()
+		server.storeDashboard(&dashboard)
+	}
+
+	httpServer := &http.Server{
+		Addr:              config.Addr,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", config.Addr)
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		slog.Info("received signal, shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+func parseServeArgs(args []string) (*ServeConfig, error) {
+	config := &ServeConfig{
+		Addr:          ":8080",
+		AuthToken:     os.Getenv("OPENAPI2GRAFANA_AUTH_TOKEN"),
+		WebhookSecret: os.Getenv("OPENAPI2GRAFANA_WEBHOOK_SECRET"),
+		Generation:    defaultConfig(),
+	}
+
+	for i := 0; i < len(args); i++ {
+		if next, ok := parseGenerationFlag(config.Generation, args, i); ok {
+			i = next
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("unknown or incomplete flag %q", args[i])
+		}
+		switch args[i] {
+		case "--addr":
+			config.Addr = args[i+1]
+		case "--spec":
+			config.Specs = append(config.Specs, args[i+1])
+		case "--auth-token":
+			config.AuthToken = args[i+1]
+		case "--webhook-secret":
+			config.WebhookSecret = args[i+1]
+		default:
+			return nil, fmt.Errorf("unknown flag %q", args[i])
+		}
+		i++
+	}
+
+	if err := loadFileConfig(config.Generation); err != nil {
+		return nil, err
+	}
+	if err := validateConfig(config.Generation); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// NewServer creates the HTTP handler for serve mode
+func NewServer(config *ServeConfig) *Server {
+	s := &Server{
+		config:    config,
+		metrics:   newServerMetrics(),
+		mux:       http.NewServeMux(),
+		fetcher:   NewSpecFetcher(config.Generation.SpecCacheDir),
+		managed:   make(map[string]*GrafanaDashboard),
+		generated: make(map[string]*GrafanaDashboard),
+	}
+	s.fetcher.SkipValidation = config.Generation.SkipValidation
+	s.fetcher.Refs = config.Generation.refOptions()
+
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.HandleFunc("GET /metrics", s.metrics.handler)
+	s.mux.Handle("POST /generate", s.requireToken(http.HandlerFunc(s.handleGenerate)))
+	s.mux.HandleFunc("POST /webhook", s.handleWebhook)
+	s.mux.Handle("GET /dashboards/{uid}/panels/{operationId}", s.requireToken(http.HandlerFunc(s.handleOperationPanels)))
+	return s
+}
+
+// storeDashboard keeps a dashboard of the --spec sources for
+// handleOperationPanels, which reads it concurrently: it must not be
+// modified once stored
+func (s *Server) storeDashboard(dashboard *GrafanaDashboard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.managed[dashboard.UID] = dashboard
+}
+
+// storeGenerated keeps a dashboard of /generate like storeDashboard,
+// evicting the least recently generated one past maxGeneratedDashboards
+func (s *Server) storeGenerated(dashboard *GrafanaDashboard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.generated[dashboard.UID]; ok {
+		s.generatedOrder = slices.DeleteFunc(s.generatedOrder, func(uid string) bool { return uid == dashboard.UID })
+	} else if len(s.generatedOrder) == maxGeneratedDashboards {
+		delete(s.generated, s.generatedOrder[0])
+		s.generatedOrder = s.generatedOrder[1:]
+	}
+	s.generated[dashboard.UID] = dashboard
+	s.generatedOrder = append(s.generatedOrder, dashboard.UID)
+}
+
+// storedDashboard returns the dashboard stored under uid, the one of the
+// --spec sources when /generate used the same UID
+func (s *Server) storedDashboard(uid string) (*GrafanaDashboard, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if dashboard, ok := s.managed[uid]; ok {
+		return dashboard, true
+	}
+	dashboard, ok := s.generated[uid]
+	return dashboard, ok
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+	_, pattern := s.mux.Handler(r)
+	path := r.URL.Path
+	if pattern == "" {
+		path = "unmatched"
+	} else if _, p, ok := strings.Cut(pattern, " "); ok {
+		path = p
+	}
+
+	s.mux.ServeHTTP(rec, r)
+	s.metrics.observeRequest(path, r.Method, rec.status, time.Since(start))
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "OK")
+}
+
+// handleGenerate accepts a spec in the request body and returns the dashboard JSON.
+// The uid, title and datasource query parameters override the server defaults.
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxSpecSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+
+	spec, err := parseSpec("request", data, nil)
+	if err != nil {
+		s.metrics.incGeneration("api", "error")
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	config := *s.config.Generation
+	query := r.URL.Query()
+	if uid := query.Get("uid"); uid != "" {
+		config.DashboardUID = uid
+		config.UIDTemplate = ""
+	}
+	if title := query.Get("title"); title != "" {
+		config.DashboardTitle = title
+		config.TitleTemplate = ""
+	}
+	if datasource := query.Get("datasource"); datasource != "" {
+		config.DataSource = datasource
+	}
+
+	ctx, cancel := generationContext(r.Context(), &config)
+	defer cancel()
+	input, err := prepareGenerationInput(ctx, []LoadedSpec{spec}, &config)
+	if err != nil {
+		s.metrics.incGeneration("api", "error")
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	dashboard := generateDashboard(ctx, input, &config, calculateSpecHash(input.Specs))
+	if err := checkDashboard(&dashboard); err != nil {
+		s.metrics.incGeneration("api", "error")
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	s.storeGenerated(&dashboard)
+	s.metrics.incGeneration("api", "success")
+	writeJSON(w, http.StatusOK, dashboard)
+}
+
+// generationContext applies the configured --timeout to a request context
+func generationContext(ctx context.Context, config *Config) (context.Context, context.CancelFunc) {
+	if config.Timeout > 0 {
+		return context.WithTimeout(ctx, config.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// webhookResponse reports the outcome of a webhook-triggered regeneration
+type webhookResponse struct {
+	UID        string       `json:"uid"`
+	Title      string       `json:"title"`
+	Panels     int          `json:"panels"`
+	SpecHash   string       `json:"spec_hash"`
+	Specs      []SpecSource `json:"specs"`
+	Pushed     bool         `json:"pushed"`
+	PushError  string       `json:"push_error,omitempty"`
+	PushStatus int          `json:"push_status,omitempty"`
+	// Grafana lists the dashboards pushed, on every instance
+	Grafana []PushSummary `json:"grafana,omitempty"`
+}
+
+// handleWebhook regenerates the dashboard from the configured specs and
+// pushes it to Grafana like --push, to every configured instance. It is
+// meant to be called by the Git provider when the spec changes.
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.config.WebhookSecret == "" && s.config.AuthToken == "" {
+		writeError(w, http.StatusForbidden, errors.New("webhook disabled: set --webhook-secret or --auth-token"))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSpecSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+	if !s.authorizeWebhook(r, body) {
+		writeError(w, http.StatusUnauthorized, errors.New("invalid webhook signature or token"))
+		return
+	}
+	if len(s.config.Specs) == 0 {
+		writeError(w, http.StatusServiceUnavailable, errors.New("no --spec configured for webhook regeneration"))
+		return
+	}
+
+	config := s.config.Generation
+	ctx, cancel := generationContext(r.Context(), config)
+	defer cancel()
+	input, err := loadGenerationInput(ctx, s.fetcher, s.config.Specs, config)
+	if err != nil {
+		s.metrics.incGeneration("webhook", "error")
+		// Broken specs are the caller's problem, failing gRPC or Prometheus lookups are not
+		status := http.StatusBadGateway
+		var loadErr *SpecLoadError
+		if errors.As(err, &loadErr) {
+			status = http.StatusUnprocessableEntity
+		}
+		writeError(w, status, err)
+		return
+	}
+	specs := input.Specs
+	specHash := calculateSpecHash(specs)
+	dashboard := generateDashboard(ctx, input, config, specHash)
+	dashboards, libraryPanels := outputDashboards(dashboard, config)
+	for i := range dashboards {
+		if err := checkDashboard(&dashboards[i]); err != nil {
+			s.metrics.incGeneration("webhook", "error")
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+	s.metrics.incGeneration("webhook", "success")
+
+	resp := webhookResponse{
+		UID:      dashboard.UID,
+		Title:    dashboard.Title,
+		Panels:   len(dashboard.Panels),
+		SpecHash: specHash,
+	}
+	for _, spec := range specs {
+		resp.Specs = append(resp.Specs, spec.Source)
+	}
+
+	if config.GrafanaURL == "" && len(config.fileConfig().Instances) == 0 {
+		s.storeDashboard(&dashboard)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	summary := newRunSummary()
+	err = pushDashboards(ctx, config, dashboards, libraryPanels, "Regenerated by webhook", summary)
+	// The push resolves the data source and contact points of the panels
+	// the dashboards share with it, so it is served only once done with
+	s.storeDashboard(&dashboard)
+	resp.Grafana = summary.Pushed
+	if err != nil {
+		s.metrics.incPush("error")
+		resp.PushError = err.Error()
+		status := http.StatusBadGateway
+		var overwriteErr *OverwriteError
+		var pushErr *PushError
+		switch {
+		case errors.As(err, &overwriteErr):
+			status = http.StatusConflict
+		case errors.As(err, &pushErr):
+			resp.PushStatus = pushErr.StatusCode
+		}
+		writeJSON(w, status, resp)
+		return
+	}
+	s.metrics.incPush("success")
+	resp.Pushed = true
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// operationPanelsResponse is the panel group generated for a single operation
+type operationPanelsResponse struct {
+	OperationPanels
+	DashboardUID string   `json:"dashboardUid"`
+	Panels       []Panel  `json:"panels"`
+	EmbedURLs    []string `json:"embedUrls,omitempty"`
+}
+
+// handleOperationPanels returns the panels generated for one operation of a
+// dashboard previously generated by this server. The operation is identified
+// by operationId, or "METHOD /path" when the spec does not define one.
+func (s *Server) handleOperationPanels(w http.ResponseWriter, r *http.Request) {
+	uid := r.PathValue("uid")
+	operationID := r.PathValue("operationId")
+
+	dashboard, ok := s.storedDashboard(uid)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("dashboard %q has not been generated", uid))
+		return
+	}
+
+	group, panels, ok := dashboard.OperationPanels(operationID)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("operation %q not found in dashboard %q", operationID, uid))
+		return
+	}
+
+	resp := operationPanelsResponse{
+		OperationPanels: group,
+		DashboardUID:    uid,
+		Panels:          panels,
+	}
+	if grafanaURL := s.config.Generation.GrafanaURL; grafanaURL != "" {
+		for _, id := range group.PanelIDs {
+			resp.EmbedURLs = append(resp.EmbedURLs, fmt.Sprintf("%s/d-solo/%s/?orgId=1&panelId=%d", strings.TrimSuffix(grafanaURL, "/"), uid, id))
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// requireToken rejects requests without the configured bearer token
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.AuthToken != "" && !validBearer(r, s.config.AuthToken) {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeWebhook accepts a GitHub/Gitea HMAC signature, a GitLab token, or
+// the server bearer token. Without any secret configured nothing is
+// accepted: the webhook pushes to Grafana, it must not be open to anyone.
+func (s *Server) authorizeWebhook(r *http.Request, body []byte) bool {
+	if secret := s.config.WebhookSecret; secret != "" {
+		if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(body)
+			expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+			return hmac.Equal([]byte(sig), []byte(expected))
+		}
+		if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+			return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+		}
+	}
+
+	if s.config.AuthToken != "" {
+		return validBearer(r, s.config.AuthToken)
+	}
+	return false
+}
+
+func validBearer(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("writing response failed", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// serverMetrics is a minimal Prometheus text-format registry for the
+// server's own metrics, using the same conventions as the generated dashboards
+type serverMetrics struct {
+	mu       sync.Mutex
+	counters map[string]float64
+	help     map[string]string
+	// durations are the series of the request duration histogram, by labels
+	durations map[string]*histogram
+}
+
+// requestDurationBuckets are the upper bounds of the request duration
+// histogram, the default ones of the Prometheus client libraries
+var requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a series of a histogram: the observations per bucket, not
+// cumulative, leaving out those past the last bucket, their sum and count
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		counters:  make(map[string]float64),
+		durations: make(map[string]*histogram),
+		help: map[string]string{
+			"http_requests_total":               "Total HTTP requests handled by the server",
+			"http_request_duration_seconds":     "Time spent handling HTTP requests",
+			"openapi2grafana_generations_total": "Dashboard generations by trigger and result",
+			"openapi2grafana_pushes_total":      "Grafana dashboard pushes by result",
+		},
+	}
+}
+
+func (m *serverMetrics) add(name, labels string, v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name+"{"+labels+"}"] += v
+}
+
+func (m *serverMetrics) observeRequest(path, method string, status int, d time.Duration) {
+	labels := fmt.Sprintf(`path="%s",method="%s",service="openapi2grafana"`, path, method)
+	m.add("http_requests_total", fmt.Sprintf(`%s,status_code="%d"`, labels, status), 1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.durations[labels]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(requestDurationBuckets))}
+		m.durations[labels] = h
+	}
+	// The first bucket at or above the duration, le being inclusive
+	if i, _ := slices.BinarySearch(requestDurationBuckets, d.Seconds()); i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += d.Seconds()
+	h.count++
+}
+
+func (m *serverMetrics) incGeneration(trigger, result string) {
+	m.add("openapi2grafana_generations_total", fmt.Sprintf(`trigger="%s",result="%s"`, trigger, result), 1)
+}
+
+func (m *serverMetrics) incPush(result string) {
+	m.add("openapi2grafana_pushes_total", fmt.Sprintf(`result="%s"`, result), 1)
+}
+
+func (m *serverMetrics) handler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := make([]string, 0, len(m.counters))
+	for key := range m.counters {
+		series = append(series, key)
+	}
+	sort.Strings(series)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	lastName := ""
+	for _, key := range series {
+		name := key[:strings.Index(key, "{")]
+		if name != lastName {
+			fmt.Fprintf(w, "# HELP %s %s\n", name, m.help[name])
+			fmt.Fprintf(w, "# TYPE %s counter\n", name)
+			lastName = name
+		}
+		fmt.Fprintf(w, "%s %g\n", key, m.counters[key])
+	}
+
+	if len(m.durations) == 0 {
+		return
+	}
+	const name = "http_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s %s\n", name, m.help[name])
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, labels := range slices.Sorted(maps.Keys(m.durations)) {
+		h := m.durations[labels]
+		var cumulative uint64
+		for i, le := range requestDurationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", name, labels, le, cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, h.sum)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGrafana serves the Grafana API a push uses, recording the UIDs of the
+// dashboards pushed to it
+type fakeGrafana struct {
+	*httptest.Server
+	mu     sync.Mutex
+	pushed []string
+}
+
+func newFakeGrafana(t *testing.T) *fakeGrafana {
+	t.Helper()
+	grafana := &fakeGrafana{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/dashboards/uid/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("GET /api/datasources", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []GrafanaDataSource{{UID: "prom-uid", Name: "Prometheus", Type: "prometheus", IsDefault: true}})
+	})
+	mux.HandleFunc("GET /api/v1/provisioning/contact-points", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		writeJSON(w, http.StatusOK, []contactPoint{{UID: name + "-uid", Name: name}})
+	})
+	mux.HandleFunc("POST /api/dashboards/db", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Dashboard struct {
+				UID string `json:"uid"`
+			} `json:"dashboard"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		grafana.mu.Lock()
+		grafana.pushed = append(grafana.pushed, request.Dashboard.UID)
+		grafana.mu.Unlock()
+		writeJSON(w, http.StatusOK, PushResult{UID: request.Dashboard.UID, URL: "/d/" + request.Dashboard.UID, Status: "success", Version: 1})
+	})
+	grafana.Server = httptest.NewServer(mux)
+	t.Cleanup(grafana.Close)
+	return grafana
+}
+
+// pushedUIDs returns the UIDs pushed so far, sorted
+func (g *fakeGrafana) pushedUIDs() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Sorted(slices.Values(g.pushed))
+}
+
+// testWebhookSecret is the webhook secret of the test servers
+const testWebhookSecret = "test-secret"
+
+// webhookRequest returns a webhook call carrying testWebhookSecret as a
+// GitLab token
+func webhookRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	r.Header.Set("X-Gitlab-Token", testWebhookSecret)
+	return r
+}
+
+// TestWebhookAuthorization checks the webhook takes only the configured
+// secret or token, and nothing when there is neither. The servers have no
+// --spec, so an authorized call ends with 503.
+func TestWebhookAuthorization(t *testing.T) {
+	body := `{"ref": "refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name    string
+		config  ServeConfig
+		headers map[string]string
+		want    int
+	}{
+		{"no secret", ServeConfig{}, nil, http.StatusForbidden},
+		{"unsigned", ServeConfig{WebhookSecret: testWebhookSecret}, nil, http.StatusUnauthorized},
+		{"wrong token", ServeConfig{WebhookSecret: testWebhookSecret}, map[string]string{"X-Gitlab-Token": "guess"}, http.StatusUnauthorized},
+		{"signature", ServeConfig{WebhookSecret: testWebhookSecret}, map[string]string{"X-Hub-Signature-256": signature}, http.StatusServiceUnavailable},
+		{"gitlab token", ServeConfig{WebhookSecret: testWebhookSecret}, map[string]string{"X-Gitlab-Token": testWebhookSecret}, http.StatusServiceUnavailable},
+		{"bearer token", ServeConfig{AuthToken: "token"}, map[string]string{"Authorization": "Bearer token"}, http.StatusServiceUnavailable},
+		{"wrong bearer token", ServeConfig{AuthToken: "token"}, map[string]string{"Authorization": "Bearer guess"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Generation = defaultConfig()
+			r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			NewServer(&tt.config).ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+// TestServerMetrics checks the request durations are exported as one
+// histogram family next to the counters
+func TestServerMetrics(t *testing.T) {
+	metrics := newServerMetrics()
+	metrics.observeRequest("/healthz", "GET", http.StatusOK, 20*time.Millisecond)
+	metrics.observeRequest("/healthz", "GET", http.StatusOK, 100*time.Millisecond)
+	metrics.observeRequest("/healthz", "GET", http.StatusOK, 30*time.Second)
+
+	rec := httptest.NewRecorder()
+	metrics.handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	output := rec.Body.String()
+
+	labels := `path="/healthz",method="GET",service="openapi2grafana"`
+	for _, want := range []string{
+		"# TYPE http_requests_total counter\n",
+		"http_requests_total{" + labels + `,status_code="200"} 3` + "\n",
+		"# TYPE http_request_duration_seconds histogram\n",
+		"http_request_duration_seconds_bucket{" + labels + `,le="0.01"} 0` + "\n",
+		"http_request_duration_seconds_bucket{" + labels + `,le="0.025"} 1` + "\n",
+		"http_request_duration_seconds_bucket{" + labels + `,le="0.1"} 2` + "\n",
+		"http_request_duration_seconds_bucket{" + labels + `,le="10"} 2` + "\n",
+		"http_request_duration_seconds_bucket{" + labels + `,le="+Inf"} 3` + "\n",
+		"http_request_duration_seconds_sum{" + labels + "} 30.12\n",
+		"http_request_duration_seconds_count{" + labels + "} 3\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("metrics lack %q:\n%s", want, output)
+		}
+	}
+	if strings.Count(output, "# TYPE http_request_duration_seconds") != 1 {
+		t.Errorf("request durations are not a single family:\n%s", output)
+	}
+}
+
+// TestWebhookPushesToInstances checks the webhook pushes like --push: the
+// split dashboards, to every configured Grafana instance
+func TestWebhookPushesToInstances(t *testing.T) {
+	prod, staging := newFakeGrafana(t), newFakeGrafana(t)
+	config := defaultConfig()
+	config.SplitDir = t.TempDir()
+	config.File = &FileConfig{Instances: []GrafanaInstance{
+		{Name: "prod", URL: prod.URL},
+		{Name: "staging", URL: staging.URL, TitleSuffix: " (staging)"},
+	}}
+	server := NewServer(&ServeConfig{Specs: []string{"testdata/specs/small.yaml"}, WebhookSecret: testWebhookSecret, Generation: config})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, webhookRequest())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp webhookResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Pushed {
+		t.Fatalf("not pushed: %s", resp.PushError)
+	}
+
+	uids := prod.pushedUIDs()
+	if len(uids) < 2 || !slices.Contains(uids, resp.UID) {
+		t.Errorf("pushed %v to prod, want the overview %s and the operation dashboards", uids, resp.UID)
+	}
+	if got := staging.pushedUIDs(); !slices.Equal(got, uids) {
+		t.Errorf("pushed %v to staging, want %v as on prod", got, uids)
+	}
+	if len(resp.Grafana) != 2*len(uids) {
+		t.Errorf("response lists %d pushes, want %d", len(resp.Grafana), 2*len(uids))
+	}
+}
+
+// TestWebhookRacesOperationPanels regenerates and pushes the dashboard,
+// which resolves the contact points of its alerts, while the operation
+// panels of the stored one are read; run with go test -race
+func TestWebhookRacesOperationPanels(t *testing.T) {
+	grafana := newFakeGrafana(t)
+	config := defaultConfig()
+	config.GrafanaURL = grafana.URL
+	config.File = &FileConfig{Alerts: true, Notifications: NotificationsConfig{Default: []string{"oncall"}}}
+	server := NewServer(&ServeConfig{Specs: []string{"testdata/specs/small.yaml"}, WebhookSecret: testWebhookSecret, Generation: config})
+
+	webhook := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, webhookRequest())
+		return rec
+	}
+	rec := webhook()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp webhookResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	server.mu.RLock()
+	var key string
+	for key = range server.managed[resp.UID].operations {
+		break
+	}
+	server.mu.RUnlock()
+	panelsURL := "/dashboards/" + resp.UID + "/panels/" + url.PathEscape(key)
+
+	// Readers keep reading until every regeneration is pushed
+	var webhooks, readers sync.WaitGroup
+	done := make(chan struct{})
+	for range 4 {
+		webhooks.Add(1)
+		go func() {
+			defer webhooks.Done()
+			for range 5 {
+				if rec := webhook(); rec.Code != http.StatusOK {
+					t.Errorf("webhook status %d: %s", rec.Code, rec.Body)
+				}
+			}
+		}()
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				rec := httptest.NewRecorder()
+				server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, panelsURL, nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("panels status %d: %s", rec.Code, rec.Body)
+					return
+				}
+			}
+		}()
+	}
+	webhooks.Wait()
+	close(done)
+	readers.Wait()
+}
+
+// TestGenerateKeepsSpecDashboards checks a dashboard posted to /generate
+// under the UID of a --spec dashboard does not replace it
+func TestGenerateKeepsSpecDashboards(t *testing.T) {
+	server := NewServer(&ServeConfig{Specs: []string{"testdata/specs/small.yaml"}, WebhookSecret: testWebhookSecret, Generation: defaultConfig()})
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, webhookRequest())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", rec.Code, rec.Body)
+	}
+	var resp webhookResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	webhookDashboard, _ := server.storedDashboard(resp.UID)
+
+	spec, err := os.ReadFile("testdata/specs/large.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/generate?uid="+url.QueryEscape(resp.UID), bytes.NewReader(spec)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("generate status %d: %s", rec.Code, rec.Body)
+	}
+	if stored, _ := server.storedDashboard(resp.UID); stored != webhookDashboard {
+		t.Errorf("/generate replaced the dashboard of the --spec sources under %s", resp.UID)
+	}
+}
+
+// TestGenerateEvictsOldDashboards checks /generate keeps at most
+// maxGeneratedDashboards, evicting the least recently generated
+func TestGenerateEvictsOldDashboards(t *testing.T) {
+	server := NewServer(&ServeConfig{Generation: defaultConfig()})
+	for i := range maxGeneratedDashboards + 1 {
+		server.storeGenerated(&GrafanaDashboard{UID: fmt.Sprintf("uid-%d", i)})
+	}
+	// Generating uid-1 again makes uid-2 the least recent
+	server.storeGenerated(&GrafanaDashboard{UID: "uid-1"})
+	server.storeGenerated(&GrafanaDashboard{UID: "uid-extra"})
+
+	if len(server.generated) != maxGeneratedDashboards {
+		t.Errorf("kept %d dashboards, want %d", len(server.generated), maxGeneratedDashboards)
+	}
+	for uid, want := range map[string]bool{"uid-0": false, "uid-1": true, "uid-2": false, "uid-3": true, "uid-extra": true} {
+		if _, ok := server.storedDashboard(uid); ok != want {
+			t.Errorf("%s stored: %v, want %v", uid, ok, want)
+		}
+	}
+}
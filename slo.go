@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ThresholdConfig holds the warning and critical levels of latency (seconds)
+// and error rate (percent) panels. Error levels apply to 5xx responses,
+// client error levels to the separate 4xx panels.
+type ThresholdConfig struct {
+	LatencyWarning      float64
+	LatencyCritical     float64
+	ErrorWarning        float64
+	ErrorCritical       float64
+	ClientErrorWarning  float64
+	ClientErrorCritical float64
+}
+
+var defaultThresholds = ThresholdConfig{
+	LatencyWarning:      0.5,
+	LatencyCritical:     1.0,
+	ErrorWarning:        1,
+	ErrorCritical:       5,
+	ClientErrorWarning:  10,
+	ClientErrorCritical: 25,
+}
+
+// minBudgetTightening bounds how far thresholds tighten as the budget runs out
+const minBudgetTightening = 0.25
+
+// ErrorBudget is the state of an operation's error budget over the SLO window
+type ErrorBudget struct {
+	ErrorRatio float64
+	// Remaining is the fraction of the budget left; negative once exhausted
+	Remaining float64
+}
+
+// fetchErrorBudgets queries the error ratio of every operation over the SLO
+// window, within scope (see Config.liveScope), and derives how much of the
+// error budget is left, keyed by "METHOD path"
+func fetchErrorBudgets(ctx context.Context, client *PrometheusClient, target float64, window string, scope []string) (map[string]ErrorBudget, error) {
+	requests := selectorOf("http_requests_total", scope...)
+	by := []string{"path", "method"}
+	query := promSumBy(by, promOverTime("rate", requests.regex("status_code", "5.."), window)) + " / " + promSumBy(by, promOverTime("rate", requests, window))
+	samples, err := client.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := 1 - target/100
+	budgets := make(map[string]ErrorBudget, len(samples))
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) {
+			continue
+		}
+		key := strings.ToUpper(sample.Labels["method"]) + " " + sample.Labels["path"]
+		budgets[key] = ErrorBudget{
+			ErrorRatio: sample.Value,
+			Remaining:  1 - sample.Value/allowed,
+		}
+	}
+	return budgets, nil
+}
+
+// sloThresholds derives thresholds from an SLO target (percent, e.g. 99.9):
+// the error rate turns red when the whole budget is being consumed and
+// yellow at half of it. When the current budget is known, all levels are
+// tightened in proportion to the budget left, down to a quarter of their
+// base value once it is exhausted.
+func sloThresholds(base ThresholdConfig, target float64, budget *ErrorBudget) ThresholdConfig {
+	allowedPercent := 100 - target
+	// Client errors do not consume the budget and keep their base levels
+	thresholds := base
+	thresholds.ErrorWarning = allowedPercent / 2
+	thresholds.ErrorCritical = allowedPercent
+
+	factor := 1.0
+	if budget != nil {
+		factor = math.Max(minBudgetTightening, math.Min(1, budget.Remaining))
+	}
+	thresholds.LatencyWarning = roundThreshold(thresholds.LatencyWarning * factor)
+	thresholds.LatencyCritical = roundThreshold(thresholds.LatencyCritical * factor)
+	thresholds.ErrorWarning = roundThreshold(thresholds.ErrorWarning * factor)
+	thresholds.ErrorCritical = roundThreshold(thresholds.ErrorCritical * factor)
+	return thresholds
+}
+
+// roundThreshold keeps float noise (100-99.9) out of the dashboard JSON
+func roundThreshold(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// createLatencyAlert builds an alert firing when p99 latency (refId A of
+// the latency panel) stays above the critical threshold
+func createLatencyAlert(title string, thresholds ThresholdConfig, query Target) *Alert {
+	return &Alert{
+		Name:      title + " - p99 latency",
+		Message:   fmt.Sprintf("%s p99 latency above %gs", title, thresholds.LatencyCritical),
+		Frequency: "1m",
+		For:       "5m",
+		Conditions: []AlertCondition{
+			{
+				Evaluator: AlertEvaluator{Params: []float64{thresholds.LatencyCritical}, Type: "gt"},
+				Operator:  AlertOperator{Type: "and"},
+				Query:     AlertQuery{Model: query, Params: []string{query.RefID, "5m", "now"}},
+				Reducer:   AlertReducer{Params: []string{}, Type: "avg"},
+				Type:      "query",
+			},
+		},
+		ExecutionErrorState: "alerting",
+		NoDataState:         "no_data",
+		Notifications:       []AlertNotification{},
+	}
+}
+
+// createErrorRateAlert builds an alert firing when the 5xx error rate
+// (refId A of the error rate panel) stays above the critical threshold
+func createErrorRateAlert(title string, thresholds ThresholdConfig, query Target) *Alert {
+	return &Alert{
+		Name:      title + " - error rate",
+		Message:   fmt.Sprintf("%s 5xx error rate above %g%%", title, thresholds.ErrorCritical),
+		Frequency: "1m",
+		For:       "5m",
+		Conditions: []AlertCondition{
+			{
+				Evaluator: AlertEvaluator{Params: []float64{thresholds.ErrorCritical}, Type: "gt"},
+				Operator:  AlertOperator{Type: "and"},
+				Query:     AlertQuery{Model: query, Params: []string{query.RefID, "5m", "now"}},
+				Reducer:   AlertReducer{Params: []string{}, Type: "avg"},
+				Type:      "query",
+			},
+		},
+		ExecutionErrorState: "alerting",
+		NoDataState:         "no_data",
+		Notifications:       []AlertNotification{},
+	}
+}
+
+// budgetDescription summarises the budget state for panel descriptions
+func budgetDescription(target float64, budget *ErrorBudget) string {
+	if budget == nil {
+		return fmt.Sprintf("SLO %g%%", target)
+	}
+	return fmt.Sprintf("SLO %g%%, %.0f%% of error budget left at generation", target, math.Max(0, budget.Remaining)*100)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestSLOThresholds(t *testing.T) {
+	tests := []struct {
+		name   string
+		target float64
+		budget *ErrorBudget
+		want   ThresholdConfig
+	}{
+		{
+			name:   "no budget",
+			target: 99.9,
+			want:   ThresholdConfig{LatencyWarning: 0.5, LatencyCritical: 1, ErrorWarning: 0.05, ErrorCritical: 0.1, ClientErrorWarning: 10, ClientErrorCritical: 25},
+		},
+		{
+			name:   "half the budget left",
+			target: 99,
+			budget: &ErrorBudget{Remaining: 0.5},
+			want:   ThresholdConfig{LatencyWarning: 0.25, LatencyCritical: 0.5, ErrorWarning: 0.25, ErrorCritical: 0.5, ClientErrorWarning: 10, ClientErrorCritical: 25},
+		},
+		{
+			name:   "budget exhausted",
+			target: 99,
+			budget: &ErrorBudget{Remaining: -2},
+			want:   ThresholdConfig{LatencyWarning: 0.125, LatencyCritical: 0.25, ErrorWarning: 0.125, ErrorCritical: 0.25, ClientErrorWarning: 10, ClientErrorCritical: 25},
+		},
+		{
+			name:   "budget untouched",
+			target: 99,
+			budget: &ErrorBudget{Remaining: 1},
+			want:   ThresholdConfig{LatencyWarning: 0.5, LatencyCritical: 1, ErrorWarning: 0.5, ErrorCritical: 1, ClientErrorWarning: 10, ClientErrorCritical: 25},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sloThresholds(defaultThresholds, tt.target, tt.budget); got != tt.want {
+				t.Errorf("thresholds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchErrorBudgets(t *testing.T) {
+	prometheus := newFakePrometheus(t, []map[string]interface{}{
+		promSample("0.0005", "method", "get", "path", "/orders"),
+		promSample("0.002", "method", "POST", "path", "/orders"),
+		promSample("NaN", "method", "GET", "path", "/idle"),
+	})
+	budgets, err := fetchErrorBudgets(context.Background(), NewPrometheusClient(prometheus.URL), 99.9, "30d", []string{`namespace="shop"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `sum by (path, method) (rate(http_requests_total{namespace="shop", status_code=~"5.."}[30d])) / sum by (path, method) (rate(http_requests_total{namespace="shop"}[30d]))`
+	if got := prometheus.lastQuery(); got != want {
+		t.Errorf("query = %s, want %s", got, want)
+	}
+	if len(budgets) != 2 {
+		t.Fatalf("budgets = %v, want GET and POST /orders", budgets)
+	}
+	if got := budgets["GET /orders"].Remaining; math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("GET /orders budget left = %g, want 0.5", got)
+	}
+	if got := budgets["POST /orders"].Remaining; math.Abs(got+1) > 1e-9 {
+		t.Errorf("POST /orders budget left = %g, want -1", got)
+	}
+}
+
+func TestBudgetDescription(t *testing.T) {
+	if got, want := budgetDescription(99.9, nil), "SLO 99.9%"; got != want {
+		t.Errorf("description = %q, want %q", got, want)
+	}
+	if got, want := budgetDescription(99.9, &ErrorBudget{Remaining: -0.5}), "SLO 99.9%, 0% of error budget left at generation"; got != want {
+		t.Errorf("description = %q, want %q", got, want)
+	}
+}
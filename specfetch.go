@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SpecSource describes where a loaded spec came from, for generation reports
+type SpecSource struct {
+	Source       string `json:"source"`
+	Version      string `json:"version,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	NotModified  bool   `json:"not_modified"`
+}
+
+// SpecFetcher reads spec files and URLs. Remote specs are fetched with
+// If-None-Match/If-Modified-Since against a local cache, and unchanged specs
+// reuse the document parsed on a previous load instead of being re-parsed.
+type SpecFetcher struct {
+	CacheDir   string
+	HTTPClient *http.Client
+	// SkipValidation parses specs without validating them first
+	SkipValidation bool
+	// Refs controls the resolution of external $refs, refused when nil
+	Refs *RefOptions
+
+	mu     sync.Mutex
+	parsed map[string]LoadedSpec
+}
+
+// specCacheEntry is the on-disk validator record stored next to a cached spec body
+type specCacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// NewSpecFetcher creates a fetcher caching remote specs in cacheDir. An empty
+// cacheDir selects the user cache directory; caching on disk is skipped when
+// none is available.
+func NewSpecFetcher(cacheDir string) *SpecFetcher {
+	if cacheDir == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(dir, "openapi2grafana", "specs")
+		}
+	}
+	return &SpecFetcher{
+		CacheDir:   cacheDir,
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+		parsed:     make(map[string]LoadedSpec),
+		Refs:       &RefOptions{},
+	}
+}
+
+// stdinSource reads a spec from standard input
+const stdinSource = "-"
+
+// Load reads and parses one spec source
+func (f *SpecFetcher) Load(ctx context.Context, source string) (LoadedSpec, error) {
+	if !isURL(source) {
+		var data []byte
+		var err error
+		if source == stdinSource {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(source)
+		}
+		if err != nil {
+			return LoadedSpec{}, &SpecLoadError{Source: source, Op: "reading OpenAPI spec", Err: err}
+		}
+		spec, err := f.parse(source, data)
+		if err != nil {
+			return LoadedSpec{}, err
+		}
+		spec.Source = SpecSource{Source: source, Version: specVersion(spec)}
+		return spec, nil
+	}
+
+	data, entry, notModified, err := f.fetch(ctx, source)
+	if err != nil {
+		loadErr := &SpecLoadError{Source: source, Op: "fetching OpenAPI spec", Err: err}
+		var statusErr *fetchStatusError
+		if errors.As(err, &statusErr) {
+			loadErr.StatusCode = statusErr.StatusCode
+		}
+		return LoadedSpec{}, loadErr
+	}
+
+	f.mu.Lock()
+	cached, ok := f.parsed[source]
+	f.mu.Unlock()
+
+	var spec LoadedSpec
+	if ok && bytes.Equal(cached.Data, data) {
+		spec = cached
+	} else {
+		if spec, err = f.parse(source, data); err != nil {
+			return LoadedSpec{}, err
+		}
+		f.mu.Lock()
+		f.parsed[source] = spec
+		f.mu.Unlock()
+	}
+
+	spec.Source = SpecSource{
+		Source:       source,
+		Version:      specVersion(spec),
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+		NotModified:  notModified,
+	}
+	return spec, nil
+}
+
+// fetch performs a conditional GET, returning the cached body on 304
+func (f *SpecFetcher) fetch(ctx context.Context, source string) ([]byte, specCacheEntry, bool, error) {
+	entry, cachedBody := f.readCache(source)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, entry, false, err
+	}
+	if f.Refs != nil {
+		f.Refs.setHeaders(req)
+	}
+	if cachedBody != nil {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := f.HTTPClient.Do(req)
+	if err != nil {
+		return nil, entry, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cachedBody != nil:
+		return cachedBody, entry, true, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, entry, false, &fetchStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, entry, false, err
+	}
+
+	entry = specCacheEntry{
+		URL:          source,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+	}
+	f.writeCache(source, entry, body)
+	return body, entry, false, nil
+}
+
+func (f *SpecFetcher) cachePaths(source string) (meta, body string) {
+	sum := sha256.Sum256([]byte(source))
+	base := filepath.Join(f.CacheDir, hex.EncodeToString(sum[:16]))
+	return base + ".json", base + ".spec"
+}
+
+func (f *SpecFetcher) readCache(source string) (specCacheEntry, []byte) {
+	var entry specCacheEntry
+	if f.CacheDir == "" {
+		return entry, nil
+	}
+
+	metaPath, bodyPath := f.cachePaths(source)
+	meta, err := os.ReadFile(metaPath)
+	if err != nil || json.Unmarshal(meta, &entry) != nil || entry.URL != source {
+		return specCacheEntry{}, nil
+	}
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return specCacheEntry{}, nil
+	}
+	return entry, body
+}
+
+// writeCache stores the body and validators; failures only cost a refetch
+func (f *SpecFetcher) writeCache(source string, entry specCacheEntry, body []byte) {
+	if f.CacheDir == "" || (entry.ETag == "" && entry.LastModified == "") {
+		return
+	}
+	if err := os.MkdirAll(f.CacheDir, 0755); err != nil {
+		return
+	}
+
+	metaPath, bodyPath := f.cachePaths(source)
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if os.WriteFile(bodyPath, body, 0644) == nil {
+		_ = os.WriteFile(metaPath, meta, 0644)
+	}
+}
+
+func specVersion(spec LoadedSpec) string {
+	if spec.Doc.Info != nil {
+		return spec.Doc.Info.Version
+	}
+	return ""
+}
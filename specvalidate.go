@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v3"
+)
+
+// pathParameterPattern finds the {parameter} segments of a path template
+var pathParameterPattern = regexp.MustCompile(`\{[^}]*\}`)
+
+// specMethods are the keys of a path item that are operations
+var specMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// SpecIssue is a problem found in a spec, located by JSON pointer and, when
+// known, line
+type SpecIssue struct {
+	Line    int    `json:"line,omitempty"`
+	Pointer string `json:"pointer,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i SpecIssue) String() string {
+	location := i.Pointer
+	if i.Line > 0 {
+		location = fmt.Sprintf("line %d %s", i.Line, i.Pointer)
+	}
+	if location == "" {
+		return i.Message
+	}
+	return fmt.Sprintf("%s: %s", strings.TrimSpace(location), i.Message)
+}
+
+// SpecValidationError lists every problem of a spec that failed validation
+type SpecValidationError struct {
+	Issues []SpecIssue
+}
+
+func (e *SpecValidationError) Error() string {
+	messages := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		messages[i] = issue.String()
+	}
+	noun := "problems"
+	if len(e.Issues) == 1 {
+		noun = "problem"
+	}
+	return fmt.Sprintf("%d %s: %s", len(e.Issues), noun, strings.Join(messages, "; "))
+}
+
+// specValidator collects the problems of one spec, walking its YAML (or
+// JSON) node tree for line numbers
+type specValidator struct {
+	root   *yaml.Node
+	issues []SpecIssue
+}
+
+func (v *specValidator) report(node *yaml.Node, pointer, format string, args ...interface{}) {
+	issue := SpecIssue{Pointer: pointer, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		issue.Line = node.Line
+	}
+	v.issues = append(v.issues, issue)
+}
+
+// validateSpec checks a spec in one pass: duplicate keys, unresolved local
+// $refs, conflicting paths, duplicate operationIds and, when the loader
+// parsed it, the OpenAPI validation of each part of the document
+func validateSpec(data []byte, doc *openapi3.T) []SpecIssue {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil || len(document.Content) == 0 {
+		// Not YAML or JSON at all, the loader error says it best
+		return nil
+	}
+	v := &specValidator{root: document.Content[0]}
+	v.walk(v.root, "")
+	v.checkPaths()
+	if doc != nil {
+		v.checkDocument(doc)
+	}
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		return v.issues[i].Line < v.issues[j].Line
+	})
+	return v.issues
+}
+
+// walk reports duplicate keys and unresolved local $refs under node
+func (v *specValidator) walk(node *yaml.Node, pointer string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		seen := make(map[string]*yaml.Node)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			child := pointer + "/" + escapePointer(key.Value)
+			if first, ok := seen[key.Value]; ok {
+				v.report(key, child, "duplicate key %q, first defined on line %d", key.Value, first.Line)
+			}
+			seen[key.Value] = key
+			if key.Value == "$ref" && value.Kind == yaml.ScalarNode && strings.HasPrefix(value.Value, "#") {
+				if v.resolve(value.Value) == nil {
+					v.report(value, pointer, "unresolved $ref %q", value.Value)
+				}
+			}
+			v.walk(value, child)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			v.walk(item, pointer+"/"+strconv.Itoa(i))
+		}
+	}
+}
+
+// resolve returns the node a local $ref or JSON pointer points to, nil when
+// there is none
+func (v *specValidator) resolve(ref string) *yaml.Node {
+	pointer := strings.TrimPrefix(ref, "#")
+	node := v.root
+	if pointer == "" {
+		return node
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		node = childNode(node, token)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// childNode returns the value of a mapping key or sequence index
+func childNode(node *yaml.Node, token string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// checkPaths reports paths matching the same requests, such as /items/{id}
+// and /items/{itemId}, and operationIds used by several operations
+func (v *specValidator) checkPaths() {
+	paths := childNode(v.root, "paths")
+	if paths == nil || paths.Kind != yaml.MappingNode {
+		return
+	}
+	templates := make(map[string]*yaml.Node)
+	operationIDs := make(map[string]string)
+	for i := 0; i+1 < len(paths.Content); i += 2 {
+		key, item := paths.Content[i], paths.Content[i+1]
+		pointer := "/paths/" + escapePointer(key.Value)
+		template := pathParameterPattern.ReplaceAllString(key.Value, "{}")
+		if first, ok := templates[template]; ok && first.Value != key.Value {
+			v.report(key, pointer, "path %q conflicts with %q on line %d, both match the same requests", key.Value, first.Value, first.Line)
+		} else if !ok {
+			templates[template] = key
+		}
+
+		for _, method := range specMethods {
+			operation := childNode(item, method)
+			if operation == nil {
+				continue
+			}
+			id := childNode(operation, "operationId")
+			if id == nil || id.Value == "" {
+				continue
+			}
+			name := strings.ToUpper(method) + " " + key.Value
+			if first, ok := operationIDs[id.Value]; ok {
+				v.report(id, pointer+"/"+method+"/operationId", "duplicate operationId %q, also used by %s", id.Value, first)
+				continue
+			}
+			operationIDs[id.Value] = fmt.Sprintf("%s (line %d)", name, id.Line)
+		}
+	}
+}
+
+// checkDocument runs the OpenAPI validation of every part of a loaded
+// document separately, so a problem in one path does not hide the others
+func (v *specValidator) checkDocument(doc *openapi3.T) {
+	ctx := openapi3.WithValidationOptions(context.Background(), openapi3.AllowExtraSiblingFields("webhooks"))
+	check := func(pointer string, err error) {
+		if err != nil {
+			v.report(v.resolve(pointer), pointer, "%v", err)
+		}
+	}
+
+	if doc.Components != nil {
+		check("/components", doc.Components.Validate(ctx))
+	}
+	if doc.Info == nil {
+		check("/info", fmt.Errorf("info is required"))
+	} else {
+		check("/info", doc.Info.Validate(ctx))
+	}
+	if doc.Paths != nil {
+		for _, path := range sortedMapKeys(doc.Paths.Map()) {
+			item := doc.Paths.Value(path)
+			if item == nil {
+				continue
+			}
+			// A document of one path checks its parameters against the template
+			single := openapi3.NewPaths(openapi3.WithPath(path, item))
+			check("/paths/"+escapePointer(path), single.Validate(ctx))
+		}
+	}
+	if doc.Security != nil {
+		check("/security", doc.Security.Validate(ctx))
+	}
+	if doc.Servers != nil {
+		check("/servers", doc.Servers.Validate(ctx))
+	}
+	if doc.Tags != nil {
+		check("/tags", doc.Tags.Validate(ctx))
+	}
+}
+
+// parse parses raw spec data and, unless validation is skipped, validates
+// OpenAPI specs, reporting all their problems at once rather than the first
+// one the loader fails on
+func (f *SpecFetcher) parse(source string, data []byte) (LoadedSpec, error) {
+	spec, err := parseSpec(source, data, f.Refs)
+	var unsupported *UnsupportedFeatureError
+	if f.SkipValidation || spec.Async != nil || errors.As(err, &unsupported) {
+		return spec, err
+	}
+	// A loader error no problem explains is reported as is
+	if issues := validateSpec(data, spec.Doc); len(issues) > 0 {
+		return LoadedSpec{}, &SpecLoadError{Source: source, Op: "validating OpenAPI spec", Err: &SpecValidationError{Issues: issues}}
+	}
+	return spec, err
+}
+
+// escapePointer escapes a JSON pointer token
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DataLink is a link on the values of a panel field
+type DataLink struct {
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	TargetBlank bool   `json:"targetBlank,omitempty"`
+}
+
+// Grafana limits dashboard UIDs to 40 characters
+const maxUIDLength = 40
+
+// Overview panels are laid out in a grid of this many columns
+const overviewColumns = 3
+
+// splitDashboard splits a generated dashboard into an overview and one
+// detail dashboard per operation. The overview keeps the UID of the full
+// dashboard and shows the first panel of every operation, with a data link
+// to the operation's detail dashboard carrying the time range and variables;
+// panels not belonging to an operation (gRPC, custom rows, coverage) stay on
+// the overview below the grid. Detail dashboards link back to the overview.
+func splitDashboard(full GrafanaDashboard) (GrafanaDashboard, []GrafanaDashboard) {
+	owner := make(map[int]OperationPanels)
+	for _, group := range full.operations {
+		for _, id := range group.PanelIDs {
+			owner[id] = group
+		}
+	}
+
+	overview := full
+	overview.Panels = nil
+	overview.operations = nil
+
+	var details []GrafanaDashboard
+	var rest []Panel
+	seen := make(map[string]bool)
+	for _, panel := range full.Panels {
+		group, ok := owner[panel.ID]
+		if !ok {
+			rest = append(rest, panel)
+			continue
+		}
+		if seen[group.Key] {
+			continue
+		}
+		seen[group.Key] = true
+
+		_, panels, _ := full.OperationPanels(group.Key)
+		detail := newDetailDashboard(full, group, panels)
+		details = append(details, detail)
+
+		i := len(details) - 1
+		link := panels[0]
+		link.ID = i + 1
+		link.Alert = nil
+		link.GridPos = GridPos{H: 8, W: 24 / overviewColumns, X: (i % overviewColumns) * (24 / overviewColumns), Y: (i / overviewColumns) * 8}
+		link.FieldConfig.Defaults.Links = []DataLink{
+			{
+				Title: detailName(group) + " details",
+				URL:   "/d/" + detail.UID + "?${__url_time_range}&${service:queryparam}&${datasource:queryparam}",
+			},
+		}
+		overview.Panels = append(overview.Panels, link)
+	}
+
+	// Keep the remaining panels in their original order below the grid
+	y := (len(details) + overviewColumns - 1) / overviewColumns * 8
+	id := len(details) + 1
+	offset := 0
+	if len(rest) > 0 {
+		offset = rest[0].GridPos.Y
+	}
+	for _, panel := range rest {
+		panel.ID = id
+		panel.GridPos.Y = panel.GridPos.Y - offset + y
+		overview.Panels = append(overview.Panels, panel)
+		id++
+	}
+	return overview, details
+}
+
+// newDetailDashboard builds the detail dashboard of one operation
+func newDetailDashboard(full GrafanaDashboard, group OperationPanels, panels []Panel) GrafanaDashboard {
+	detail := full
+	detail.UID = detailUID(full.UID, group.Key)
+	detail.Title = fmt.Sprintf("%s - %s", full.Title, detailName(group))
+	detail.Tags = append(append([]string{}, full.Tags...), "endpoint")
+	detail.Links = append(append([]Link{}, full.Links...), Link{
+		Icon:        "dashboard",
+		IncludeVars: true,
+		KeepTime:    true,
+		Tags:        []string{},
+		Title:       full.Title,
+		Type:        "link",
+		URL:         "/d/" + full.UID,
+	})
+
+	detail.Panels = make([]Panel, len(panels))
+	offset := panels[0].GridPos.Y
+	for i, panel := range panels {
+		panel.GridPos.Y -= offset
+		detail.Panels[i] = panel
+	}
+	detail.operations = map[string]OperationPanels{group.Key: group}
+	return detail
+}
+
+// detailName names the detail dashboard of an operation like its panels
+func detailName(group OperationPanels) string {
+	if group.Title != "" {
+		return group.Title
+	}
+	return group.Method + " " + group.Path
+}
+
+// detailUID derives a stable UID within Grafana's length limit for an operation
+func detailUID(uid, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	suffix := hex.EncodeToString(sum[:4])
+	if len(uid) > maxUIDLength-len(suffix)-1 {
+		uid = uid[:maxUIDLength-len(suffix)-1]
+	}
+	return uid + "-" + suffix
+}
+
+// writeSplitDashboards writes the overview and detail dashboards into dir,
+// one file per dashboard named after its UID
+func writeSplitDashboards(ctx context.Context, dir string, overview GrafanaDashboard, details []GrafanaDashboard, encoding string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	var files []string
+	for _, dashboard := range append([]GrafanaDashboard{overview}, details...) {
+		path := filepath.Join(dir, dashboard.UID+outputExtension(encoding))
+		if err := writeDashboardFile(ctx, path, dashboard, encoding); err != nil {
+			return nil, err
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import "fmt"
+
+// createStalePanel counts the requests an operation received over the
+// stale window and turns red when there were none, flagging broken routing
+// or dead code. RefId B, hidden, is the absent_over_time query the
+// no-traffic alert evaluates.
+func createStalePanel(title string, match operationMatch, window string, panelID, height, yPos int) Panel {
+	requests := match.selector("http_requests_total")
+	return Panel{
+		ID:         panelID,
+		Title:      fmt.Sprintf("%s - Requests (%s)", title, window),
+		Type:       "stat",
+		Datasource: map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		GridPos:    GridPos{H: height, W: 6, X: 0, Y: yPos},
+		Targets: []Target{
+			{
+				Expr:         promSum(promOverTime("increase", requests, window), match.by()...) + " or vector(0)",
+				LegendFormat: match.legend("Requests"),
+				RefID:        "A",
+				Instant:      true,
+			},
+			{
+				Expr:         promOverTime("absent_over_time", requests, window),
+				LegendFormat: "No traffic",
+				RefID:        "B",
+				Hide:         true,
+			},
+		},
+		Options: Options{
+			ReduceOptions: ReduceOptions{
+				Values: false,
+				Fields: "",
+				Calcs:  []string{"lastNotNull"},
+			},
+			Orientation: "auto",
+			Text: TextOptions{
+				TitleSize: 10,
+				ValueSize: 18,
+			},
+			ShowThresholdLabels:  false,
+			ShowThresholdMarkers: true,
+		},
+		FieldConfig: FieldConfig{
+			Defaults: FieldConfigDefaults{
+				Color: ColorOptions{Mode: "thresholds"},
+				Unit:  "short",
+				Min:   floatPtr(0),
+				Thresholds: ThresholdOptions{
+					Mode: "absolute",
+					Steps: []ThresholdStep{
+						{Color: "red", Value: nil},
+						{Color: "green", Value: floatPtr(1)},
+					},
+				},
+			},
+		},
+		Description: fmt.Sprintf("Requests over the last %s; red when the endpoint received none", window),
+	}
+}
+
+// createNoTrafficAlert builds an alert firing when the operation received
+// no requests over the stale window, i.e. when the absent_over_time query
+// (refId B of the stale panel) returns a series
+func createNoTrafficAlert(title, window string, query Target) *Alert {
+	return &Alert{
+		Name:      title + " - no traffic",
+		Message:   fmt.Sprintf("%s received no requests in the last %s", title, window),
+		Frequency: "5m",
+		For:       "0m",
+		Conditions: []AlertCondition{
+			{
+				Evaluator: AlertEvaluator{Params: []float64{0}, Type: "gt"},
+				Operator:  AlertOperator{Type: "and"},
+				Query:     AlertQuery{Model: query, Params: []string{query.RefID, "5m", "now"}},
+				Reducer:   AlertReducer{Params: []string{}, Type: "last"},
+				Type:      "query",
+			},
+		},
+		ExecutionErrorState: "alerting",
+		// absent_over_time returns nothing while the operation has traffic
+		NoDataState:   "ok",
+		Notifications: []AlertNotification{},
+	}
+}
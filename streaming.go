@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Stream protocols recognised on operations holding long-lived connections
+const (
+	streamProtocolWebSocket = "websocket"
+	streamProtocolSSE       = "sse"
+)
+
+// streamProtocol reports whether an operation serves a WebSocket or
+// Server-Sent Events stream. Operations are recognised by an x-websocket or
+// x-sse extension, a 101 Switching Protocols response or an Upgrade header
+// parameter (WebSocket), or a text/event-stream response (SSE).
+func streamProtocol(operation *openapi3.Operation) string {
+	if isTruthy(operation.Extensions["x-websocket"]) {
+		return streamProtocolWebSocket
+	}
+	if isTruthy(operation.Extensions["x-sse"]) {
+		return streamProtocolSSE
+	}
+
+	for _, param := range operation.Parameters {
+		if param.Value != nil && param.Value.In == openapi3.ParameterInHeader && strings.EqualFold(param.Value.Name, "Upgrade") {
+			return streamProtocolWebSocket
+		}
+	}
+
+	if operation.Responses == nil {
+		return ""
+	}
+	if operation.Responses.Status(101) != nil {
+		return streamProtocolWebSocket
+	}
+	for _, response := range operation.Responses.Map() {
+		if response.Value == nil {
+			continue
+		}
+		if response.Value.Content.Get("text/event-stream") != nil {
+			return streamProtocolSSE
+		}
+	}
+	return ""
+}
+
+func isTruthy(v interface{}) bool {
+	switch value := v.(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	case map[string]interface{}:
+		return true
+	}
+	return false
+}
+
+// createStreamingPanels builds connection-oriented panels for a streaming endpoint
+func createStreamingPanels(title, path, protocol string, scope []string, panelID, height, yPos int) []Panel {
+	stream := func(metric string) promSelector {
+		return selectorOf(metric).eq("path", path).eq("protocol", protocol).with(scope...)
+	}
+
+	return []Panel{
+		createStreamingPanel(panelID, title+" - Active Connections", "Currently open "+protocol+" connections", metricUnit("stream_connections_active"), height, yPos, []Target{
+			{
+				Expr:         promSum(stream("stream_connections_active").String()),
+				LegendFormat: "Connections",
+				RefID:        "A",
+			},
+		}),
+		createStreamingPanel(panelID+1, title+" - Message Rate", "Messages per second by direction", metricUnit("stream_messages_total"), height, yPos+height, []Target{
+			{
+				Expr:         promSum(promRate(stream("stream_messages_total")), "direction"),
+				LegendFormat: "{{direction}}",
+				RefID:        "A",
+			},
+		}),
+		createStreamingPanel(panelID+2, title+" - Connection Duration", "Connection lifetime percentiles", metricUnit("stream_connection_duration_seconds"), height, yPos+2*height, []Target{
+			{
+				Expr:         promHistogramQuantile("0.99", stream("stream_connection_duration_seconds")),
+				LegendFormat: "p99",
+				RefID:        "A",
+			},
+			{
+				Expr:         promHistogramQuantile("0.50", stream("stream_connection_duration_seconds")),
+				LegendFormat: "p50",
+				RefID:        "B",
+			},
+		}),
+	}
+}
+
+func createStreamingPanel(panelID int, title, description, unit string, height, yPos int, targets []Target) Panel {
+	return Panel{
+		ID:         panelID,
+		Title:      title,
+		Type:       "timeseries",
+		Datasource: map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		GridPos:    GridPos{H: height, W: 12, X: 0, Y: yPos},
+		Targets:    targets,
+		Options: Options{
+			Legend: LegendOptions{
+				DisplayMode: "list",
+				Placement:   "bottom",
+			},
+			Tooltip: TooltipOptions{
+				Mode: "multi",
+			},
+		},
+		FieldConfig: FieldConfig{
+			Defaults: FieldConfigDefaults{
+				Color: ColorOptions{Mode: "palette-classic"},
+				Unit:  unit,
+				Thresholds: ThresholdOptions{
+					Mode: "absolute",
+					Steps: []ThresholdStep{
+						{Color: "green", Value: nil},
+					},
+				},
+			},
+		},
+		Description: description,
+	}
+}
+
+// createGRPCStreamingPanels builds stream-oriented panels for a streaming
+// gRPC method: the streams open, computed from the started and handled
+// counters, the messages received and sent, how streams end and how long
+// they last
+func createGRPCStreamingPanels(title string, method GRPCMethod, scope []string, panelID, height, yPos int) []Panel {
+	match := method.match(scope)
+	stream := func(metric string) promSelector {
+		return match.selector(metric, fmt.Sprintf(`grpc_type="%s"`, method.grpcType()))
+	}
+	kind := strings.ReplaceAll(method.grpcType(), "_", " ") + "ing"
+
+	return []Panel{
+		createStreamingPanel(panelID, title+" - Active Streams", "Open "+kind+" calls: streams started minus streams handled", "short", height, yPos, []Target{
+			{
+				Expr:         promSum(stream("grpc_server_started_total").String()) + " - " + promSum(stream("grpc_server_handled_total").String()),
+				LegendFormat: "Streams",
+				RefID:        "A",
+			},
+		}),
+		createStreamingPanel(panelID+1, title+" - Message Rate", "Stream messages per second received from and sent to clients", metricUnit("grpc_server_msg_received_total"), height, yPos+height, []Target{
+			{
+				Expr:         promSum(promRate(stream("grpc_server_msg_received_total"))),
+				LegendFormat: "Received",
+				RefID:        "A",
+			},
+			{
+				Expr:         promSum(promRate(stream("grpc_server_msg_sent_total"))),
+				LegendFormat: "Sent",
+				RefID:        "B",
+			},
+		}),
+		createStreamingPanel(panelID+2, title+" - Stream Outcomes", "Streams ended per second by status code", metricUnit("grpc_server_handled_total"), height, yPos+2*height, []Target{
+			{
+				Expr:         promSum(promRate(stream("grpc_server_handled_total")), "grpc_code"),
+				LegendFormat: "Code {{grpc_code}}",
+				RefID:        "A",
+			},
+		}),
+		createStreamingPanel(panelID+3, title+" - Stream Duration", "Stream lifetime percentiles", metricUnit("grpc_server_handling_seconds"), height, yPos+3*height, []Target{
+			{
+				Expr:         promHistogramQuantile("0.99", stream("grpc_server_handling_seconds")),
+				LegendFormat: "p99",
+				RefID:        "A",
+			},
+			{
+				Expr:         promHistogramQuantile("0.50", stream("grpc_server_handling_seconds")),
+				LegendFormat: "p50",
+				RefID:        "B",
+			},
+		}),
+	}
+}
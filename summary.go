@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Exit codes of a generation run, one per failure class so CI can react
+// to each
+const (
+	exitError           = 1
+	exitSpecError       = 2
+	exitValidationError = 3
+	exitPushError       = 4
+)
+
+// Failure classes of the run summary
+const (
+	failureSpec       = "spec"
+	failureValidation = "validation"
+	failurePush       = "push"
+	failureOther      = "error"
+)
+
+// failureClass classifies the error ending a run, returning its class and
+// exit code
+func failureClass(err error) (string, int) {
+	var specErr *SpecLoadError
+	var validationErr *ValidationError
+	var configErr *ConfigError
+	var pushErr *PushError
+	var overwriteErr *OverwriteError
+	var dataSourceErr *DataSourceError
+	switch {
+	case errors.As(err, &specErr):
+		return failureSpec, exitSpecError
+	case errors.As(err, &validationErr), errors.As(err, &configErr):
+		return failureValidation, exitValidationError
+	case errors.As(err, &pushErr), errors.As(err, &overwriteErr), errors.As(err, &dataSourceErr):
+		return failurePush, exitPushError
+	default:
+		return failureOther, exitError
+	}
+}
+
+// RunSummary is the --summary-json report of a generation run
+type RunSummary struct {
+	Success  bool   `json:"success"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+	// Failure is the class of the error: spec, validation, push or error
+	Failure    string             `json:"failure,omitempty"`
+	Specs      []string           `json:"specs"`
+	Dashboards []DashboardSummary `json:"dashboards"`
+	Files      []string           `json:"files"`
+	Pushed     []PushSummary      `json:"pushed"`
+	Warnings   []string           `json:"warnings"`
+}
+
+// DashboardSummary counts the panels of a generated dashboard
+type DashboardSummary struct {
+	UID     string `json:"uid"`
+	Title   string `json:"title"`
+	Panels  int    `json:"panels"`
+	Queries int    `json:"queries"`
+	Alerts  int    `json:"alerts"`
+	// SummarizedBy is tag or repeat when the operations were summarized to
+	// fit --max-panels, Collapsed the operations without their own panels
+	SummarizedBy string   `json:"summarized_by,omitempty"`
+	Collapsed    []string `json:"collapsed,omitempty"`
+}
+
+// PushSummary is a dashboard pushed to Grafana
+type PushSummary struct {
+	// Instance names the grafana_instances entry pushed to
+	Instance string `json:"instance,omitempty"`
+	UID      string `json:"uid"`
+	URL      string `json:"url"`
+	Version  int    `json:"version"`
+}
+
+// newRunSummary returns an empty summary, its lists encoding as []
+func newRunSummary() *RunSummary {
+	return &RunSummary{
+		Specs:      []string{},
+		Dashboards: []DashboardSummary{},
+		Files:      []string{},
+		Pushed:     []PushSummary{},
+		Warnings:   []string{},
+	}
+}
+
+// addDashboards records the generated dashboards
+func (s *RunSummary) addDashboards(dashboards []GrafanaDashboard) {
+	for _, dashboard := range dashboards {
+		panels, queries, alerts := countDashboard(dashboard.Panels)
+		s.Dashboards = append(s.Dashboards, DashboardSummary{
+			UID:          dashboard.UID,
+			Title:        dashboard.Title,
+			Panels:       panels,
+			Queries:      queries,
+			Alerts:       alerts,
+			SummarizedBy: dashboard.summarized,
+			Collapsed:    dashboard.collapsed,
+		})
+	}
+}
+
+// finish records how the run ended and returns its exit code
+func (s *RunSummary) finish(err error) int {
+	if err == nil {
+		s.Success = true
+		return 0
+	}
+	s.Failure, s.ExitCode = failureClass(err)
+	s.Error = err.Error()
+	return s.ExitCode
+}
+
+// write prints the summary as indented JSON
+func (s *RunSummary) write(w io.Writer) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling run summary: %w", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
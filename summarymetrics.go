@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Metric presets whose latency can be exposed as a summary, with the
+// duration metric each queries. dependencies and webhooks take theirs from
+// their config file sections.
+var summaryPresetMetrics = map[string][]string{
+	"http":      {"http_request_duration_seconds"},
+	"grpc":      {"grpc_server_handling_seconds"},
+	"broker":    {"messaging_process_duration_seconds"},
+	"streaming": {"stream_connection_duration_seconds"},
+	"auth":      {"auth_token_validation_duration_seconds"},
+}
+
+const (
+	summaryPresetDependencies = "dependencies"
+	summaryPresetWebhooks     = "webhooks"
+)
+
+// histogramQuantilePattern matches the latency percentile queries panel
+// builders generate: the quantile, the histogram, its matchers and the
+// labels of the by clause
+var histogramQuantilePattern = regexp.MustCompile(`histogram_quantile\(([0-9.]+),\s*sum\(rate\(([a-zA-Z_:][a-zA-Z0-9_:]*)_bucket\{` + promMatchers + `\}\[[^\]]+\]\)\)(?:\s*by\s*\(([^)]*)\))?\)`)
+
+// validateSummaryLatency checks the presets of the summary_latency section
+func validateSummaryLatency(presets []string) error {
+	for _, preset := range presets {
+		if _, ok := summaryPresetMetrics[preset]; !ok && preset != summaryPresetDependencies && preset != summaryPresetWebhooks {
+			return fmt.Errorf("summary_latency: unknown preset %q: must be http, grpc, broker, streaming, auth, dependencies or webhooks", preset)
+		}
+	}
+	return nil
+}
+
+// summaryMetrics returns the duration metrics of the presets the config file
+// declares as summaries
+func summaryMetrics(file *FileConfig) map[string]bool {
+	metrics := make(map[string]bool)
+	for _, preset := range file.SummaryLatency {
+		names := summaryPresetMetrics[preset]
+		switch preset {
+		case summaryPresetDependencies:
+			names = []string{file.Dependencies.metrics(dependencyHTTP).DurationMetric, file.Dependencies.metrics(dependencyGRPC).DurationMetric}
+		case summaryPresetWebhooks:
+			names = []string{file.Webhooks.withDefaults().DurationMetric}
+		}
+		for _, name := range names {
+			metrics[strings.TrimSuffix(name, "_bucket")] = true
+		}
+	}
+	return metrics
+}
+
+// summaryQuantileExpr rewrites the percentile queries of summary metrics
+// to read their quantile label: histogram_quantile(0.99, sum(rate(x_bucket{m}[5m]))
+// by (le)) becomes max(x{m, quantile="0.99"}). Summary quantiles cannot be
+// aggregated, so series are combined with max, the worst instance.
+func summaryQuantileExpr(expr string, metrics map[string]bool) string {
+	return histogramQuantilePattern.ReplaceAllStringFunc(expr, func(query string) string {
+		match := histogramQuantilePattern.FindStringSubmatch(query)
+		if !metrics[match[2]] {
+			return query
+		}
+		quantile := match[1]
+		if value, err := strconv.ParseFloat(quantile, 64); err == nil {
+			quantile = strconv.FormatFloat(value, 'g', -1, 64)
+		}
+		matchers := fmt.Sprintf(`quantile="%s"`, quantile)
+		if selector := strings.TrimSpace(match[3]); selector != "" {
+			matchers = selector + ", " + matchers
+		}
+		var labels []string
+		for _, label := range strings.Split(match[4], ",") {
+			if label = strings.TrimSpace(label); label != "" && label != "le" {
+				labels = append(labels, label)
+			}
+		}
+		if len(labels) == 0 {
+			return fmt.Sprintf("max(%s{%s})", match[2], matchers)
+		}
+		return fmt.Sprintf("max by (%s) (%s{%s})", strings.Join(labels, ", "), match[2], matchers)
+	})
+}
+
+// applySummaryLatency rewrites the latency queries of every panel and alert
+// querying a summary metric
+func applySummaryLatency(dashboard *GrafanaDashboard, file *FileConfig) {
+	metrics := summaryMetrics(file)
+	if len(metrics) == 0 {
+		return
+	}
+	applyToPanels(dashboard.Panels, func(panel *Panel) {
+		for i := range panel.Targets {
+			panel.Targets[i].Expr = summaryQuantileExpr(panel.Targets[i].Expr, metrics)
+		}
+		if panel.Alert == nil {
+			return
+		}
+		for i := range panel.Alert.Conditions {
+			model := &panel.Alert.Conditions[i].Query.Model
+			model.Expr = summaryQuantileExpr(model.Expr, metrics)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults of the synthetic_checks section: the blackbox exporter probing
+// the endpoints and the module it probes them with
+const (
+	defaultBlackboxExporter = "blackbox-exporter:9115"
+	defaultBlackboxModule   = "http_2xx"
+)
+
+// SyntheticChecksConfig configures the blackbox exporter probes of
+// --synthetic-checks and --emit-probes, in the synthetic_checks section of
+// the config file
+type SyntheticChecksConfig struct {
+	// Exporter is the host:port of the blackbox exporter
+	Exporter string `yaml:"exporter"`
+	Module   string `yaml:"module"`
+}
+
+// withDefaults fills in what is not configured
+func (c SyntheticChecksConfig) withDefaults() SyntheticChecksConfig {
+	if c.Exporter == "" {
+		c.Exporter = defaultBlackboxExporter
+	}
+	if c.Module == "" {
+		c.Module = defaultBlackboxModule
+	}
+	return c
+}
+
+func (c SyntheticChecksConfig) validate() error {
+	if c.Exporter != "" && strings.Contains(c.Exporter, "/") {
+		return fmt.Errorf("exporter: %q must be a host:port", c.Exporter)
+	}
+	return nil
+}
+
+// Probe is an endpoint URL probed by the blackbox exporter
+type Probe struct {
+	Service string
+	Method  string
+	Path    string
+	URL     string
+}
+
+// probeBaseURLs returns the base URL of every spec's service: its first
+// server with a host and no variables
+func probeBaseURLs(specs []LoadedSpec) map[string]string {
+	bases := make(map[string]string)
+	for _, spec := range specs {
+		if spec.Doc == nil {
+			continue
+		}
+		for _, server := range spec.Doc.Servers {
+			u, err := url.Parse(server.URL)
+			if err != nil || u.Host == "" || strings.Contains(server.URL, "{") {
+				continue
+			}
+			if _, ok := bases[spec.Service]; !ok {
+				bases[spec.Service] = strings.TrimSuffix(server.URL, "/")
+			}
+		}
+	}
+	return bases
+}
+
+// probes returns the endpoints the blackbox exporter can probe: GET
+// operations without path parameters, under the base URL of each service
+// defining them; operations of a single spec list no services
+func probes(specs []LoadedSpec, ops []OperationInfo) []Probe {
+	bases := probeBaseURLs(specs)
+	var probes []Probe
+	for _, op := range ops {
+		if !strings.EqualFold(op.Method, http.MethodGet) || strings.Contains(op.Path, "{") {
+			continue
+		}
+		services := op.Services
+		if len(services) == 0 && len(specs) == 1 {
+			services = []string{specs[0].Service}
+		}
+		for _, service := range services {
+			if base, ok := bases[service]; ok {
+				probes = append(probes, Probe{Service: service, Method: http.MethodGet, Path: op.Path, URL: base + op.Path})
+			}
+		}
+	}
+	return probes
+}
+
+// addSyntheticCheckPanels appends a "Synthetic Checks" row with the
+// external availability and probe duration of every probed endpoint
+func addSyntheticCheckPanels(dashboard *GrafanaDashboard, probes []Probe, scope []string, cursor *panelCursor) {
+	if len(probes) == 0 {
+		return
+	}
+
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Synthetic Checks", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	for _, probe := range probes {
+		title := probe.Method + " " + probe.Path
+		success := selectorOf("probe_success").eq("instance", probe.URL).with(scope...)
+		duration := selectorOf("probe_duration_seconds").eq("instance", probe.URL).with(scope...)
+
+		availability := createStreamingPanel(cursor.ID, title+" - External Availability",
+			"Share of successful blackbox exporter probes of "+probe.URL, "percent", cursor.Height, cursor.Y, []Target{
+				{
+					Expr:         promOverTime("avg_over_time", success, "$__rate_interval") + " * 100",
+					LegendFormat: "Availability",
+					RefID:        "A",
+				},
+			})
+		availability.FieldConfig.Defaults.Min = floatPtr(0)
+		availability.FieldConfig.Defaults.Max = floatPtr(100)
+		dashboard.Panels = append(dashboard.Panels, availability)
+		cursor.ID++
+		cursor.Y += cursor.Height
+
+		dashboard.Panels = append(dashboard.Panels, createStreamingPanel(cursor.ID, title+" - Probe Duration",
+			"Duration of the blackbox exporter probes of "+probe.URL, metricUnit("probe_duration_seconds"), cursor.Height, cursor.Y, []Target{
+				{
+					Expr:         duration.String(),
+					LegendFormat: "Duration",
+					RefID:        "A",
+				},
+			}))
+		cursor.ID++
+		cursor.Y += cursor.Height
+	}
+}
+
+// ProbeScrapeConfig is the Prometheus scrape_config of a service's blackbox
+// exporter probes
+type ProbeScrapeConfig struct {
+	JobName        string              `yaml:"job_name"`
+	MetricsPath    string              `yaml:"metrics_path"`
+	Params         map[string][]string `yaml:"params"`
+	StaticConfigs  []StaticConfig      `yaml:"static_configs"`
+	RelabelConfigs []RelabelConfig     `yaml:"relabel_configs"`
+}
+
+// RelabelConfig is a Prometheus relabeling step
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels,omitempty"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+}
+
+// probeScrapeConfigs builds a scrape config per service probing its
+// endpoints through the blackbox exporter: the endpoint URL becomes the
+// target parameter and the instance label, the service label is added
+func probeScrapeConfigs(probes []Probe, settings SyntheticChecksConfig) []ProbeScrapeConfig {
+	var configs []ProbeScrapeConfig
+	index := make(map[string]int)
+	for _, probe := range probes {
+		i, ok := index[probe.Service]
+		if !ok {
+			i = len(configs)
+			index[probe.Service] = i
+			configs = append(configs, ProbeScrapeConfig{
+				JobName:       probe.Service + "-probes",
+				MetricsPath:   "/probe",
+				Params:        map[string][]string{"module": {settings.Module}},
+				StaticConfigs: []StaticConfig{{Labels: map[string]string{"service": probe.Service}}},
+				RelabelConfigs: []RelabelConfig{
+					{SourceLabels: []string{"__address__"}, TargetLabel: "__param_target"},
+					{SourceLabels: []string{"__param_target"}, TargetLabel: "instance"},
+					{TargetLabel: "__address__", Replacement: settings.Exporter},
+				},
+			})
+		}
+		configs[i].StaticConfigs[0].Targets = append(configs[i].StaticConfigs[0].Targets, probe.URL)
+	}
+	return configs
+}
+
+// writeProbeConfig writes the blackbox exporter scrape configs of the probes
+func writeProbeConfig(path string, probes []Probe, settings SyntheticChecksConfig) error {
+	data, err := yaml.Marshal(map[string]interface{}{"scrape_configs": probeScrapeConfigs(probes, settings)})
+	if err != nil {
+		return fmt.Errorf("error marshaling probe config: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing probe config file: %w", err)
+	}
+	return nil
+}
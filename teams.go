@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Prefix of the dashboard tags naming the teams owning its operations, and
+// label of the team owning an alert, for Alertmanager routing
+const (
+	teamTagPrefix = "team:"
+	teamLabel     = "team"
+)
+
+// validateTeams checks that every tag maps to a team and that the runbooks
+// are URLs of those teams
+func validateTeams(teams, runbooks map[string]string) error {
+	owners := make(map[string]bool, len(teams))
+	for tag, team := range teams {
+		if strings.TrimSpace(team) == "" {
+			return fmt.Errorf("teams.%s: empty team name", tag)
+		}
+		owners[team] = true
+	}
+	for team, runbook := range runbooks {
+		if !owners[team] {
+			return fmt.Errorf("team_runbooks.%s: not a team of teams", team)
+		}
+		if u, err := url.Parse(runbook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("team_runbooks.%s: %q is not an http(s) URL", team, runbook)
+		}
+	}
+	return nil
+}
+
+// operationTeam returns the team owning an operation through its tag, ""
+// for operations without one
+func (c *Config) operationTeam(op OperationInfo) string {
+	if op.Tag == "" {
+		return ""
+	}
+	return c.fileConfig().Teams[op.Tag]
+}
+
+// teamTags returns the sorted dashboard tags of the teams owning operations
+func teamTags(config *Config, ops []OperationInfo) []string {
+	seen := make(map[string]bool)
+	for _, op := range ops {
+		if team := config.operationTeam(op); team != "" {
+			seen[teamTagPrefix+team] = true
+		}
+	}
+	return sortedMapKeys(seen)
+}
+
+// applyTeam marks the panels of an operation with its owning team: a link
+// to the team's runbook when it has one, and the team label on alerts
+func applyTeam(panels []Panel, team, runbook string) {
+	for i := range panels {
+		panel := &panels[i]
+		if runbook != "" {
+			panel.Links = append(panel.Links, DataLink{Title: team + " runbook", URL: runbook, TargetBlank: true})
+		}
+		if panel.Alert != nil {
+			if panel.Alert.AlertRuleTags == nil {
+				panel.Alert.AlertRuleTags = make(map[string]string)
+			}
+			panel.Alert.AlertRuleTags[teamLabel] = team
+		}
+	}
+}
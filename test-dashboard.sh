@@ -76,10 +76,10 @@ generate_dashboard() {
     # Check if we should update or create new
     if [[ -f "$DASHBOARD_FILE" ]]; then
         print_info "Updating existing dashboard..."
-        go run main.go "$OPENAPI_FILE" "$DASHBOARD_FILE" --update --datasource prometheus
+        go run . "$OPENAPI_FILE" "$DASHBOARD_FILE" --update --datasource prometheus
     else
         print_info "Creating new dashboard..."
-        go run main.go "$OPENAPI_FILE" "$DASHBOARD_FILE" --datasource prometheus
+        go run . "$OPENAPI_FILE" "$DASHBOARD_FILE" --datasource prometheus
     fi
     
     if [[ $? -eq 0 ]]; then
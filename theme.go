@@ -0,0 +1,89 @@
+package main
+
+import "fmt"
+
+// Themes of --theme
+const (
+	themeDark  = "dark"
+	themeLight = "light"
+)
+
+// ColorsConfig sets the colors of the threshold states and the color mode
+// of multi-series panels. Colors are Grafana color names or hex codes.
+type ColorsConfig struct {
+	OK       string `yaml:"ok"`
+	Warning  string `yaml:"warning"`
+	Critical string `yaml:"critical"`
+	// Palette is the color mode of multi-series panels, e.g. palette-classic
+	Palette string `yaml:"palette"`
+}
+
+// themeColors are the colors of each theme; the darker shades of the light
+// theme stay legible on a white background
+var themeColors = map[string]ColorsConfig{
+	themeDark:  {OK: "green", Warning: "yellow", Critical: "red", Palette: "palette-classic"},
+	themeLight: {OK: "dark-green", Warning: "dark-orange", Critical: "dark-red", Palette: "palette-classic"},
+}
+
+// validateTheme checks a --theme or theme value
+func validateTheme(theme string) error {
+	if _, ok := themeColors[theme]; theme != "" && !ok {
+		return fmt.Errorf("invalid theme %q: must be dark or light", theme)
+	}
+	return nil
+}
+
+// theme returns the dashboard style, --theme overriding the config file's,
+// and its colors with the config file's colors applied
+func (c *Config) theme() (string, ColorsConfig) {
+	file := c.fileConfig()
+	theme := file.Theme
+	if c.Theme != "" {
+		theme = c.Theme
+	}
+	if theme == "" {
+		theme = themeDark
+	}
+
+	colors := themeColors[theme]
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{file.Colors.OK, &colors.OK},
+		{file.Colors.Warning, &colors.Warning},
+		{file.Colors.Critical, &colors.Critical},
+		{file.Colors.Palette, &colors.Palette},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	return theme, colors
+}
+
+// applyTheme sets the dashboard style and replaces the generated state
+// colors (green, yellow and red threshold steps) and palette with the
+// theme's
+func applyTheme(dashboard *GrafanaDashboard, style string, colors ColorsConfig) {
+	dashboard.Style = style
+	states := map[string]string{"green": colors.OK, "yellow": colors.Warning, "red": colors.Critical}
+	applyToPanels(dashboard.Panels, func(panel *Panel) {
+		defaults := &panel.FieldConfig.Defaults
+		for i, step := range defaults.Thresholds.Steps {
+			if color, ok := states[step.Color]; ok {
+				defaults.Thresholds.Steps[i].Color = color
+			}
+		}
+		if panel.Thresholds != nil {
+			for i, step := range panel.Thresholds.Steps {
+				if color, ok := states[step.Color]; ok {
+					panel.Thresholds.Steps[i].Color = color
+				}
+			}
+		}
+		if defaults.Color.Mode == "palette-classic" {
+			defaults.Color.Mode = colors.Palette
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	// Zones validate without the system zoneinfo, e.g. in minimal containers
+	_ "time/tzdata"
+)
+
+// refreshOff disables auto-refresh
+const refreshOff = "off"
+
+// Default time settings of generated dashboards
+const (
+	defaultRefresh  = "30s"
+	defaultTimeFrom = "now-6h"
+	defaultTimeTo   = "now"
+)
+
+var (
+	// refreshIntervalPattern matches Grafana refresh intervals such as 30s or 1d
+	refreshIntervalPattern = regexp.MustCompile(`^([0-9]+)(s|m|h|d)$`)
+	// relativeTimePattern matches Grafana relative times such as now-6h or now/d
+	relativeTimePattern = regexp.MustCompile(`^now(-[0-9]+[smhdwMy])?(/[smhdwMy])?$`)
+)
+
+// weekStarts are the days a Grafana week can start on
+var weekStarts = map[string]bool{"monday": true, "saturday": true, "sunday": true}
+
+// TimeSettings are the refresh, time range and calendar settings of the
+// generated dashboards, in the time section of the config file; flags take
+// precedence
+type TimeSettings struct {
+	// Refresh is the auto-refresh interval, off to disable it
+	Refresh string `yaml:"refresh"`
+	// From and To are the default time range, relative (now-7d) or RFC 3339
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Timezone is browser, utc or a IANA zone such as Europe/Berlin
+	Timezone string `yaml:"timezone"`
+	// WeekStart is monday, saturday or sunday; empty follows the browser
+	WeekStart string `yaml:"week_start"`
+}
+
+// timeSettings returns the time settings of the config file overridden by
+// the flags
+func (c *Config) timeSettings() TimeSettings {
+	settings := c.fileConfig().Time
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{c.Time.Refresh, &settings.Refresh},
+		{c.Time.From, &settings.From},
+		{c.Time.To, &settings.To},
+		{c.Time.Timezone, &settings.Timezone},
+		{c.Time.WeekStart, &settings.WeekStart},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	return settings
+}
+
+func (s TimeSettings) validate() error {
+	if s.Refresh != "" && s.Refresh != refreshOff && !refreshIntervalPattern.MatchString(s.Refresh) {
+		return fmt.Errorf("invalid refresh %q: must be an interval such as 30s, 5m or 1h, or off", s.Refresh)
+	}
+	for _, value := range []string{s.From, s.To} {
+		if value == "" || relativeTimePattern.MatchString(value) {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Errorf("invalid time %q: must be relative such as now-7d or an RFC 3339 timestamp", value)
+		}
+	}
+	switch s.Timezone {
+	case "", "browser", "utc":
+	default:
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: must be browser, utc or a zone such as Europe/Berlin", s.Timezone)
+		}
+	}
+	if s.WeekStart != "" && !weekStarts[s.WeekStart] {
+		return fmt.Errorf("invalid week start %q: must be monday, saturday or sunday", s.WeekStart)
+	}
+	return nil
+}
+
+// applyTimeSettings sets the refresh, time range and calendar of a dashboard,
+// keeping the ones not configured
+func applyTimeSettings(dashboard *GrafanaDashboard, settings TimeSettings) {
+	switch settings.Refresh {
+	case "":
+	case refreshOff:
+		dashboard.Refresh = ""
+	default:
+		dashboard.Refresh = settings.Refresh
+		dashboard.Timepicker.RefreshIntervals = withRefreshInterval(dashboard.Timepicker.RefreshIntervals, settings.Refresh)
+	}
+	if settings.From != "" {
+		dashboard.Time.From = settings.From
+	}
+	if settings.To != "" {
+		dashboard.Time.To = settings.To
+	}
+	if settings.Timezone != "" {
+		dashboard.Timezone = settings.Timezone
+	}
+	if settings.WeekStart != "" {
+		dashboard.WeekStart = settings.WeekStart
+	}
+}
+
+// withRefreshInterval adds an interval to the refresh picker, which Grafana
+// requires of the dashboard refresh, keeping the picker sorted
+func withRefreshInterval(intervals []string, interval string) []string {
+	for _, existing := range intervals {
+		if existing == interval {
+			return intervals
+		}
+	}
+	intervals = append(append([]string{}, intervals...), interval)
+	sort.SliceStable(intervals, func(i, j int) bool {
+		return refreshSeconds(intervals[i]) < refreshSeconds(intervals[j])
+	})
+	return intervals
+}
+
+// refreshSeconds returns the length of a refresh interval in seconds
+func refreshSeconds(interval string) int {
+	match := refreshIntervalPattern.FindStringSubmatch(interval)
+	if match == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(match[1])
+	return n * map[string]int{"s": 1, "m": 60, "h": 3600, "d": 86400}[match[2]]
+}
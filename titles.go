@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stripPrefixAuto strips the path segments shared by every path of the specs
+const stripPrefixAuto = "auto"
+
+// titleEllipsis marks where truncated titles were cut
+const titleEllipsis = "…"
+
+// minSummaryLength is the room below which summaries are left out of
+// truncated titles rather than cut
+const minSummaryLength = 12
+
+// TitleSettings shorten the panel titles of operations with long paths, in
+// the titles section of the config file; flags take precedence
+type TitleSettings struct {
+	// Template renders the title of an operation from PanelTitleData, e.g.
+	// "{{.Method}} {{.ShortPath}}"; empty keeps the operationId or endpoint
+	Template string `yaml:"template"`
+	// StripPrefix is left out of paths in titles, e.g. /api/inventory/v1beta1,
+	// or auto for the segments all paths of the specs share
+	StripPrefix string `yaml:"strip_prefix"`
+	// Abbreviations replace path segments in titles, e.g.
+	// resource-relationships: rel
+	Abbreviations map[string]string `yaml:"abbreviations"`
+	// MaxLength truncates longer titles in the middle; 0 keeps them whole
+	MaxLength int `yaml:"max_length"`
+	// RawPaths shows paths in titles as written in the spec rather than
+	// percent-decoded
+	RawPaths bool `yaml:"raw_paths"`
+}
+
+// PanelTitleData is the data title templates are executed with
+type PanelTitleData struct {
+	// Name is the default title: the operationId, or the endpoint and summary
+	Name   string
+	Method string
+	Path   string
+	// ShortPath is the path without the stripped prefix, percent-decoded
+	// and abbreviated
+	ShortPath   string
+	OperationID string
+	Summary     string
+	Tag         string
+}
+
+// panelTitleFuncs are the functions of title templates in addition to those
+// of --uid-template and --title-template
+var panelTitleFuncs = template.FuncMap{
+	// last keeps the last n segments of a path, e.g. {{last 2 .ShortPath}}
+	"last": func(n int, path string) string {
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		if n <= 0 || n >= len(segments) {
+			return path
+		}
+		return titleEllipsis + "/" + strings.Join(segments[len(segments)-n:], "/")
+	},
+	// truncate cuts a value to n characters, e.g. {{truncate 40 .Summary}}
+	"truncate": truncateEnd,
+}
+
+// truncateEnd cuts a value to n characters, the last being an ellipsis
+func truncateEnd(n int, s string) string {
+	runes := []rune(s)
+	if n <= 0 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + titleEllipsis
+}
+
+// titleSettings returns the title settings of the config file overridden by
+// the flags
+func (c *Config) titleSettings() TitleSettings {
+	settings := c.fileConfig().Titles
+	if c.Titles.Template != "" {
+		settings.Template = c.Titles.Template
+	}
+	if c.Titles.StripPrefix != "" {
+		settings.StripPrefix = c.Titles.StripPrefix
+	}
+	if c.Titles.MaxLength != 0 {
+		settings.MaxLength = c.Titles.MaxLength
+	}
+	settings.RawPaths = settings.RawPaths || c.Titles.RawPaths
+	return settings
+}
+
+func (s TitleSettings) validate() error {
+	if s.MaxLength < 0 || (s.MaxLength > 0 && s.MaxLength < 10) {
+		return fmt.Errorf("invalid title max length %d: must be at least 10, or 0 for no limit", s.MaxLength)
+	}
+	if s.Template != "" {
+		if _, err := renderPanelTitle(s.Template, PanelTitleData{}); err != nil {
+			return fmt.Errorf("invalid title template: %w", err)
+		}
+	}
+	for segment, abbreviation := range s.Abbreviations {
+		if segment == "" || strings.Contains(segment, "/") || strings.Contains(abbreviation, "/") {
+			return fmt.Errorf("invalid title abbreviation %q: %q: must replace a single path segment", segment, abbreviation)
+		}
+	}
+	return nil
+}
+
+// pathPrefix resolves the prefix stripped from paths in titles, auto
+// finding the segments shared by every path of the specs. Template segments
+// and the last segment are never shared.
+func (s TitleSettings) pathPrefix(specs []LoadedSpec) string {
+	if s.StripPrefix != stripPrefixAuto {
+		return strings.TrimSuffix(s.StripPrefix, "/")
+	}
+	var shared []string
+	first := true
+	for _, spec := range specs {
+		if spec.Doc == nil || spec.Doc.Paths == nil {
+			continue
+		}
+		for path := range spec.Doc.Paths.Map() {
+			segments := strings.Split(strings.Trim(path, "/"), "/")
+			segments = segments[:len(segments)-1]
+			if first {
+				shared, first = segments, false
+			}
+			n := 0
+			for n < len(shared) && n < len(segments) && shared[n] == segments[n] && !strings.HasPrefix(segments[n], "{") {
+				n++
+			}
+			shared = shared[:n]
+		}
+	}
+	if len(shared) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(shared, "/")
+}
+
+// shortPath strips the prefix from a path, decodes it for display and
+// abbreviates its segments
+func (s TitleSettings) shortPath(path, prefix string) string {
+	if prefix != "" && strings.HasPrefix(path, prefix+"/") {
+		path = strings.TrimPrefix(path, prefix)
+	}
+	path = s.displayPath(path)
+	if len(s.Abbreviations) == 0 {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if abbreviation, ok := s.Abbreviations[segment]; ok {
+			segments[i] = abbreviation
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// displayPath is a path as shown in titles: percent-decoded unless raw
+// paths are configured, and with invisible characters escaped either way.
+// Queries always match the path as written in the spec, which is what the
+// path label records.
+func (s TitleSettings) displayPath(path string) string {
+	if !s.RawPaths {
+		path = decodePercents(path)
+	}
+	if strings.IndexFunc(path, invisible) < 0 {
+		return path
+	}
+	var b strings.Builder
+	for _, r := range path {
+		if invisible(r) {
+			b.WriteString(strings.Trim(strconv.QuoteRuneToASCII(r), "'"))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// invisible reports characters that would not show in a title: controls,
+// format characters such as zero-width spaces, and unprintable ones
+func invisible(r rune) bool {
+	return r != ' ' && (!unicode.IsPrint(r) || unicode.Is(unicode.Cf, r))
+}
+
+// decodePercents decodes the percent-encoded runs of a path that form
+// UTF-8 text. Encoded delimiters (/ ? #), percent signs and malformed
+// escapes are kept, so the decoded path reads as the same route.
+func decodePercents(path string) string {
+	if !strings.Contains(path, "%") {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); {
+		if path[i] != '%' {
+			b.WriteByte(path[i])
+			i++
+			continue
+		}
+		// Collect the run of escapes starting here
+		var run []byte
+		j := i
+		for j+2 < len(path) && path[j] == '%' {
+			value, err := strconv.ParseUint(path[j+1:j+3], 16, 8)
+			if err != nil || strings.ContainsRune("/?#%", rune(value)) {
+				break
+			}
+			run = append(run, byte(value))
+			j += 3
+		}
+		if len(run) == 0 || !utf8.Valid(run) {
+			if j == i {
+				j = i + 1
+			}
+			b.WriteString(path[i:j])
+			i = j
+			continue
+		}
+		b.Write(run)
+		i = j
+	}
+	return b.String()
+}
+
+// operationTitle names the panels and alerts of an operation: its
+// operationId, or its endpoint title when it has none or with --panel-titles
+// path, unless a title template renders it. The path is shortened and the
+// title truncated as configured.
+func (c *Config) operationTitle(op OperationInfo, prefix string) string {
+	settings := c.titleSettings()
+	data := PanelTitleData{
+		Method:    strings.ToUpper(op.Method),
+		Path:      op.Path,
+		ShortPath: settings.shortPath(op.Path, prefix),
+		Tag:       op.Tag,
+	}
+	if op.Operation != nil {
+		data.OperationID, data.Summary = op.Operation.OperationID, op.Operation.Summary
+	}
+	data.Name = data.Method + " " + data.ShortPath
+	if data.Summary != "" {
+		// Summaries give way to the endpoint when the title is too long
+		room := settings.MaxLength - len([]rune(data.Name)) - len(": ")
+		switch {
+		case settings.MaxLength == 0:
+			data.Name += ": " + data.Summary
+		case room >= minSummaryLength:
+			data.Name += ": " + truncateEnd(room, data.Summary)
+		}
+	}
+	if c.PanelTitles != panelTitlesPath && data.OperationID != "" {
+		data.Name = data.OperationID
+	}
+
+	title := data.Name
+	if settings.Template != "" {
+		rendered, err := renderPanelTitle(settings.Template, data)
+		switch {
+		case err != nil:
+			slog.Warn("ignoring title template", "operation", op.Key(), "error", err)
+		case rendered == "":
+			slog.Warn("ignoring title template, it renders empty", "operation", op.Key())
+		default:
+			title = rendered
+		}
+	}
+	return truncateTitle(title, settings.MaxLength)
+}
+
+// renderPanelTitle executes a title template
+func renderPanelTitle(text string, data PanelTitleData) (string, error) {
+	tmpl, err := template.New("title").Funcs(nameTemplateFuncs).Funcs(panelTitleFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// truncateTitle cuts titles longer than max characters in the middle, where
+// paths are the least telling
+func truncateTitle(title string, max int) string {
+	runes := []rune(title)
+	if max <= 0 || len(runes) <= max {
+		return title
+	}
+	head := (max - 1) / 3
+	tail := max - 1 - head
+	return string(runes[:head]) + titleEllipsis + string(runes[len(runes)-tail:])
+}
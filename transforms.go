@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/itchyny/gojq"
+)
+
+// TransformConfig is a post-generation tweak of the dashboard JSON, in the
+// transforms section of the config file: either an RFC 6902 JSON Patch or a
+// jq program turning the dashboard into the one to write, e.g.
+// (.panels[] | select(.type == "stat") | .options.colorMode) = "background"
+type TransformConfig struct {
+	Patch []JSONPatchOperation `yaml:"patch"`
+	JQ    string               `yaml:"jq"`
+	// patch and jq are the decoded patch and the compiled jq program, set
+	// when the config is loaded
+	patch jsonpatch.Patch
+	jq    *gojq.Code
+}
+
+// JSONPatchOperation is an operation of an RFC 6902 JSON Patch
+type JSONPatchOperation struct {
+	Op    string      `yaml:"op" json:"op"`
+	Path  string      `yaml:"path" json:"path"`
+	From  string      `yaml:"from" json:"from,omitempty"`
+	Value interface{} `yaml:"value" json:"value"`
+}
+
+// MarshalJSON applies the transforms of the dashboard to its JSON, so they
+// hold for every output format and for pushes
+func (d GrafanaDashboard) MarshalJSON() ([]byte, error) {
+	type plain GrafanaDashboard
+	data, err := json.Marshal(plain(d))
+	if err != nil || len(d.transforms) == 0 {
+		return data, err
+	}
+	return applyTransforms(data, d.transforms)
+}
+
+// transformedDashboard returns the dashboard its transforms yield, decoded
+// like a dashboard file
+func transformedDashboard(d GrafanaDashboard) (GrafanaDashboard, error) {
+	var transformed GrafanaDashboard
+	data, err := d.MarshalJSON()
+	if err != nil {
+		return transformed, err
+	}
+	if err := json.Unmarshal(data, &transformed); err != nil {
+		return transformed, fmt.Errorf("transformed dashboard: %w", err)
+	}
+	return transformed, nil
+}
+
+// loadTransforms decodes the patch or compiles the jq program of every
+// transform, so that only a document not matching a transform fails at
+// generation
+func loadTransforms(transforms []TransformConfig) error {
+	for i := range transforms {
+		transform := &transforms[i]
+		if (len(transform.Patch) == 0) == (transform.JQ == "") {
+			return fmt.Errorf("transforms[%d]: exactly one of patch and jq is required", i)
+		}
+		if transform.JQ != "" {
+			query, err := gojq.Parse(transform.JQ)
+			if err != nil {
+				return fmt.Errorf("transforms[%d]: jq: %w", i, err)
+			}
+			code, err := gojq.Compile(query)
+			if err != nil {
+				return fmt.Errorf("transforms[%d]: jq: %w", i, err)
+			}
+			transform.jq = code
+			continue
+		}
+		for j, op := range transform.Patch {
+			if err := op.validate(); err != nil {
+				return fmt.Errorf("transforms[%d]: patch[%d]: %w", i, j, err)
+			}
+		}
+		data, err := json.Marshal(transform.Patch)
+		if err != nil {
+			return fmt.Errorf("transforms[%d]: patch: %w", i, err)
+		}
+		if transform.patch, err = jsonpatch.DecodePatch(data); err != nil {
+			return fmt.Errorf("transforms[%d]: patch: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validate checks what the patch library only finds when applying the
+// operation: its name and the syntax of its pointers
+func (op JSONPatchOperation) validate() error {
+	switch op.Op {
+	case "add", "remove", "replace", "test":
+	case "move", "copy":
+		if err := validatePointer(op.From); err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid op %q: must be add, remove, replace, move, copy or test", op.Op)
+	}
+	if err := validatePointer(op.Path); err != nil {
+		return fmt.Errorf("path: %w", err)
+	}
+	return nil
+}
+
+// validatePointer checks an RFC 6901 JSON Pointer is empty or starts with /
+func validatePointer(pointer string) error {
+	if pointer != "" && pointer[0] != '/' {
+		return fmt.Errorf("invalid JSON pointer %q: must start with /", pointer)
+	}
+	return nil
+}
+
+// applyTransforms applies the transforms in order to the JSON of a dashboard
+func applyTransforms(data []byte, transforms []TransformConfig) ([]byte, error) {
+	var err error
+	for i, transform := range transforms {
+		if transform.jq != nil {
+			data, err = runJQ(transform.jq, data)
+			if err != nil {
+				return nil, fmt.Errorf("transforms[%d]: jq %s: %w", i, transform.JQ, err)
+			}
+			continue
+		}
+		data, err = transform.patch.Apply(data)
+		if err != nil {
+			return nil, fmt.Errorf("transforms[%d]: patch: %w", i, err)
+		}
+	}
+	return data, nil
+}
+
+// runJQ runs a jq program on a JSON document, which must yield a single
+// object, the transformed document
+func runJQ(code *gojq.Code, data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	results := code.Run(doc)
+	result, ok := results.Next()
+	if !ok {
+		return nil, fmt.Errorf("yields no value, want the dashboard")
+	}
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
+	if _, ok := results.Next(); ok {
+		return nil, fmt.Errorf("yields several values, want the dashboard only")
+	}
+	if _, ok := result.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("yields %s, want the dashboard object", gojq.TypeOf(result))
+	}
+	return json.Marshal(result)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// transformDoc is the document the transform tests start from
+const transformDoc = `{
+	"title": "API",
+	"tags": ["generated", "api"],
+	"panels": [
+		{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}},
+		{"id": 2, "type": "stat", "options": {}},
+		{"id": 3, "type": "stat", "title": "a/b~c"}
+	]
+}`
+
+// runTransform loads a transform and applies it to transformDoc
+func runTransform(t *testing.T, transform TransformConfig) ([]byte, error) {
+	t.Helper()
+	transforms := []TransformConfig{transform}
+	if err := loadTransforms(transforms); err != nil {
+		return nil, err
+	}
+	return applyTransforms([]byte(transformDoc), transforms)
+}
+
+// checkTransform compares the result of a transform with the JSON want, or
+// its error with the substring wantErr
+func checkTransform(t *testing.T, transform TransformConfig, want, wantErr string) {
+	t.Helper()
+	got, err := runTransform(t, transform)
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("error = %v, want one containing %q", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotDoc, wantDoc interface{}
+	if err := json.Unmarshal(got, &gotDoc); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantDoc); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotDoc, wantDoc) {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   []JSONPatchOperation
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "add member",
+			patch: []JSONPatchOperation{{Op: "add", Path: "/refresh", Value: "1m"}},
+			want:  `{"title": "API", "refresh": "1m", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name:  "add array element",
+			patch: []JSONPatchOperation{{Op: "add", Path: "/tags/1", Value: "team"}},
+			want:  `{"title": "API", "tags": ["generated", "team", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name:  "add to array end",
+			patch: []JSONPatchOperation{{Op: "add", Path: "/tags/-", Value: map[string]interface{}{"n": 1}}},
+			want:  `{"title": "API", "tags": ["generated", "api", {"n": 1}], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name:    "add past array end",
+			patch:   []JSONPatchOperation{{Op: "add", Path: "/tags/3", Value: "x"}},
+			wantErr: "invalid index referenced",
+		},
+		{
+			name:    "add to missing parent",
+			patch:   []JSONPatchOperation{{Op: "add", Path: "/missing/key", Value: "x"}},
+			wantErr: `doc is missing path: "/missing/key"`,
+		},
+		{
+			name:  "remove",
+			patch: []JSONPatchOperation{{Op: "remove", Path: "/panels/0"}, {Op: "remove", Path: "/panels/0/options"}},
+			want:  `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 2, "type": "stat"}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name:    "remove missing member",
+			patch:   []JSONPatchOperation{{Op: "remove", Path: "/panels/0/title"}},
+			wantErr: "unable to remove nonexistent key: title",
+		},
+		{
+			name:    "remove whole document",
+			patch:   []JSONPatchOperation{{Op: "remove", Path: ""}},
+			wantErr: "error in remove for path: ''",
+		},
+		{
+			name:  "replace",
+			patch: []JSONPatchOperation{{Op: "replace", Path: "/panels/2/type", Value: "gauge"}},
+			want:  `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "gauge", "title": "a/b~c"}]}`,
+		},
+		{
+			name:  "replace whole document",
+			patch: []JSONPatchOperation{{Op: "replace", Path: "", Value: map[string]interface{}{"title": "New"}}},
+			want:  `{"title": "New"}`,
+		},
+		{
+			name:    "replace missing member",
+			patch:   []JSONPatchOperation{{Op: "replace", Path: "/refresh", Value: "1m"}},
+			wantErr: "doc is missing key: /refresh",
+		},
+		{
+			name:  "move",
+			patch: []JSONPatchOperation{{Op: "move", From: "/panels/0/options/legend", Path: "/legend"}},
+			want:  `{"title": "API", "legend": {"displayMode": "list"}, "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name:  "copy",
+			patch: []JSONPatchOperation{{Op: "copy", From: "/tags/1", Path: "/panels/1/options/tag"}},
+			want:  `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {"tag": "api"}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name:    "copy from missing member",
+			patch:   []JSONPatchOperation{{Op: "copy", From: "/missing", Path: "/copy"}},
+			wantErr: "error in copy for from: '/missing'",
+		},
+		{
+			name:  "test escaped pointer",
+			patch: []JSONPatchOperation{{Op: "test", Path: "/panels/2/title", Value: "a/b~c"}, {Op: "test", Path: "/panels/0/id", Value: 1}},
+			want:  transformDoc,
+		},
+		{
+			name:    "test failure",
+			patch:   []JSONPatchOperation{{Op: "test", Path: "/title", Value: "Other"}},
+			wantErr: "testing value /title failed",
+		},
+		{
+			name:    "invalid op",
+			patch:   []JSONPatchOperation{{Op: "merge", Path: "/title"}},
+			wantErr: `invalid op "merge"`,
+		},
+		{
+			name:    "invalid pointer",
+			patch:   []JSONPatchOperation{{Op: "remove", Path: "title"}},
+			wantErr: "must start with /",
+		},
+		{
+			name:    "index a string",
+			patch:   []JSONPatchOperation{{Op: "test", Path: "/title/0", Value: "A"}},
+			wantErr: "is missing path: /title/0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkTransform(t, TransformConfig{Patch: tt.patch}, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestJQ(t *testing.T) {
+	tests := []struct {
+		name    string
+		jq      string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "assign path",
+			jq:   `.refresh = "1m"`,
+			want: `{"title": "API", "refresh": "1m", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name: "assign creates objects and pads arrays",
+			jq:   `.time.range[1] = {"from": "now-1h"}`,
+			want: `{"title": "API", "time": {"range": [null, {"from": "now-1h"}]}, "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name: "assign quoted keys and index",
+			jq:   `.panels[0]["options"]."legend".displayMode = "table"`,
+			want: `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "table"}}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name: "assign iterated",
+			jq:   `.panels[].transparent = true`,
+			want: `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "transparent": true, "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "transparent": true, "options": {}}, {"id": 3, "type": "stat", "transparent": true, "title": "a/b~c"}]}`,
+		},
+		{
+			name: "select equal",
+			jq:   `(.panels[] | select(.type == "stat") | .options.colorMode) = "background"`,
+			want: `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {"colorMode": "background"}}, {"id": 3, "type": "stat", "title": "a/b~c", "options": {"colorMode": "background"}}]}`,
+		},
+		{
+			name: "select not equal",
+			jq:   `(.panels[] | select(.id != 2) | .type) = "table"`,
+			want: `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "table", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "table", "title": "a/b~c"}]}`,
+		},
+		{
+			name: "select object",
+			jq:   `(.panels[] | select(.options == {}) | .id) = 0`,
+			want: `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 0, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name: "delete path",
+			jq:   `del(.tags)`,
+			want: `{"title": "API", "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name: "delete selected array elements",
+			jq:   `del(.panels[] | select(.type == "stat"))`,
+			want: `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}]}`,
+		},
+		{
+			name: "delete missing path",
+			jq:   `del(.panels[5].options)`,
+			want: transformDoc,
+		},
+		{
+			name: "update",
+			jq:   `.panels |= map(select(.type == "stat"))`,
+			want: `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 2, "type": "stat", "options": {}}, {"id": 3, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name: "update with arithmetic",
+			jq:   `.panels[].id += 10`,
+			want: `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 11, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 12, "type": "stat", "options": {}}, {"id": 13, "type": "stat", "title": "a/b~c"}]}`,
+		},
+		{
+			name: "select comparison",
+			jq:   `(.panels[] | select(.id > 1) | .type) = "gauge"`,
+			want: `{"title": "API", "tags": ["generated", "api"], "panels": [{"id": 1, "type": "timeseries", "options": {"legend": {"displayMode": "list"}}}, {"id": 2, "type": "gauge", "options": {}}, {"id": 3, "type": "gauge", "title": "a/b~c"}]}`,
+		},
+		{
+			name:    "runtime error",
+			jq:      `.title[] = 1`,
+			wantErr: "cannot iterate over: string",
+		},
+		{
+			name:    "no value",
+			jq:      `empty`,
+			wantErr: "yields no value",
+		},
+		{
+			name:    "several values",
+			jq:      `., .`,
+			wantErr: "yields several values",
+		},
+		{
+			name:    "not an object",
+			jq:      `.tags`,
+			wantErr: "yields array, want the dashboard object",
+		},
+		{
+			name:    "delete whole document",
+			jq:      `del(.)`,
+			wantErr: "yields null",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkTransform(t, TransformConfig{JQ: tt.jq}, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestLoadTransforms(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms []TransformConfig
+		wantErr    string
+	}{
+		{"neither", []TransformConfig{{}}, "exactly one of patch and jq is required"},
+		{"both", []TransformConfig{{JQ: ".a = 1", Patch: []JSONPatchOperation{{Op: "remove", Path: "/a"}}}}, "exactly one of patch and jq is required"},
+		{"invalid from", []TransformConfig{{Patch: []JSONPatchOperation{{Op: "move", From: "a", Path: "/b"}}}}, "transforms[0]: patch[0]: from:"},
+		{"invalid op", []TransformConfig{{Patch: []JSONPatchOperation{{Op: "merge", Path: "/a"}}}}, `transforms[0]: patch[0]: invalid op "merge"`},
+		{"invalid jq", []TransformConfig{{JQ: ".a = "}}, "transforms[0]: jq:"},
+		{"undefined jq function", []TransformConfig{{JQ: "nope(.a)"}}, "transforms[0]: jq: function not defined: nope/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadTransforms(tt.transforms)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestTransformsValidated checks transforms apply before validation: a
+// dashboard left without a title by a transform fails the check
+func TestTransformsValidated(t *testing.T) {
+	dashboard := GrafanaDashboard{Title: "API", UID: "api"}
+	if err := checkDashboard(&dashboard); err != nil {
+		t.Fatal(err)
+	}
+
+	dashboard.transforms = []TransformConfig{{JQ: "del(.title)"}}
+	if err := loadTransforms(dashboard.transforms); err != nil {
+		t.Fatal(err)
+	}
+	err := checkDashboard(&dashboard)
+	if err == nil || !strings.Contains(err.Error(), "dashboard title is empty") {
+		t.Fatalf("error = %v, want the empty title of the transformed dashboard", err)
+	}
+}
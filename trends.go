@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dashboard variants selected with --variant
+const (
+	variantOperational = "operational"
+	variantTrends      = "trends"
+	variantRepeat      = "repeat"
+)
+
+// Recorded series the trends variant is built on, see trendRecordingRules
+const (
+	trendRequestsSeries = "service_path_method:http_requests:rate1d"
+	trendErrorsSeries   = "service_path_method:http_requests_5xx:rate1d"
+	trendLatencySeries  = "service_path_method:http_request_duration_seconds_bucket:rate1d"
+)
+
+// trendRecordingRules returns the Prometheus recording rules producing the
+// 1d-resolution series used by the trends variant, keeping the labels the
+// dashboard variables filter on
+func trendRecordingRules(labels []string) map[string]interface{} {
+	by := append(append([]string{}, labels...), "path", "method")
+	requests := selectorOf("http_requests_total")
+	return map[string]interface{}{
+		"groups": []map[string]interface{}{
+			{
+				"name":     "openapi2grafana-trends",
+				"interval": "5m",
+				"rules": []map[string]string{
+					{"record": trendRequestsSeries, "expr": promSumBy(by, promOverTime("rate", requests, "1d"))},
+					{"record": trendErrorsSeries, "expr": promSumBy(by, promOverTime("rate", requests.regex("status_code", "5.."), "1d"))},
+					{"record": trendLatencySeries, "expr": promSumBy(append(by, "le"), promOverTime("rate", selectorOf("http_request_duration_seconds").bucket(), "1d"))},
+				},
+			},
+		},
+	}
+}
+
+// writeRecordingRules writes the trends recording rules as a Prometheus rules
+// file, recording native histograms when native is set
+func writeRecordingRules(path string, labels []string, native bool) error {
+	rules := trendRecordingRules(labels)
+	if native {
+		for _, group := range rules["groups"].([]map[string]interface{}) {
+			for _, rule := range group["rules"].([]map[string]string) {
+				rule["record"] = nativeHistogramExpr(rule["record"])
+				rule["expr"] = nativeHistogramExpr(rule["expr"])
+			}
+		}
+	}
+	data, err := yaml.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("error marshaling recording rules: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing recording rules file: %w", err)
+	}
+	return nil
+}
+
+// buildTrendsDashboard turns a dashboard skeleton into the long-term trends
+// variant: one row per tag with traffic, p99 latency and error rate trends
+// over 90 days at 1d resolution, for capacity planning rather than incident
+// response
+func buildTrendsDashboard(dashboard *GrafanaDashboard, operations []OperationInfo, scope []string) {
+	dashboard.Title = strings.TrimSuffix(dashboard.Title, " Monitoring") + " Trends"
+	if dashboard.UID != "" {
+		dashboard.UID += "-trends"
+	}
+	dashboard.Tags = append(dashboard.Tags, "trends")
+	dashboard.Time = Time{From: "now-90d", To: "now"}
+	dashboard.Refresh = ""
+
+	var tags []string
+	byTag := make(map[string][]OperationInfo)
+	for _, op := range operations {
+		if streamProtocol(op.Operation) != "" {
+			continue
+		}
+		tag := op.Tag
+		if tag == "" {
+			tag = "untagged"
+		}
+		if _, ok := byTag[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		byTag[tag] = append(byTag[tag], op)
+	}
+
+	cursor := &panelCursor{ID: 1, Y: 0, Height: 8}
+	for _, tag := range tags {
+		dashboard.Panels = append(dashboard.Panels, createRowPanel("Tag: "+tag, cursor.ID, cursor.Y))
+		cursor.ID++
+		cursor.Y++
+
+		requests := trendSelector(trendRequestsSeries, byTag[tag], scope)
+		errors := trendSelector(trendErrorsSeries, byTag[tag], scope)
+		latency := trendSelector(trendLatencySeries, byTag[tag], scope)
+
+		dashboard.Panels = append(dashboard.Panels,
+			createTrendPanel(cursor.ID, tag+" - Traffic Growth", "Average requests per second per day", "reqps",
+				promSum(requests), "Requests", cursor.Height, cursor.Y),
+			createTrendPanel(cursor.ID+1, tag+" - Latency Trend", "Daily p99 response time", "s",
+				fmt.Sprintf("histogram_quantile(0.99, %s)", promSumBy([]string{"le"}, latency)), "p99", cursor.Height, cursor.Y+cursor.Height),
+			createTrendPanel(cursor.ID+2, tag+" - Error Trend", "Daily 5xx error rate percentage", "percent",
+				promPercent(promSum(errors), promSum(requests)), "Error Rate", cursor.Height, cursor.Y+2*cursor.Height),
+		)
+		cursor.ID += 3
+		cursor.Y += 3 * cursor.Height
+	}
+}
+
+// trendSelector selects a recorded series for every operation of a tag
+func trendSelector(series string, ops []OperationInfo, scope []string) string {
+	selectors := make([]string, len(ops))
+	for i, op := range ops {
+		selectors[i] = operationMatch{Path: op.Path, Method: strings.ToUpper(op.Method), Scope: scope}.selector(series).String()
+	}
+	return strings.Join(selectors, " or ")
+}
+
+func createTrendPanel(panelID int, title, description, unit, expr, legend string, height, yPos int) Panel {
+	return Panel{
+		ID:         panelID,
+		Title:      title,
+		Type:       "timeseries",
+		Datasource: map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		GridPos:    GridPos{H: height, W: 24, X: 0, Y: yPos},
+		Targets: []Target{
+			{
+				Expr:         expr,
+				LegendFormat: legend,
+				RefID:        "A",
+				Interval:     "1d",
+			},
+		},
+		Options: Options{
+			Legend: LegendOptions{
+				DisplayMode: "list",
+				Placement:   "bottom",
+			},
+			Tooltip: TooltipOptions{
+				Mode: "multi",
+			},
+		},
+		FieldConfig: FieldConfig{
+			Defaults: FieldConfigDefaults{
+				Color: ColorOptions{Mode: "palette-classic"},
+				Unit:  unit,
+				Thresholds: ThresholdOptions{
+					Mode: "absolute",
+					Steps: []ThresholdStep{
+						{Color: "green", Value: nil},
+					},
+				},
+			},
+		},
+		Description: description,
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// metricNamePattern finds the first metric selector of a PromQL expression
+var metricNamePattern = regexp.MustCompile(`([a-zA-Z_:][a-zA-Z0-9_:]*)\{`)
+
+// primaryMetric returns the first metric a panel queries, without histogram suffixes
+func primaryMetric(panel Panel) string {
+	for _, target := range panel.Targets {
+		if m := metricNamePattern.FindStringSubmatch(target.Expr); m != nil {
+			name := m[1]
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				name = strings.TrimSuffix(name, suffix)
+			}
+			return name
+		}
+	}
+	return ""
+}
+
+// isDurationMetric reports whether a metric measures time
+func isDurationMetric(metric string) bool {
+	return strings.Contains(metric, "duration") || strings.Contains(metric, "latency")
+}
+
+// metricUnit infers the Grafana unit of a panel showing metric from the
+// Prometheus naming conventions: byte sizes, durations in seconds or
+// milliseconds, and rates of counters as requests or operations per second
+func metricUnit(metric string) string {
+	switch {
+	case strings.HasSuffix(metric, "_bytes"):
+		return "bytes"
+	case strings.HasSuffix(metric, "_milliseconds"), strings.HasSuffix(metric, "_ms"):
+		return "ms"
+	case strings.HasSuffix(metric, "_seconds"), isDurationMetric(metric):
+		return "s"
+	case strings.HasSuffix(metric, "_total"):
+		if strings.Contains(metric, "request") || strings.Contains(metric, "handled") {
+			return "reqps"
+		}
+		return "ops"
+	}
+	return "short"
+}
+
+// applyUnits fills in inferred units for panels without one (such as raw
+// custom row panels) and applies the units configuration: the units map sets
+// the unit of every panel querying a matching metric (exact name or glob),
+// and duration_unit switches duration panels between s and ms. Ratio panels
+// (percent) are left alone as their unit does not depend on the metric.
+func applyUnits(dashboard *GrafanaDashboard, file *FileConfig) {
+	patterns := make([]string, 0, len(file.Units))
+	for pattern := range file.Units {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for i := range dashboard.Panels {
+		panel := &dashboard.Panels[i]
+		if panel.FieldConfig.Defaults.Unit == "percent" {
+			continue
+		}
+		metric := primaryMetric(*panel)
+		if metric == "" {
+			continue
+		}
+
+		if panel.FieldConfig.Defaults.Unit == "" {
+			panel.FieldConfig.Defaults.Unit = metricUnit(metric)
+		}
+		if file.DurationUnit != "" && isDurationMetric(metric) {
+			panel.FieldConfig.Defaults.Unit = file.DurationUnit
+		}
+		if unit, ok := file.Units[metric]; ok {
+			panel.FieldConfig.Defaults.Unit = unit
+			continue
+		}
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, metric); matched {
+				panel.FieldConfig.Defaults.Unit = file.Units[pattern]
+				break
+			}
+		}
+	}
+}
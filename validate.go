@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Validation issue severities; errors make Grafana reject or mis-render the
+// dashboard, warnings are likely mistakes
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// gridColumns is the width of the Grafana dashboard grid
+const gridColumns = 24
+
+// knownPanelTypes are the panel plugins bundled with Grafana
+var knownPanelTypes = map[string]bool{
+	"alertlist": true, "annolist": true, "barchart": true, "bargauge": true,
+	"canvas": true, "dashlist": true, "flamegraph": true, "gauge": true,
+	"geomap": true, "heatmap": true, "histogram": true, "logs": true,
+	"news": true, "nodeGraph": true, "piechart": true, "row": true,
+	"stat": true, "state-timeline": true, "status-history": true, "table": true,
+	"text": true, "timeseries": true, "traces": true, "trend": true,
+	"xychart": true, "graph": true, "singlestat": true,
+}
+
+// variableReferencePattern finds $var and ${var} references in queries
+var variableReferencePattern = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+
+// ValidationIssue is a problem found in a dashboard
+type ValidationIssue struct {
+	Severity string `json:"severity"`
+	// Path locates the offending element, e.g. panels[3].targets[0]
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (i ValidationIssue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Path, i.Message)
+}
+
+// dashboardValidator collects the issues of one dashboard
+type dashboardValidator struct {
+	dashboard *GrafanaDashboard
+	variables map[string]bool
+	panelIDs  map[int]string
+	issues    []ValidationIssue
+}
+
+func (v *dashboardValidator) report(severity, path, format string, args ...interface{}) {
+	v.issues = append(v.issues, ValidationIssue{Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateDashboard checks a dashboard against the rules Grafana enforces on
+// import and the linter rules for common mistakes: missing or unknown
+// datasources, undefined variables, malformed queries, duplicate panel IDs
+// and refIds, panels outside the grid and unordered thresholds
+func validateDashboard(dashboard *GrafanaDashboard) []ValidationIssue {
+	v := &dashboardValidator{
+		dashboard: dashboard,
+		variables: make(map[string]bool),
+		panelIDs:  make(map[int]string),
+	}
+
+	if dashboard.Title == "" {
+		v.report(severityError, "title", "dashboard title is empty")
+	}
+	if len(dashboard.UID) > maxUIDLength {
+		v.report(severityError, "uid", "UID %q is longer than %d characters", dashboard.UID, maxUIDLength)
+	}
+	if dashboard.UID == "" {
+		v.report(severityWarning, "uid", "no UID, Grafana assigns a random one on every import")
+	}
+	supported := false
+	for _, version := range supportedSchemaVersions {
+		supported = supported || dashboard.SchemaVersion == version
+	}
+	if !supported {
+		v.report(severityWarning, "schemaVersion", "schemaVersion %d is not one of %v", dashboard.SchemaVersion, supportedSchemaVersions)
+	}
+
+	for i, variable := range dashboard.Templating.List {
+		path := fmt.Sprintf("templating.list[%d]", i)
+		if variable.Name == "" {
+			v.report(severityError, path, "variable has no name")
+			continue
+		}
+		if v.variables[variable.Name] {
+			v.report(severityError, path, "duplicate variable %q", variable.Name)
+		}
+		v.variables[variable.Name] = true
+		if variable.Type == "query" && isEmptyDatasource(variable.Datasource) {
+			v.report(severityError, path, "query variable %q has no datasource", variable.Name)
+		}
+	}
+
+	for i, annotation := range dashboard.Annotations.List {
+		path := fmt.Sprintf("annotations.list[%d]", i)
+		v.checkVariables(path, annotation.Expr)
+		for _, tag := range annotation.Tags {
+			v.checkVariables(path+".tags", tag)
+		}
+	}
+
+	for i := range dashboard.Panels {
+		v.validatePanel(&dashboard.Panels[i], fmt.Sprintf("panels[%d]", i))
+	}
+	v.validateLayout(dashboard.Panels)
+	return v.issues
+}
+
+func (v *dashboardValidator) validatePanel(panel *Panel, path string) {
+	if panel.ID <= 0 {
+		v.report(severityError, path, "panel %q has no id", panel.Title)
+	} else if other, ok := v.panelIDs[panel.ID]; ok {
+		v.report(severityError, path, "panel id %d is also used by %s", panel.ID, other)
+	} else {
+		v.panelIDs[panel.ID] = path
+	}
+	if panel.GridPos.W <= 0 || panel.GridPos.H <= 0 {
+		v.report(severityError, path+".gridPos", "panel %q has an empty size", panel.Title)
+	}
+	if panel.GridPos.X < 0 || panel.GridPos.Y < 0 || panel.GridPos.X+panel.GridPos.W > gridColumns {
+		v.report(severityError, path+".gridPos", "panel %q lies outside the %d column grid", panel.Title, gridColumns)
+	}
+
+	// Library panel references are completed by Grafana from the element
+	if panel.LibraryPanel != nil {
+		if panel.LibraryPanel.UID == "" {
+			v.report(severityError, path+".libraryPanel", "library panel reference has no uid")
+		}
+		return
+	}
+
+	if panel.Type == "row" {
+		for i := range panel.Panels {
+			v.validatePanel(&panel.Panels[i], fmt.Sprintf("%s.panels[%d]", path, i))
+		}
+		return
+	}
+	if panel.Type == "" {
+		v.report(severityError, path, "panel %q has no type", panel.Title)
+	} else if !knownPanelTypes[panel.Type] {
+		v.report(severityWarning, path, "panel type %q is not bundled with Grafana and needs a plugin", panel.Type)
+	}
+	if panel.Title == "" {
+		v.report(severityWarning, path, "panel has no title")
+	}
+	if panel.Alert != nil && v.dashboard.SchemaVersion >= 36 {
+		v.report(severityWarning, path+".alert", "legacy panel alerts are ignored by Grafana 10 and later")
+	}
+
+	if len(panel.Targets) > 0 {
+		if isEmptyDatasource(panel.Datasource) {
+			v.report(severityError, path+".datasource", "panel %q has queries but no datasource", panel.Title)
+		} else if uid := datasourceUID(panel.Datasource); uid != "" {
+			v.checkVariables(path+".datasource", uid)
+		}
+	}
+	refIDs := make(map[string]bool, len(panel.Targets))
+	// Paths of targets and steps are only built for a report, the checks
+	// run on every query of every panel
+	for i, target := range panel.Targets {
+		targetPath := func() string { return fmt.Sprintf("%s.targets[%d]", path, i) }
+		if target.RefID == "" {
+			v.report(severityError, targetPath(), "query has no refId")
+		} else if refIDs[target.RefID] {
+			v.report(severityError, targetPath(), "duplicate refId %q", target.RefID)
+		}
+		refIDs[target.RefID] = true
+		if strings.TrimSpace(target.Expr) == "" && !target.Hide {
+			v.report(severityError, targetPath(), "query %s has no expression", target.RefID)
+		}
+		for _, name := range v.undefinedVariables(target.Expr) {
+			v.report(severityError, targetPath(), "references undefined variable $%s", name)
+		}
+		if err := checkPromQL(target.Expr); err != nil {
+			v.report(severityError, targetPath(), "query %s is not valid PromQL: %v", target.RefID, err)
+		}
+	}
+
+	steps := panel.FieldConfig.Defaults.Thresholds.Steps
+	for i, step := range steps {
+		stepPath := func() string { return fmt.Sprintf("%s.fieldConfig.defaults.thresholds.steps[%d]", path, i) }
+		switch {
+		case i == 0 && step.Value != nil:
+			v.report(severityWarning, stepPath(), "the first threshold step should be the base step without a value")
+		case i > 0 && step.Value == nil:
+			v.report(severityError, stepPath(), "only the first threshold step may omit its value")
+		case i > 1 && steps[i-1].Value != nil && *step.Value < *steps[i-1].Value:
+			v.report(severityError, stepPath(), "threshold %g is below the previous step %g", *step.Value, *steps[i-1].Value)
+		}
+	}
+}
+
+// checkVariables reports references to dashboard variables that do not exist
+func (v *dashboardValidator) checkVariables(path, text string) {
+	for _, name := range v.undefinedVariables(text) {
+		v.report(severityError, path, "references undefined variable $%s", name)
+	}
+}
+
+// undefinedVariables returns the variables text references that the
+// dashboard does not define, each once
+func (v *dashboardValidator) undefinedVariables(text string) []string {
+	var undefined []string
+	for name := range variableReferences(text) {
+		if !strings.HasPrefix(name, "__") && !v.variables[name] && !slices.Contains(undefined, name) {
+			undefined = append(undefined, name)
+		}
+	}
+	return undefined
+}
+
+// variableReferences yields the names of the $var and ${var} references in
+// text, as variableReferencePattern finds them but without allocating: every
+// query of every panel is scanned
+func variableReferences(text string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for i := 0; i < len(text); i++ {
+			if text[i] != '$' {
+				continue
+			}
+			start := i + 1
+			if start < len(text) && text[start] == '{' {
+				start++
+			}
+			end := start
+			for end < len(text) && isVariableNameByte(text[end], end == start) {
+				end++
+			}
+			if end > start && !yield(text[start:end]) {
+				return
+			}
+			i = max(i, end-1)
+		}
+	}
+}
+
+// isVariableNameByte reports whether c can appear in a variable name, at its
+// start when first
+func isVariableNameByte(c byte, first bool) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || !first && '0' <= c && c <= '9'
+}
+
+// validateLayout reports top-level panels that overlap on the grid
+func (v *dashboardValidator) validateLayout(panels []Panel) {
+	// Sweep the panels top to bottom, only comparing those whose rows meet
+	byY := make([]int, len(panels))
+	for i := range byY {
+		byY[i] = i
+	}
+	sort.SliceStable(byY, func(i, j int) bool { return panels[byY[i]].GridPos.Y < panels[byY[j]].GridPos.Y })
+
+	var overlaps [][2]int
+	for p, i := range byY {
+		a := panels[i].GridPos
+		for _, j := range byY[p+1:] {
+			b := panels[j].GridPos
+			if b.Y >= a.Y+a.H {
+				break
+			}
+			if a.X < b.X+b.W && b.X < a.X+a.W && a.Y < b.Y+b.H {
+				overlaps = append(overlaps, [2]int{min(i, j), max(i, j)})
+			}
+		}
+	}
+	sort.Slice(overlaps, func(i, j int) bool {
+		if overlaps[i][0] != overlaps[j][0] {
+			return overlaps[i][0] < overlaps[j][0]
+		}
+		return overlaps[i][1] < overlaps[j][1]
+	})
+	for _, pair := range overlaps {
+		i, j := pair[0], pair[1]
+		v.report(severityWarning, fmt.Sprintf("panels[%d].gridPos", j), "panel %q overlaps %q", panels[j].Title, panels[i].Title)
+	}
+}
+
+// datasourceUID returns the uid of a datasource reference object
+func datasourceUID(datasource interface{}) string {
+	switch ref := datasource.(type) {
+	case map[string]string:
+		return ref["uid"]
+	case map[string]interface{}:
+		uid, _ := ref["uid"].(string)
+		return uid
+	}
+	return ""
+}
+
+// isEmptyDatasource reports whether a datasource is neither a name nor a
+// reference with a uid
+func isEmptyDatasource(datasource interface{}) bool {
+	if name, ok := datasource.(string); ok {
+		return name == ""
+	}
+	return datasourceUID(datasource) == ""
+}
+
+// checkDashboard validates a generated dashboard before it is written or
+// pushed, logging warnings and returning the errors as a ValidationError.
+// A dashboard with transforms is validated as transformed, as it is written.
+func checkDashboard(dashboard *GrafanaDashboard) error {
+	checked := dashboard
+	if len(dashboard.transforms) > 0 {
+		transformed, err := transformedDashboard(*dashboard)
+		if err != nil {
+			return err
+		}
+		checked = &transformed
+	}
+
+	var errs []ValidationIssue
+	for _, issue := range validateDashboard(checked) {
+		if issue.Severity == severityError {
+			errs = append(errs, issue)
+			continue
+		}
+		slog.Warn(issue.Message, "dashboard", dashboard.UID, "path", issue.Path)
+	}
+	if len(errs) > 0 {
+		return &ValidationError{UID: dashboard.UID, Issues: errs}
+	}
+	return nil
+}
+
+// validationReport is the `validate --json` result for one file
+type validationReport struct {
+	File   string            `json:"file"`
+	Valid  bool              `json:"valid"`
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// runValidate implements the `validate` subcommand
+func runValidate(args []string) error {
+	var files []string
+	asJSON := false
+	for _, arg := range args {
+		switch {
+		case arg == "--json":
+			asJSON = true
+		case strings.HasPrefix(arg, "--"):
+			return fmt.Errorf("unknown flag %q", arg)
+		default:
+			files = append(files, arg)
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no dashboard file given")
+	}
+
+	invalid := 0
+	reports := make([]validationReport, 0, len(files))
+	for _, file := range files {
+		report := validationReport{File: file, Valid: true, Issues: []ValidationIssue{}}
+		var dashboard GrafanaDashboard
+		data, err := os.ReadFile(file)
+		if err == nil {
+			err = decodeDashboard(data, &dashboard)
+		}
+		if err != nil {
+			report.Issues = append(report.Issues, ValidationIssue{Severity: severityError, Message: fmt.Sprintf("cannot read dashboard: %v", err)})
+		} else {
+			report.Issues = append(report.Issues, validateDashboard(&dashboard)...)
+		}
+		for _, issue := range report.Issues {
+			if issue.Severity == severityError {
+				report.Valid = false
+			}
+		}
+		if !report.Valid {
+			invalid++
+		}
+		reports = append(reports, report)
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling validation report: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, report := range reports {
+			status := "ok"
+			if !report.Valid {
+				status = "invalid"
+			}
+			fmt.Printf("%s: %s\n", report.File, status)
+			for _, issue := range report.Issues {
+				fmt.Printf("  - %s\n", issue)
+			}
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d dashboards failed validation", invalid, len(files))
+	}
+	return nil
+}
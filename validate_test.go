@@ -0,0 +1,27 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestVariableReferences checks the scanner finds the references
+// variableReferencePattern matches
+func TestVariableReferences(t *testing.T) {
+	tests := []string{
+		`sum(rate(x{service=~"$service"}[$__rate_interval]))`,
+		`${datasource}`,
+		`$$a $1b ${2c} ${_d} $e9f $`,
+		`label_values(up, job) ${`,
+		`no variables`,
+	}
+	for _, text := range tests {
+		var want []string
+		for _, match := range variableReferencePattern.FindAllStringSubmatch(text, -1) {
+			want = append(want, match[1])
+		}
+		if got := slices.Collect(variableReferences(text)); !slices.Equal(got, want) {
+			t.Errorf("references in %q = %v, want %v", text, got, want)
+		}
+	}
+}
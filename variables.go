@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// endpointVariable is the custom variable listing the documented endpoints
+const endpointVariable = "endpoint"
+
+// VariableConfig defines a query variable in the config file. Variables
+// filter every generated selector on their Prometheus label unless filter is
+// false.
+type VariableConfig struct {
+	Name string `yaml:"name"`
+	// Label is the name shown in Grafana, defaulting to Name
+	Label       string `yaml:"label"`
+	Query       string `yaml:"query"`
+	Description string `yaml:"description"`
+	// MatchLabel is the Prometheus label filtered by the variable, defaulting to Name
+	MatchLabel string `yaml:"match_label"`
+	Filter     *bool  `yaml:"filter"`
+}
+
+// defaultVariables is the single service variable used without a variables config
+var defaultVariables = []VariableConfig{
+	{
+		Name:        "service",
+		Label:       "Service",
+		Query:       "label_values(http_requests_total, service)",
+		Description: "Service name filter",
+	},
+}
+
+// matchLabel returns the Prometheus label the variable filters
+func (v VariableConfig) matchLabel() string {
+	if v.MatchLabel != "" {
+		return v.MatchLabel
+	}
+	return v.Name
+}
+
+// filters reports whether generated selectors are filtered by the variable
+func (v VariableConfig) filters() bool {
+	return v.Filter == nil || *v.Filter
+}
+
+// validateVariables checks the variables of the config file
+func validateVariables(variables []VariableConfig) error {
+	seen := make(map[string]bool)
+	for i, variable := range variables {
+		if variable.Name == "" || variable.Query == "" {
+			return fmt.Errorf("variables[%d]: name and query are required", i)
+		}
+		if variable.Name == "datasource" || variable.Name == "environment" || variable.Name == endpointVariable || seen[variable.Name] {
+			return fmt.Errorf("variables[%d]: duplicate variable %q", i, variable.Name)
+		}
+		seen[variable.Name] = true
+	}
+	return nil
+}
+
+// labelMatcherPattern parses one matcher of an extra selector
+var labelMatcherPattern = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*"((?:[^"\\]|\\.)*)"\s*$`)
+
+// variableValuePattern matches a matcher value that is a single variable
+var variableValuePattern = regexp.MustCompile(`^\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?$`)
+
+// labelMatcher is a PromQL label matcher such as namespace=~"$namespace"
+type labelMatcher struct {
+	Label string
+	Op    string
+	Value string
+}
+
+func (m labelMatcher) String() string {
+	return fmt.Sprintf(`%s%s"%s"`, m.Label, m.Op, m.Value)
+}
+
+// parseExtraSelector parses comma-separated label matchers, with or without
+// the surrounding braces
+func parseExtraSelector(selector string) ([]labelMatcher, error) {
+	selector = strings.TrimSpace(selector)
+	selector = strings.TrimSuffix(strings.TrimPrefix(selector, "{"), "}")
+
+	var matchers []labelMatcher
+	var current strings.Builder
+	inQuotes, escaped := false, false
+	flush := func() error {
+		part := current.String()
+		current.Reset()
+		if strings.TrimSpace(part) == "" {
+			return nil
+		}
+		m := labelMatcherPattern.FindStringSubmatch(part)
+		if m == nil {
+			return fmt.Errorf("invalid label matcher %q", strings.TrimSpace(part))
+		}
+		matchers = append(matchers, labelMatcher{Label: m[1], Op: m[2], Value: m[3]})
+		return nil
+	}
+	for _, r := range selector {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && inQuotes:
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ',' && !inQuotes:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote in selector %q", selector)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return matchers, nil
+}
+
+// extraMatchers returns the matchers of --extra-selector and the config
+// file's extra_selector; both were validated when the config was loaded
+func (c *Config) extraMatchers() []labelMatcher {
+	var matchers []labelMatcher
+	for _, selector := range []string{c.ExtraSelector, c.fileConfig().ExtraSelector} {
+		parsed, _ := parseExtraSelector(selector)
+		matchers = append(matchers, parsed...)
+	}
+	return matchers
+}
+
+// queryVariables returns the configured query variables, or the default
+// service variable, followed by the region and cluster variables of
+// --multi-region and by a variable for every extra selector matcher
+// whose value is a variable not defined otherwise
+func (c *Config) queryVariables() []VariableConfig {
+	variables := c.fileConfig().Variables
+	if len(variables) == 0 {
+		variables = defaultVariables
+	}
+	variables = append([]VariableConfig{}, variables...)
+
+	defined := map[string]bool{endpointVariable: true}
+	for _, variable := range variables {
+		defined[variable.Name] = true
+	}
+	if c.MultiRegion {
+		for _, variable := range regionVariables(c.fileConfig().MultiRegion.withDefaults()) {
+			if !defined[variable.Name] {
+				defined[variable.Name] = true
+				variables = append(variables, variable)
+			}
+		}
+	}
+	noFilter := false
+	for _, matcher := range c.extraMatchers() {
+		m := variableValuePattern.FindStringSubmatch(matcher.Value)
+		if m == nil || defined[m[1]] || strings.HasPrefix(matcher.Op, "!") {
+			continue
+		}
+		defined[m[1]] = true
+		variables = append(variables, VariableConfig{
+			Name:       m[1],
+			Query:      fmt.Sprintf("label_values(http_requests_total, %s)", matcher.Label),
+			MatchLabel: matcher.Label,
+			// The matcher itself is injected into the queries
+			Filter: &noFilter,
+		})
+	}
+	return variables
+}
+
+// filterLabels returns the Prometheus labels generated selectors filter on
+func (c *Config) filterLabels() []string {
+	var labels []string
+	for _, variable := range c.queryVariables() {
+		if variable.filters() {
+			labels = append(labels, variable.matchLabel())
+		}
+	}
+	for _, matcher := range c.extraMatchers() {
+		labels = append(labels, matcher.Label)
+	}
+	return labels
+}
+
+// queryScope returns the label matchers every generated selector filters
+// on: those of the filtering variables, service=~"$service" by default, and
+// of the extra selector
+func (c *Config) queryScope() []string {
+	var matchers []string
+	for _, variable := range c.queryVariables() {
+		if variable.filters() {
+			matchers = append(matchers, fmt.Sprintf(`%s=~"$%s"`, variable.matchLabel(), variable.Name))
+		}
+	}
+	for _, matcher := range c.extraMatchers() {
+		matchers = append(matchers, matcher.String())
+	}
+	return matchers
+}
+
+// createQueryVariable builds a multi-value label_values variable
+func createQueryVariable(variable VariableConfig, datasource string) Variable {
+	label := variable.Label
+	if label == "" {
+		label = variable.Name
+	}
+	return Variable{
+		Name:        variable.Name,
+		Label:       label,
+		Type:        "query",
+		Query:       variable.Query,
+		Current:     Current{Text: "All", Value: "$__all"},
+		Datasource:  datasource,
+		IncludeAll:  true,
+		AllValue:    ".*",
+		Multi:       true,
+		Refresh:     1,
+		Sort:        1,
+		Definition:  variable.Query,
+		Description: variable.Description,
+	}
+}
+
+// createEndpointVariable lists the documented paths of the operations with
+// their methods, e.g. "GET|POST /items", as a multi-value custom variable.
+// Its values are regex matchers of the paths, escaped for a PromQL string:
+// queries use them with the pipe format, path=~"${endpoint:pipe}", which
+// joins selected values as an alternation without Grafana escaping them
+// again. Their texts show the paths as titles do, decoded. Streaming
+// operations are left out.
+func createEndpointVariable(operations []OperationInfo, titles TitleSettings) Variable {
+	options := []Option{{Text: "All", Value: "$__all", Selected: true}}
+	var query []string
+	for _, op := range collapseMethods(operations) {
+		if streamProtocol(op.Operation) != "" {
+			continue
+		}
+		text := strings.ToUpper(op.Method) + " " + titles.displayPath(op.Path)
+		value := promRegexValue(op.Path)
+		options = append(options, Option{Text: text, Value: value})
+		query = append(query, customVariableValue(text)+" : "+customVariableValue(value))
+	}
+	return Variable{
+		Name:        endpointVariable,
+		Label:       "Endpoint",
+		Type:        "custom",
+		Query:       strings.Join(query, ","),
+		Current:     Current{Text: "All", Value: "$__all"},
+		Options:     options,
+		IncludeAll:  true,
+		Multi:       true,
+		Description: `Documented endpoints, matched with path=~"${endpoint:pipe}"`,
+	}
+}
+
+// customVariableValue escapes the separators of a custom variable query
+func customVariableValue(value string) string {
+	return strings.ReplaceAll(value, ",", `\,`)
+}
+
+// applyToPanels calls fn for every panel, including those of collapsed rows
+func applyToPanels(panels []Panel, fn func(*Panel)) {
+	for i := range panels {
+		fn(&panels[i])
+		applyToPanels(panels[i].Panels, fn)
+	}
+}
+
+// liveScope returns the matchers of the query scope for queries sent to
+// Prometheus directly rather than through a dashboard, such as the coverage
+// report or the error budgets: those of the extra selector naming no
+// variable. Outside Grafana variables have no value, which stands for All.
+func (c *Config) liveScope() []string {
+	var matchers []string
+	for _, matcher := range c.extraMatchers() {
+		if !variableReferencePattern.MatchString(matcher.Value) {
+			matchers = append(matchers, matcher.String())
+		}
+	}
+	return matchers
+}
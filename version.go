@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, overridden at release time via
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..."
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// supportedSchemaVersions lists the Grafana dashboard schemaVersions the generator can emit
+var supportedSchemaVersions = []int{30, 39}
+
+// supportedConventions lists the metric naming conventions the generated
+// queries expect, by default: metrics the config file can rename are listed
+// under their default names
+var supportedConventions = []string{
+	"http_requests_total{method,path,status_code,service}",
+	"http_request_duration_seconds_bucket{method,path,service,le}",
+	"grpc_server_handled_total{grpc_service,grpc_method,grpc_code}",
+	"grpc_server_handling_seconds_bucket{grpc_service,grpc_method,le}",
+	"grpc_server_started_total{grpc_service,grpc_method,grpc_type}",
+	"grpc_server_msg_received_total{grpc_service,grpc_method,grpc_type}",
+	"grpc_server_msg_sent_total{grpc_service,grpc_method,grpc_type}",
+	"stream_connections_active{path,protocol,service}",
+	"stream_messages_total{path,protocol,direction,service}",
+	"stream_connection_duration_seconds_bucket{path,protocol,service,le}",
+	"auth_token_validation_duration_seconds_bucket{service,le}",
+	defaultDeliveriesMetric + "{" + defaultWebhookLabel + ",outcome}",
+	defaultDeliveryDuration + "_bucket{" + defaultWebhookLabel + ",le}",
+	defaultRemainingMetric + "{method,path}",
+	defaultCacheHitsMetric + "{method,path}",
+	defaultCacheMissesMetric + "{method,path}",
+	"http_client_requests_seconds_count{client_name,outcome}",
+	"http_client_requests_seconds_bucket{client_name,le}",
+	"grpc_client_handled_total{grpc_service,grpc_code}",
+	"grpc_client_handling_seconds_bucket{grpc_service,le}",
+	"messaging_publish_messages_total{destination}",
+	"messaging_consumer_lag_messages{destination}",
+	"messaging_process_duration_seconds_bucket{destination,le}",
+	"kafka_topic_partition_current_offset{topic}",
+	"kafka_consumergroup_lag{topic,consumergroup}",
+	"rabbitmq_queue_messages_published_total{queue}",
+	"rabbitmq_queue_messages_ready{queue}",
+	"probe_success{instance}",
+	"probe_duration_seconds{instance}",
+	"k6_vus{testid}",
+	"k6_http_reqs_total{testid,name,status}",
+	"k6_http_req_duration_p95{testid,name}",
+	"k6_http_req_duration_p99{testid,name}",
+	"k6_http_req_failed_rate{testid,name}",
+	trendRequestsSeries + "{method,path}",
+	trendErrorsSeries + "{method,path}",
+	trendLatencySeries + "{method,path,le}",
+}
+
+// BuildInfo describes the generator build that produced a dashboard
+type BuildInfo struct {
+	Version                 string   `json:"version"`
+	Commit                  string   `json:"commit,omitempty"`
+	BuildDate               string   `json:"build_date,omitempty"`
+	GoVersion               string   `json:"go_version"`
+	Platform                string   `json:"platform"`
+	SupportedSchemaVersions []int    `json:"supported_schema_versions"`
+	SupportedConventions    []string `json:"supported_conventions"`
+}
+
+// GetBuildInfo returns the build metadata of the running binary. When the
+// commit was not injected via ldflags it falls back to the VCS revision
+// recorded by the Go toolchain.
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:                 version,
+		Commit:                  commit,
+		BuildDate:               buildDate,
+		GoVersion:               runtime.Version(),
+		Platform:                runtime.GOOS + "/" + runtime.GOARCH,
+		SupportedSchemaVersions: supportedSchemaVersions,
+		SupportedConventions:    supportedConventions,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			}
+		}
+	}
+
+	return info
+}
+
+// runVersion implements the `version` subcommand
+func runVersion(args []string) error {
+	info := GetBuildInfo()
+
+	for _, arg := range args {
+		if arg == "--json" {
+			data, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error marshaling build info: %w", err)
+			}
+			fmt.Fprintln(os.Stdout, string(data))
+			return nil
+		}
+	}
+
+	fmt.Printf("openapi2grafana %s\n", info.Version)
+	if info.Commit != "" {
+		fmt.Printf("  commit:          %s\n", info.Commit)
+	}
+	if info.BuildDate != "" {
+		fmt.Printf("  built:           %s\n", info.BuildDate)
+	}
+	fmt.Printf("  go:              %s (%s)\n", info.GoVersion, info.Platform)
+	fmt.Printf("  schemaVersions:  %v\n", info.SupportedSchemaVersions)
+	fmt.Println("  conventions:")
+	for _, convention := range info.SupportedConventions {
+		fmt.Printf("    - %s\n", convention)
+	}
+	return nil
+}
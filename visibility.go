@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Visibilities of operations, from x-visibility or x-internal; operations
+// marked with neither are public
+const (
+	visibilityPublic   = "public"
+	visibilityInternal = "internal"
+)
+
+// severityLabel labels generated alerts with the severity of their
+// operation's visibility, for Alertmanager routing
+const severityLabel = "severity"
+
+// Section rows of dashboards with both public and internal operations
+const (
+	publicSectionTitle   = "Public API"
+	internalSectionTitle = "Internal"
+)
+
+// defaultInternalThresholds are the built-in thresholds of internal
+// operations, twice those of public ones: internal consumers retry and
+// tolerate more than customers do
+var defaultInternalThresholds = ThresholdConfig{
+	LatencyWarning:      1.0,
+	LatencyCritical:     2.0,
+	ErrorWarning:        2,
+	ErrorCritical:       10,
+	ClientErrorWarning:  20,
+	ClientErrorCritical: 50,
+}
+
+// VisibilityConfig sets the thresholds and alert severity of the public or
+// internal operations, in the visibility section of the config file
+type VisibilityConfig struct {
+	// Thresholds override the thresholds of the visibility, after the
+	// config file default and before tag and operation overrides
+	Thresholds ThresholdOverride `yaml:"thresholds"`
+	// Severity labels the alerts of the visibility; critical for public
+	// operations and warning for internal ones by default
+	Severity string `yaml:"severity"`
+}
+
+// VisibilitySettings configure public and internal operations
+type VisibilitySettings struct {
+	Public   VisibilityConfig `yaml:"public"`
+	Internal VisibilityConfig `yaml:"internal"`
+}
+
+func (s VisibilitySettings) validate() error {
+	for name, config := range map[string]VisibilityConfig{visibilityPublic: s.Public, visibilityInternal: s.Internal} {
+		if strings.ContainsAny(config.Severity, " \t\n\"") {
+			return fmt.Errorf("%s.severity: %q is not a valid label value", name, config.Severity)
+		}
+	}
+	return nil
+}
+
+// markedVisibility returns the visibility an operation is marked with,
+// x-visibility taking precedence over x-internal, "" if unmarked
+func markedVisibility(op OperationInfo) string {
+	if op.Operation == nil {
+		return ""
+	}
+	if value, ok := op.Operation.Extensions["x-visibility"].(string); ok {
+		switch visibility := strings.ToLower(value); visibility {
+		case visibilityPublic, visibilityInternal:
+			return visibility
+		}
+	}
+	if internal, ok := op.Operation.Extensions["x-internal"].(bool); ok {
+		if internal {
+			return visibilityInternal
+		}
+		return visibilityPublic
+	}
+	return ""
+}
+
+// operationVisibility returns whether an operation is public or internal
+func operationVisibility(op OperationInfo) string {
+	if markedVisibility(op) == visibilityInternal {
+		return visibilityInternal
+	}
+	return visibilityPublic
+}
+
+// visibilityMarked reports whether the specs mark any operation public or
+// internal, warning about x-visibility values that are neither
+func visibilityMarked(specs []LoadedSpec) bool {
+	marked := false
+	for _, spec := range specs {
+		if spec.Doc == nil {
+			continue
+		}
+		for _, op := range collectOperations(spec.Doc, "path") {
+			if value, ok := op.Operation.Extensions["x-visibility"]; ok && markedVisibility(op) == "" {
+				slog.Warn("ignoring x-visibility, it must be public or internal", "operation", op.Key(), "value", value)
+			}
+			marked = marked || markedVisibility(op) != ""
+		}
+	}
+	return marked
+}
+
+// visibilityConfig returns the configuration of a visibility
+func (c *Config) visibilityConfig(visibility string) VisibilityConfig {
+	if visibility == visibilityInternal {
+		return c.fileConfig().Visibility.Internal
+	}
+	return c.fileConfig().Visibility.Public
+}
+
+// visibilityThresholds returns the thresholds of an operation before tag and
+// operation overrides: the built-in defaults of its visibility, the config
+// file default, then the override of its visibility
+func (c *Config) visibilityThresholds(op OperationInfo) ThresholdConfig {
+	visibility := operationVisibility(op)
+	defaults := defaultThresholds
+	if visibility == visibilityInternal {
+		defaults = defaultInternalThresholds
+	}
+	thresholds := c.fileConfig().Thresholds.Default.apply(defaults)
+	return c.visibilityConfig(visibility).Thresholds.apply(thresholds)
+}
+
+// operationSeverity returns the severity label of an operation's alerts
+func (c *Config) operationSeverity(op OperationInfo) string {
+	visibility := operationVisibility(op)
+	if severity := c.visibilityConfig(visibility).Severity; severity != "" {
+		return severity
+	}
+	if visibility == visibilityInternal {
+		return "warning"
+	}
+	return "critical"
+}
+
+// applySeverity labels the alerts of an operation's panels with its severity
+func applySeverity(panels []Panel, severity string) {
+	for i := range panels {
+		if alert := panels[i].Alert; alert != nil {
+			if alert.AlertRuleTags == nil {
+				alert.AlertRuleTags = make(map[string]string)
+			}
+			alert.AlertRuleTags[severityLabel] = severity
+		}
+	}
+}
+
+// addVisibilitySections adds the panels of the operations with addPanels,
+// in a Public API and an Internal section when there are both
+func addVisibilitySections(ctx context.Context, dashboard *GrafanaDashboard, ops []OperationInfo, input *GenerationInput, config *Config, cursor *panelCursor, addPanels func(context.Context, *GrafanaDashboard, []OperationInfo, *GenerationInput, *Config, *panelCursor)) {
+	var public, internal []OperationInfo
+	for _, op := range ops {
+		if operationVisibility(op) == visibilityInternal {
+			internal = append(internal, op)
+		} else {
+			public = append(public, op)
+		}
+	}
+	if len(public) == 0 || len(internal) == 0 {
+		addPanels(ctx, dashboard, ops, input, config, cursor)
+		return
+	}
+
+	for _, section := range []struct {
+		title string
+		ops   []OperationInfo
+	}{{publicSectionTitle, public}, {internalSectionTitle, internal}} {
+		dashboard.Panels = append(dashboard.Panels, createRowPanel(section.title, cursor.ID, cursor.Y))
+		cursor.ID++
+		cursor.Y++
+		addPanels(ctx, dashboard, section.ops, input, config, cursor)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Kinds of outbound calls a spec declares
+const (
+	outboundCallback = "callback"
+	outboundWebhook  = "webhook"
+)
+
+// Default delivery metrics of outbound calls, webhook_deliveries_total
+// counting deliveries by outcome and a latency histogram, both labelled with
+// the callback or webhook name
+const (
+	defaultDeliveriesMetric = "webhook_deliveries_total"
+	defaultDeliveryDuration = "webhook_delivery_duration_seconds"
+	defaultWebhookLabel     = "webhook"
+	defaultFailureMatcher   = `outcome="failure"`
+)
+
+// WebhooksConfig names the metrics outbound call panels query, in the
+// webhooks section of the config file
+type WebhooksConfig struct {
+	DeliveriesMetric string `yaml:"deliveries_metric"`
+	DurationMetric   string `yaml:"duration_metric"`
+	// NameLabel is the label carrying the callback or webhook name
+	NameLabel string `yaml:"name_label"`
+	// FailureMatcher selects the failed deliveries, e.g. outcome="failure"
+	FailureMatcher string `yaml:"failure_matcher"`
+}
+
+// withDefaults fills in the metrics that are not configured
+func (c WebhooksConfig) withDefaults() WebhooksConfig {
+	for _, field := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&c.DeliveriesMetric, defaultDeliveriesMetric},
+		{&c.DurationMetric, defaultDeliveryDuration},
+		{&c.NameLabel, defaultWebhookLabel},
+		{&c.FailureMatcher, defaultFailureMatcher},
+	} {
+		if *field.value == "" {
+			*field.value = field.fallback
+		}
+	}
+	return c
+}
+
+// outcomeLabel returns the label of the failure matcher, which the delivery
+// rate is broken down by
+func (c WebhooksConfig) outcomeLabel() string {
+	matchers, err := parseExtraSelector(c.FailureMatcher)
+	if err != nil || len(matchers) == 0 {
+		return "outcome"
+	}
+	return matchers[0].Label
+}
+
+func (c WebhooksConfig) validate() error {
+	if c.FailureMatcher == "" {
+		return nil
+	}
+	if _, err := parseExtraSelector(c.FailureMatcher); err != nil {
+		return fmt.Errorf("failure_matcher: %w", err)
+	}
+	return nil
+}
+
+// OutboundCall is a callback of an operation or a webhook (OpenAPI 3.1) the
+// service calls out to
+type OutboundCall struct {
+	Kind string
+	Name string
+	// Requests lists "METHOD target" of every request of the call, the
+	// target being the callback URL expression or the webhook name
+	Requests []string
+	// Operations lists the operations declaring a callback
+	Operations []string
+}
+
+// collectOutboundCalls returns the callbacks of the operations and the
+// webhooks of the specs, callbacks of the same name merged, sorted by kind
+// and name
+func collectOutboundCalls(specs []LoadedSpec, ops []OperationInfo) []OutboundCall {
+	calls := make(map[string]*OutboundCall)
+	call := func(kind, name string) *OutboundCall {
+		key := kind + " " + name
+		if calls[key] == nil {
+			calls[key] = &OutboundCall{Kind: kind, Name: name}
+		}
+		return calls[key]
+	}
+
+	for _, op := range ops {
+		for name, ref := range op.Operation.Callbacks {
+			if ref == nil || ref.Value == nil {
+				continue
+			}
+			callback := call(outboundCallback, name)
+			callback.Operations = appendUnique(callback.Operations, strings.ToUpper(op.Method)+" "+op.Path)
+			for expression, item := range ref.Value.Map() {
+				for _, method := range sortedMapKeys(item.Operations()) {
+					callback.Requests = appendUnique(callback.Requests, method+" "+expression)
+				}
+			}
+		}
+	}
+
+	for _, spec := range specs {
+		for name, item := range specWebhooks(spec) {
+			webhook := call(outboundWebhook, name)
+			for _, method := range sortedMapKeys(item.Operations()) {
+				webhook.Requests = appendUnique(webhook.Requests, method+" "+name)
+			}
+		}
+	}
+
+	result := make([]OutboundCall, 0, len(calls))
+	for _, key := range sortedMapKeys(calls) {
+		sort.Strings(calls[key].Requests)
+		result = append(result, *calls[key])
+	}
+	return result
+}
+
+// specWebhooks returns the webhooks of an OpenAPI 3.1 spec. The loader only
+// knows OpenAPI 3.0, which keeps them among the unknown fields.
+func specWebhooks(spec LoadedSpec) map[string]*openapi3.PathItem {
+	if spec.Doc == nil || spec.Doc.Extensions["webhooks"] == nil {
+		return nil
+	}
+	data, err := json.Marshal(spec.Doc.Extensions["webhooks"])
+	if err != nil {
+		return nil
+	}
+	var webhooks map[string]*openapi3.PathItem
+	if err := json.Unmarshal(data, &webhooks); err != nil {
+		slog.Warn("ignoring invalid webhooks", "spec", spec.File, "error", err)
+		return nil
+	}
+	return webhooks
+}
+
+func appendUnique(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// addOutboundPanels appends an "Outbound Calls" row with the delivery rate,
+// failure rate and delivery latency of every callback and webhook
+func addOutboundPanels(dashboard *GrafanaDashboard, calls []OutboundCall, config *Config, cursor *panelCursor) {
+	if len(calls) == 0 {
+		return
+	}
+	metrics := config.fileConfig().Webhooks.withDefaults()
+	dashboard.Panels = append(dashboard.Panels, createRowPanel("Outbound Calls", cursor.ID, cursor.Y))
+	cursor.ID++
+	cursor.Y++
+
+	for _, call := range calls {
+		panels := createOutboundPanels(call, metrics, config.queryScope(), cursor.ID, cursor.Height, cursor.Y)
+		dashboard.Panels = append(dashboard.Panels, panels...)
+		cursor.ID += len(panels)
+		cursor.Y += len(panels) * cursor.Height
+	}
+}
+
+// createOutboundPanels builds the delivery panels of one callback or webhook
+func createOutboundPanels(call OutboundCall, metrics WebhooksConfig, scope []string, panelID, height, yPos int) []Panel {
+	title := fmt.Sprintf("%s %s", strings.ToUpper(call.Kind[:1])+call.Kind[1:], call.Name)
+	description := "Outbound " + strings.Join(call.Requests, ", ")
+	if len(call.Operations) > 0 {
+		description += ", declared by " + strings.Join(call.Operations, ", ")
+	}
+	deliveries := selectorOf(metrics.DeliveriesMetric).eq(metrics.NameLabel, call.Name).with(scope...)
+	latency := selectorOf(metrics.DurationMetric).eq(metrics.NameLabel, call.Name).with(scope...)
+	outcome := metrics.outcomeLabel()
+
+	return []Panel{
+		createStreamingPanel(panelID, title+" - Delivery Rate", description+". Deliveries per second by outcome", "reqps", height, yPos, []Target{
+			{
+				Expr:         promSum(promRate(deliveries), outcome),
+				LegendFormat: "{{" + outcome + "}}",
+				RefID:        "A",
+			},
+		}),
+		createStreamingPanel(panelID+1, title+" - Failure Rate", description+". Percentage of failed deliveries", "percent", height, yPos+height, []Target{
+			{
+				Expr:         promPercent(promSum(promRate(deliveries.with(metrics.FailureMatcher))), promSum(promRate(deliveries))),
+				LegendFormat: "Failures",
+				RefID:        "A",
+			},
+		}),
+		createStreamingPanel(panelID+2, title+" - Delivery Latency", description+". Time to deliver a call, retries included", metricUnit(metrics.DurationMetric), height, yPos+2*height, []Target{
+			{
+				Expr:         promHistogramQuantile("0.99", latency),
+				LegendFormat: "p99",
+				RefID:        "A",
+			},
+			{
+				Expr:         promHistogramQuantile("0.50", latency),
+				LegendFormat: "p50",
+				RefID:        "B",
+			},
+		}),
+	}
+}